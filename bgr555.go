@@ -23,19 +23,28 @@ func (i *BGR555) At(x, y int) color.Color {
 	}
 
 	pix := i.Pix[i.PixOffset(x, y):]
-	clr := uint16(pix[0])<<8 | uint16(pix[1])
+	clr := uint16(pix[0]) | uint16(pix[1])<<8
 
-	return RGBColor{
-		uint8(clr) & mask5,
-		uint8(clr>>5) & mask5,
-		uint8(clr>>10) & mask5,
-	}
+	var c RGBColor
+	c.B = expand5(clr >> 10)
+	c.G = expand5(clr >> 5)
+	c.R = expand5(clr)
+	return c
 }
 
 func (i *BGR555) Set(x, y int, c color.Color) {
-	i.SetRGB(x, y, RGB555Model.Convert(c).(RGBColor))
+	i.SetRGB8(x, y, RGB555Model.Convert(c).(RGBColor))
+}
+
+// SetRGB8 sets the pixel at x, y to the given color. Channels are
+// truncated to the bit depth of the image.
+func (i *BGR555) SetRGB8(x, y int, c RGBColor) {
+	i.SetRGB(x, y, RGBColor{c.R >> 3, c.G >> 3, c.B >> 3})
 }
 
+// SetRGB sets the pixel at x, y to the given channel values, which
+// are in the range of the bit depth of the image: 0-31 for each channel.
+// Use SetRGB8 for colors with 8-bit channels.
 func (i *BGR555) SetRGB(x, y int, c RGBColor) {
 	if !(image.Point{x, y}.In(i.Rect)) {
 		return
@@ -43,7 +52,7 @@ func (i *BGR555) SetRGB(x, y int, c RGBColor) {
 
 	n := i.PixOffset(x, y)
 	pix := i.Pix[n:]
-	clr := (uint16(c.B) << 10) | uint16(c.G<<5) | uint16(c.R)
+	clr := uint16(c.B&mask5)<<10 | uint16(c.G&mask5)<<5 | uint16(c.R&mask5)
 
 	pix[0] = uint8(clr)
 	pix[1] = uint8(clr >> 8)
@@ -0,0 +1,103 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"unsafe"
+)
+
+// BackBuffer returns an image of the visible size, which is displayed
+// by the next call to Flip. Drawing into it does not disturb what is
+// on screen, which avoids flicker when redrawing complete frames.
+//
+// If the virtual resolution has room for a second page, the back
+// buffer is that page, and Flip pans the display to it. Otherwise it
+// lives in regular memory and Flip copies it to the framebuffer.
+//
+// The contents of the back buffer are undefined after a flip, so
+// each frame should be drawn in full. The returned image changes
+// with every flip; call BackBuffer again for each frame.
+func (c *Canvas) BackBuffer() (draw.Image, error) {
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return nil, err
+	}
+
+	g := mode.Geometry
+	stride := c.stride(mode)
+	r := image.Rect(0, 0, g.XRes, g.YRes)
+	size := backSize(mode, stride)
+
+	if c.canPan(mode) {
+		back := 1 - c.page
+		return newImage(mode.Format, c.packing(mode), c.mem[back*size:(back+1)*size], stride, r)
+	}
+
+	if size > len(c.mem) {
+		return nil, errors.New("framebuffer: memory too small for the planes of the format")
+	}
+
+	if len(c.back) != size {
+		c.back = make([]byte, size)
+		clearYUV(mode.Format, c.back)
+	}
+
+	return newImage(mode.Format, c.packing(mode), c.back, stride, r)
+}
+
+// Flip displays the back buffer. When panning, it waits for the
+// driver to accept the new offset, which many drivers synchronise
+// with the vertical blank.
+func (c *Canvas) Flip() error {
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return err
+	}
+
+	g := mode.Geometry
+	size := backSize(mode, c.stride(mode))
+
+	if !c.canPan(mode) {
+		if len(c.back) == size {
+			copy(c.mem[:size], c.back)
+		}
+		return nil
+	}
+
+	back := 1 - c.page
+	vi := c.origVi.Copy()
+	vi.xoffset = 0
+	vi.yoffset = uint32(back * g.YRes)
+
+	err = c.ioctl(_IOPAN_DISPLAY, unsafe.Pointer(vi))
+	if err != nil {
+		return err
+	}
+
+	c.page = back
+	return nil
+}
+
+// canPan returns true if the framebuffer memory holds two pages
+// of the visible size, so flipping can be done by panning.
+// Planar formats keep their chroma planes after all rows, so their
+// pages can not be told apart.
+func (c *Canvas) canPan(mode *DisplayMode) bool {
+	g := mode.Geometry
+	return g.YVRes >= 2*g.YRes && len(c.mem) >= 2*c.stride(mode)*g.YRes && !mode.Format.planar()
+}
+
+// backSize returns the size of a back buffer. That of planar formats
+// is laid out as the framebuffer memory, with room for all rows of its
+// luma plane, so its chroma planes are found in the same place.
+func backSize(mode *DisplayMode, stride int) int {
+	g := mode.Geometry
+	if mode.Format.planar() {
+		return mode.Format.frameSize(stride, g.YVRes)
+	}
+	return stride * g.YRes
+}
@@ -0,0 +1,115 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestFlipPan(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 16, 8, 32)
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i, want := range []uint32{8, 0, 8} {
+		back, err := c.BackBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if back.Bounds() != image.Rect(0, 0, 16, 8) {
+			t.Fatalf("bounds: have %v", back.Bounds())
+		}
+
+		col := color.RGBA{uint8(i + 1), 0, 0, 0xff}
+		draw.Draw(back, back.Bounds(), image.NewUniform(col), image.Point{}, draw.Src)
+
+		if fb.vi.yoffset == want {
+			t.Fatalf("flip %d: drawing into the displayed page", i)
+		}
+
+		if err := c.Flip(); err != nil {
+			t.Fatal(err)
+		}
+
+		if fb.vi.yoffset != want {
+			t.Fatalf("flip %d: yoffset %d, want %d", i, fb.vi.yoffset, want)
+		}
+
+		img, _ := c.Image()
+		if have := img.At(0, int(want)); have != col {
+			t.Fatalf("flip %d: displayed %v, want %v", i, have, col)
+		}
+	}
+}
+
+func TestFlipCopy(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 8, 4, 16)
+	fb.vi.yresVirtual = fb.vi.yres
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	back, err := c.BackBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := back.(*RGB565); !ok {
+		t.Fatalf("have %T, want *RGB565", back)
+	}
+
+	draw.Draw(back, back.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for i, b := range c.Buffer() {
+		if b != 0 {
+			t.Fatalf("byte %d drawn before flip", i)
+		}
+	}
+
+	if err := c.Flip(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fb.vi.yoffset != 0 {
+		t.Fatalf("panned to %d", fb.vi.yoffset)
+	}
+
+	for i, b := range c.Buffer()[:8*4*2] {
+		if b != 0xff {
+			t.Fatalf("byte %d not copied on flip", i)
+		}
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	r := image.Rect(0, 0, 3, 2)
+
+	img, err := NewImage(PixelFormat{Depth: 16, RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, ok := img.(*RGB565)
+	if !ok || i.Rect != r || len(i.Pix) != 12 || i.Stride != 6 {
+		t.Fatalf("have %T %+v", img, img)
+	}
+
+	_, err = NewImage(PixelFormat{Depth: 24}, r)
+	if _, ok := err.(*ErrUnsupportedFormat); !ok {
+		t.Fatalf("24 bits: have %v, want ErrUnsupportedFormat", err)
+	}
+}
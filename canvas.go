@@ -43,15 +43,22 @@ type Canvas struct {
 	origB    [256]uint16     // Palette blue channel.
 	origA    [256]uint16     // Palette transparent channel.
 	origVT   vtMode          // Virtual terminal mode.
-	origVTNo int             // Virtual terminal number.
+	origVTNo int             // Virtual terminal number which was active.
 	origKd   int             // KD mode.
 
 	// Framebuffer state and access bits.
-	fd          *os.File // Framebuffer file descriptor.
-	tty         *os.File // Current tty.
-	mem         []byte   // mmap'd memory.
-	dev         string   // name of the device we are using.
-	switchState int      // Current switch state.
+	fd          *os.File       // Framebuffer file descriptor.
+	tty         *os.File       // Current tty.
+	vtNo        int            // Virtual terminal number of tty.
+	ownTTY      bool           // tty was opened by us and must be closed.
+	newVT       bool           // vtNo was allocated by us and must be freed.
+	mem         []byte         // mmap'd memory.
+	dev         string         // name of the device we are using.
+	switchState int            // Current switch state.
+	signals     chan os.Signal // VT switch signals.
+	page        int            // Page of mem being displayed, when double buffering.
+	back        []byte         // Back buffer, if mem has no room for a second page.
+	virt        device         // Emulated device of a memory or DRM canvas.
 
 	// pre-allocated scratchpad values.
 	zero []byte
@@ -76,10 +83,45 @@ type Canvas struct {
 // can damage the display. Refer to Canvas.Modes() and Canvas.FindMode()
 // for more information. Canvas.CurrentMode() can be used to see which
 // mode is actually being used.
-func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
-	c = new(Canvas)
+//
+// If tty is nil, no virtual terminal handling is performed and the
+// FRAMEBUFFER environment variable must name the device to use.
+// Refer to OpenConsole for a variant which finds the tty by itself.
+func Open(dm *DisplayMode, tty *os.File) (*Canvas, error) {
+	c := new(Canvas)
 	c.tty = tty
-	c.origVTNo = 0
+
+	err := c.open(dm)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// OpenDevice opens the given framebuffer device with the given display mode.
+// It behaves like Open, but bypasses the FRAMEBUFFER environment variable
+// and the console mapping, which makes it suitable for multi-head setups.
+//
+// Each Canvas has its own independent state, so several devices can be
+// opened at the same time. Usually only one of them, if any, should be
+// given the tty. Refer to ListDevices for the available devices.
+func OpenDevice(dev string, dm *DisplayMode, tty *os.File) (*Canvas, error) {
+	c := new(Canvas)
+	c.dev = dev
+	c.tty = tty
+
+	err := c.open(dm)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// open initializes the framebuffer and the tty, if any.
+// On failure, all acquired resources are released again.
+func (c *Canvas) open(dm *DisplayMode) (err error) {
 	c.switchState = _FB_ACTIVE
 
 	defer func() {
@@ -89,31 +131,44 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 		}
 	}()
 
-	// Determine which framebuffer to use.
-	c.dev = os.Getenv("FRAMEBUFFER")
-	if c.dev == "" {
-		if c.tty == nil {
-			err = errors.New("No tty provided. Must set FRAMEBUFFER")
-			return
-		}
-
-		// Get VT state
+	if c.tty != nil {
+		// Remember which VT is active, so we can return to it on Close.
 		var vts vtStat
 		err = ioctl(c.tty.Fd(), _VT_GETSTATE, unsafe.Pointer(&vts))
 		if err != nil {
+			err = notVT(c.tty)
+			return
+		}
+
+		c.origVTNo = int(vts.vActive)
+		c.vtNo = vtNumber(c.tty)
+		if c.vtNo == 0 {
+			c.vtNo = c.origVTNo
+		}
+	}
+
+	// Determine which framebuffer to use.
+	if c.dev == "" {
+		c.dev = os.Getenv("FRAMEBUFFER")
+	}
+
+	if c.virt != nil {
+		// The device is emulated, and already open.
+	} else if c.dev == "" {
+		if c.tty == nil {
+			err = fmt.Errorf("%w: no tty provided, FRAMEBUFFER must be set", ErrNoDevice)
 			return
 		}
 
 		var c2m fb_con2fbmap
 		var fd *os.File
 
-		fd, err = os.OpenFile(fb0, os.O_WRONLY, 0)
+		fd, err = openDevice(fb0, os.O_WRONLY)
 		if err != nil {
-			err = fmt.Errorf("open %q: %v", fb0, err)
 			return
 		}
 
-		c2m.console = uint32(vts.vActive)
+		c2m.console = uint32(c.vtNo)
 		err = ioctl(fd.Fd(), _IOGET_CON2FBMAP, unsafe.Pointer(&c2m))
 		fd.Close()
 
@@ -125,21 +180,23 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 	}
 
 	// Open the frame buffer.
-	c.fd, err = os.OpenFile(c.dev, os.O_RDWR, 0)
-	if err != nil {
-		return
+	if c.virt == nil {
+		c.fd, err = openDevice(c.dev, os.O_RDWR)
+		if err != nil {
+			return
+		}
 	}
 
 	// Fetch original fixed buffer information.
 	// This will never be changed, but we need the information
 	// in various places.
-	err = ioctl(c.fd.Fd(), _IOGET_FSCREENINFO, unsafe.Pointer(&c.origFi))
+	err = c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&c.origFi))
 	if err != nil {
 		return
 	}
 
 	// Fetch original variable information.
-	err = ioctl(c.fd.Fd(), _IOGET_VSCREENINFO, unsafe.Pointer(&c.origVi))
+	err = c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&c.origVi))
 	if err != nil {
 		return
 	}
@@ -154,7 +211,7 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 		cm.blue = unsafe.Pointer(&c.origB[0])
 		cm.transp = unsafe.Pointer(&c.origA[0])
 
-		err = ioctl(c.fd.Fd(), _IOGET_CMAP, unsafe.Pointer(&cm))
+		err = c.ioctl(_IOGET_CMAP, unsafe.Pointer(&cm))
 		if err != nil {
 			return
 		}
@@ -181,14 +238,15 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 	}
 
 	// Fetch original fixed buffer information (again).
-	err = ioctl(c.fd.Fd(), _IOGET_FSCREENINFO, unsafe.Pointer(&c.origFi))
+	err = c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&c.origFi))
 	if err != nil {
 		return
 	}
 
-	// Ensure we are in PACKED_PIXELS mode. Others are useless to us.
-	if c.origFi.typ != _TYPE_PACKED_PIXELS {
-		err = errors.New("Canvas.Open: Framebuffer is not in PACKED PIXELS mode. Unable to continue")
+	// Ensure we are in PACKED_PIXELS or FOURCC mode. Others are
+	// useless to us.
+	if c.origFi.typ != _TYPE_PACKED_PIXELS && c.origFi.typ != _TYPE_FOURCC {
+		err = ErrNotPackedPixels
 		return
 	}
 
@@ -206,17 +264,20 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 		}
 	}
 
-	// mmap the buffer's memory.
-	c.mem, err = syscall.Mmap(int(c.fd.Fd()), 0, int(c.origFi.smemlen),
-		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		err = errors.New("Canvas.Open: Mmap failed: " + err.Error())
-		return
+	// mmap the buffer's memory. Emulated devices have done so.
+	if c.virt == nil {
+		c.mem, err = syscall.Mmap(int(c.fd.Fd()), 0, int(c.origFi.smemlen),
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			err = fmt.Errorf("Canvas.Open: mmap: %w", err)
+			return
+		}
 	}
 
 	// Create pre-allocated zero-memory.
 	// This is used to do fast screen clears.
 	c.zero = make([]byte, len(c.mem))
+	c.clearYUV()
 
 	// Move viewport to top-left corner.
 	if c.origVi.xoffset != 0 || c.origVi.yoffset != 0 {
@@ -224,7 +285,7 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 		vi.xoffset = 0
 		vi.yoffset = 0
 
-		err = ioctl(c.fd.Fd(), _IOPAN_DISPLAY, unsafe.Pointer(vi))
+		err = c.ioctl(_IOPAN_DISPLAY, unsafe.Pointer(vi))
 		if err != nil {
 			return
 		}
@@ -238,7 +299,7 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 		}
 
 		// Activate the given tty.
-		err = c.activateCurrent(c.tty)
+		err = c.activateCurrent()
 		if err != nil {
 			return
 		}
@@ -246,20 +307,35 @@ func Open(dm *DisplayMode, tty *os.File) (c *Canvas, err error) {
 
 	// Clear screen
 	c.Clear()
-	go c.pollSignals()
+
+	c.signals = make(chan os.Signal, 2)
+	signal.Notify(c.signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go c.pollSignals(c.signals)
 	return
 }
 
 // Close closes the framebuffer and cleans up its resources.
 func (c *Canvas) Close() (err error) {
+	if c.signals != nil {
+		signal.Stop(c.signals)
+		close(c.signals)
+		c.signals = nil
+	}
+
 	if c.mem != nil {
-		syscall.Munmap(c.mem)
+		if c.virt == nil {
+			syscall.Munmap(c.mem)
+		}
 		c.mem = nil
 	}
 
+	if c.virt != nil {
+		err = c.virt.close()
+	}
+
 	if c.fd != nil {
 		// Restore original framebuffer settings.
-		err = ioctl(c.fd.Fd(), _IOPUT_VSCREENINFO, unsafe.Pointer(&c.origVi))
+		err = c.ioctl(_IOPUT_VSCREENINFO, unsafe.Pointer(&c.origVi))
 		if err != nil {
 			goto skip_fd
 		}
@@ -274,7 +350,7 @@ func (c *Canvas) Close() (err error) {
 			cm.blue = unsafe.Pointer(&c.origB[0])
 			cm.transp = unsafe.Pointer(&c.origA[0])
 
-			err = ioctl(c.fd.Fd(), _IOPUT_CMAP, unsafe.Pointer(&cm))
+			err = c.ioctl(_IOPUT_CMAP, unsafe.Pointer(&cm))
 		}
 
 	skip_fd:
@@ -303,21 +379,38 @@ func (c *Canvas) Close() (err error) {
 		}
 
 	skip_tty:
-		//c.tty.Close() // Don't close stdout
+		// Only close ttys we opened ourselves. Don't close stdout.
+		if c.ownTTY {
+			c.tty.Close()
+		}
 		c.tty = nil
+
+		// Report a VT we could not free, along with any restore error.
+		if c.newVT && c.vtNo != c.origVTNo {
+			err = errors.Join(err, freeConsole(c.vtNo))
+		}
 	}
 
 	return
 }
 
 // File returns the underlying framebuffer file descriptor.
-// This can be used in custom IOCTL calls.
+// This can be used in custom IOCTL calls. Memory canvases
+// have none, and return nil.
 //
 // Use with caution and do not close it manually.
 func (c *Canvas) File() *os.File {
 	return c.fd
 }
 
+// TTY returns the terminal the canvas is displayed on, or nil if
+// there is none. Pass it to KeyboardFromTTY to read key presses.
+//
+// Do not close it manually.
+func (c *Canvas) TTY() *os.File {
+	return c.tty
+}
+
 // Image returns the pixel buffer as a draw.Image instance.
 // Returns nil if something went wrong.
 func (c *Canvas) Image() (draw.Image, error) {
@@ -326,46 +419,55 @@ func (c *Canvas) Image() (draw.Image, error) {
 		return nil, err
 	}
 
-	p := c.mem
-	s := int(c.origFi.ywrapstep)
-	if s == 0 {
-		s = mode.Stride()
+	stride := c.stride(mode)
+	mem, err := planes(mode.Format, c.mem, stride, mode.Geometry.YVRes)
+	if err != nil {
+		return nil, err
 	}
-	r := image.Rect(0, 0, mode.Geometry.XVRes, mode.Geometry.YVRes)
-
-	// Find out which image type we should be returning.
-	// This depends on the current pixel format.
-	switch mode.Format.Type() {
-	case PF_RGBA:
-		return &image.RGBA{Pix: p, Stride: s, Rect: r}, nil
-
-	case PF_BGRA:
-		return &BGRA{Pix: p, Stride: s, Rect: r}, nil
-
-	case PF_RGB_555:
-		return &RGB555{Pix: p, Stride: s, Rect: r}, nil
-
-	case PF_RGB_565:
-		return &RGB565{Pix: p, Stride: s, Rect: r}, nil
-
-	case PF_BGR_555:
-		return &BGR555{Pix: p, Stride: s, Rect: r}, nil
 
-	case PF_BGR_565:
-		return &BGR565{Pix: p, Stride: s, Rect: r}, nil
+	r := image.Rect(0, 0, mode.Geometry.XVRes, mode.Geometry.YVRes)
+	return newImage(mode.Format, c.packing(mode), mem, stride, r)
+}
 
-	case PF_INDEXED:
-		return &image.Alpha{Pix: p, Stride: s, Rect: r}, nil
+// stride returns the length of a row of pixels in memory.
+// The driver may pad rows, so this is not always the virtual
+// width times the pixel size.
+func (c *Canvas) stride(mode *DisplayMode) int {
+	var fi fbFixScreenInfo
+	err := c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&fi))
+	if err == nil && fi.lineLength > 0 {
+		return int(fi.lineLength)
 	}
+	return mode.Stride()
+}
 
-	return nil, fmt.Errorf("Unsupported pixelformat: %+v", mode.Format)
+// packing returns how pixels of less than a byte are stored.
+func (c *Canvas) packing(mode *DisplayMode) packing {
+	fi := c.origFi
+	c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&fi))
+	return devicePacking(fi.visual, mode)
 }
 
-// Clear clears (zeroes) the framebuffer memory.
+// Clear clears (zeroes) the framebuffer memory. With YUV formats,
+// whose zeroes are green, it is set to black instead.
 func (c *Canvas) Clear() {
 	copy(c.mem, c.zero)
 }
 
+// clearYUV fills the memory Clear copies with black, if the current
+// format is a YUV one.
+func (c *Canvas) clearYUV() {
+	mode, err := c.CurrentMode()
+	if err != nil || mode.Format.FourCC == 0 {
+		return
+	}
+
+	zero, err := planes(mode.Format, c.zero, c.stride(mode), mode.Geometry.YVRes)
+	if err == nil {
+		clearYUV(mode.Format, zero)
+	}
+}
+
 // Accelerated returns true if the framebuffer
 // currently supports hardware acceleration.
 func (c *Canvas) Accelerated() bool {
@@ -387,11 +489,18 @@ func (c *Canvas) setMode(dm *DisplayMode) error {
 
 	var v fbVarScreenInfo
 
-	err := ioctl(c.fd.Fd(), _IOGET_VSCREENINFO, unsafe.Pointer(&v))
+	err := c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&v))
 	if err != nil {
 		return err
 	}
 
+	v.setMode(dm)
+	return c.ioctl(_IOPUT_VSCREENINFO, unsafe.Pointer(&v))
+}
+
+// setMode sets the geometry, timings and pixel format of the given
+// display mode, and moves the viewport to the top-left corner.
+func (v *fbVarScreenInfo) setMode(dm *DisplayMode) {
 	v.xres = uint32(dm.Geometry.XRes)
 	v.yres = uint32(dm.Geometry.YRes)
 	v.xresVirtual = uint32(dm.Geometry.XVRes)
@@ -424,22 +533,52 @@ func (c *Canvas) setMode(dm *DisplayMode) error {
 	v.transparent.offset = uint32(pf.AlphaShift)
 	v.transparent.msb_right = 1
 
+	// FOURCC formats are selected through the grayscale field.
+	if pf.FourCC != 0 {
+		v.grayscale = pf.FourCC
+		v.colorspace = pf.Colorspace
+	} else if v.grayscale > 1 {
+		v.grayscale = 0
+	}
+
 	v.xoffset = 0
 	v.yoffset = 0
+}
 
-	return ioctl(c.fd.Fd(), _IOPUT_VSCREENINFO, unsafe.Pointer(&v))
+// device is a framebuffer device emulated on top of something else.
+type device interface {
+	// ioctl performs a framebuffer request.
+	ioctl(name uintptr, data interface{}) error
+
+	// close releases the device.
+	close() error
+}
+
+// ioctl performs an ioctl on the framebuffer device.
+func (c *Canvas) ioctl(name uintptr, data interface{}) error {
+	if c.virt != nil {
+		return c.virt.ioctl(name, data)
+	}
+	return ioctl(c.fd.Fd(), name, data)
 }
 
 // CurrentMode returns the current framebuffer display mode.
 func (c *Canvas) CurrentMode() (*DisplayMode, error) {
 	var v fbVarScreenInfo
-	var dm DisplayMode
 
-	if ioctl(c.fd.Fd(), _IOGET_VSCREENINFO, unsafe.Pointer(&v)) != nil {
-		return nil, errors.New("Canvas.CurrentMode failed")
+	err := c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&v))
+	if err != nil {
+		return nil, err
 	}
 
-	dm.Accelerated = c.origFi.accel != _ACCEL_NONE
+	return newDisplayMode(&v, c.origFi.accel != _ACCEL_NONE), nil
+}
+
+// newDisplayMode creates a display mode from the given variable screen info.
+func newDisplayMode(v *fbVarScreenInfo, accel bool) *DisplayMode {
+	var dm DisplayMode
+
+	dm.Accelerated = accel
 
 	dm.Geometry.XRes = int(v.xres)
 	dm.Geometry.YRes = int(v.yres)
@@ -455,6 +594,7 @@ func (c *Canvas) CurrentMode() (*DisplayMode, error) {
 	dm.Timings.VSLen = int(v.vsyncLen)
 	dm.Sync = int(v.sync)
 	dm.VMode = int(v.vmode)
+	dm.Nonstandard = int(v.nonstd)
 
 	var pf PixelFormat
 	pf.Depth = uint8(v.bitsPerPixel)
@@ -466,9 +606,15 @@ func (c *Canvas) CurrentMode() (*DisplayMode, error) {
 	pf.BlueShift = uint8(v.blue.offset)
 	pf.AlphaBits = uint8(v.transparent.length)
 	pf.AlphaShift = uint8(v.transparent.offset)
+
+	// FOURCC formats are announced through the grayscale field.
+	if v.grayscale > 1 {
+		pf.FourCC = v.grayscale
+		pf.Colorspace = v.colorspace
+	}
 	dm.Format = pf
 
-	return &dm, nil
+	return &dm
 }
 
 // FindMode finds the display mode with the given name.
@@ -498,9 +644,14 @@ func (c *Canvas) FindMode(name string) *DisplayMode {
 }
 
 // Modes returns the list of supported display modes.
-// These are read from `/etc/fb.modes`.
+// These are read from `/etc/fb.modes`, or for canvases opened
+// with OpenDRM, from the display.
 // This can be called before the framebuffer has been opened.
 func (c *Canvas) Modes() ([]*DisplayMode, error) {
+	if d, ok := c.virt.(*drmDevice); ok {
+		return d.modes(), nil
+	}
+
 	fd, err := os.Open("/etc/fb.modes")
 	if err != nil {
 		return nil, err
@@ -513,17 +664,27 @@ func (c *Canvas) Modes() ([]*DisplayMode, error) {
 
 // Palette returns the current framebuffer color palette.
 func (c *Canvas) Palette() (color.Palette, error) {
+	return readPalette(c.ioctl)
+}
+
+// ioctlFunc performs an ioctl on a particular framebuffer device.
+type ioctlFunc func(name uintptr, data interface{}) error
+
+// readPalette reads the color palette of a framebuffer device.
+func readPalette(ctl ioctlFunc) (color.Palette, error) {
+	var r, g, b, a [256]uint16
 	var cm fb_cmap
 
 	cm.start = 0
 	cm.len = 256
-	cm.red = unsafe.Pointer(&c.tmpR[0])
-	cm.green = unsafe.Pointer(&c.tmpG[0])
-	cm.blue = unsafe.Pointer(&c.tmpB[0])
-	cm.transp = unsafe.Pointer(&c.tmpA[0])
+	cm.red = unsafe.Pointer(&r[0])
+	cm.green = unsafe.Pointer(&g[0])
+	cm.blue = unsafe.Pointer(&b[0])
+	cm.transp = unsafe.Pointer(&a[0])
 
-	if ioctl(c.fd.Fd(), _IOGET_CMAP, unsafe.Pointer(&cm)) != nil {
-		return nil, errors.New("Canvas.Palette failed")
+	err := ctl(_IOGET_CMAP, unsafe.Pointer(&cm))
+	if err != nil {
+		return nil, err
 	}
 
 	s := int(cm.start)
@@ -531,10 +692,10 @@ func (c *Canvas) Palette() (color.Palette, error) {
 
 	for i := range pal {
 		pal[i] = color.NRGBA{
-			uint8(c.tmpR[i+s] >> 8),
-			uint8(c.tmpG[i+s] >> 8),
-			uint8(c.tmpB[i+s] >> 8),
-			uint8(c.tmpA[i+s] >> 8),
+			uint8(r[i+s] >> 8),
+			uint8(g[i+s] >> 8),
+			uint8(b[i+s] >> 8),
+			uint8(a[i+s] >> 8),
 		}
 	}
 
@@ -549,10 +710,10 @@ func (c *Canvas) SetPalette(pal color.Palette) error {
 
 	for i, clr := range pal {
 		r, g, b, a := clr.RGBA()
-		c.tmpR[i] = uint16(r >> 16)
-		c.tmpG[i] = uint16(g >> 16)
-		c.tmpB[i] = uint16(b >> 16)
-		c.tmpA[i] = uint16(a >> 16)
+		c.tmpR[i] = uint16(r)
+		c.tmpG[i] = uint16(g)
+		c.tmpB[i] = uint16(b)
+		c.tmpA[i] = uint16(a)
 	}
 
 	var cm fb_cmap
@@ -563,11 +724,7 @@ func (c *Canvas) SetPalette(pal color.Palette) error {
 	cm.blue = unsafe.Pointer(&c.tmpB[0])
 	cm.transp = unsafe.Pointer(&c.tmpA[0])
 
-	if ioctl(c.fd.Fd(), _IOPUT_CMAP, unsafe.Pointer(&cm)) != nil {
-		return errors.New("Canvas.SetPalette failed")
-	}
-
-	return nil
+	return c.ioctl(_IOPUT_CMAP, unsafe.Pointer(&cm))
 }
 
 func (c *Canvas) switchAcquire() {
@@ -599,11 +756,8 @@ func (c *Canvas) switchInit() error {
 	return ioctl(c.tty.Fd(), _VT_SETMODE, unsafe.Pointer(&vm))
 }
 
-// pollSignals polls for user signals.
-func (c *Canvas) pollSignals() {
-	signals := make(chan os.Signal, 2)
-	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
-
+// pollSignals polls for user signals until Close is called.
+func (c *Canvas) pollSignals(signals <-chan os.Signal) {
 	for sig := range signals {
 		switch sig {
 		case syscall.SIGUSR1: // Release
@@ -615,18 +769,12 @@ func (c *Canvas) pollSignals() {
 	}
 }
 
-func (c *Canvas) activateCurrent(tty *os.File) error {
-	var vts vtStat
-
-	err := ioctl(tty.Fd(), _VT_GETSTATE, unsafe.Pointer(&vts))
-	if err != nil {
-		return err
-	}
-
-	err = ioctl(tty.Fd(), _VT_ACTIVATE, int(vts.vActive))
+// activateCurrent switches the display to our own virtual terminal.
+func (c *Canvas) activateCurrent() error {
+	err := ioctl(c.tty.Fd(), _VT_ACTIVATE, c.vtNo)
 	if err != nil {
 		return err
 	}
 
-	return ioctl(tty.Fd(), _VT_WAITACTIVE, int(vts.vActive))
+	return ioctl(c.tty.Fd(), _VT_WAITACTIVE, c.vtNo)
 }
@@ -0,0 +1,313 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// Visual describes how pixel values are turned into colors.
+type Visual int
+
+// Known visual types.
+const (
+	VisualMono01            Visual = _VISUAL_MONO01             // Monochrome. 1=Black 0=White.
+	VisualMono10            Visual = _VISUAL_MONO10             // Monochrome. 1=White 0=Black.
+	VisualTrueColor         Visual = _VISUAL_TRUECOLOR          // True color.
+	VisualPseudoColor       Visual = _VISUAL_PSEUDOCOLOR        // Pseudo color, through a palette.
+	VisualDirectColor       Visual = _VISUAL_DIRECTCOLOR        // Direct color, through a palette per channel.
+	VisualStaticPseudoColor Visual = _VISUAL_STATIC_PSEUDOCOLOR // Pseudo color with a read-only palette.
+	VisualFourCC            Visual = _VISUAL_FOURCC             // Identified by a V4L2 FOURCC.
+)
+
+func (v Visual) String() string {
+	switch v {
+	case VisualMono01:
+		return "mono01"
+	case VisualMono10:
+		return "mono10"
+	case VisualTrueColor:
+		return "truecolor"
+	case VisualPseudoColor:
+		return "pseudocolor"
+	case VisualDirectColor:
+		return "directcolor"
+	case VisualStaticPseudoColor:
+		return "static pseudocolor"
+	case VisualFourCC:
+		return "fourcc"
+	}
+
+	return "unknown"
+}
+
+// Support tells whether the device supports a feature, for features
+// which can only be found by probing.
+type Support int
+
+// Known support values.
+const (
+	SupportUnknown Support = iota // The probe failed for another reason.
+	Supported                     // The driver accepted the probe.
+	Unsupported                   // The driver does not implement the request.
+)
+
+func (s Support) String() string {
+	switch s {
+	case Supported:
+		return "yes"
+	case Unsupported:
+		return "no"
+	}
+
+	return "unknown"
+}
+
+// probeSupport interprets the result of a probing request. Drivers
+// reject requests they do not implement with ENOTTY or EINVAL.
+func probeSupport(err error) Support {
+	switch {
+	case err == nil:
+		return Supported
+	case errors.Is(err, syscall.ENOTTY), errors.Is(err, syscall.EINVAL):
+		return Unsupported
+	}
+
+	return SupportUnknown
+}
+
+// Capabilities describes what the framebuffer device supports.
+//
+// Most of these values are reported by the driver. Some are found by
+// probing the device with harmless requests, as drivers have no other
+// way of announcing them.
+type Capabilities struct {
+	XPanStep  int // Horizontal panning granularity in pixels. Zero if not supported.
+	YPanStep  int // Vertical panning granularity in lines. Zero if not supported.
+	YWrapStep int // Vertical wrapping granularity in lines. Zero if not supported.
+
+	MaxXVRes int // Largest virtual horizontal resolution accepted by the driver.
+	MaxYVRes int // Largest virtual vertical resolution accepted by the driver.
+
+	VBlank   bool    // Vertical blanks can be detected.
+	VSync    bool    // Waiting for vertical sync is supported.
+	HWCursor Support // Hardware cursor is supported.
+	Blanking Support // Display blanking is supported.
+	FourCC   bool    // FOURCC based pixel formats are supported.
+
+	Visual          Visual // Current visual type.
+	Accel           int    // Accelerator identifier.
+	AccelName       string // Accelerator name. Empty if there is none.
+	PaletteWritable bool   // The color palette can be changed.
+}
+
+// Capabilities probes the framebuffer and reports what it supports.
+func (c *Canvas) Capabilities() (*Capabilities, error) {
+	var fi fbFixScreenInfo
+	var vi fbVarScreenInfo
+
+	err := c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&fi))
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&vi))
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Capabilities
+	cp.XPanStep = int(fi.xpanstep)
+	cp.YPanStep = int(fi.ypanstep)
+	cp.YWrapStep = int(fi.ywrapstep)
+	cp.FourCC = fi.capabilities&_CAP_FOURCC != 0
+	cp.Visual = Visual(fi.visual)
+	cp.Accel = int(fi.accel)
+	cp.AccelName = accelNames[fi.accel]
+
+	cp.MaxXVRes, cp.MaxYVRes = c.probeVirtual(&fi, &vi)
+
+	var vb fbVblank
+	if c.ioctl(uintptr(_IOGET_VBLANK), unsafe.Pointer(&vb)) == nil {
+		cp.VBlank = vb.flags&_VBLANK_HAVE_VBLANK != 0
+		cp.VSync = vb.flags&_VBLANK_HAVE_VSYNC != 0
+	}
+
+	if !cp.VSync {
+		var crtc uint32
+		cp.VSync = c.ioctl(uintptr(_IO_WAITFORVSYNC), unsafe.Pointer(&crtc)) == nil
+	}
+
+	// Only move the cursor, which is hidden while we draw. The console
+	// puts it back where it belongs the next time it draws it.
+	var cur fbCursor
+	cur.set = _CUR_SETPOS
+	cp.HWCursor = probeSupport(c.ioctl(uintptr(_IO_CURSOR), unsafe.Pointer(&cur)))
+
+	// The screen is visible while we are running, so unblanking is a no-op.
+	cp.Blanking = probeSupport(c.ioctl(_IO_BLANK, _BLANK_UNBLANK))
+
+	if fi.visual == _VISUAL_PSEUDOCOLOR || fi.visual == _VISUAL_DIRECTCOLOR {
+		// Write the current palette back to see if it is accepted.
+		var cm fb_cmap
+		cm.start = 0
+		cm.len = 256
+		cm.red = unsafe.Pointer(&c.tmpR[0])
+		cm.green = unsafe.Pointer(&c.tmpG[0])
+		cm.blue = unsafe.Pointer(&c.tmpB[0])
+		cm.transp = unsafe.Pointer(&c.tmpA[0])
+
+		if c.ioctl(_IOGET_CMAP, unsafe.Pointer(&cm)) == nil {
+			cp.PaletteWritable = c.ioctl(_IOPUT_CMAP, unsafe.Pointer(&cm)) == nil
+		}
+	}
+
+	return &cp, nil
+}
+
+// probeVirtual finds the largest virtual resolution the driver accepts.
+// Each dimension is probed separately, leaving the other unchanged.
+// Requests are made with _ACTIVATE_TEST, so the mode is never changed.
+func (c *Canvas) probeVirtual(fi *fbFixScreenInfo, vi *fbVarScreenInfo) (int, int) {
+	bpp := vi.bitsPerPixel
+	if bpp == 0 {
+		bpp = 8
+	}
+
+	// Video memory is the upper bound for both dimensions.
+	maxX := int(vi.xresVirtual)
+	if vi.yres > 0 {
+		maxX = int(uint64(fi.smemlen) * 8 / uint64(bpp) / uint64(vi.yres))
+	}
+
+	maxY := int(vi.yresVirtual)
+	if fi.lineLength > 0 {
+		maxY = int(fi.smemlen / fi.lineLength)
+	}
+
+	x := c.probeLimit(vi, int(vi.xresVirtual), maxX, func(v *fbVarScreenInfo, n int) *uint32 {
+		v.xresVirtual = uint32(n)
+		return &v.xresVirtual
+	})
+
+	y := c.probeLimit(vi, int(vi.yresVirtual), maxY, func(v *fbVarScreenInfo, n int) *uint32 {
+		v.yresVirtual = uint32(n)
+		return &v.yresVirtual
+	})
+
+	return x, y
+}
+
+// probeLimit performs a binary search for the largest value in [lo, hi]
+// the driver accepts for the field set by the given function.
+func (c *Canvas) probeLimit(vi *fbVarScreenInfo, lo, hi int, set func(*fbVarScreenInfo, int) *uint32) int {
+	ok := func(n int) bool {
+		v := vi.Copy()
+		v.activate = _ACTIVATE_TEST
+		field := set(v, n)
+
+		if c.ioctl(_IOPUT_VSCREENINFO, unsafe.Pointer(v)) != nil {
+			return false
+		}
+
+		// Drivers may round impossible values instead of rejecting them.
+		return int(*field) >= n
+	}
+
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		if ok(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo
+}
+
+// accelNames maps accelerator identifiers to human readable names.
+var accelNames = map[uint32]string{
+	_ACCEL_ATARIBLITT:          "Atari Blitter",
+	_ACCEL_AMIGABLITT:          "Amiga Blitter",
+	_ACCEL_S3_TR_IO64:          "Cybervision64 (S3 Trio64)",
+	_ACCEL_NCR_77C32BLT:        "RetinaZ3 (NCR 77C32BLT)",
+	_ACCEL_S3_VIRGE:            "Cybervision64/3D (S3 ViRGE)",
+	_ACCEL_ATI_MACH64GX:        "ATI Mach 64GX family",
+	_ACCEL_DEC_TGA:             "DEC 21030 TGA",
+	_ACCEL_ATI_MACH64CT:        "ATI Mach 64CT family",
+	_ACCEL_ATI_MACH64VT:        "ATI Mach 64CT family VT class",
+	_ACCEL_ATI_MACH64GT:        "ATI Mach 64CT family GT class",
+	_ACCEL_SUN_CREATOR:         "Sun Creator/Creator3D",
+	_ACCEL_SUN_CGSIX:           "Sun cg6",
+	_ACCEL_SUN_LEO:             "Sun leo/zx",
+	_ACCEL_IMS_TWINTURBO:       "IMS Twin Turbo",
+	_ACCEL_3DLABS_PERMEDIA2:    "3Dlabs Permedia 2",
+	_ACCEL_MATROX_MGA2064W:     "Matrox MGA2064W (Millenium)",
+	_ACCEL_MATROX_MGA1064SG:    "Matrox MGA1064SG (Mystique)",
+	_ACCEL_MATROX_MGA2164W:     "Matrox MGA2164W (Millenium II)",
+	_ACCEL_MATROX_MGA2164W_AGP: "Matrox MGA2164W (Millenium II)",
+	_ACCEL_MATROX_MGAG100:      "Matrox G100 (Productiva G100)",
+	_ACCEL_MATROX_MGAG200:      "Matrox G200 (Myst, Mill, ...)",
+	_ACCEL_SUN_CG14:            "Sun cgfourteen",
+	_ACCEL_SUN_BWTWO:           "Sun bwtwo",
+	_ACCEL_SUN_CGTHREE:         "Sun cgthree",
+	_ACCEL_SUN_TCX:             "Sun tcx",
+	_ACCEL_MATROX_MGAG400:      "Matrox G400",
+	_ACCEL_NV3:                 "nVidia RIVA 128",
+	_ACCEL_NV4:                 "nVidia RIVA TNT",
+	_ACCEL_NV5:                 "nVidia RIVA TNT2",
+	_ACCEL_CT_6555x:            "C&T 6555x",
+	_ACCEL_3DFX_BANSHEE:        "3Dfx Banshee",
+	_ACCEL_ATI_RAGE128:         "ATI Rage128 family",
+	_ACCEL_IGS_CYBER2000:       "CyberPro 2000",
+	_ACCEL_IGS_CYBER2010:       "CyberPro 2010",
+	_ACCEL_IGS_CYBER5000:       "CyberPro 5000",
+	_ACCEL_SIS_GLAMOUR:         "SiS 300/630/540",
+	_ACCEL_3DLABS_PERMEDIA3:    "3Dlabs Permedia 3",
+	_ACCEL_ATI_RADEON:          "ATI Radeon family",
+	_ACCEL_I810:                "Intel 810/815",
+	_ACCEL_SIS_GLAMOUR_2:       "SiS 315, 650, 740",
+	_ACCEL_SIS_XABRE:           "SiS 330 (\"Xabre\")",
+	_ACCEL_I830:                "Intel 830M/845G/85x/865G",
+	_ACCEL_NV_10:               "nVidia Arch 10",
+	_ACCEL_NV_20:               "nVidia Arch 20",
+	_ACCEL_NV_30:               "nVidia Arch 30",
+	_ACCEL_NV_40:               "nVidia Arch 40",
+	_ACCEL_XGI_VOLARI_V:        "XGI Volari V3XT, V5, V8",
+	_ACCEL_XGI_VOLARI_Z:        "XGI Volari Z7",
+	_ACCEL_OMAP1610:            "TI OMAP16xx",
+	_ACCEL_TRIDENT_TGUI:        "Trident TGUI",
+	_ACCEL_TRIDENT_3DIMAGE:     "Trident 3DImage",
+	_ACCEL_TRIDENT_BLADE3D:     "Trident Blade3D",
+	_ACCEL_TRIDENT_BLADEXP:     "Trident BladeXP / Cirrus Logic 543x/544x/5480",
+	_ACCEL_NEOMAGIC_NM2070:     "NeoMagic NM2070",
+	_ACCEL_NEOMAGIC_NM2090:     "NeoMagic NM2090",
+	_ACCEL_NEOMAGIC_NM2093:     "NeoMagic NM2093",
+	_ACCEL_NEOMAGIC_NM2097:     "NeoMagic NM2097",
+	_ACCEL_NEOMAGIC_NM2160:     "NeoMagic NM2160",
+	_ACCEL_NEOMAGIC_NM2200:     "NeoMagic NM2200",
+	_ACCEL_NEOMAGIC_NM2230:     "NeoMagic NM2230",
+	_ACCEL_NEOMAGIC_NM2360:     "NeoMagic NM2360",
+	_ACCEL_NEOMAGIC_NM2380:     "NeoMagic NM2380",
+	_ACCEL_PXA3XX:              "PXA3xx",
+	_ACCEL_SAVAGE4:             "S3 Savage4",
+	_ACCEL_SAVAGE3D:            "S3 Savage3D",
+	_ACCEL_SAVAGE3D_MV:         "S3 Savage3D-MV",
+	_ACCEL_SAVAGE2000:          "S3 Savage2000",
+	_ACCEL_SAVAGE_MX_MV:        "S3 Savage/MX-MV",
+	_ACCEL_SAVAGE_MX:           "S3 Savage/MX",
+	_ACCEL_SAVAGE_IX_MV:        "S3 Savage/IX-MV",
+	_ACCEL_SAVAGE_IX:           "S3 Savage/IX",
+	_ACCEL_PROSAVAGE_PM:        "S3 ProSavage PM133",
+	_ACCEL_PROSAVAGE_KM:        "S3 ProSavage KM133",
+	_ACCEL_S3TWISTER_P:         "S3 Twister",
+	_ACCEL_S3TWISTER_K:         "S3 TwisterK",
+	_ACCEL_SUPERSAVAGE:         "S3 Supersavage",
+	_ACCEL_PROSAVAGE_DDR:       "S3 ProSavage DDR",
+	_ACCEL_PROSAVAGE_DDRK:      "S3 ProSavage DDR-K",
+	_ACCEL_PUV3_UNIGFX:         "PKUnity-v3 Unigfx",
+}
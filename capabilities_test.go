@@ -0,0 +1,72 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 64, 48, 32)
+	fb.vi.yresVirtual = 48
+	fb.fi.ypanstep = 1
+	fb.fi.accel = _ACCEL_ATI_RADEON
+	fb.vblank = _VBLANK_HAVE_VBLANK | _VBLANK_HAVE_VSYNC
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cp, err := c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Capabilities{
+		YPanStep:  1,
+		MaxXVRes:  128, // Video memory fits two screens in either direction.
+		MaxYVRes:  96,
+		VBlank:    true,
+		VSync:     true,
+		HWCursor:  Supported,
+		Blanking:  Supported,
+		Visual:    VisualTrueColor,
+		Accel:     _ACCEL_ATI_RADEON,
+		AccelName: "ATI Radeon family",
+	}
+
+	if *cp != want {
+		t.Errorf("have %+v\nwant %+v", *cp, want)
+	}
+
+	// Probing must not alter the mode.
+	if fb.vi.xresVirtual != 64 || fb.vi.yresVirtual != 48 {
+		t.Errorf("virtual resolution changed to %dx%d", fb.vi.xresVirtual, fb.vi.yresVirtual)
+	}
+
+	// Rejected requests mean no support; other errors tell nothing.
+	fb = s.addFB(1, "fb1", "drv", 64, 48, 32)
+	fb.errs = map[uintptr]syscall.Errno{
+		uintptr(_IO_CURSOR): syscall.ENOTTY,
+		_IO_BLANK:           syscall.EPERM,
+	}
+
+	c1, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	cp, err = c1.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.HWCursor != Unsupported || cp.Blanking != SupportUnknown {
+		t.Errorf("cursor %v, blanking %v", cp.HWCursor, cp.Blanking)
+	}
+}
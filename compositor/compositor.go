@@ -0,0 +1,191 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package compositor blends off-screen surfaces onto the framebuffer.
+//
+// Applications draw into surfaces, each of which has a position, z-order,
+// opacity, visibility and clip rectangle. The compositor keeps track of
+// which parts of the screen have changed and repaints only those,
+// blending the surfaces in z-order with the Over operator. Blending is
+// done in premultiplied RGBA, after which the result is converted to
+// the pixel format of the destination.
+package compositor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"sync"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Compositor blends surfaces onto a destination image.
+// It is safe for concurrent use.
+type Compositor struct {
+	mu       sync.Mutex
+	dst      draw.Image
+	area     image.Rectangle // Area of dst the surfaces are drawn in.
+	bg       image.Image     // Drawn beneath all surfaces.
+	surfaces []*Surface      // In drawing order.
+	damage   region          // Area which must be repainted.
+	scratch  *image.RGBA     // Blending buffer, covering area.
+	seq      int             // Creation order of surfaces.
+}
+
+// New creates a compositor which draws into the given area of dst.
+// The background is black, and the whole area is initially damaged,
+// so the first call to Composite paints all of it.
+func New(dst draw.Image, area image.Rectangle) *Compositor {
+	area = area.Intersect(dst.Bounds())
+
+	c := &Compositor{
+		dst:     dst,
+		area:    area,
+		bg:      image.NewUniform(color.Black),
+		scratch: image.NewRGBA(area),
+	}
+
+	c.damage.add(area)
+	return c
+}
+
+// Open creates a compositor for the canvas. It draws into the
+// visible part of the framebuffer, not the virtual resolution.
+func Open(canvas *framebuffer.Canvas) (*Compositor, error) {
+	img, err := canvas.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := canvas.CurrentMode()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(img, image.Rect(0, 0, mode.Geometry.XRes, mode.Geometry.YRes)), nil
+}
+
+// Bounds returns the area of the destination the compositor draws in.
+func (c *Compositor) Bounds() image.Rectangle {
+	return c.area
+}
+
+// SetBackground sets the image drawn beneath all surfaces. It is
+// aligned with the destination, and drawn without blending. A nil
+// image means black.
+func (c *Compositor) SetBackground(bg image.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if bg == nil {
+		bg = image.NewUniform(color.Black)
+	}
+
+	c.bg = bg
+	c.damage.add(c.area)
+}
+
+// NewSurface creates a transparent surface with the given size,
+// positioned at the top-left of the compositor area. It is visible
+// and fully opaque, and stacked above existing surfaces with the same
+// z-order.
+func (c *Compositor) NewSurface(width, height int) *Surface {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	c.seq++
+
+	s := &Surface{
+		c:       c,
+		img:     img,
+		pos:     c.area.Min,
+		seq:     c.seq,
+		opacity: 0xff,
+		visible: true,
+		clip:    img.Rect,
+	}
+
+	c.surfaces = append(c.surfaces, s)
+	c.sort()
+	return s
+}
+
+// Damage marks an area of the destination for repainting.
+func (c *Compositor) Damage(r image.Rectangle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.damage.add(r.Intersect(c.area))
+}
+
+// Redraw marks the whole area for repainting. This is needed after
+// something other than the compositor has drawn to the destination.
+func (c *Compositor) Redraw() {
+	c.Damage(c.area)
+}
+
+// Composite repaints all damaged parts of the destination.
+// It returns the rectangles which were repainted.
+func (c *Compositor) Composite() []image.Rectangle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rects := c.damage.rects
+	c.damage.rects = nil
+
+	for _, r := range rects {
+		c.paint(r)
+	}
+
+	return rects
+}
+
+// paint blends the surfaces covering r and copies the result to
+// the destination.
+func (c *Compositor) paint(r image.Rectangle) {
+	draw.Draw(c.scratch, r, c.bg, r.Min, draw.Src)
+
+	for _, s := range c.surfaces {
+		if !s.visible || s.opacity == 0 {
+			continue
+		}
+
+		sr := s.area().Intersect(r)
+		if sr.Empty() {
+			continue
+		}
+
+		sp := sr.Min.Sub(s.pos)
+		if s.opacity == 0xff {
+			draw.Draw(c.scratch, sr, s.img, sp, draw.Over)
+		} else {
+			mask := image.NewUniform(color.Alpha{s.opacity})
+			draw.DrawMask(c.scratch, sr, s.img, sp, mask, image.Point{}, draw.Over)
+		}
+	}
+
+	draw.Draw(c.dst, r, c.scratch, r.Min, draw.Src)
+}
+
+// sort orders the surfaces by z-order, then by creation.
+func (c *Compositor) sort() {
+	sort.Slice(c.surfaces, func(i, j int) bool {
+		a, b := c.surfaces[i], c.surfaces[j]
+		if a.z != b.z {
+			return a.z < b.z
+		}
+		return a.seq < b.seq
+	})
+}
+
+// remove takes s out of the surface list.
+func (c *Compositor) remove(s *Surface) {
+	for i, v := range c.surfaces {
+		if v == s {
+			c.surfaces = append(c.surfaces[:i], c.surfaces[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package compositor
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/sparques/framebuffer"
+)
+
+var update = flag.Bool("update", false, "Update golden images.")
+
+// scene sets up surfaces exercising all surface properties.
+func scene(c *Compositor) map[string]*Surface {
+	c.SetBackground(image.NewUniform(color.RGBA{0x20, 0x20, 0x40, 0xff}))
+
+	// An opaque square with a translucent border.
+	a := c.NewSurface(24, 24)
+	a.Paint(func(dst draw.Image) {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.NRGBA{0xff, 0, 0, 0x80}), image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rect(4, 4, 20, 20), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+	})
+	a.Move(image.Pt(8, 8))
+
+	// A gradient in alpha, half transparent as a whole, above a.
+	b := c.NewSurface(32, 16)
+	b.Paint(func(dst draw.Image) {
+		for x := 0; x < 32; x++ {
+			col := color.NRGBA{0, 0xff, 0, uint8(x * 8)}
+			draw.Draw(dst, image.Rect(x, 0, x+1, 16), image.NewUniform(col), image.Point{}, draw.Src)
+		}
+	})
+	b.Move(image.Pt(20, 20))
+	b.SetOpacity(0x80)
+	b.SetZ(1)
+
+	// Created last, but stacked beneath a and b.
+	d := c.NewSurface(40, 8)
+	d.Paint(func(dst draw.Image) {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	})
+	d.Move(image.Pt(4, 16))
+	d.SetZ(-1)
+
+	// Clipped to its right half.
+	e := c.NewSurface(16, 16)
+	e.Paint(func(dst draw.Image) {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.RGBA{0, 0, 0xff, 0xff}), image.Point{}, draw.Src)
+	})
+	e.Move(image.Pt(44, 4))
+	e.SetClip(image.Rect(8, 0, 16, 16))
+
+	// Hidden.
+	h := c.NewSurface(64, 48)
+	h.Paint(func(dst draw.Image) {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	})
+	h.SetVisible(false)
+
+	return map[string]*Surface{"a": a, "b": b, "d": d, "e": e, "h": h}
+}
+
+func TestCompositeGolden(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	c := New(img, img.Bounds())
+	scene(c)
+	c.Composite()
+
+	golden(t, "testdata/scene.png", img)
+}
+
+func TestCompositeFormats(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	c := New(want, want.Bounds())
+	scene(c)
+	c.Composite()
+
+	r := want.Bounds()
+	for _, dst := range []draw.Image{
+		&framebuffer.BGRA{Pix: make([]byte, 4*64*48), Stride: 4 * 64, Rect: r},
+		&framebuffer.RGB565{Pix: make([]byte, 2*64*48), Stride: 2 * 64, Rect: r},
+		&framebuffer.BGR565{Pix: make([]byte, 2*64*48), Stride: 2 * 64, Rect: r},
+		&framebuffer.RGB555{Pix: make([]byte, 2*64*48), Stride: 2 * 64, Rect: r},
+		&framebuffer.BGR555{Pix: make([]byte, 2*64*48), Stride: 2 * 64, Rect: r},
+	} {
+		c := New(dst, r)
+		scene(c)
+		c.Composite()
+
+		// The result is the blended image, converted to the format.
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				have := dst.At(x, y)
+				exp := dst.ColorModel().Convert(want.At(x, y))
+				if !sameColor(have, exp) {
+					t.Fatalf("%T: pixel %d,%d: have %v, want %v", dst, x, y, have, exp)
+				}
+			}
+		}
+	}
+}
+
+func TestCompositeDamage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	c := New(img, img.Bounds())
+	s := scene(c)
+
+	rects := c.Composite()
+	if len(rects) != 1 || rects[0] != img.Bounds() {
+		t.Fatalf("first composite: have %v, want %v", rects, img.Bounds())
+	}
+
+	if rects := c.Composite(); len(rects) != 0 {
+		t.Fatalf("nothing changed, yet repainted %v", rects)
+	}
+
+	// Paint over everything. Only damaged areas should be restored.
+	marker := color.RGBA{0xff, 0, 0xff, 0xff}
+	draw.Draw(img, img.Bounds(), image.NewUniform(marker), image.Point{}, draw.Src)
+
+	s["a"].Move(image.Pt(0, 0))
+	s["e"].SetClip(image.Rect(0, 0, 8, 16))
+	rects = c.Composite()
+
+	want := []image.Rectangle{
+		image.Rect(0, 0, 32, 32),
+		image.Rect(52, 4, 60, 20), // Old clip.
+		image.Rect(44, 4, 52, 20), // New clip.
+	}
+	if len(rects) != len(want) {
+		t.Fatalf("damage: have %v, want %v", rects, want)
+	}
+	for i := range want {
+		if rects[i] != want[i] {
+			t.Fatalf("damage: have %v, want %v", rects, want)
+		}
+	}
+
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			p := image.Pt(x, y)
+			damaged := false
+			for _, r := range want {
+				damaged = damaged || p.In(r)
+			}
+			if !damaged && img.At(x, y) != marker {
+				t.Fatalf("pixel %d,%d outside damage was repainted", x, y)
+			}
+			if damaged && img.At(x, y) == marker {
+				t.Fatalf("pixel %d,%d inside damage was not repainted", x, y)
+			}
+		}
+	}
+
+	// The repainted parts must match a full redraw.
+	full := image.NewRGBA(img.Bounds())
+	f := New(full, full.Bounds())
+	fs := scene(f)
+	fs["a"].Move(image.Pt(0, 0))
+	fs["e"].SetClip(image.Rect(0, 0, 8, 16))
+	f.Composite()
+
+	for _, r := range want {
+		compare(t, img.SubImage(r).(*image.RGBA), full.SubImage(r))
+	}
+
+	golden(t, "testdata/moved.png", full)
+}
+
+func TestSurfaceDamage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	c := New(img, img.Bounds())
+	s := c.NewSurface(16, 16)
+	s.Move(image.Pt(60, 10))
+	c.Composite()
+
+	// Damage is clipped to the surface and the compositor area.
+	s.Damage(image.Rect(-4, 2, 100, 4))
+	if have, want := c.Composite(), image.Rect(60, 12, 64, 14); len(have) != 1 || have[0] != want {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+
+	// Hidden and removed surfaces do not cause damage.
+	s.SetVisible(false)
+	c.Composite()
+	s.Damage(s.Image().Bounds())
+	if have := c.Composite(); len(have) != 0 {
+		t.Fatalf("hidden surface damaged %v", have)
+	}
+
+	s.SetVisible(true)
+	s.Remove()
+	if have, want := c.Composite(), image.Rect(60, 10, 64, 26); len(have) != 1 || have[0] != want {
+		t.Fatalf("remove: have %v, want %v", have, want)
+	}
+
+	s.Move(image.Pt(0, 0))
+	if have := c.Composite(); len(have) != 0 {
+		t.Fatalf("removed surface damaged %v", have)
+	}
+}
+
+func TestRegion(t *testing.T) {
+	var g region
+
+	g.add(image.Rect(0, 0, 10, 10))
+	g.add(image.Rect(2, 2, 4, 4))
+	g.add(image.Rect(20, 0, 30, 10))
+	if len(g.rects) != 2 {
+		t.Fatalf("contained rectangle added: %v", g.rects)
+	}
+
+	// Bridges both rectangles, so all three merge.
+	g.add(image.Rect(5, 5, 25, 6))
+	if len(g.rects) != 1 || g.rects[0] != image.Rect(0, 0, 30, 10) {
+		t.Fatalf("overlapping rectangles not merged: %v", g.rects)
+	}
+
+	g = region{}
+	for i := 0; i <= maxRects; i++ {
+		g.add(image.Rect(i*10, i*10, i*10+5, i*10+5))
+	}
+	if len(g.rects) != 1 || g.rects[0] != image.Rect(0, 0, maxRects*10+5, maxRects*10+5) {
+		t.Fatalf("region not reduced to bounding box: %v", g.rects)
+	}
+}
+
+func golden(t *testing.T, path string, img *image.RGBA) {
+	if *update {
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		os.WriteFile(path, buf.Bytes(), 0644)
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	want, err := png.Decode(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, img, want)
+}
+
+func compare(t *testing.T, have *image.RGBA, want image.Image) {
+	if have.Bounds() != want.Bounds() {
+		t.Fatalf("bounds: have %v, want %v", have.Bounds(), want.Bounds())
+	}
+
+	b := have.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !sameColor(have.At(x, y), want.At(x, y)) {
+				t.Fatalf("pixel %d,%d: have %v, want %v", x, y, have.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
@@ -0,0 +1,58 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package compositor
+
+import "image"
+
+// maxRects is the number of rectangles a region holds, before it is
+// reduced to its bounding box. Beyond this, repainting a somewhat
+// larger area is cheaper than keeping track of many small ones.
+const maxRects = 16
+
+// region is a set of non-overlapping rectangles.
+type region struct {
+	rects []image.Rectangle
+}
+
+// add adds r to the region. Rectangles which overlap
+// are merged into their bounding box.
+func (g *region) add(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+
+	for i := 0; i < len(g.rects); {
+		v := g.rects[i]
+
+		if r.In(v) {
+			return
+		}
+
+		if v.Overlaps(r) {
+			r = r.Union(v)
+			g.rects = append(g.rects[:i], g.rects[i+1:]...)
+
+			// The union may overlap rectangles which were checked before.
+			i = 0
+			continue
+		}
+
+		i++
+	}
+
+	g.rects = append(g.rects, r)
+
+	if len(g.rects) > maxRects {
+		g.rects = []image.Rectangle{g.bounds()}
+	}
+}
+
+// bounds returns the bounding box of the region.
+func (g *region) bounds() image.Rectangle {
+	var b image.Rectangle
+	for _, r := range g.rects {
+		b = b.Union(r)
+	}
+	return b
+}
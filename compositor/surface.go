@@ -0,0 +1,168 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package compositor
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Surface is an off-screen image which the compositor blends onto
+// the destination. Its methods are safe for concurrent use, but
+// drawing into its image must be synchronised with Composite by
+// the caller, for instance by using Paint.
+type Surface struct {
+	c       *Compositor
+	img     *image.RGBA
+	pos     image.Point     // Position of the image origin on the destination.
+	z       int             // Stacking order; higher is on top.
+	seq     int             // Creation order, for surfaces with equal z.
+	opacity uint8           // Applied on top of the per-pixel alpha.
+	visible bool            // Whether the surface is drawn at all.
+	clip    image.Rectangle // Part of the image which is drawn.
+	removed bool
+}
+
+// Image returns the surface contents. Its bounds start at (0, 0).
+// The pixels are premultiplied by alpha, as with any image.RGBA.
+// After drawing into it directly, call Damage with the changed area.
+func (s *Surface) Image() *image.RGBA {
+	return s.img
+}
+
+// Paint calls fn to draw into the surface, and marks the
+// whole surface as damaged afterwards.
+func (s *Surface) Paint(fn func(dst draw.Image)) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	fn(s.img)
+	s.damage()
+}
+
+// Damage marks an area of the surface, in surface coordinates,
+// for repainting.
+func (s *Surface) Damage(r image.Rectangle) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	if s.removed || !s.visible {
+		return
+	}
+
+	r = r.Intersect(s.clip).Add(s.pos)
+	s.c.damage.add(r.Intersect(s.c.area))
+}
+
+// Bounds returns the area of the destination the surface image covers,
+// regardless of clipping and visibility.
+func (s *Surface) Bounds() image.Rectangle {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.img.Rect.Add(s.pos)
+}
+
+// Position returns the position of the surface on the destination.
+func (s *Surface) Position() image.Point {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.pos
+}
+
+// Move places the top-left corner of the surface at p.
+func (s *Surface) Move(p image.Point) {
+	s.update(func() { s.pos = p })
+}
+
+// Z returns the z-order of the surface.
+func (s *Surface) Z() int {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.z
+}
+
+// SetZ changes the z-order. Surfaces with a higher z-order are drawn
+// on top. Surfaces with equal z-order are drawn in order of creation.
+func (s *Surface) SetZ(z int) {
+	s.update(func() {
+		s.z = z
+		s.c.sort()
+	})
+}
+
+// Opacity returns the opacity of the surface.
+func (s *Surface) Opacity() uint8 {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.opacity
+}
+
+// SetOpacity sets the opacity, from 0 (transparent) to 255 (opaque).
+// It scales the alpha of each pixel.
+func (s *Surface) SetOpacity(a uint8) {
+	s.update(func() { s.opacity = a })
+}
+
+// Visible returns true if the surface is shown.
+func (s *Surface) Visible() bool {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.visible
+}
+
+// SetVisible shows or hides the surface.
+func (s *Surface) SetVisible(v bool) {
+	s.update(func() { s.visible = v })
+}
+
+// Clip returns the clip rectangle, in surface coordinates.
+func (s *Surface) Clip() image.Rectangle {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.clip
+}
+
+// SetClip limits drawing to the given part of the surface, in surface
+// coordinates. An empty rectangle hides the surface; the full image
+// bounds remove the clip.
+func (s *Surface) SetClip(r image.Rectangle) {
+	s.update(func() { s.clip = r.Intersect(s.img.Rect) })
+}
+
+// Remove takes the surface out of the compositor.
+// It must not be used afterwards.
+func (s *Surface) Remove() {
+	s.update(func() {
+		s.c.remove(s)
+		s.removed = true
+	})
+}
+
+// update applies a change to the surface properties,
+// damaging the area covered before and after.
+func (s *Surface) update(fn func()) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	if s.removed {
+		return
+	}
+
+	s.damage()
+	fn()
+	s.damage()
+}
+
+// damage marks the area the surface currently covers.
+func (s *Surface) damage() {
+	if s.removed || !s.visible {
+		return
+	}
+	s.c.damage.add(s.area().Intersect(s.c.area))
+}
+
+// area returns the part of the destination the surface draws to.
+func (s *Surface) area() image.Rectangle {
+	return s.clip.Add(s.pos)
+}
@@ -0,0 +1,288 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// Flags for OpenConsole.
+const (
+	// ConsoleNewVT makes OpenConsole allocate an unused virtual terminal
+	// and switch to it, rather than drawing on the terminal the process
+	// is running on. The original terminal is activated again on Close.
+	ConsoleNewVT = 1 << iota
+)
+
+// procStat is the location of the process status file. It is
+// used to find the controlling terminal of the current process.
+var procStat = "/proc/self/stat"
+
+// VTError is returned when a terminal can not be used to control
+// the console, because it is not a Linux virtual terminal. This is
+// the case when running from a terminal emulator or over ssh.
+type VTError struct {
+	TTY    string // Name of the terminal which was examined, if any.
+	Reason string // Explanation of why it can not be used.
+}
+
+func (e *VTError) Error() string {
+	if e.TTY == "" {
+		return "framebuffer: no virtual terminal: " + e.Reason
+	}
+
+	return fmt.Sprintf("framebuffer: %s is not a virtual terminal: %s", e.TTY, e.Reason)
+}
+
+// OpenConsole opens the framebuffer with the given display mode and
+// takes control of the virtual terminal the process is running on.
+//
+// Unlike Open, the caller does not need to supply a tty. The console is
+// located through the controlling terminal of the current process. If
+// the process has no controlling terminal, the currently active virtual
+// terminal is used. If the process is attached to something other than
+// a virtual terminal, such as a pseudo-terminal, a *VTError is returned.
+//
+// With the ConsoleNewVT flag, an unused virtual terminal is allocated and
+// activated instead. This also works from a terminal emulator, provided
+// the user has sufficient permissions on /dev/tty0.
+//
+// Close switches back to the virtual terminal which was active when
+// OpenConsole was called.
+func OpenConsole(dm *DisplayMode, flags int) (*Canvas, error) {
+	var tty *os.File
+	var err error
+
+	if flags&ConsoleNewVT != 0 {
+		tty, err = allocConsole()
+	} else {
+		tty, err = findConsole()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Canvas)
+	c.tty = tty
+	c.ownTTY = true
+	c.newVT = flags&ConsoleNewVT != 0
+
+	err = c.open(dm)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// findConsole opens the virtual terminal which controls the current
+// process. If there is none, the active virtual terminal is opened.
+func findConsole() (*os.File, error) {
+	dev, err := controllingTTY()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	if dev == 0 {
+		n, err = activeConsole()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		major, minor := splitDev(dev)
+		if major != _TTY_MAJOR || minor == 0 || minor > _MAX_NR_CONSOLES {
+			return nil, &VTError{
+				TTY:    ttyName(major, minor),
+				Reason: ttyReason(major, minor),
+			}
+		}
+		n = int(minor)
+	}
+
+	name := fmt.Sprintf(ttynr, n)
+	tty, err := openDevice(name, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+
+	return tty, nil
+}
+
+// allocConsole finds an unused virtual terminal and opens it.
+func allocConsole() (*os.File, error) {
+	name := fmt.Sprintf(ttynr, 0)
+	fd, err := openDevice(name, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fd.Close()
+
+	var n int32
+	err = ioctl(fd.Fd(), _VT_OPENQRY, unsafe.Pointer(&n))
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 1 {
+		return nil, &VTError{TTY: name, Reason: "all virtual terminals are in use"}
+	}
+
+	name = fmt.Sprintf(ttynr, n)
+	tty, err := openDevice(name, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+
+	return tty, nil
+}
+
+// freeConsole releases a virtual terminal obtained through allocConsole.
+// It must no longer be active or opened by anyone.
+func freeConsole(n int) error {
+	name := fmt.Sprintf(ttynr, 0)
+	fd, err := openDevice(name, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+	return ioctl(fd.Fd(), _VT_DISALLOCATE, n)
+}
+
+// activeConsole returns the number of the currently active virtual terminal.
+func activeConsole() (int, error) {
+	name := fmt.Sprintf(ttynr, 0)
+	fd, err := openDevice(name, os.O_WRONLY)
+	if err != nil {
+		if errors.Is(err, ErrNoDevice) {
+			return 0, &VTError{Reason: "the system has no virtual terminals"}
+		}
+		return 0, err
+	}
+
+	defer fd.Close()
+
+	var vts vtStat
+	err = ioctl(fd.Fd(), _VT_GETSTATE, unsafe.Pointer(&vts))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(vts.vActive), nil
+}
+
+// controllingTTY returns the device number of the controlling terminal
+// of the current process, or 0 if it has none.
+func controllingTTY() (uint64, error) {
+	data, err := os.ReadFile(procStat)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseTTYNr(data)
+}
+
+// parseTTYNr extracts the tty_nr field from the contents of /proc/<pid>/stat.
+func parseTTYNr(data []byte) (uint64, error) {
+	// The command name is enclosed in parentheses and may itself
+	// contain spaces and parentheses. Fields resume after the last one.
+	n := bytes.LastIndexByte(data, ')')
+	if n == -1 {
+		return 0, errors.New("parseTTYNr: malformed process status")
+	}
+
+	// Remaining fields: state ppid pgrp session tty_nr ...
+	fields := bytes.Fields(data[n+1:])
+	if len(fields) < 5 {
+		return 0, errors.New("parseTTYNr: malformed process status")
+	}
+
+	v, err := strconv.ParseInt(string(fields[4]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(uint32(v)), nil
+}
+
+// splitDev splits a device number into its major and minor parts.
+func splitDev(dev uint64) (major, minor uint32) {
+	major = uint32((dev>>8)&0xfff) | uint32(dev>>32)&^0xfff
+	minor = uint32(dev&0xff) | uint32(dev>>12)&^0xff
+	return
+}
+
+// vtNumber returns the number of the virtual terminal the given file
+// refers to. It returns 0 if this can not be determined from the device
+// alone, as is the case for /dev/tty0 and /dev/console.
+func vtNumber(f *os.File) int {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	major, minor := splitDev(uint64(st.Rdev))
+	if major != _TTY_MAJOR || minor > _MAX_NR_CONSOLES {
+		return 0
+	}
+
+	return int(minor)
+}
+
+// notVT builds a VTError for a tty which failed a virtual terminal ioctl.
+func notVT(f *os.File) error {
+	reason := "it does not support virtual terminal control"
+
+	fi, err := f.Stat()
+	if err == nil {
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && fi.Mode()&os.ModeCharDevice != 0 {
+			reason = ttyReason(splitDev(uint64(st.Rdev)))
+		} else {
+			reason = "it is not a terminal device"
+		}
+	}
+
+	return &VTError{TTY: f.Name(), Reason: reason}
+}
+
+// ttyName returns a likely device name for a non-console terminal.
+func ttyName(major, minor uint32) string {
+	switch {
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("/dev/pts/%d", (major-136)<<8|minor)
+	case major == _TTY_MAJOR && minor > _MAX_NR_CONSOLES:
+		return fmt.Sprintf("/dev/ttyS%d", minor-64)
+	}
+
+	return fmt.Sprintf("device %d:%d", major, minor)
+}
+
+// ttyReason explains why the terminal with the given device
+// numbers is not a virtual terminal.
+func ttyReason(major, minor uint32) string {
+	switch {
+	case major >= 136 && major <= 143:
+		return "it is a pseudo-terminal, as used by terminal emulators and remote logins"
+	case major == _TTY_MAJOR && minor > _MAX_NR_CONSOLES:
+		return "it is a serial port"
+	case major == 5 && minor == 1:
+		return "the system console is not attached to a virtual terminal"
+	}
+
+	return fmt.Sprintf("device %d:%d does not support virtual terminal control", major, minor)
+}
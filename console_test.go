@@ -0,0 +1,33 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import "testing"
+
+func TestParseTTYNr(t *testing.T) {
+	for _, tc := range []struct {
+		stat  string
+		major uint32
+		minor uint32
+	}{
+		{"1234 (app) S 1 1234 1234 1026 1234 4194304", 4, 2},
+		{"1234 (my (odd) app) S 1 1234 1234 34816 1234 0", 136, 0},
+		{"1234 (daemon) S 1 1234 1234 0 -1 1077936448", 0, 0},
+	} {
+		dev, err := parseTTYNr([]byte(tc.stat))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.stat, err)
+		}
+
+		major, minor := splitDev(dev)
+		if major != tc.major || minor != tc.minor {
+			t.Errorf("%q: have %d:%d, want %d:%d", tc.stat, major, minor, tc.major, tc.minor)
+		}
+	}
+
+	_, err := parseTTYNr([]byte("garbage"))
+	if err == nil {
+		t.Errorf("expected error for malformed input")
+	}
+}
@@ -0,0 +1,184 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// sysGraphics is the sysfs directory which holds the framebuffer
+// class devices. It supplies information which is not available
+// through the device itself, like the name of the driver.
+var sysGraphics = "/sys/class/graphics"
+
+// Device describes a single framebuffer device present in the system.
+type Device struct {
+	Path     string       // Device node, for use with OpenDevice.
+	Index    int          // Framebuffer number.
+	ID       string       // Identification string (e.g.: "inteldrmfb").
+	Driver   string       // Name of the kernel driver, if known.
+	Mode     *DisplayMode // Current display mode. Nil if the device can not be read.
+	Consoles []int        // Virtual terminals mapped to this framebuffer.
+}
+
+// ListDevices returns all framebuffer devices present in the system,
+// ordered by their framebuffer number.
+//
+// This can be called without opening any framebuffer. Devices which
+// can not be opened by the current user are still listed, but with
+// incomplete information. If none of them could be opened, the first
+// error is returned along with the list, such as ErrPermission.
+func ListDevices() ([]*Device, error) {
+	var list []*Device
+	var c2m []uint32
+	var first error
+	var opened bool
+
+	fail := func(err error) {
+		if first == nil && !errors.Is(err, os.ErrNotExist) {
+			first = err
+		}
+	}
+
+	for n := 0; n < _MAX; n++ {
+		path := fmt.Sprintf(fbnr, n)
+		if _, err := os.Stat(path); err != nil {
+			fail(err)
+			continue
+		}
+
+		dev := &Device{Path: path, Index: n}
+		sys := filepath.Join(sysGraphics, fmt.Sprintf("fb%d", n))
+
+		if data, err := os.ReadFile(filepath.Join(sys, "name")); err == nil {
+			dev.ID = strings.TrimSpace(string(data))
+		} else {
+			fail(err)
+		}
+
+		if link, err := os.Readlink(filepath.Join(sys, "device", "driver")); err == nil {
+			dev.Driver = filepath.Base(link)
+		} else {
+			fail(err)
+		}
+
+		fd, err := openDevice(path, os.O_RDONLY)
+		if err != nil {
+			fail(err)
+		} else {
+			opened = true
+
+			var fi fbFixScreenInfo
+			var vi fbVarScreenInfo
+
+			if ioctl(fd.Fd(), _IOGET_FSCREENINFO, unsafe.Pointer(&fi)) == nil &&
+				ioctl(fd.Fd(), _IOGET_VSCREENINFO, unsafe.Pointer(&vi)) == nil {
+				dev.Mode = newDisplayMode(&vi, fi.accel != _ACCEL_NONE)
+
+				if dev.ID == "" {
+					dev.ID = string(bytes.TrimRight(fi.id[:], "\x00"))
+				}
+			}
+
+			// The console mapping is global. Any device can tell us.
+			if c2m == nil {
+				c2m = readCon2FBMap(fd)
+			}
+
+			fd.Close()
+		}
+
+		list = append(list, dev)
+	}
+
+	for _, dev := range list {
+		for con, fb := range c2m {
+			if con > 0 && int(fb) == dev.Index {
+				dev.Consoles = append(dev.Consoles, con)
+			}
+		}
+	}
+
+	if !opened && first != nil {
+		return list, first
+	}
+
+	return list, nil
+}
+
+// QueryDevice returns the current display mode and the capabilities
+// of the given framebuffer device. Unlike OpenDevice, it neither
+// clears the screen nor moves the viewport, so it can be used on a
+// display which is showing something else.
+func QueryDevice(dev string) (*DisplayMode, *Capabilities, error) {
+	fd, err := openDevice(dev, os.O_RDWR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer fd.Close()
+
+	c := &Canvas{dev: dev, fd: fd}
+	err = c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&c.origFi))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cp, err := c.Capabilities()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mode, cp, nil
+}
+
+// readCon2FBMap reads the framebuffer numbers for all virtual terminals.
+// The result is indexed by console number. Console 0 is unused.
+// Returns nil if the mapping is not available.
+func readCon2FBMap(fd *os.File) []uint32 {
+	list := make([]uint32, _MAX_NR_CONSOLES+1)
+
+	for con := 1; con < len(list); con++ {
+		var c2m fb_con2fbmap
+		c2m.console = uint32(con)
+
+		if ioctl(fd.Fd(), _IOGET_CON2FBMAP, unsafe.Pointer(&c2m)) != nil {
+			return nil
+		}
+
+		list[con] = c2m.framebuffer
+	}
+
+	return list
+}
+
+// MapConsole maps the given virtual terminal to framebuffer fb.
+// The text console on that terminal will be drawn on the new
+// framebuffer from then on. This requires CAP_SYS_TTY_CONFIG.
+func MapConsole(console, fb int) error {
+	path := fmt.Sprintf(fbnr, fb)
+	fd, err := openDevice(path, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+
+	defer fd.Close()
+
+	var c2m fb_con2fbmap
+	c2m.console = uint32(console)
+	c2m.framebuffer = uint32(fb)
+
+	return ioctl(fd.Fd(), _IOPUT_CON2FBMAP, unsafe.Pointer(&c2m))
+}
@@ -0,0 +1,163 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestListDevices(t *testing.T) {
+	s := newFakeSystem(t)
+	s.addFB(0, "inteldrmfb", "i915", 64, 48, 32)
+	s.addFB(1, "fb_ili9341", "fb_ili9341", 32, 24, 16)
+
+	for con := 1; con <= _MAX_NR_CONSOLES; con++ {
+		s.con2fb[con] = 0
+	}
+	s.con2fb[7] = 1
+
+	list, err := ListDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("have %d devices, want 2", len(list))
+	}
+
+	fb1 := list[1]
+	if fb1.Index != 1 || fb1.ID != "fb_ili9341" || fb1.Driver != "fb_ili9341" {
+		t.Errorf("unexpected device: %+v", fb1)
+	}
+
+	if fb1.Mode == nil || fb1.Mode.Geometry.XRes != 32 || fb1.Mode.Format.Type() != PF_RGB_565 {
+		t.Errorf("unexpected mode: %+v", fb1.Mode)
+	}
+
+	if !reflect.DeepEqual(fb1.Consoles, []int{7}) {
+		t.Errorf("fb1 consoles: have %v, want [7]", fb1.Consoles)
+	}
+
+	if len(list[0].Consoles) != _MAX_NR_CONSOLES-1 {
+		t.Errorf("fb0 consoles: have %d, want %d", len(list[0].Consoles), _MAX_NR_CONSOLES-1)
+	}
+}
+
+func TestListDevicesError(t *testing.T) {
+	s := newFakeSystem(t)
+
+	// No devices is not an error.
+	if list, err := ListDevices(); len(list) != 0 || err != nil {
+		t.Fatalf("have %d devices, %v", len(list), err)
+	}
+
+	// A device which can not be looked at is.
+	path := fmt.Sprintf(fbnr, 0)
+	os.Symlink(path, path)
+
+	if _, err := ListDevices(); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("have %v, want ELOOP", err)
+	}
+
+	// As long as one can be opened, the list is complete enough.
+	s.addFB(1, "fb1", "drv", 8, 8, 32)
+	if list, err := ListDevices(); len(list) != 1 || err != nil {
+		t.Errorf("have %d devices, %v", len(list), err)
+	}
+}
+
+func TestQueryDevice(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 8, 4, 32)
+	fb.vi.yoffset = 4
+
+	pix := bytes.Repeat([]byte{0x5a}, int(fb.fi.smemlen))
+	os.WriteFile(fb.path, pix, 0644)
+
+	mode, cp, err := QueryDevice(fb.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode.Geometry.XRes != 8 || cp.Visual != VisualTrueColor {
+		t.Errorf("mode %+v, capabilities %+v", mode, cp)
+	}
+
+	// What is displayed must be left alone.
+	if data, _ := os.ReadFile(fb.path); !bytes.Equal(data, pix) || fb.vi.yoffset != 4 {
+		t.Errorf("display changed, offset %d", fb.vi.yoffset)
+	}
+
+	if _, _, err := QueryDevice(fb.path + "9"); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("missing device: have %v, want ErrNoDevice", err)
+	}
+}
+
+func TestMapConsole(t *testing.T) {
+	s := newFakeSystem(t)
+	s.addFB(0, "fb0", "drv", 8, 8, 32)
+	s.addFB(1, "fb1", "drv", 8, 8, 32)
+
+	err := MapConsole(3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := ListDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(list[1].Consoles, []int{3}) {
+		t.Errorf("fb1 consoles: have %v, want [3]", list[1].Consoles)
+	}
+}
+
+func TestOpenDevices(t *testing.T) {
+	s := newFakeSystem(t)
+	fb0 := s.addFB(0, "fb0", "drv", 16, 8, 32)
+	fb1 := s.addFB(1, "fb1", "drv", 8, 4, 16)
+
+	c0, err := OpenDevice(fb0.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c0.Close()
+
+	c1, err := OpenDevice(fb1.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	img, err := c0.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := img.(*BGRA); !ok {
+		t.Errorf("fb0: have %T, want *BGRA", img)
+	}
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for i, b := range c1.Buffer() {
+		if b != 0 {
+			t.Fatalf("fb1 byte %d modified by drawing on fb0", i)
+		}
+	}
+
+	if len(c0.Buffer()) == len(c1.Buffer()) {
+		t.Errorf("devices share a buffer size")
+	}
+}
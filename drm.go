@@ -0,0 +1,542 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// dri0 is the first DRM device.
+var dri0 = "/dev/dri/card0"
+
+// sysRead reads events from a DRM device. It is a variable, so
+// tests can substitute an emulated device.
+var sysRead = func(fd uintptr, p []byte) (int, error) {
+	return syscall.Read(int(fd), p)
+}
+
+// OpenDRM opens a DRM/KMS device, such as /dev/dri/card0, and returns
+// a canvas for it. This works on systems whose kernel no longer offers
+// framebuffer devices. An empty dev opens /dev/dri/card0.
+//
+// The first connected display is used, in the mode of dm with the same
+// visible resolution, or its preferred mode if dm is nil. A depth of 16
+// in dm selects RGB565 pixels; otherwise they are 32-bit XRGB.
+//
+// Pixels live in a dumb buffer with room for two screens, so BackBuffer
+// and Flip work as they do with a framebuffer which can pan; Flip waits
+// for the page flip to complete. Modes returns the modes the display
+// supports. The tty is handled as by Open.
+func OpenDRM(dev string, dm *DisplayMode, tty *os.File) (*Canvas, error) {
+	if dev == "" {
+		dev = dri0
+	}
+
+	d, err := openDRM(dev, dm)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Canvas{
+		dev:  dev,
+		tty:  tty,
+		virt: d,
+		mem:  d.mem,
+	}
+
+	if err := c.open(nil); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// drmDevice emulates a framebuffer device on top of a DRM device.
+type drmDevice struct {
+	fd        *os.File
+	fi        fbFixScreenInfo
+	vi        fbVarScreenInfo
+	modeList  []*DisplayMode
+	connector uint32
+	encoders  []uint32 // Encoders of the connector.
+	crtcs     []uint32 // CRTCs of the device.
+	crtc      uint32
+	origCrtc  drmModeCrtc // CRTC configuration to restore.
+	handle    uint32      // Dumb buffer.
+	fbs       []uint32    // Framebuffer of each page.
+	mem       []byte
+}
+
+// ioctlDRM performs a DRM request.
+func (d *drmDevice) ioctlDRM(name int, p unsafe.Pointer) error {
+	return ioctl(d.fd.Fd(), uintptr(name), p)
+}
+
+// openDRM opens the DRM device dev, and shows a dumb buffer on its
+// first connected display. On failure, everything acquired is
+// released again.
+func openDRM(dev string, dm *DisplayMode) (_ *drmDevice, err error) {
+	d := new(drmDevice)
+
+	d.fd, err = openDevice(dev, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			d.close()
+			err = fmt.Errorf("%s: %w", dev, err)
+		}
+	}()
+
+	// Only the master may set modes. The first process to open the
+	// device becomes master anyway; this takes over after others left.
+	ioctl(d.fd.Fd(), uintptr(_DRM_IOCTL_SET_MASTER), 0)
+
+	dumb := drmGetCap{capability: _DRM_CAP_DUMB_BUFFER}
+	if err = d.ioctlDRM(_DRM_IOCTL_GET_CAP, unsafe.Pointer(&dumb)); err != nil {
+		return nil, err
+	}
+	if dumb.value == 0 {
+		return nil, errors.New("framebuffer: DRM device has no dumb buffers")
+	}
+
+	conn, modes, err := d.findConnector()
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := pickMode(modes, dm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.findCrtc(conn); err != nil {
+		return nil, err
+	}
+
+	d.origCrtc.crtcID = d.crtc
+	if err = d.ioctlDRM(_DRM_IOCTL_MODE_GETCRTC, unsafe.Pointer(&d.origCrtc)); err != nil {
+		return nil, err
+	}
+
+	depth := 32
+	if dm != nil && dm.Geometry.Depth == 16 {
+		depth = 16
+	}
+
+	if err = d.allocate(mode, depth); err != nil {
+		return nil, err
+	}
+
+	// Show the first page.
+	crtc := drmModeCrtc{
+		crtcID:           d.crtc,
+		fbID:             d.fbs[0],
+		setConnectorsPtr: uint64(uintptr(unsafe.Pointer(&d.connector))),
+		countConnectors:  1,
+		modeValid:        1,
+		mode:             *mode,
+	}
+	if err = d.ioctlDRM(_DRM_IOCTL_MODE_SETCRTC, unsafe.Pointer(&crtc)); err != nil {
+		return nil, err
+	}
+
+	for i := range modes {
+		d.modeList = append(d.modeList, drmDisplayMode(&modes[i], depth))
+	}
+
+	return d, nil
+}
+
+// findConnector finds the first connected connector with modes,
+// and returns it along with its modes.
+func (d *drmDevice) findConnector() (*drmModeGetConnector, []drmModeInfo, error) {
+	var res drmModeCardRes
+	if err := d.ioctlDRM(_DRM_IOCTL_MODE_GETRESOURCES, unsafe.Pointer(&res)); err != nil {
+		return nil, nil, err
+	}
+
+	crtcs := make([]uint32, res.countCrtcs)
+	conns := make([]uint32, res.countConns)
+	res = drmModeCardRes{
+		crtcIDPtr:      sliceAddr(crtcs),
+		connectorIDPtr: sliceAddr(conns),
+		countCrtcs:     uint32(len(crtcs)),
+		countConns:     uint32(len(conns)),
+	}
+	err := d.ioctlDRM(_DRM_IOCTL_MODE_GETRESOURCES, unsafe.Pointer(&res))
+	runtime.KeepAlive(crtcs)
+	runtime.KeepAlive(conns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.crtcs = crtcs[:min(len(crtcs), int(res.countCrtcs))]
+
+	for _, id := range conns[:min(len(conns), int(res.countConns))] {
+		// Asking for the number of modes probes the display.
+		conn := drmModeGetConnector{connectorID: id}
+		if err := d.ioctlDRM(_DRM_IOCTL_MODE_GETCONNECTOR, unsafe.Pointer(&conn)); err != nil {
+			return nil, nil, err
+		}
+
+		if conn.connection != _DRM_MODE_CONNECTED || conn.countModes == 0 {
+			continue
+		}
+
+		modes := make([]drmModeInfo, conn.countModes)
+		encoders := make([]uint32, max(conn.countEncoders, 1))
+		conn = drmModeGetConnector{
+			connectorID:   id,
+			modesPtr:      sliceAddr(modes),
+			countModes:    uint32(len(modes)),
+			encodersPtr:   sliceAddr(encoders),
+			countEncoders: uint32(len(encoders)),
+		}
+		err := d.ioctlDRM(_DRM_IOCTL_MODE_GETCONNECTOR, unsafe.Pointer(&conn))
+		runtime.KeepAlive(modes)
+		runtime.KeepAlive(encoders)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		d.connector = id
+		d.encoders = encoders[:min(len(encoders), int(conn.countEncoders))]
+		return &conn, modes[:min(len(modes), int(conn.countModes))], nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: no connected display", ErrNoDevice)
+}
+
+// sliceAddr returns the address of the elements of s, as the kernel
+// expects it in pointer fields.
+func sliceAddr[T any](s []T) uint64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return uint64(uintptr(unsafe.Pointer(&s[0])))
+}
+
+// findCrtc finds a CRTC for the connector: the one it is already
+// connected to, or the first its encoders can drive.
+func (d *drmDevice) findCrtc(conn *drmModeGetConnector) error {
+	encoders := d.encoders
+	if conn.encoderID != 0 {
+		encoders = append([]uint32{conn.encoderID}, encoders...)
+	}
+
+	for _, id := range encoders {
+		enc := drmModeGetEncoder{encoderID: id}
+		if err := d.ioctlDRM(_DRM_IOCTL_MODE_GETENCODER, unsafe.Pointer(&enc)); err != nil {
+			return err
+		}
+
+		if enc.crtcID != 0 {
+			d.crtc = enc.crtcID
+			return nil
+		}
+
+		for i, crtc := range d.crtcs {
+			if enc.possibleCrtcs&(1<<i) != 0 {
+				d.crtc = crtc
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: no CRTC for the display", ErrNoDevice)
+}
+
+// pickMode returns the mode with the visible resolution of dm, and the
+// same name if it has one, or the preferred mode if dm is nil.
+func pickMode(modes []drmModeInfo, dm *DisplayMode) (*drmModeInfo, error) {
+	if dm == nil {
+		for i := range modes {
+			if modes[i].typ&_DRM_MODE_TYPE_PREFERRED != 0 {
+				return &modes[i], nil
+			}
+		}
+		return &modes[0], nil
+	}
+
+	for i := range modes {
+		m := &modes[i]
+		if int(m.hdisplay) == dm.Geometry.XRes && int(m.vdisplay) == dm.Geometry.YRes &&
+			(dm.Name == "" || dm.Name == cString(m.name[:])) {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("framebuffer: display has no %dx%d mode", dm.Geometry.XRes, dm.Geometry.YRes)
+}
+
+// allocate creates a dumb buffer with room for two screens in the
+// given mode, and a framebuffer for each, and maps it. If the driver
+// can not allocate that much, there is only one.
+func (d *drmDevice) allocate(mode *drmModeInfo, depth int) error {
+	w, h := uint32(mode.hdisplay), uint32(mode.vdisplay)
+
+	format := uint32(_DRM_FORMAT_XRGB8888)
+	if depth == 16 {
+		format = _DRM_FORMAT_RGB565
+	}
+
+	var dumb drmModeCreateDumb
+	pages := 2
+
+	for ; pages > 0; pages-- {
+		dumb = drmModeCreateDumb{width: w, height: h * uint32(pages), bpp: uint32(depth)}
+		err := d.ioctlDRM(_DRM_IOCTL_MODE_CREATE_DUMB, unsafe.Pointer(&dumb))
+		if err == nil {
+			break
+		}
+		if pages == 1 {
+			return err
+		}
+	}
+	d.handle = dumb.handle
+
+	for page := 0; page < pages; page++ {
+		fb := drmModeFbCmd2{width: w, height: h, pixelFormat: format}
+		fb.handles[0] = dumb.handle
+		fb.pitches[0] = dumb.pitch
+		fb.offsets[0] = uint32(page) * dumb.pitch * h
+
+		if err := d.ioctlDRM(_DRM_IOCTL_MODE_ADDFB2, unsafe.Pointer(&fb)); err != nil {
+			return err
+		}
+		d.fbs = append(d.fbs, fb.fbID)
+	}
+
+	mapDumb := drmModeMapDumb{handle: dumb.handle}
+	if err := d.ioctlDRM(_DRM_IOCTL_MODE_MAP_DUMB, unsafe.Pointer(&mapDumb)); err != nil {
+		return err
+	}
+
+	mem, err := syscall.Mmap(int(d.fd.Fd()), int64(mapDumb.offset), int(dumb.size),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("mmap: %w", err)
+	}
+	d.mem = mem
+
+	// Describe it as a framebuffer device would.
+	dm := drmDisplayMode(mode, depth)
+	dm.Geometry.YVRes = pages * dm.Geometry.YRes
+	d.vi.setMode(dm)
+
+	d.fi.typ = _TYPE_PACKED_PIXELS
+	d.fi.visual = _VISUAL_TRUECOLOR
+	d.fi.lineLength = dumb.pitch
+	d.fi.smemlen = uint32(len(mem))
+	d.fi.ypanstep = uint16(h)
+	copy(d.fi.id[:], "drm")
+	return nil
+}
+
+// drmDisplayMode converts a DRM mode.
+func drmDisplayMode(m *drmModeInfo, depth int) *DisplayMode {
+	var dm DisplayMode
+	dm.Name = cString(m.name[:])
+	dm.Geometry = Geometry{
+		XRes: int(m.hdisplay), YRes: int(m.vdisplay),
+		XVRes: int(m.hdisplay), YVRes: int(m.vdisplay),
+		Depth: depth,
+	}
+
+	if m.clock > 0 {
+		dm.Timings.Pixclock = int(1e9 / m.clock)
+	}
+	dm.Timings.Left = int(m.htotal) - int(m.hsyncEnd)
+	dm.Timings.Right = int(m.hsyncStart) - int(m.hdisplay)
+	dm.Timings.HSLen = int(m.hsyncEnd) - int(m.hsyncStart)
+	dm.Timings.Upper = int(m.vtotal) - int(m.vsyncEnd)
+	dm.Timings.Lower = int(m.vsyncStart) - int(m.vdisplay)
+	dm.Timings.VSLen = int(m.vsyncEnd) - int(m.vsyncStart)
+
+	if m.flags&_DRM_MODE_FLAG_PHSYNC != 0 {
+		dm.Sync |= SyncHorHighAct
+	}
+	if m.flags&_DRM_MODE_FLAG_PVSYNC != 0 {
+		dm.Sync |= SyncVertHighAct
+	}
+	if m.flags&_DRM_MODE_FLAG_INTERLACE != 0 {
+		dm.VMode |= VModeInterlaced
+	}
+	if m.flags&_DRM_MODE_FLAG_DBLSCAN != 0 {
+		dm.VMode |= VModeDouble
+	}
+
+	if depth == 16 {
+		dm.Format = PixelFormat{Depth: 16, RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5}
+	} else {
+		dm.Format = PixelFormat{Depth: 32, RedBits: 8, RedShift: 16, GreenBits: 8, GreenShift: 8, BlueBits: 8}
+	}
+
+	return &dm
+}
+
+// cString returns the string in b, up to the first NUL byte.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// ioctl implements the framebuffer requests a canvas makes for
+// drawing. Others fail as they would on a device which does not
+// support them.
+func (d *drmDevice) ioctl(name uintptr, data interface{}) error {
+	p, _ := data.(unsafe.Pointer)
+	fail := func(errno syscall.Errno) error {
+		return &IoctlError{Op: ioctlName(name), Request: name, Errno: errno}
+	}
+
+	switch name {
+	case _IOGET_FSCREENINFO:
+		*(*fbFixScreenInfo)(p) = d.fi
+
+	case _IOGET_VSCREENINFO:
+		*(*fbVarScreenInfo)(p) = d.vi
+
+	case _IOPUT_VSCREENINFO:
+		// The mode is chosen by OpenDRM; only the page may change.
+		v := (*fbVarScreenInfo)(p)
+		if v.xres != d.vi.xres || v.yres != d.vi.yres ||
+			v.xresVirtual != d.vi.xresVirtual || v.yresVirtual != d.vi.yresVirtual ||
+			v.bitsPerPixel != d.vi.bitsPerPixel {
+			return fail(syscall.EINVAL)
+		}
+
+		if v.activate&_ACTIVATE_MASK != _ACTIVATE_TEST {
+			return d.pan(v)
+		}
+
+	case _IOPAN_DISPLAY:
+		return d.pan((*fbVarScreenInfo)(p))
+
+	default:
+		return fail(syscall.ENOTTY)
+	}
+
+	return nil
+}
+
+// pan shows the page at the offsets of v, and waits until it is
+// on screen.
+func (d *drmDevice) pan(v *fbVarScreenInfo) error {
+	page := int(v.yoffset / d.vi.yres)
+	if v.xoffset != 0 || v.yoffset%d.vi.yres != 0 || page >= len(d.fbs) {
+		return &IoctlError{Op: ioctlName(_IOPAN_DISPLAY), Request: _IOPAN_DISPLAY, Errno: syscall.EINVAL}
+	}
+
+	if v.yoffset == d.vi.yoffset {
+		return nil
+	}
+
+	flip := drmModeCrtcPageFlip{
+		crtcID:   d.crtc,
+		fbID:     d.fbs[page],
+		flags:    _DRM_MODE_PAGE_FLIP_EVENT,
+		userData: uint64(page),
+	}
+	if err := d.ioctlDRM(_DRM_IOCTL_MODE_PAGE_FLIP, unsafe.Pointer(&flip)); err != nil {
+		return err
+	}
+
+	if err := d.waitFlip(); err != nil {
+		return err
+	}
+
+	d.vi.yoffset = v.yoffset
+	return nil
+}
+
+// waitFlip reads events from the device until a page flip completed.
+func (d *drmDevice) waitFlip() error {
+	buf := make([]byte, 1024)
+
+	for {
+		n, err := sysRead(d.fd.Fd(), buf)
+		if err != nil {
+			return fmt.Errorf("framebuffer: reading DRM events: %w", err)
+		}
+
+		// A read returns whole events.
+		for b := buf[:n]; len(b) >= 8; {
+			var ev drmEvent
+			copy((*[unsafe.Sizeof(ev)]byte)(unsafe.Pointer(&ev))[:], b)
+			if ev.length < 8 || int(ev.length) > len(b) {
+				return errors.New("framebuffer: invalid DRM event")
+			}
+
+			if ev.typ == _DRM_EVENT_FLIP_COMPLETE {
+				return nil
+			}
+			b = b[ev.length:]
+		}
+	}
+}
+
+// modes returns the modes of the display.
+func (d *drmDevice) modes() []*DisplayMode {
+	modes := make([]*DisplayMode, len(d.modeList))
+	for i, m := range d.modeList {
+		mm := *m
+		modes[i] = &mm
+	}
+	return modes
+}
+
+// close restores the display, and releases the buffers and the device.
+func (d *drmDevice) close() error {
+	var err error
+
+	if d.origCrtc.crtcID != 0 && len(d.fbs) > 0 {
+		// Show what was shown before, or nothing.
+		crtc := d.origCrtc
+		if crtc.fbID != 0 && crtc.modeValid != 0 {
+			crtc.setConnectorsPtr = uint64(uintptr(unsafe.Pointer(&d.connector)))
+			crtc.countConnectors = 1
+		} else {
+			crtc = drmModeCrtc{crtcID: d.crtc}
+		}
+		err = d.ioctlDRM(_DRM_IOCTL_MODE_SETCRTC, unsafe.Pointer(&crtc))
+	}
+
+	for _, fb := range d.fbs {
+		id := fb
+		d.ioctlDRM(_DRM_IOCTL_MODE_RMFB, unsafe.Pointer(&id))
+	}
+	d.fbs = nil
+
+	if d.mem != nil {
+		syscall.Munmap(d.mem)
+		d.mem = nil
+	}
+
+	if d.handle != 0 {
+		destroy := drmModeDestroyDumb{handle: d.handle}
+		d.ioctlDRM(_DRM_IOCTL_MODE_DESTROY_DUMB, unsafe.Pointer(&destroy))
+		d.handle = 0
+	}
+
+	if d.fd != nil {
+		ioctl(d.fd.Fd(), uintptr(_DRM_IOCTL_DROP_MASTER), 0)
+		d.fd.Close()
+		d.fd = nil
+	}
+
+	return err
+}
@@ -0,0 +1,175 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import "unsafe"
+
+// Definitions from <drm/drm.h> and <drm/drm_mode.h>.
+
+const (
+	_DRM_CAP_DUMB_BUFFER = 0x1
+
+	_DRM_MODE_CONNECTED = 1
+
+	_DRM_MODE_TYPE_PREFERRED = 1 << 3
+
+	_DRM_MODE_FLAG_PHSYNC    = 1 << 0
+	_DRM_MODE_FLAG_PVSYNC    = 1 << 2
+	_DRM_MODE_FLAG_INTERLACE = 1 << 4
+	_DRM_MODE_FLAG_DBLSCAN   = 1 << 5
+
+	_DRM_MODE_PAGE_FLIP_EVENT = 0x01
+
+	_DRM_EVENT_FLIP_COMPLETE = 0x02
+
+	_DRM_FORMAT_RGB565   = 'R' | 'G'<<8 | '1'<<16 | '6'<<24
+	_DRM_FORMAT_XRGB8888 = 'X' | 'R'<<8 | '2'<<16 | '4'<<24
+)
+
+type drmGetCap struct {
+	capability uint64
+	value      uint64
+}
+
+type drmModeCardRes struct {
+	fbIDPtr        uint64
+	crtcIDPtr      uint64
+	connectorIDPtr uint64
+	encoderIDPtr   uint64
+	countFbs       uint32
+	countCrtcs     uint32
+	countConns     uint32
+	countEncoders  uint32
+	minWidth       uint32
+	maxWidth       uint32
+	minHeight      uint32
+	maxHeight      uint32
+}
+
+type drmModeInfo struct {
+	clock      uint32 // Pixel clock, in kHz.
+	hdisplay   uint16
+	hsyncStart uint16
+	hsyncEnd   uint16
+	htotal     uint16
+	hskew      uint16
+	vdisplay   uint16
+	vsyncStart uint16
+	vsyncEnd   uint16
+	vtotal     uint16
+	vscan      uint16
+	vrefresh   uint32
+	flags      uint32
+	typ        uint32
+	name       [32]byte
+}
+
+type drmModeCrtc struct {
+	setConnectorsPtr uint64
+	countConnectors  uint32
+	crtcID           uint32
+	fbID             uint32
+	x                uint32
+	y                uint32
+	gammaSize        uint32
+	modeValid        uint32
+	mode             drmModeInfo
+}
+
+type drmModeGetEncoder struct {
+	encoderID      uint32
+	encoderType    uint32
+	crtcID         uint32
+	possibleCrtcs  uint32
+	possibleClones uint32
+}
+
+type drmModeGetConnector struct {
+	encodersPtr     uint64
+	modesPtr        uint64
+	propsPtr        uint64
+	propValuesPtr   uint64
+	countModes      uint32
+	countProps      uint32
+	countEncoders   uint32
+	encoderID       uint32
+	connectorID     uint32
+	connectorType   uint32
+	connectorTypeID uint32
+	connection      uint32
+	mmWidth         uint32
+	mmHeight        uint32
+	subpixel        uint32
+	pad             uint32
+}
+
+type drmModeFbCmd2 struct {
+	fbID        uint32
+	width       uint32
+	height      uint32
+	pixelFormat uint32
+	flags       uint32
+	handles     [4]uint32
+	pitches     [4]uint32
+	offsets     [4]uint32
+	modifier    [4]uint64
+}
+
+type drmModeCrtcPageFlip struct {
+	crtcID   uint32
+	fbID     uint32
+	flags    uint32
+	reserved uint32
+	userData uint64
+}
+
+type drmModeCreateDumb struct {
+	height uint32
+	width  uint32
+	bpp    uint32
+	flags  uint32
+	handle uint32
+	pitch  uint32
+	size   uint64
+}
+
+type drmModeMapDumb struct {
+	handle uint32
+	pad    uint32
+	offset uint64
+}
+
+type drmModeDestroyDumb struct {
+	handle uint32
+}
+
+// drmEvent is struct drm_event_vblank, which is read from the
+// device after a page flip.
+type drmEvent struct {
+	typ      uint32
+	length   uint32
+	userData uint64
+	tvSec    uint32
+	tvUsec   uint32
+	sequence uint32
+	crtcID   uint32
+}
+
+// DRM ioctl values.
+var (
+	_DRM_IOCTL_SET_MASTER        = _IO('d', 0x1e)
+	_DRM_IOCTL_DROP_MASTER       = _IO('d', 0x1f)
+	_DRM_IOCTL_GET_CAP           = _IOWR('d', 0x0c, int(unsafe.Sizeof(drmGetCap{})))
+	_DRM_IOCTL_MODE_GETRESOURCES = _IOWR('d', 0xa0, int(unsafe.Sizeof(drmModeCardRes{})))
+	_DRM_IOCTL_MODE_GETCRTC      = _IOWR('d', 0xa1, int(unsafe.Sizeof(drmModeCrtc{})))
+	_DRM_IOCTL_MODE_SETCRTC      = _IOWR('d', 0xa2, int(unsafe.Sizeof(drmModeCrtc{})))
+	_DRM_IOCTL_MODE_GETENCODER   = _IOWR('d', 0xa6, int(unsafe.Sizeof(drmModeGetEncoder{})))
+	_DRM_IOCTL_MODE_GETCONNECTOR = _IOWR('d', 0xa7, int(unsafe.Sizeof(drmModeGetConnector{})))
+	_DRM_IOCTL_MODE_RMFB         = _IOWR('d', 0xaf, 4) // 4 = sizeof(uint32)
+	_DRM_IOCTL_MODE_PAGE_FLIP    = _IOWR('d', 0xb0, int(unsafe.Sizeof(drmModeCrtcPageFlip{})))
+	_DRM_IOCTL_MODE_CREATE_DUMB  = _IOWR('d', 0xb2, int(unsafe.Sizeof(drmModeCreateDumb{})))
+	_DRM_IOCTL_MODE_MAP_DUMB     = _IOWR('d', 0xb3, int(unsafe.Sizeof(drmModeMapDumb{})))
+	_DRM_IOCTL_MODE_DESTROY_DUMB = _IOWR('d', 0xb4, int(unsafe.Sizeof(drmModeDestroyDumb{})))
+	_DRM_IOCTL_MODE_ADDFB2       = _IOWR('d', 0xb8, int(unsafe.Sizeof(drmModeFbCmd2{})))
+)
@@ -0,0 +1,185 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"testing"
+)
+
+func TestOpenDRM(t *testing.T) {
+	d := newFakeDRM(t,
+		fakeMode(640, 480, "640x480", false),
+		fakeMode(320, 240, "320x240", true),
+		fakeMode(160, 120, "160x120", false),
+	)
+
+	c, err := OpenDRM("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The preferred mode, in XRGB, with two pages.
+	mode, err := c.CurrentMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode.Geometry != (Geometry{320, 240, 320, 480, 32}) || mode.Format.Type() != PF_BGRA {
+		t.Fatalf("mode %+v", mode)
+	}
+	if mode.Timings.Right != 16 || mode.Timings.HSLen != 32 || mode.Sync != SyncHorHighAct {
+		t.Errorf("timings %+v, sync %d", mode.Timings, mode.Sync)
+	}
+
+	if cstr := cString(d.crtc.mode.name[:]); cstr != "320x240" || len(d.fbs) != 3 {
+		t.Fatalf("mode %q set, %d framebuffers", cstr, len(d.fbs))
+	}
+
+	modes, err := c.Modes()
+	if err != nil || len(modes) != 3 || modes[0].Name != "640x480" || c.FindMode("160x120") == nil {
+		t.Fatalf("modes: %v, %v", modes, err)
+	}
+
+	// Flipping shows the back buffer, without copying.
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	for i := 0; i < 2; i++ {
+		back, err := c.BackBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		col := red
+		col.G = uint8(i)
+		draw.Draw(back, image.Rect(10, 20, 11, 21), image.NewUniform(col), image.Point{}, draw.Src)
+
+		if err := c.Flip(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Pixels are stored as B, G, R, X.
+		pix := d.shown()
+		if off := 20*int(d.fbs[d.crtc.fbID].pitches[0]) + 10*4; pix[off+2] != 0xff || pix[off+1] != uint8(i) {
+			t.Errorf("flip %d: pixel %v", i, pix[off:off+4])
+		}
+	}
+
+	if d.flips != 2 || len(d.events) != 0 {
+		t.Errorf("%d flips, %d events left", d.flips, len(d.events))
+	}
+
+	// Snapshots see what is shown.
+	snap, err := c.Snapshot(image.Rect(10, 20, 11, 21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := snap.RGBAAt(10, 20); have != (color.RGBA{0xff, 1, 0, 0xff}) {
+		t.Errorf("snapshot: %v", have)
+	}
+
+	// The mode can not change through the framebuffer interface.
+	if err := c.setMode(modes[0]); err == nil {
+		t.Error("mode change accepted")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.crtc.fbID != fakeConsoleFB || len(d.fbs) != 1 || len(d.dumbs) != 0 {
+		t.Errorf("after close: showing %d, %d framebuffers, %d dumb buffers", d.crtc.fbID, len(d.fbs), len(d.dumbs))
+	}
+}
+
+func TestOpenDRMMode(t *testing.T) {
+	d := newFakeDRM(t, fakeMode(64, 48, "64x48", true), fakeMode(32, 24, "32x24", false))
+
+	// Only one page fits.
+	d.maxHeight = 24
+
+	var dm DisplayMode
+	dm.Geometry = Geometry{XRes: 32, YRes: 24, Depth: 16}
+
+	c, err := OpenDRM(d.path, &dm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*RGB565); !ok || img.Bounds() != image.Rect(0, 0, 32, 24) {
+		t.Fatalf("image %T %v", img, img.Bounds())
+	}
+
+	// Without a second page, flipping copies.
+	back, _ := c.BackBuffer()
+	back.Set(1, 1, color.White)
+	if err := c.Flip(); err != nil {
+		t.Fatal(err)
+	}
+
+	pix := d.shown()
+	if d.flips != 0 || d.fbs[d.crtc.fbID].pixelFormat != _DRM_FORMAT_RGB565 {
+		t.Errorf("%d flips, format %#x", d.flips, d.fbs[d.crtc.fbID].pixelFormat)
+	}
+	if off := int(d.fbs[d.crtc.fbID].pitches[0]) + 2; pix[off] != 0xff || pix[off+1] != 0xff {
+		t.Errorf("pixel %v", pix[off:off+2])
+	}
+}
+
+func TestOpenDRMErrors(t *testing.T) {
+	d := newFakeDRM(t, fakeMode(64, 48, "64x48", true))
+
+	var dm DisplayMode
+	dm.Geometry = Geometry{XRes: 1920, YRes: 1080}
+
+	if c, err := OpenDRM("", &dm, nil); err == nil {
+		c.Close()
+		t.Error("missing mode accepted")
+	}
+
+	d.connected = false
+	if _, err := OpenDRM("", nil, nil); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("no display: %v", err)
+	}
+
+	// Failures release what was acquired.
+	if len(d.fbs) != 1 || len(d.dumbs) != 0 || d.crtc.fbID != fakeConsoleFB {
+		t.Errorf("%d framebuffers, %d dumb buffers, showing %d", len(d.fbs), len(d.dumbs), d.crtc.fbID)
+	}
+}
+
+// TestOpenDRMDevice runs on a real DRM device, such as one of the vkms
+// driver, when FRAMEBUFFER_TEST_DRM names it.
+func TestOpenDRMDevice(t *testing.T) {
+	dev := os.Getenv("FRAMEBUFFER_TEST_DRM")
+	if dev == "" {
+		t.Skip("FRAMEBUFFER_TEST_DRM is not set")
+	}
+
+	c, err := OpenDRM(dev, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		back, err := c.BackBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		draw.Draw(back, back.Bounds(), image.NewUniform(color.Gray{uint8(i * 60)}), image.Point{}, draw.Src)
+		if err := c.Flip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
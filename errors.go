@@ -0,0 +1,181 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Sentinel errors. Use errors.Is to test for these, as
+// they are usually wrapped with more specific information.
+var (
+	// ErrNotPackedPixels is returned when the framebuffer stores
+	// its pixels in a layout other than packed pixels or a FOURCC
+	// format, such as planes of bits.
+	ErrNotPackedPixels = errors.New("framebuffer: not in packed pixels mode")
+
+	// ErrPermission is returned when access to a device is denied.
+	ErrPermission = errors.New("framebuffer: permission denied; the user may need to be in the video group")
+
+	// ErrNotATTY is returned when a terminal is required, but the
+	// one available is not a virtual terminal. See VTError.
+	ErrNotATTY = errors.New("framebuffer: not a virtual terminal")
+
+	// ErrNoDevice is returned when no framebuffer device can be found.
+	ErrNoDevice = errors.New("framebuffer: no such device")
+)
+
+// ErrUnsupportedFormat is returned when the framebuffer
+// uses a pixel format this package can not handle.
+type ErrUnsupportedFormat struct {
+	Format PixelFormat
+}
+
+func (e *ErrUnsupportedFormat) Error() string {
+	return fmt.Sprintf("framebuffer: unsupported pixel format: %+v", e.Format)
+}
+
+// IoctlError is returned when a device control request fails.
+//
+// It matches ErrPermission for EPERM and EACCES and unwraps to
+// the system error number, so errors.Is(err, syscall.ENOTTY) and
+// friends work as expected.
+type IoctlError struct {
+	Op      string        // Name of the request, e.g. "FBIOGET_VSCREENINFO".
+	Request uintptr       // Request number.
+	Errno   syscall.Errno // Error returned by the system.
+}
+
+func (e *IoctlError) Error() string {
+	return fmt.Sprintf("framebuffer: ioctl %s: %v", e.Op, e.Errno)
+}
+
+func (e *IoctlError) Unwrap() error { return e.Errno }
+
+func (e *IoctlError) Is(target error) bool {
+	return target == ErrPermission && (e.Errno == syscall.EPERM || e.Errno == syscall.EACCES)
+}
+
+// Is reports VTErrors as ErrNotATTY.
+func (e *VTError) Is(target error) bool { return target == ErrNotATTY }
+
+// ParseError is returned when a display mode database is malformed.
+type ParseError struct {
+	Line int   // Line number, starting at 1.
+	Err  error // Underlying error.
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("framebuffer: mode database line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// openDevice opens the given device node. Failures are
+// translated to ErrPermission or ErrNoDevice where applicable.
+func openDevice(name string, flag int) (*os.File, error) {
+	fd, err := os.OpenFile(name, flag, 0)
+
+	switch {
+	case err == nil:
+		return fd, nil
+	case os.IsPermission(err):
+		return nil, fmt.Errorf("%w: %w", ErrPermission, err)
+	case os.IsNotExist(err):
+		return nil, fmt.Errorf("%w: %w", ErrNoDevice, err)
+	}
+
+	return nil, err
+}
+
+// ioctlName returns the name of the given request number.
+func ioctlName(req uintptr) string {
+	switch req {
+	case _IOGET_VSCREENINFO:
+		return "FBIOGET_VSCREENINFO"
+	case _IOPUT_VSCREENINFO:
+		return "FBIOPUT_VSCREENINFO"
+	case _IOGET_FSCREENINFO:
+		return "FBIOGET_FSCREENINFO"
+	case _IOGET_CMAP:
+		return "FBIOGETCMAP"
+	case _IOPUT_CMAP:
+		return "FBIOPUTCMAP"
+	case _IOPAN_DISPLAY:
+		return "FBIOPAN_DISPLAY"
+	case _IOGET_CON2FBMAP:
+		return "FBIOGET_CON2FBMAP"
+	case _IOPUT_CON2FBMAP:
+		return "FBIOPUT_CON2FBMAP"
+	case _IO_BLANK:
+		return "FBIOBLANK"
+	case uintptr(_IO_CURSOR):
+		return "FBIO_CURSOR"
+	case uintptr(_IOGET_VBLANK):
+		return "FBIOGET_VBLANK"
+	case uintptr(_IO_WAITFORVSYNC):
+		return "FBIO_WAITFORVSYNC"
+	case _KDSETMODE:
+		return "KDSETMODE"
+	case _KDGETMODE:
+		return "KDGETMODE"
+	case _KDGKBMODE:
+		return "KDGKBMODE"
+	case _KDSKBMODE:
+		return "KDSKBMODE"
+	case syscall.TCGETS:
+		return "TCGETS"
+	case syscall.TCSETS:
+		return "TCSETS"
+	case _VT_OPENQRY:
+		return "VT_OPENQRY"
+	case _VT_GETMODE:
+		return "VT_GETMODE"
+	case _VT_SETMODE:
+		return "VT_SETMODE"
+	case _VT_GETSTATE:
+		return "VT_GETSTATE"
+	case _VT_RELDISP:
+		return "VT_RELDISP"
+	case _VT_ACTIVATE:
+		return "VT_ACTIVATE"
+	case _VT_WAITACTIVE:
+		return "VT_WAITACTIVE"
+	case _VT_DISALLOCATE:
+		return "VT_DISALLOCATE"
+	case uintptr(_DRM_IOCTL_SET_MASTER):
+		return "DRM_IOCTL_SET_MASTER"
+	case uintptr(_DRM_IOCTL_DROP_MASTER):
+		return "DRM_IOCTL_DROP_MASTER"
+	case uintptr(_DRM_IOCTL_GET_CAP):
+		return "DRM_IOCTL_GET_CAP"
+	case uintptr(_DRM_IOCTL_MODE_GETRESOURCES):
+		return "DRM_IOCTL_MODE_GETRESOURCES"
+	case uintptr(_DRM_IOCTL_MODE_GETCRTC):
+		return "DRM_IOCTL_MODE_GETCRTC"
+	case uintptr(_DRM_IOCTL_MODE_SETCRTC):
+		return "DRM_IOCTL_MODE_SETCRTC"
+	case uintptr(_DRM_IOCTL_MODE_GETENCODER):
+		return "DRM_IOCTL_MODE_GETENCODER"
+	case uintptr(_DRM_IOCTL_MODE_GETCONNECTOR):
+		return "DRM_IOCTL_MODE_GETCONNECTOR"
+	case uintptr(_DRM_IOCTL_MODE_RMFB):
+		return "DRM_IOCTL_MODE_RMFB"
+	case uintptr(_DRM_IOCTL_MODE_PAGE_FLIP):
+		return "DRM_IOCTL_MODE_PAGE_FLIP"
+	case uintptr(_DRM_IOCTL_MODE_CREATE_DUMB):
+		return "DRM_IOCTL_MODE_CREATE_DUMB"
+	case uintptr(_DRM_IOCTL_MODE_MAP_DUMB):
+		return "DRM_IOCTL_MODE_MAP_DUMB"
+	case uintptr(_DRM_IOCTL_MODE_DESTROY_DUMB):
+		return "DRM_IOCTL_MODE_DESTROY_DUMB"
+	case uintptr(_DRM_IOCTL_MODE_ADDFB2):
+		return "DRM_IOCTL_MODE_ADDFB2"
+	}
+
+	return fmt.Sprintf("%#x", req)
+}
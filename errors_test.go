@@ -0,0 +1,64 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOpenErrors(t *testing.T) {
+	s := newFakeSystem(t)
+
+	_, err := OpenDevice(filepath.Join(s.dir, "dev", "fb9"), nil, nil)
+	if !errors.Is(err, ErrNoDevice) {
+		t.Errorf("missing device: have %v, want ErrNoDevice", err)
+	}
+
+	fb := s.addFB(0, "fb0", "drv", 8, 8, 32)
+	fb.fi.typ = _TYPE_PLANES
+
+	_, err = OpenDevice(fb.path, nil, nil)
+	if !errors.Is(err, ErrNotPackedPixels) {
+		t.Errorf("planar device: have %v, want ErrNotPackedPixels", err)
+	}
+
+	fb = s.addFB(1, "fb1", "drv", 8, 8, 24)
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var uf *ErrUnsupportedFormat
+	if _, err = c.Image(); !errors.As(err, &uf) || uf.Format.Depth != 24 {
+		t.Errorf("24-bit image: have %v, want ErrUnsupportedFormat", err)
+	}
+
+	// Make the fake device reject blanking.
+	fb.errs = map[uintptr]syscall.Errno{_IO_BLANK: syscall.EINVAL}
+	var ie *IoctlError
+	err = ioctl(c.File().Fd(), _IO_BLANK, _BLANK_UNBLANK)
+	if !errors.As(err, &ie) || ie.Op != "FBIOBLANK" || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("blank: have %v, want EINVAL IoctlError", err)
+	}
+}
+
+func TestIoctlErrorPermission(t *testing.T) {
+	err := error(&IoctlError{Op: "KDSETMODE", Request: _KDSETMODE, Errno: syscall.EPERM})
+	if !errors.Is(err, ErrPermission) {
+		t.Errorf("EPERM does not match ErrPermission")
+	}
+
+	err = &IoctlError{Op: "KDSETMODE", Request: _KDSETMODE, Errno: syscall.EINVAL}
+	if errors.Is(err, ErrPermission) {
+		t.Errorf("EINVAL matches ErrPermission")
+	}
+
+	if !errors.Is(&VTError{Reason: "test"}, ErrNotATTY) {
+		t.Errorf("VTError does not match ErrNotATTY")
+	}
+}
@@ -0,0 +1,82 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Command fbgrab saves the contents of a framebuffer to an image file.
+//
+//	fbgrab [-dev /dev/fb0] [-rect x,y,w,h] [-format png|ppm|bmp] out.png
+//
+// The format follows from the file extension, unless given. An output
+// of "-" writes to standard output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/snapshot"
+)
+
+func main() {
+	dev := flag.String("dev", "", "Framebuffer device. Defaults to $FRAMEBUFFER or /dev/fb0.")
+	rect := flag.String("rect", "", "Area to grab, as x,y,width,height. Defaults to the whole screen.")
+	format := flag.String("format", "", "Image format: png, ppm or bmp. Defaults to the file extension.")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: fbgrab [options] file\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if *dev == "" {
+		*dev = os.Getenv("FRAMEBUFFER")
+	}
+	if *dev == "" {
+		*dev = "/dev/fb0"
+	}
+
+	var r image.Rectangle
+	if *rect != "" {
+		var x, y, w, h int
+		_, err := fmt.Sscanf(*rect, "%d,%d,%d,%d", &x, &y, &w, &h)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -rect %q\n", *rect)
+			os.Exit(2)
+		}
+		r = image.Rect(x, y, x+w, y+h)
+	}
+
+	img, err := framebuffer.Grab(*dev, r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	out := flag.Arg(0)
+	f := snapshot.Format(*format)
+	if f == "" {
+		f = snapshot.FormatOf(out)
+	}
+
+	w := os.Stdout
+	if out != "-" {
+		w, err = os.Create(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = snapshot.Encode(w, img, f)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sparques/framebuffer"
+)
+
+func main() {
+	dev := flag.String("dev", "/dev/fb0", "Framebuffer device to probe.")
+	flag.Parse()
+
+	// List all devices, so it is clear which ones can be probed.
+	list, err := framebuffer.ListDevices()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ListDevices: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, d := range list {
+		fmt.Printf("%s: %q driver=%q consoles=%v\n", d.Path, d.ID, d.Driver, d.Consoles)
+	}
+
+	// Opening the device would clear it; only query it.
+	mode, cp, err := framebuffer.QueryDevice(*dev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "QueryDevice: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n%s\n", *dev)
+	fmt.Printf("  resolution:   %dx%d (virtual %dx%d), %d bpp\n",
+		mode.Geometry.XRes, mode.Geometry.YRes,
+		mode.Geometry.XVRes, mode.Geometry.YVRes, mode.Geometry.Depth)
+	fmt.Printf("  visual:       %v\n", cp.Visual)
+	fmt.Printf("  pan step:     x=%d y=%d\n", cp.XPanStep, cp.YPanStep)
+	fmt.Printf("  wrap step:    %d\n", cp.YWrapStep)
+	fmt.Printf("  max virtual:  %dx%d\n", cp.MaxXVRes, cp.MaxYVRes)
+	fmt.Printf("  vblank:       %v\n", cp.VBlank)
+	fmt.Printf("  vsync:        %v\n", cp.VSync)
+	fmt.Printf("  hw cursor:    %v\n", cp.HWCursor)
+	fmt.Printf("  blanking:     %v\n", cp.Blanking)
+	fmt.Printf("  fourcc:       %v\n", cp.FourCC)
+	fmt.Printf("  palette:      writable=%v\n", cp.PaletteWritable)
+
+	if cp.AccelName != "" {
+		fmt.Printf("  accelerator:  %s (%d)\n", cp.AccelName, cp.Accel)
+	} else {
+		fmt.Printf("  accelerator:  none\n")
+	}
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -14,11 +15,16 @@ import (
 	"os/signal"
 
 	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/termview"
 )
 
 func main() {
-	// Create a new framebuffer canvas.
-	canvas, err := framebuffer.Open(nil, nil)
+	inTerm := flag.Bool("term", false, "Draw in memory and show it in this terminal, instead of on the framebuffer.")
+	flag.Parse()
+
+	// Create a new framebuffer canvas on the console we are running on,
+	// or in memory, for showing in the terminal.
+	canvas, err := open(*inTerm)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Open: %v\n", err)
 		return
@@ -27,6 +33,15 @@ func main() {
 	// Ensure all resources are cleaned up properly before we exit.
 	defer canvas.Close()
 
+	if *inTerm {
+		view, err := termview.New(os.Stdout, canvas, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "termview: %v\n", err)
+			return
+		}
+		defer view.Close()
+	}
+
 	mode, _ := canvas.CurrentMode()
 	fmt.Fprintf(os.Stderr, "%+v\n", mode)
 
@@ -65,12 +80,56 @@ func main() {
 		fb.Set(fb.Bounds().Dx()-1, y, color.White)
 	}
 
-	wait() // Wait until an exit signal has been received.
+	wait(canvas) // Wait until a quit key or exit signal has been received.
+}
+
+// open opens the framebuffer of the console, or creates a 640x480
+// canvas in memory.
+func open(inMemory bool) (*framebuffer.Canvas, error) {
+	if !inMemory {
+		return framebuffer.OpenConsole(nil, 0)
+	}
+
+	var mode framebuffer.DisplayMode
+	mode.Geometry = framebuffer.Geometry{XRes: 640, YRes: 480, Depth: 32}
+	mode.Format = framebuffer.PixelFormat{
+		RedBits: 8, RedShift: 16, GreenBits: 8, GreenShift: 8, BlueBits: 8,
+	}
+	return framebuffer.NewMemoryCanvas(&mode)
 }
 
-// wait polls for exit signals.
-func wait() {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, os.Kill)
-	<-signals
+// wait polls for exit signals and, if we have a terminal,
+// for Escape, q or Ctrl+C to be pressed.
+func wait(canvas *framebuffer.Canvas) {
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, os.Kill)
+
+	if tty := canvas.TTY(); tty != nil {
+		kb, err := framebuffer.KeyboardFromTTY(tty, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Keyboard: %v\n", err)
+		} else {
+			defer kb.Close()
+			go readKeys(kb, done)
+		}
+	}
+
+	<-done
+}
+
+// readKeys signals done when a quit key is pressed.
+func readKeys(kb *framebuffer.Keyboard, done chan<- os.Signal) {
+	for {
+		ev, err := kb.ReadEvent()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case ev.Key == framebuffer.KeyEsc, ev.Rune == 'q',
+			ev.Key == framebuffer.KeyC && ev.Modifiers&framebuffer.ModCtrl != 0:
+			done <- os.Interrupt
+			return
+		}
+	}
 }
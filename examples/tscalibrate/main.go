@@ -0,0 +1,113 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/input"
+)
+
+func main() {
+	dev := flag.String("dev", "", "Touchscreen event device. Defaults to the first touchscreen found.")
+	out := flag.String("out", "", "Calibration file. Defaults to $TSLIB_CALIBFILE or /etc/pointercal.")
+	flag.Parse()
+
+	touch, err := openTouchscreen(*dev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Keep the touches from reaching anything else while we calibrate.
+	touch.Grab(true)
+
+	canvas, err := framebuffer.OpenConsole(nil, 0)
+	if err != nil {
+		touch.Close()
+		fmt.Fprintf(os.Stderr, "Open: %v\n", err)
+		os.Exit(1)
+	}
+
+	fb, err := canvas.Image()
+	if err != nil {
+		canvas.Close()
+		touch.Close()
+		fmt.Fprintf(os.Stderr, "Image: %v\n", err)
+		os.Exit(1)
+	}
+
+	mode, err := canvas.CurrentMode()
+	if err != nil {
+		canvas.Close()
+		touch.Close()
+		fmt.Fprintf(os.Stderr, "CurrentMode: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The image spans the virtual resolution; the targets must be
+	// placed within the visible part.
+	visible := image.Rect(0, 0, mode.Geometry.XRes, mode.Geometry.YRes)
+	if s, ok := fb.(subImager); ok {
+		fb = s.SubImage(visible).(draw.Image)
+	} else {
+		fb = &clipped{fb, visible}
+	}
+
+	mux := input.NewMux(touch)
+	var c input.Calibrator
+	cal, err := c.Run(fb, mux.Events())
+
+	mux.Close()
+	canvas.Close()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Calibrate: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cal.SavePointercal(*out); err != nil {
+		fmt.Fprintf(os.Stderr, "Save: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%+v\n", *cal)
+}
+
+// openTouchscreen opens the given device, or the first touchscreen.
+func openTouchscreen(path string) (*input.Device, error) {
+	if path != "" {
+		return input.Open(path)
+	}
+
+	devs, err := input.OpenAll(input.Touchscreen)
+	if err != nil {
+		return nil, fmt.Errorf("no touchscreen found: %w", err)
+	}
+
+	for _, d := range devs[1:] {
+		d.Close()
+	}
+
+	return devs[0], nil
+}
+
+// subImager is implemented by the standard library image types.
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// clipped limits the bounds of an image which has no SubImage
+// method, such as the 16-bit formats of this package.
+type clipped struct {
+	draw.Image
+	r image.Rectangle
+}
+
+func (c *clipped) Bounds() image.Rectangle { return c.r.Intersect(c.Image.Bounds()) }
@@ -0,0 +1,298 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// IDs of the objects of a fakeDRM.
+const (
+	fakeCrtc      = 10
+	fakeEncoder   = 20
+	fakeConnector = 30
+	fakeConsoleFB = 5 // Framebuffer shown before the device is opened.
+)
+
+// fakeDRM emulates a DRM device with a single connector, encoder and
+// CRTC. Its dumb buffers are stored in a regular file, which can be
+// mmap'd like the real thing. It replaces the ioctl and read system
+// calls for the duration of a test.
+type fakeDRM struct {
+	t         *testing.T
+	path      string
+	modes     []drmModeInfo
+	connected bool
+	maxHeight uint32 // Largest dumb buffer height.
+
+	crtc   drmModeCrtc
+	size   int64 // Size of the device file.
+	nextID uint32
+	dumbs  map[uint32]*fakeDumb
+	fbs    map[uint32]drmModeFbCmd2
+	events []drmEvent
+	flips  int
+}
+
+type fakeDumb struct {
+	drmModeCreateDumb
+	offset int64
+}
+
+func newFakeDRM(t *testing.T, modes ...drmModeInfo) *fakeDRM {
+	d := &fakeDRM{
+		t:         t,
+		path:      filepath.Join(t.TempDir(), "card0"),
+		modes:     modes,
+		connected: true,
+		maxHeight: 4096,
+		nextID:    100,
+		dumbs:     make(map[uint32]*fakeDumb),
+		fbs:       map[uint32]drmModeFbCmd2{fakeConsoleFB: {}},
+	}
+
+	d.crtc = drmModeCrtc{crtcID: fakeCrtc, fbID: fakeConsoleFB, modeValid: 1, mode: modes[0]}
+
+	if err := os.WriteFile(d.path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldDri, oldIoctl, oldRead := dri0, sysIoctl, sysRead
+	t.Cleanup(func() {
+		dri0, sysIoctl, sysRead = oldDri, oldIoctl, oldRead
+	})
+
+	dri0 = d.path
+	sysIoctl = d.ioctl
+	sysRead = d.read
+	return d
+}
+
+// fakeMode returns a mode with the given visible size.
+func fakeMode(w, h int, name string, preferred bool) drmModeInfo {
+	m := drmModeInfo{
+		clock:    uint32(w * h * 60 / 1000),
+		hdisplay: uint16(w), hsyncStart: uint16(w + 16), hsyncEnd: uint16(w + 48), htotal: uint16(w + 80),
+		vdisplay: uint16(h), vsyncStart: uint16(h + 3), vsyncEnd: uint16(h + 7), vtotal: uint16(h + 20),
+		vrefresh: 60,
+		flags:    _DRM_MODE_FLAG_PHSYNC,
+	}
+	if preferred {
+		m.typ = _DRM_MODE_TYPE_PREFERRED
+	}
+	copy(m.name[:], name)
+	return m
+}
+
+// userPtr returns the pointer the kernel would find in field p.
+func userPtr(p *uint64) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(p))
+}
+
+func (d *fakeDRM) ioctl(fd, name uintptr, ptr unsafe.Pointer, val uintptr) syscall.Errno {
+	switch int(name) {
+	case _DRM_IOCTL_SET_MASTER, _DRM_IOCTL_DROP_MASTER:
+
+	case _DRM_IOCTL_GET_CAP:
+		c := (*drmGetCap)(ptr)
+		c.value = 0
+		if c.capability == _DRM_CAP_DUMB_BUFFER {
+			c.value = 1
+		}
+
+	case _DRM_IOCTL_MODE_GETRESOURCES:
+		r := (*drmModeCardRes)(ptr)
+		if r.countCrtcs >= 1 && r.crtcIDPtr != 0 {
+			*(*uint32)(userPtr(&r.crtcIDPtr)) = fakeCrtc
+		}
+		if r.countConns >= 1 && r.connectorIDPtr != 0 {
+			*(*uint32)(userPtr(&r.connectorIDPtr)) = fakeConnector
+		}
+		r.countCrtcs, r.countConns, r.countEncoders = 1, 1, 1
+		r.maxWidth, r.maxHeight = 4096, 4096
+
+	case _DRM_IOCTL_MODE_GETCONNECTOR:
+		c := (*drmModeGetConnector)(ptr)
+		if c.connectorID != fakeConnector {
+			return syscall.ENOENT
+		}
+
+		if int(c.countModes) >= len(d.modes) && c.modesPtr != 0 {
+			copy(unsafe.Slice((*drmModeInfo)(userPtr(&c.modesPtr)), len(d.modes)), d.modes)
+		}
+		if c.countEncoders >= 1 && c.encodersPtr != 0 {
+			*(*uint32)(userPtr(&c.encodersPtr)) = fakeEncoder
+		}
+
+		c.countModes, c.countEncoders = uint32(len(d.modes)), 1
+		c.connection = 2
+		if d.connected {
+			c.connection = _DRM_MODE_CONNECTED
+		}
+		c.encoderID = fakeEncoder
+
+	case _DRM_IOCTL_MODE_GETENCODER:
+		e := (*drmModeGetEncoder)(ptr)
+		if e.encoderID != fakeEncoder {
+			return syscall.ENOENT
+		}
+		e.crtcID = 0
+		if d.crtc.fbID != 0 {
+			e.crtcID = fakeCrtc
+		}
+		e.possibleCrtcs = 1
+
+	case _DRM_IOCTL_MODE_GETCRTC:
+		c := (*drmModeCrtc)(ptr)
+		if c.crtcID != fakeCrtc {
+			return syscall.ENOENT
+		}
+		*c = d.crtc
+
+	case _DRM_IOCTL_MODE_SETCRTC:
+		c := (*drmModeCrtc)(ptr)
+		if c.crtcID != fakeCrtc {
+			return syscall.ENOENT
+		}
+
+		if c.fbID == 0 {
+			d.crtc = drmModeCrtc{crtcID: fakeCrtc}
+			break
+		}
+
+		if _, ok := d.fbs[c.fbID]; !ok || c.countConnectors != 1 || c.modeValid == 0 ||
+			*(*uint32)(userPtr(&c.setConnectorsPtr)) != fakeConnector {
+			return syscall.EINVAL
+		}
+
+		d.crtc = *c
+		d.crtc.setConnectorsPtr, d.crtc.countConnectors = 0, 0
+
+	case _DRM_IOCTL_MODE_CREATE_DUMB:
+		c := (*drmModeCreateDumb)(ptr)
+		if c.height > d.maxHeight {
+			return syscall.ENOMEM
+		}
+
+		// Rows are padded, as drivers often do.
+		c.pitch = (c.width*c.bpp/8 + 63) &^ 63
+		c.size = uint64(c.pitch * c.height)
+		c.handle = d.id()
+
+		dumb := &fakeDumb{drmModeCreateDumb: *c, offset: d.size}
+		d.dumbs[c.handle] = dumb
+		d.size += int64(c.size+4095) &^ 4095
+
+		if err := os.Truncate(d.path, d.size); err != nil {
+			d.t.Fatal(err)
+		}
+
+	case _DRM_IOCTL_MODE_MAP_DUMB:
+		m := (*drmModeMapDumb)(ptr)
+		dumb, ok := d.dumbs[m.handle]
+		if !ok {
+			return syscall.ENOENT
+		}
+		m.offset = uint64(dumb.offset)
+
+	case _DRM_IOCTL_MODE_DESTROY_DUMB:
+		handle := (*drmModeDestroyDumb)(ptr).handle
+		if _, ok := d.dumbs[handle]; !ok {
+			return syscall.ENOENT
+		}
+		delete(d.dumbs, handle)
+
+	case _DRM_IOCTL_MODE_ADDFB2:
+		f := (*drmModeFbCmd2)(ptr)
+		dumb, ok := d.dumbs[f.handles[0]]
+		if !ok {
+			return syscall.ENOENT
+		}
+
+		if f.pixelFormat != _DRM_FORMAT_XRGB8888 && f.pixelFormat != _DRM_FORMAT_RGB565 ||
+			f.pitches[0] != dumb.pitch ||
+			uint64(f.offsets[0]+f.pitches[0]*f.height) > dumb.size {
+			return syscall.EINVAL
+		}
+
+		f.fbID = d.id()
+		d.fbs[f.fbID] = *f
+
+	case _DRM_IOCTL_MODE_RMFB:
+		id := *(*uint32)(ptr)
+		if _, ok := d.fbs[id]; !ok {
+			return syscall.ENOENT
+		}
+		delete(d.fbs, id)
+
+	case _DRM_IOCTL_MODE_PAGE_FLIP:
+		f := (*drmModeCrtcPageFlip)(ptr)
+		if _, ok := d.fbs[f.fbID]; !ok || f.crtcID != fakeCrtc || d.crtc.fbID == 0 {
+			return syscall.EINVAL
+		}
+
+		d.crtc.fbID = f.fbID
+		d.flips++
+
+		if f.flags&_DRM_MODE_PAGE_FLIP_EVENT != 0 {
+			ev := drmEvent{typ: _DRM_EVENT_FLIP_COMPLETE, userData: f.userData, crtcID: fakeCrtc}
+			ev.length = uint32(unsafe.Sizeof(ev))
+			d.events = append(d.events, ev)
+		}
+
+	default:
+		return syscall.ENOTTY
+	}
+
+	return 0
+}
+
+func (d *fakeDRM) id() uint32 {
+	d.nextID++
+	return d.nextID
+}
+
+// read returns the pending events; as the real device does, but
+// without blocking when there are none.
+func (d *fakeDRM) read(fd uintptr, p []byte) (int, error) {
+	if len(d.events) == 0 {
+		return 0, syscall.EAGAIN
+	}
+
+	var n int
+	for len(d.events) > 0 && n+int(d.events[0].length) <= len(p) {
+		ev := d.events[0]
+		n += copy(p[n:], (*[unsafe.Sizeof(ev)]byte)(unsafe.Pointer(&ev))[:])
+		d.events = d.events[1:]
+	}
+
+	return n, nil
+}
+
+// shown returns the pixel memory of the framebuffer on screen.
+func (d *fakeDRM) shown() []byte {
+	fb, ok := d.fbs[d.crtc.fbID]
+	if !ok {
+		d.t.Fatalf("framebuffer %d is shown, but does not exist", d.crtc.fbID)
+	}
+
+	dumb := d.dumbs[fb.handles[0]]
+	buf := make([]byte, fb.pitches[0]*fb.height)
+
+	f, err := os.Open(d.path)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.ReadAt(buf, dumb.offset+int64(fb.offsets[0])); err != nil {
+		d.t.Fatal(err)
+	}
+
+	return buf
+}
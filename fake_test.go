@@ -0,0 +1,197 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// fakeFB emulates a single framebuffer device. Its pixel memory
+// is a regular file, which can be mmap'd like the real thing.
+type fakeFB struct {
+	path string
+	fi   fbFixScreenInfo
+	vi   fbVarScreenInfo
+	cmap [4][256]uint16
+
+	vblank uint32                    // vblank flags, zero if vblank is not supported.
+	errs   map[uintptr]syscall.Errno // errors returned for requests.
+}
+
+// fakeSystem emulates a /dev and sysfs tree with framebuffer devices.
+// It replaces the ioctl system call for the duration of a test.
+type fakeSystem struct {
+	t      *testing.T
+	dir    string
+	devs   map[string]*fakeFB
+	con2fb [_MAX_NR_CONSOLES + 1]uint32
+}
+
+func newFakeSystem(t *testing.T) *fakeSystem {
+	s := &fakeSystem{
+		t:    t,
+		dir:  t.TempDir(),
+		devs: make(map[string]*fakeFB),
+	}
+
+	oldFbnr, oldSys, oldIoctl := fbnr, sysGraphics, sysIoctl
+	t.Cleanup(func() {
+		fbnr, sysGraphics, sysIoctl = oldFbnr, oldSys, oldIoctl
+	})
+
+	fbnr = filepath.Join(s.dir, "dev", "fb%d")
+	sysGraphics = filepath.Join(s.dir, "sys", "class", "graphics")
+	sysIoctl = s.ioctl
+
+	os.MkdirAll(filepath.Join(s.dir, "dev"), 0755)
+	return s
+}
+
+// addFB adds framebuffer n with the given visible size and depth.
+// The virtual height is twice the visible height, to allow panning.
+func (s *fakeSystem) addFB(n int, id, driver string, xres, yres, depth int) *fakeFB {
+	fb := &fakeFB{path: fmt.Sprintf(fbnr, n)}
+
+	fb.vi.xres = uint32(xres)
+	fb.vi.yres = uint32(yres)
+	fb.vi.xresVirtual = uint32(xres)
+	fb.vi.yresVirtual = uint32(yres * 2)
+	fb.vi.bitsPerPixel = uint32(depth)
+
+	switch depth {
+	case 32:
+		fb.vi.red = fbBitField{offset: 16, length: 8}
+		fb.vi.green = fbBitField{offset: 8, length: 8}
+		fb.vi.blue = fbBitField{offset: 0, length: 8}
+		fb.vi.transparent = fbBitField{offset: 24, length: 8}
+		fb.fi.visual = _VISUAL_TRUECOLOR
+	case 16:
+		fb.vi.red = fbBitField{offset: 11, length: 5}
+		fb.vi.green = fbBitField{offset: 5, length: 6}
+		fb.vi.blue = fbBitField{offset: 0, length: 5}
+		fb.fi.visual = _VISUAL_TRUECOLOR
+	default:
+		fb.vi.red = fbBitField{length: uint32(depth)}
+		fb.vi.green = fbBitField{length: uint32(depth)}
+		fb.vi.blue = fbBitField{length: uint32(depth)}
+		fb.fi.visual = _VISUAL_PSEUDOCOLOR
+	}
+
+	copy(fb.fi.id[:], id)
+	fb.fi.typ = _TYPE_PACKED_PIXELS
+	fb.fi.lineLength = uint32(xres * depth / 8)
+	fb.fi.smemlen = fb.fi.lineLength * fb.vi.yresVirtual
+
+	err := os.WriteFile(fb.path, make([]byte, fb.fi.smemlen), 0644)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	sys := filepath.Join(sysGraphics, fmt.Sprintf("fb%d", n))
+	drv := filepath.Join(s.dir, "sys", "bus", "platform", "drivers", driver)
+	os.MkdirAll(filepath.Join(sys, "device"), 0755)
+	os.MkdirAll(drv, 0755)
+	os.WriteFile(filepath.Join(sys, "name"), []byte(id+"\n"), 0644)
+	os.Symlink(drv, filepath.Join(sys, "device", "driver"))
+
+	s.devs[fb.path] = fb
+	return fb
+}
+
+func (s *fakeSystem) ioctl(fd, name uintptr, ptr unsafe.Pointer, val uintptr) syscall.Errno {
+	path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		return syscall.EBADF
+	}
+
+	fb, ok := s.devs[path]
+	if !ok {
+		return syscall.ENOTTY
+	}
+
+	if e := fb.errs[name]; e != 0 {
+		return e
+	}
+
+	switch name {
+	case _IOGET_VSCREENINFO:
+		*(*fbVarScreenInfo)(ptr) = fb.vi
+
+	case _IOPUT_VSCREENINFO:
+		v := (*fbVarScreenInfo)(ptr)
+		if uint64(v.xresVirtual)*uint64(v.yresVirtual)*uint64(v.bitsPerPixel)/8 > uint64(fb.fi.smemlen) {
+			return syscall.EINVAL
+		}
+
+		if v.activate&_ACTIVATE_MASK != _ACTIVATE_TEST {
+			fb.vi = *v
+		}
+
+	case uintptr(_IOGET_VBLANK):
+		if fb.vblank == 0 {
+			return syscall.EINVAL
+		}
+		(*fbVblank)(ptr).flags = fb.vblank
+
+	case _IO_BLANK:
+		// Blanking shows nothing, there being no display.
+
+	case uintptr(_IO_CURSOR):
+		// The cursor image can not be changed.
+		if (*fbCursor)(ptr).set&^_CUR_SETPOS != 0 {
+			return syscall.EINVAL
+		}
+
+	case _IOGET_FSCREENINFO:
+		*(*fbFixScreenInfo)(ptr) = fb.fi
+
+	case _IOPAN_DISPLAY:
+		v := (*fbVarScreenInfo)(ptr)
+		fb.vi.xoffset = v.xoffset
+		fb.vi.yoffset = v.yoffset
+
+	case _IOGET_CMAP, _IOPUT_CMAP:
+		cm := (*fb_cmap)(ptr)
+		if cm.start+cm.len > 256 {
+			return syscall.EINVAL
+		}
+
+		for i, p := range []unsafe.Pointer{cm.red, cm.green, cm.blue, cm.transp} {
+			if p == nil {
+				continue
+			}
+
+			ch := unsafe.Slice((*uint16)(p), cm.start+cm.len)[cm.start:]
+			if name == _IOGET_CMAP {
+				copy(ch, fb.cmap[i][cm.start:])
+			} else {
+				copy(fb.cmap[i][cm.start:], ch)
+			}
+		}
+
+	case _IOGET_CON2FBMAP:
+		m := (*fb_con2fbmap)(ptr)
+		if m.console < 1 || m.console > _MAX_NR_CONSOLES {
+			return syscall.EINVAL
+		}
+		m.framebuffer = s.con2fb[m.console]
+
+	case _IOPUT_CON2FBMAP:
+		m := (*fb_con2fbmap)(ptr)
+		if m.console < 1 || m.console > _MAX_NR_CONSOLES {
+			return syscall.EINVAL
+		}
+		s.con2fb[m.console] = m.framebuffer
+
+	default:
+		return syscall.ENOTTY
+	}
+
+	return 0
+}
@@ -0,0 +1,111 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package font
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Measure returns the size of the given text in pixels.
+// Each newline starts a new line of text.
+func (f *Font) Measure(s string) image.Point {
+	var size image.Point
+	var width int
+
+	lines := 1
+	for _, r := range s {
+		if r == '\n' {
+			lines++
+			width = 0
+			continue
+		}
+
+		width += f.Width
+		if width > size.X {
+			size.X = width
+		}
+	}
+
+	size.Y = lines * f.Height
+	return size
+}
+
+// Draw draws the given text onto dst, starting at the top-left corner of
+// r. Drawing is clipped to r and the bounds of dst. Each newline moves
+// back to the left edge of r, one line down.
+//
+// Foreground pixels are drawn in fg. Background pixels are drawn in bg,
+// or left untouched if bg is nil. Runes without a glyph are drawn as the
+// replacement character, or a question mark if the font has neither.
+//
+// It returns the position at which subsequent text would be drawn.
+func (f *Font) Draw(dst draw.Image, r image.Rectangle, s string, fg, bg color.Color) image.Point {
+	pt := r.Min
+
+	for _, c := range s {
+		if c == '\n' {
+			pt.X = r.Min.X
+			pt.Y += f.Height
+			continue
+		}
+
+		f.DrawGlyph(dst, r, pt, f.lookup(c), fg, bg)
+		pt.X += f.Width
+	}
+
+	return pt
+}
+
+// DrawGlyph draws the glyph with the given index onto dst, with its
+// top-left corner at pt. Drawing is clipped to clip and the bounds
+// of dst. If bg is nil, background pixels are left untouched.
+func (f *Font) DrawGlyph(dst draw.Image, clip image.Rectangle, pt image.Point, index int, fg, bg color.Color) {
+	glyph := f.Glyph(index)
+	if glyph == nil {
+		return
+	}
+
+	gr := image.Rect(pt.X, pt.Y, pt.X+f.Width, pt.Y+f.Height)
+	gr = gr.Intersect(clip).Intersect(dst.Bounds())
+	if gr.Empty() {
+		return
+	}
+
+	// Convert once, rather than for every pixel.
+	model := dst.ColorModel()
+	fg = model.Convert(fg)
+	if bg != nil {
+		bg = model.Convert(bg)
+	}
+
+	for y := gr.Min.Y; y < gr.Max.Y; y++ {
+		row := glyph[(y-pt.Y)*f.rowBytes:]
+
+		for x := gr.Min.X; x < gr.Max.X; x++ {
+			gx := x - pt.X
+
+			if row[gx>>3]&(0x80>>uint(gx&7)) != 0 {
+				dst.Set(x, y, fg)
+			} else if bg != nil {
+				dst.Set(x, y, bg)
+			}
+		}
+	}
+}
+
+// lookup returns the glyph index for r, or a fallback glyph.
+func (f *Font) lookup(r rune) int {
+	if n, ok := f.Index(r); ok {
+		return n
+	}
+
+	if n, ok := f.Index('\uFFFD'); ok {
+		return n
+	}
+
+	n, _ := f.Index('?')
+	return n
+}
@@ -0,0 +1,270 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package font reads PC Screen Fonts, as used by the Linux console,
+// and renders text with them onto any draw.Image.
+//
+// Both PSF1 and PSF2 files are supported, including their Unicode
+// tables and the gzip-compressed variants found in
+// /usr/share/consolefonts.
+package font
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// ErrFormat is returned when data is not a valid PSF font.
+var ErrFormat = errors.New("font: not a valid PSF font")
+
+// <linux/kd.h> psf1 header.
+const (
+	psf1Magic0    = 0x36
+	psf1Magic1    = 0x04
+	psf1Mode512   = 0x01 // Font has 512 glyphs instead of 256.
+	psf1ModeTab   = 0x02 // Font has a Unicode table.
+	psf1ModeSeq   = 0x04 // Unicode table contains sequences.
+	psf1Separator = 0xFFFF
+	psf1StartSeq  = 0xFFFE
+)
+
+// psf2 header.
+const (
+	psf2Magic     = 0x864ab572
+	psf2HasTable  = 0x01 // Font has a Unicode table.
+	psf2Separator = 0xFF
+	psf2StartSeq  = 0xFE
+)
+
+// Font is a bitmap font. Each glyph is a fixed size, one-bit image.
+type Font struct {
+	Width  int // Glyph width in pixels.
+	Height int // Glyph height in pixels.
+
+	data     []byte       // Glyph bitmaps.
+	count    int          // Number of glyphs.
+	rowBytes int          // Bytes for a single glyph row.
+	charSize int          // Bytes for a single glyph.
+	unicode  map[rune]int // Rune to glyph index. Nil if the font has no table.
+}
+
+// Load reads a font from the given file.
+func Load(file string) (*Font, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Read reads a font from the given stream.
+func Read(r io.Reader) (*Font, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses a font from the given data. The data may be gzip-compressed.
+func Parse(data []byte) (*Font, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = io.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(data) >= 4 && binary.LittleEndian.Uint32(data) == psf2Magic:
+		return parsePSF2(data)
+	case len(data) >= 2 && data[0] == psf1Magic0 && data[1] == psf1Magic1:
+		return parsePSF1(data)
+	}
+
+	return nil, ErrFormat
+}
+
+func parsePSF1(data []byte) (*Font, error) {
+	if len(data) < 4 {
+		return nil, ErrFormat
+	}
+
+	mode := data[2]
+	f := &Font{
+		Width:    8,
+		Height:   int(data[3]),
+		count:    256,
+		rowBytes: 1,
+		charSize: int(data[3]),
+	}
+
+	if mode&psf1Mode512 != 0 {
+		f.count = 512
+	}
+
+	end := 4 + f.count*f.charSize
+	if f.charSize == 0 || len(data) < end {
+		return nil, fmt.Errorf("%w: truncated glyph data", ErrFormat)
+	}
+
+	f.data = data[4:end]
+
+	if mode&(psf1ModeTab|psf1ModeSeq) == 0 {
+		return f, nil
+	}
+
+	// Each glyph has a list of 16-bit code points, terminated by
+	// 0xFFFF. Sequences of combining characters follow 0xFFFE.
+	f.unicode = make(map[rune]int)
+	tab := data[end:]
+
+	for glyph := 0; glyph < f.count && len(tab) >= 2; glyph++ {
+		seq := false
+
+		for len(tab) >= 2 {
+			v := binary.LittleEndian.Uint16(tab)
+			tab = tab[2:]
+
+			if v == psf1Separator {
+				break
+			}
+
+			if v == psf1StartSeq {
+				seq = true
+			}
+
+			if !seq {
+				f.addRune(rune(v), glyph)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func parsePSF2(data []byte) (*Font, error) {
+	if len(data) < 32 {
+		return nil, ErrFormat
+	}
+
+	le := binary.LittleEndian
+	headerSize := int(le.Uint32(data[8:]))
+	flags := le.Uint32(data[12:])
+	count := int(le.Uint32(data[16:]))
+	charSize := int(le.Uint32(data[20:]))
+	height := int(le.Uint32(data[24:]))
+	width := int(le.Uint32(data[28:]))
+
+	f := &Font{
+		Width:    width,
+		Height:   height,
+		count:    count,
+		rowBytes: (width + 7) / 8,
+		charSize: charSize,
+	}
+
+	if width <= 0 || height <= 0 || count < 0 || charSize < f.rowBytes*height || headerSize < 32 {
+		return nil, fmt.Errorf("%w: invalid header", ErrFormat)
+	}
+
+	// Check the count before multiplying, as the header can hold
+	// sizes whose product overflows.
+	if headerSize > len(data) || count > (len(data)-headerSize)/charSize {
+		return nil, fmt.Errorf("%w: truncated glyph data", ErrFormat)
+	}
+	end := headerSize + count*charSize
+
+	f.data = data[headerSize:end]
+
+	if flags&psf2HasTable == 0 {
+		return f, nil
+	}
+
+	// Each glyph has a list of UTF-8 encoded code points, terminated by
+	// 0xFF. Sequences of combining characters follow 0xFE.
+	f.unicode = make(map[rune]int)
+	tab := data[end:]
+
+	for glyph := 0; glyph < f.count && len(tab) > 0; glyph++ {
+		seq := false
+
+		for len(tab) > 0 {
+			if tab[0] == psf2Separator {
+				tab = tab[1:]
+				break
+			}
+
+			if tab[0] == psf2StartSeq {
+				seq = true
+				tab = tab[1:]
+				continue
+			}
+
+			r, n := utf8.DecodeRune(tab)
+			tab = tab[n:]
+
+			if !seq {
+				f.addRune(r, glyph)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// addRune maps r to the given glyph, unless it is already mapped.
+func (f *Font) addRune(r rune, glyph int) {
+	if _, ok := f.unicode[r]; !ok {
+		f.unicode[r] = glyph
+	}
+}
+
+// Len returns the number of glyphs in the font.
+func (f *Font) Len() int {
+	return f.count
+}
+
+// HasUnicode returns true if the font has a Unicode table.
+// Fonts without one map runes directly to glyph indices.
+func (f *Font) HasUnicode() bool {
+	return f.unicode != nil
+}
+
+// Index returns the glyph index for the given rune.
+// The boolean is false if the font has no glyph for it.
+func (f *Font) Index(r rune) (int, bool) {
+	if f.unicode == nil {
+		if r >= 0 && int(r) < f.count {
+			return int(r), true
+		}
+		return 0, false
+	}
+
+	n, ok := f.unicode[r]
+	return n, ok
+}
+
+// Glyph returns the bitmap for the glyph at the given index. Rows are
+// stored top to bottom, with the leftmost pixel in the most significant
+// bit of the first byte of each row.
+func (f *Font) Glyph(index int) []byte {
+	if index < 0 || index >= f.count {
+		return nil
+	}
+
+	return f.data[index*f.charSize : (index+1)*f.charSize]
+}
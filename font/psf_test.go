@@ -0,0 +1,189 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package font
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// psf1Font builds a 256 glyph, 8x4 PSF1 font with a Unicode table.
+// Glyph n maps to rune n. Glyph 'A' is a diagonal line and also maps
+// to 'Å', along with a combining sequence which must be ignored.
+func psf1Font() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{psf1Magic0, psf1Magic1, psf1ModeTab | psf1ModeSeq, 4})
+
+	for n := 0; n < 256; n++ {
+		if n == 'A' {
+			buf.Write([]byte{0x80, 0x40, 0x20, 0x10})
+		} else {
+			buf.Write([]byte{byte(n), 0, 0, 0})
+		}
+	}
+
+	for n := 0; n < 256; n++ {
+		binary.Write(&buf, binary.LittleEndian, uint16(n))
+		if n == 'A' {
+			binary.Write(&buf, binary.LittleEndian, []uint16{'Å', psf1StartSeq, 'A', 0x030A})
+		}
+		binary.Write(&buf, binary.LittleEndian, uint16(psf1Separator))
+	}
+
+	return buf.Bytes()
+}
+
+// psf2Font builds a gzip-compressed 3 glyph, 5x3 PSF2 font.
+// The glyphs are '?', 'é' and a solid block.
+func psf2Font() []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&buf, le, []uint32{psf2Magic, 0, 32, psf2HasTable, 3, 3, 3, 5})
+
+	buf.Write([]byte{0x70, 0x20, 0x20}) // ?
+	buf.Write([]byte{0x20, 0x70, 0x70}) // é
+	buf.Write([]byte{0xf8, 0xf8, 0xf8}) // █
+
+	buf.WriteString("?\xff")
+	buf.WriteString("é\xfeé\xff")
+	buf.WriteString("█\xff")
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(buf.Bytes())
+	w.Close()
+	return gz.Bytes()
+}
+
+func TestParsePSF1(t *testing.T) {
+	f, err := Parse(psf1Font())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Width != 8 || f.Height != 4 || f.Len() != 256 || !f.HasUnicode() {
+		t.Fatalf("unexpected font: %dx%d, %d glyphs", f.Width, f.Height, f.Len())
+	}
+
+	for _, r := range []rune{'A', 'Å'} {
+		if n, ok := f.Index(r); !ok || n != 'A' {
+			t.Errorf("Index(%q): have %d, %v", r, n, ok)
+		}
+	}
+
+	if _, ok := f.Index(0x030A); ok {
+		t.Errorf("combining sequence was mapped as a single rune")
+	}
+
+	if g := f.Glyph('B'); g[0] != 'B' {
+		t.Errorf("Glyph('B'): have %x", g)
+	}
+}
+
+func TestParsePSF2(t *testing.T) {
+	f, err := Parse(psf2Font())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Width != 5 || f.Height != 3 || f.Len() != 3 {
+		t.Fatalf("unexpected font: %dx%d, %d glyphs", f.Width, f.Height, f.Len())
+	}
+
+	if n, ok := f.Index('█'); !ok || n != 2 {
+		t.Errorf("Index('█'): have %d, %v", n, ok)
+	}
+
+	if _, ok := f.Index('e'); ok {
+		t.Errorf("combining sequence was mapped as a single rune")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte("not a font"))
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("have %v, want ErrFormat", err)
+	}
+
+	_, err = Parse(psf1Font()[:100])
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("truncated: have %v, want ErrFormat", err)
+	}
+
+	// PSF2 headers whose sizes exceed the data, or overflow when
+	// multiplied.
+	for _, hdr := range [][]uint32{
+		{psf2Magic, 0, 32, 0, 0xffffffff, 0xffffffff, 8, 8},
+		{psf2Magic, 0, 32, 0, 0x10000001, 0x10, 8, 8},
+		{psf2Magic, 0, 0xffffff00, 0, 1, 8, 8, 8},
+	} {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, hdr)
+		buf.Write(make([]byte, 32))
+
+		_, err = Parse(buf.Bytes())
+		if !errors.Is(err, ErrFormat) {
+			t.Errorf("header %x: have %v, want ErrFormat", hdr, err)
+		}
+	}
+}
+
+func TestDraw(t *testing.T) {
+	f, err := Parse(psf1Font())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := f.Measure("AB\nC"); size != image.Pt(16, 8) {
+		t.Errorf("Measure: have %v, want (16,8)", size)
+	}
+
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	black := color.RGBA{0, 0, 0, 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 16, 4))
+
+	// Clip to the left half. The second glyph must not be drawn.
+	pt := f.Draw(img, image.Rect(0, 0, 8, 4), "AA", white, black)
+	if pt != image.Pt(16, 0) {
+		t.Errorf("Draw: next point is %v, want (16,0)", pt)
+	}
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 16; x++ {
+			want := color.RGBA{}
+			if x < 8 {
+				want = black
+				if x == y {
+					want = white
+				}
+			}
+
+			if have := img.RGBAAt(x, y); have != want {
+				t.Fatalf("pixel %d,%d: have %v, want %v", x, y, have, want)
+			}
+		}
+	}
+}
+
+func TestDrawTransparent(t *testing.T) {
+	f, err := Parse(psf2Font())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 5, 3))
+
+	// 'x' has no glyph and must be drawn as '?'.
+	f.Draw(img, img.Bounds(), "x", red, nil)
+
+	if img.RGBAAt(1, 0) != red || img.RGBAAt(0, 0) != (color.RGBA{}) {
+		t.Errorf("unexpected fallback glyph rendering")
+	}
+}
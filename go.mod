@@ -1,3 +1,7 @@
 module github.com/sparques/framebuffer
 
 go 1.23.3
+
+require golang.org/x/image v0.30.0
+
+require golang.org/x/text v0.28.0 // indirect
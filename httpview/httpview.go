@@ -0,0 +1,261 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package httpview shows the screen in a web browser. It serves
+// snapshots as PNG, and a live view as a stream of JPEG images.
+//
+// The handler serves these paths:
+//
+//	/              A page showing the live view.
+//	/snapshot.png  The current contents of the screen.
+//	/stream.mjpeg  A multipart/x-mixed-replace stream of JPEG images.
+//
+// Use http.StripPrefix to serve it below some other path.
+package httpview
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Source provides the contents of the screen. It is implemented
+// by *framebuffer.Canvas.
+type Source interface {
+	Snapshot(r image.Rectangle) (*image.RGBA, error)
+}
+
+// Options configures a Handler.
+type Options struct {
+	// Rate is the number of times per second the screen is read
+	// for the stream. Zero means 10.
+	Rate float64
+
+	// Quality is the JPEG quality of the stream, from 1 to 100.
+	// Zero means jpeg.DefaultQuality.
+	Quality int
+
+	// Rect is the area of the screen to show. The zero value
+	// shows the whole screen.
+	Rect image.Rectangle
+}
+
+//go:embed index.html
+var index []byte
+
+// Handler serves the screen over HTTP.
+//
+// The screen is read at most once per frame, no matter how many
+// clients watch, and images are only encoded when its contents
+// changed. Streams skip frames in which nothing changed.
+type Handler struct {
+	src    Source
+	opts   Options
+	period time.Duration
+	mux    *http.ServeMux
+	epoch  string // Prefix of ETags, as frames are counted per handler.
+
+	mu      sync.Mutex
+	cur     *frame
+	encodes int // Images encoded, for testing.
+}
+
+// frame is a snapshot of the screen, along with its encodings,
+// which are made when first needed.
+type frame struct {
+	img   *image.RGBA
+	seq   uint64    // Increases whenever the contents change.
+	taken time.Time // When the contents were last checked.
+	png   []byte
+	jpeg  []byte
+}
+
+// New creates a handler serving src. Opts may be nil.
+func New(src Source, opts *Options) *Handler {
+	h := &Handler{src: src, mux: http.NewServeMux()}
+	h.epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	rate := h.opts.Rate
+	if rate <= 0 {
+		rate = 10
+	}
+	h.period = time.Duration(float64(time.Second) / rate)
+
+	if h.opts.Quality == 0 {
+		h.opts.Quality = jpeg.DefaultQuality
+	}
+
+	h.mux.HandleFunc("GET /{$}", h.serveIndex)
+	h.mux.HandleFunc("GET /snapshot.png", h.serveSnapshot)
+	h.mux.HandleFunc("GET /stream.mjpeg", h.serveStream)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(index)
+}
+
+func (h *Handler) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	data, seq, err := h.encoded(true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The sequence number identifies the contents, so unchanged
+	// screens need not be sent again. The epoch keeps tags from
+	// earlier handlers, such as those of a previous run, apart.
+	etag := fmt.Sprintf(`"%s-%d"`, h.epoch, seq)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func (h *Handler) serveStream(w http.ResponseWriter, r *http.Request) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rc := http.NewResponseController(w)
+	t := time.NewTicker(h.period)
+	defer t.Stop()
+
+	var last uint64
+	for {
+		data, seq, err := h.encoded(false)
+		if err != nil {
+			return
+		}
+
+		if seq != last {
+			last = seq
+
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":   {"image/jpeg"},
+				"Content-Length": {strconv.Itoa(len(data))},
+			})
+			if err != nil {
+				return
+			}
+
+			if _, err := part.Write(data); err != nil {
+				return
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// encoded returns the current screen as PNG or JPEG,
+// along with its sequence number.
+func (h *Handler) encoded(asPNG bool) ([]byte, uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := h.current()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if asPNG && f.png == nil {
+		var b bytes.Buffer
+		if err := png.Encode(&b, f.img); err != nil {
+			return nil, 0, err
+		}
+		f.png = b.Bytes()
+		h.encodes++
+	}
+
+	if !asPNG && f.jpeg == nil {
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, f.img, &jpeg.Options{Quality: h.opts.Quality}); err != nil {
+			return nil, 0, err
+		}
+		f.jpeg = b.Bytes()
+		h.encodes++
+	}
+
+	if asPNG {
+		return f.png, f.seq, nil
+	}
+	return f.jpeg, f.seq, nil
+}
+
+// current returns the contents of the screen. It is read again
+// once per frame; if nothing changed, the previous frame is kept
+// along with its encodings. The caller holds h.mu.
+func (h *Handler) current() (*frame, error) {
+	now := time.Now()
+	if h.cur != nil && now.Sub(h.cur.taken) < h.period {
+		return h.cur, nil
+	}
+
+	img, err := h.src.Snapshot(h.opts.Rect)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cur != nil && same(img, h.cur.img) {
+		h.cur.taken = now
+		return h.cur, nil
+	}
+
+	var seq uint64 = 1
+	if h.cur != nil {
+		seq = h.cur.seq + 1
+	}
+
+	h.cur = &frame{img: img, seq: seq, taken: now}
+	return h.cur, nil
+}
+
+// same reports whether a and b hold the same pixels.
+func same(a, b *image.RGBA) bool {
+	if a.Rect != b.Rect {
+		return false
+	}
+
+	n := a.Rect.Dx() * 4
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		i, j := a.PixOffset(a.Rect.Min.X, y), b.PixOffset(b.Rect.Min.X, y)
+		if !bytes.Equal(a.Pix[i:i+n], b.Pix[j:j+n]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,292 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package httpview
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+// source is a screen the tests draw on.
+type source struct {
+	mu    sync.Mutex
+	img   *image.RGBA
+	reads int
+}
+
+func newSource(w, h int, c color.RGBA) *source {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return &source{img: img}
+}
+
+func (s *source) Snapshot(r image.Rectangle) (*image.RGBA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	if r.Empty() {
+		r = s.img.Rect
+	}
+
+	dst := image.NewRGBA(r)
+	draw.Draw(dst, r, s.img, r.Min, draw.Src)
+	return dst, nil
+}
+
+func (s *source) fill(c color.RGBA) {
+	s.mu.Lock()
+	draw.Draw(s.img, s.img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	s.mu.Unlock()
+}
+
+// counts returns the number of images encoded by h, and
+// the number of times the screen was read.
+func counts(h *Handler, src *source) (encodes, reads int) {
+	h.mu.Lock()
+	encodes = h.encodes
+	h.mu.Unlock()
+
+	src.mu.Lock()
+	reads = src.reads
+	src.mu.Unlock()
+	return encodes, reads
+}
+
+var (
+	red  = color.RGBA{0xff, 0, 0, 0xff}
+	blue = color.RGBA{0, 0, 0xff, 0xff}
+)
+
+func TestIndex(t *testing.T) {
+	srv := httptest.NewServer(New(newSource(4, 4, red), nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `src="stream.mjpeg"`) {
+		t.Fatalf("status %d, body %q", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(srv.URL + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown path: status %d", resp.StatusCode)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	src := newSource(8, 6, red)
+	src.img.SetRGBA(3, 2, blue)
+
+	h := New(src, &Options{Rate: 1000, Rect: image.Rect(2, 2, 6, 5)})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/snapshot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PNG images start at the origin.
+	if img.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Fatalf("bounds %v", img.Bounds())
+	}
+	if c := color.RGBAModel.Convert(img.At(1, 0)); c != blue {
+		t.Errorf("pixel: have %v", c)
+	}
+
+	// The same contents are not sent, or encoded, again.
+	etag := resp.Header.Get("ETag")
+	time.Sleep(2 * time.Millisecond)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/snapshot.png", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unchanged: status %d", resp.StatusCode)
+	}
+
+	if encodes, reads := counts(h, src); encodes != 1 || reads != 2 {
+		t.Errorf("%d encodes, %d reads", encodes, reads)
+	}
+
+	// Changes are.
+	src.fill(blue)
+	time.Sleep(2 * time.Millisecond)
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("changed: status %d, etag %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	// A new handler, as after a restart, does not take tags of the
+	// old one for its own, even though it counts frames from 1 again.
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/snapshot.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	New(src, nil).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("new handler: status %d, etag %s", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestStream(t *testing.T) {
+	src := newSource(16, 16, red)
+	h := New(src, &Options{Rate: 100, Quality: 90})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream.mjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	typ, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || typ != "multipart/x-mixed-replace" {
+		t.Fatalf("content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	next := func(want color.RGBA) {
+		t.Helper()
+
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if typ := part.Header.Get("Content-Type"); typ != "image/jpeg" {
+			t.Fatalf("part type %q", typ)
+		}
+
+		img, err := jpeg.Decode(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := color.RGBAModel.Convert(img.At(8, 8)).(color.RGBA)
+		for _, d := range []int{int(c.R) - int(want.R), int(c.G) - int(want.G), int(c.B) - int(want.B)} {
+			if d < -8 || d > 8 {
+				t.Fatalf("have %v, want %v", c, want)
+			}
+		}
+	}
+
+	next(red)
+
+	// Frames without changes are skipped, and not encoded.
+	time.Sleep(50 * time.Millisecond)
+	if encodes, _ := counts(h, src); encodes != 1 {
+		t.Errorf("%d encodes of an unchanged screen", encodes)
+	}
+
+	src.fill(blue)
+	next(blue)
+}
+
+func TestStreamClients(t *testing.T) {
+	src := newSource(4, 4, red)
+	h := New(src, &Options{Rate: 20})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// Clients share frames, so the screen is read once per frame.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := http.Get(srv.URL + "/stream.mjpeg")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			time.Sleep(200 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	if _, reads := counts(h, src); reads > 6 {
+		t.Errorf("%d reads for 4 clients at 20 fps in 200 ms", reads)
+	}
+}
+
+func TestMemoryCanvas(t *testing.T) {
+	var mode framebuffer.DisplayMode
+	mode.Geometry = framebuffer.Geometry{XRes: 8, YRes: 4, Depth: 16}
+	mode.Format = framebuffer.PixelFormat{RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5}
+
+	c, err := framebuffer.NewMemoryCanvas(&mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, _ := c.Image()
+	img.Set(3, 2, color.White)
+
+	srv := httptest.NewServer(New(c, nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/snapshot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	snap, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := color.RGBAModel.Convert(snap.At(3, 2)); have != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("pixel: have %v", have)
+	}
+}
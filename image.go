@@ -0,0 +1,83 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// NewImage allocates an image with the given pixel format. It is of
+// the same type as Canvas.Image returns for that format, so pixels
+// can be copied between the two without conversion. Formats of less
+// than 8 bits are packed with the leftmost pixel in the most
+// significant bits, and 0 as black. YUV images start out black.
+func NewImage(format PixelFormat, r image.Rectangle) (draw.Image, error) {
+	stride := format.rowSize(r.Dx())
+	if format.Type() == PF_I420 {
+		stride = (stride + 1) &^ 1 // Chroma rows of half the size.
+	}
+
+	p := make([]byte, format.frameSize(stride, r.Dy()))
+	clearYUV(format, p)
+	return newImage(format, packing{}, p, stride, r)
+}
+
+// newImage wraps the pixel memory p in the image type for format.
+// Formats of less than 8 bits are packed as pk describes. The planes
+// of planar formats fill p.
+func newImage(format PixelFormat, pk packing, p []byte, stride int, r image.Rectangle) (draw.Image, error) {
+	switch format.Type() {
+	case PF_RGBA:
+		return &image.RGBA{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_BGRA:
+		return &BGRA{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_RGB_555:
+		return &RGB555{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_RGB_565:
+		return &RGB565{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_BGR_555:
+		return &BGR555{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_BGR_565:
+		return &BGR565{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_INDEXED:
+		return &image.Alpha{Pix: p, Stride: stride, Rect: r}, nil
+
+	case PF_MONO:
+		return &Mono{Pix: p, Stride: stride, Rect: r, Inverse: pk.inverse, LSBFirst: pk.lsbFirst}, nil
+
+	case PF_GRAY_2:
+		return &Gray2{Pix: p, Stride: stride, Rect: r, Inverse: pk.inverse, LSBFirst: pk.lsbFirst}, nil
+
+	case PF_GRAY_4:
+		return &Gray4{Pix: p, Stride: stride, Rect: r, Inverse: pk.inverse, LSBFirst: pk.lsbFirst}, nil
+
+	case PF_YUYV, PF_UYVY, PF_NV12, PF_NV21, PF_I420:
+		return newYUVImage(format, p, stride, r), nil
+	}
+
+	return nil, &ErrUnsupportedFormat{format}
+}
+
+// planes returns the memory of a frame of the given number of rows in
+// mem. Planar formats expect their chroma planes at its end; others
+// take mem as it is.
+func planes(format PixelFormat, mem []byte, stride, rows int) ([]byte, error) {
+	if !format.planar() {
+		return mem, nil
+	}
+
+	n := format.frameSize(stride, rows)
+	if n > len(mem) {
+		return nil, errors.New("framebuffer: memory too small for the planes of the format")
+	}
+	return mem[:n], nil
+}
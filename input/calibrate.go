@@ -0,0 +1,142 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// ErrAborted is returned when calibration ends before
+// all targets have been touched.
+var ErrAborted = errors.New("input: calibration aborted")
+
+// Calibrator runs an interactive calibration. It shows five crosshairs
+// in turn, one near each corner and one in the centre, and records
+// where the user touches them.
+type Calibrator struct {
+	Margin     int         // Distance of the corner targets from the edges. Zero means 50 pixels.
+	Foreground color.Color // Color of the crosshairs. Nil means white.
+	Background color.Color // Color of the screen. Nil means black.
+}
+
+// Targets returns the target positions used for the given screen area.
+func (c *Calibrator) Targets(r image.Rectangle) []image.Point {
+	m := c.Margin
+	if m <= 0 {
+		m = 50
+	}
+
+	return []image.Point{
+		image.Pt(r.Min.X+m, r.Min.Y+m),
+		image.Pt(r.Max.X-m-1, r.Min.Y+m),
+		image.Pt(r.Max.X-m-1, r.Max.Y-m-1),
+		image.Pt(r.Min.X+m, r.Max.Y-m-1),
+		image.Pt(r.Min.X+r.Dx()/2, r.Min.Y+r.Dy()/2),
+	}
+}
+
+// Run draws the calibration targets onto dst and reads touches from
+// events, until all targets have been touched. The events must carry
+// the raw device coordinates, which they do regardless of any mapping
+// set on the device.
+//
+// The returned calibration maps onto the coordinates of dst, which
+// should be the unrotated framebuffer. Set its Rotation afterwards
+// if the displayed image is rotated in software. The bounds of dst
+// must be the visible area: the image of a canvas spans the virtual
+// resolution, so pass a sub-image of the size of the current mode.
+//
+// Events other than touches are ignored. If the channel is
+// closed before calibration is complete, ErrAborted is returned.
+func (c *Calibrator) Run(dst draw.Image, events <-chan Event) (*Calibration, error) {
+	r := dst.Bounds()
+	targets := c.Targets(r)
+	raw := make([]image.Point, 0, len(targets))
+
+	fg, bg := c.Foreground, c.Background
+	if fg == nil {
+		fg = color.White
+	}
+	if bg == nil {
+		bg = color.Black
+	}
+
+	for _, t := range targets {
+		draw.Draw(dst, r, image.NewUniform(bg), image.Point{}, draw.Src)
+		drawCrosshair(dst, t, fg)
+
+		p, err := sample(events)
+		if err != nil {
+			return nil, err
+		}
+
+		raw = append(raw, p)
+	}
+
+	draw.Draw(dst, r, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	cal, err := Fit(targets, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cal.XRes = r.Dx()
+	cal.YRes = r.Dy()
+	return cal, nil
+}
+
+// sample reads a single touch and returns the median
+// of the positions it reported, to filter out noise.
+func sample(events <-chan Event) (image.Point, error) {
+	var xs, ys []int
+
+	for ev := range events {
+		te, ok := ev.(*TouchEvent)
+		if !ok || te.Slot != 0 {
+			continue
+		}
+
+		switch te.State {
+		case TouchDown:
+			xs, ys = xs[:0], ys[:0]
+			fallthrough
+		case TouchMove:
+			xs = append(xs, te.X)
+			ys = append(ys, te.Y)
+		case TouchUp:
+			if len(xs) > 0 {
+				return image.Pt(median(xs), median(ys)), nil
+			}
+		}
+	}
+
+	return image.Point{}, ErrAborted
+}
+
+func median(v []int) int {
+	sort.Ints(v)
+	return v[len(v)/2]
+}
+
+// drawCrosshair draws a calibration target centred on p.
+func drawCrosshair(dst draw.Image, p image.Point, c color.Color) {
+	const size = 10
+
+	for i := -size; i <= size; i++ {
+		dst.Set(p.X+i, p.Y, c)
+		dst.Set(p.X, p.Y+i, c)
+	}
+
+	// A square around the centre makes the target easier to find.
+	for i := -size / 2; i <= size/2; i++ {
+		dst.Set(p.X+i, p.Y-size/2, c)
+		dst.Set(p.X+i, p.Y+size/2, c)
+		dst.Set(p.X-size/2, p.Y+i, c)
+		dst.Set(p.X+size/2, p.Y+i, c)
+	}
+}
@@ -0,0 +1,278 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrCollinear is returned when calibration points do
+// not span an area, so no transform can be derived.
+var ErrCollinear = errors.New("input: calibration points are collinear")
+
+// ErrNoResolution is returned when a calibration with a rotation is
+// used, but the resolution it was made for is unknown. Older
+// pointercal files do not store it.
+var ErrNoResolution = errors.New("input: calibration has a rotation, but no resolution")
+
+// DefaultPointercal is where tslib keeps its calibration, unless
+// the TSLIB_CALIBFILE environment variable says otherwise.
+var DefaultPointercal = "/etc/pointercal"
+
+// pointercalScale is the fixed-point scale tslib uses for the matrix.
+const pointercalScale = 65536
+
+// Rotation defines how the displayed image is rotated in software,
+// relative to the framebuffer. The values match the rot parameter
+// of tslib's linear module.
+type Rotation int
+
+// Known rotations.
+const (
+	Rotate0   Rotation = iota // Not rotated.
+	Rotate90                  // Rotated 90 degrees clockwise.
+	Rotate180                 // Upside down.
+	Rotate270                 // Rotated 90 degrees counter-clockwise.
+)
+
+// Calibration maps raw touch coordinates onto framebuffer pixels
+// using an affine transform:
+//
+//	x' = A*x + B*y + C
+//	y' = D*x + E*y + F
+//
+// The result is then rotated into the coordinate system of the
+// displayed image, if Rotation is set.
+type Calibration struct {
+	A, B, C    float64
+	D, E, F    float64
+	XRes, YRes int      // Framebuffer resolution the calibration was made for.
+	Rotation   Rotation // Software rotation of the displayed image.
+}
+
+// Apply transforms raw device coordinates into screen coordinates.
+// Rotating the result requires XRes and YRes to be set.
+func (c *Calibration) Apply(x, y int) image.Point {
+	fx, fy := float64(x), float64(y)
+	px := int(math.Round(c.A*fx + c.B*fy + c.C))
+	py := int(math.Round(c.D*fx + c.E*fy + c.F))
+
+	switch c.Rotation {
+	case Rotate90:
+		return image.Pt(py, c.XRes-px-1)
+	case Rotate180:
+		return image.Pt(c.XRes-px-1, c.YRes-py-1)
+	case Rotate270:
+		return image.Pt(c.YRes-py-1, px)
+	}
+
+	return image.Pt(px, py)
+}
+
+// Fit computes the calibration which best maps the raw points onto
+// the screen points, in the least-squares sense. At least three
+// points are required, which must not lie on a single line.
+func Fit(screen, raw []image.Point) (*Calibration, error) {
+	if len(screen) != len(raw) {
+		return nil, errors.New("input: Fit: point counts differ")
+	}
+
+	if len(raw) < 3 {
+		return nil, errors.New("input: Fit: at least three points are required")
+	}
+
+	// Normal equations of the linear least squares problem. The
+	// matrix is the same for both axes; only the right side differs.
+	var sx, sy, sxx, sxy, syy float64
+	var bx, by [3]float64
+	n := float64(len(raw))
+
+	for i, p := range raw {
+		x, y := float64(p.X), float64(p.Y)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+		syy += y * y
+
+		X, Y := float64(screen[i].X), float64(screen[i].Y)
+		bx[0] += x * X
+		bx[1] += y * X
+		bx[2] += X
+		by[0] += x * Y
+		by[1] += y * Y
+		by[2] += Y
+	}
+
+	m := [3][3]float64{
+		{sxx, sxy, sx},
+		{sxy, syy, sy},
+		{sx, sy, n},
+	}
+
+	a, ok := solve3(m, bx)
+	if !ok {
+		return nil, ErrCollinear
+	}
+
+	d, _ := solve3(m, by)
+	return &Calibration{
+		A: a[0], B: a[1], C: a[2],
+		D: d[0], E: d[1], F: d[2],
+	}, nil
+}
+
+// solve3 solves the 3x3 linear system m*v = b using Cramer's rule.
+func solve3(m [3][3]float64, b [3]float64) (v [3]float64, ok bool) {
+	det := det3(m)
+
+	// Relative to the magnitude of the entries, so it does not
+	// depend on the range of the device coordinates.
+	var scale float64
+	for _, row := range m {
+		for _, x := range row {
+			scale = math.Max(scale, math.Abs(x))
+		}
+	}
+
+	if scale == 0 || math.Abs(det) < 1e-12*scale*scale*scale {
+		return v, false
+	}
+
+	for i := range v {
+		mi := m
+		for r := range mi {
+			mi[r][i] = b[r]
+		}
+		v[i] = det3(mi) / det
+	}
+
+	return v, true
+}
+
+func det3(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// LoadPointercal reads a calibration from a tslib pointercal file.
+// An empty path means the file named by TSLIB_CALIBFILE, or
+// DefaultPointercal.
+func LoadPointercal(path string) (*Calibration, error) {
+	path = pointercalPath(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := ReadPointercal(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// SavePointercal writes the calibration to a tslib pointercal file.
+// An empty path is interpreted as for LoadPointercal.
+func (c *Calibration) SavePointercal(path string) error {
+	f, err := os.Create(pointercalPath(path))
+	if err != nil {
+		return err
+	}
+
+	err = c.WritePointercal(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func pointercalPath(path string) string {
+	if path != "" {
+		return path
+	}
+
+	if env := os.Getenv("TSLIB_CALIBFILE"); env != "" {
+		return env
+	}
+
+	return DefaultPointercal
+}
+
+// ReadPointercal reads a calibration in tslib's pointercal format:
+// seven integers, being A, B, C, D, E, F scaled by the seventh,
+// optionally followed by the resolution. The rotation is not part
+// of the file; tslib configures it separately. Without a resolution
+// in the file, set XRes and YRes before setting a rotation.
+func ReadPointercal(r io.Reader) (*Calibration, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 7 && len(fields) != 9 {
+		return nil, fmt.Errorf("input: pointercal: expected 7 or 9 values, have %d", len(fields))
+	}
+
+	var v [9]int64
+	for i, f := range fields {
+		v[i], err = strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("input: pointercal: %w", err)
+		}
+	}
+
+	if v[6] == 0 {
+		return nil, errors.New("input: pointercal: zero scale")
+	}
+
+	s := float64(v[6])
+	return &Calibration{
+		A: float64(v[0]) / s, B: float64(v[1]) / s, C: float64(v[2]) / s,
+		D: float64(v[3]) / s, E: float64(v[4]) / s, F: float64(v[5]) / s,
+		XRes: int(v[7]),
+		YRes: int(v[8]),
+	}, nil
+}
+
+// WritePointercal writes the calibration in tslib's pointercal format.
+func (c *Calibration) WritePointercal(w io.Writer) error {
+	fixed := func(f float64) int64 {
+		return int64(math.Round(f * pointercalScale))
+	}
+
+	_, err := fmt.Fprintf(w, "%d %d %d %d %d %d %d %d %d\n",
+		fixed(c.A), fixed(c.B), fixed(c.C),
+		fixed(c.D), fixed(c.E), fixed(c.F),
+		pointercalScale, c.XRes, c.YRes)
+	return err
+}
+
+// Calibrate maps the raw touch coordinates of the device through the
+// given calibration, which is used to compute TouchEvent.Pos.
+// This replaces any mapping set with MapTo.
+//
+// ErrNoResolution is returned if the calibration is rotated, but has
+// no resolution to rotate within.
+func (d *Device) Calibrate(c *Calibration) error {
+	if c.Rotation != Rotate0 && (c.XRes <= 0 || c.YRes <= 0) {
+		return ErrNoResolution
+	}
+
+	d.mapping = c.Apply
+	return nil
+}
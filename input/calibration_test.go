@@ -0,0 +1,226 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resistive simulates a panel whose axes are swapped, mirrored and
+// skewed relative to the display, as is common with resistive panels.
+func resistive(p image.Point) image.Point {
+	return image.Pt(3900-p.Y*7+p.X/10, 200+p.X*5)
+}
+
+func TestFit(t *testing.T) {
+	screen := []image.Point{{50, 50}, {749, 50}, {749, 429}, {50, 429}, {400, 240}}
+	raw := make([]image.Point, len(screen))
+	for i, p := range screen {
+		raw[i] = resistive(p)
+	}
+
+	cal, err := Fit(screen, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []image.Point{{0, 0}, {799, 479}, {123, 321}, {400, 240}} {
+		if have := cal.Apply(resistive(p).X, resistive(p).Y); have != p {
+			t.Errorf("Apply(%v): want %v, have %v", resistive(p), p, have)
+		}
+	}
+
+	// Noise is averaged out.
+	noise := []image.Point{{3, -2}, {-4, 1}, {2, 4}, {-1, -3}, {0, 0}}
+	for i := range raw {
+		raw[i] = raw[i].Add(noise[i])
+	}
+
+	cal, err = Fit(screen, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range screen {
+		have := cal.Apply(raw[i].X, raw[i].Y)
+		if d := have.Sub(p); abs(d.X) > 2 || abs(d.Y) > 2 {
+			t.Errorf("Apply(%v): want about %v, have %v", raw[i], p, have)
+		}
+	}
+
+	_, err = Fit(screen[:3], []image.Point{{0, 0}, {10, 10}, {20, 20}})
+	if !errors.Is(err, ErrCollinear) {
+		t.Fatalf("collinear points: want ErrCollinear, have %v", err)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestRotation(t *testing.T) {
+	cal := &Calibration{A: 1, E: 1, XRes: 800, YRes: 480}
+
+	for _, tt := range []struct {
+		rot  Rotation
+		want image.Point
+	}{
+		{Rotate0, image.Pt(10, 20)},
+		{Rotate90, image.Pt(20, 789)},
+		{Rotate180, image.Pt(789, 459)},
+		{Rotate270, image.Pt(459, 10)},
+	} {
+		cal.Rotation = tt.rot
+		if have := cal.Apply(10, 20); have != tt.want {
+			t.Errorf("rotation %d: want %v, have %v", tt.rot, tt.want, have)
+		}
+	}
+}
+
+func TestPointercal(t *testing.T) {
+	// As written by ts_calibrate.
+	cal, err := ReadPointercal(strings.NewReader("-12 -13856 53791952 8918 21 -3479252 65536 800 480\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cal.XRes != 800 || cal.YRes != 480 || math.Abs(cal.C-53791952.0/65536) > 1e-9 {
+		t.Fatalf("have %+v", cal)
+	}
+
+	var buf bytes.Buffer
+	if err := cal.WritePointercal(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := buf.String(); have != "-12 -13856 53791952 8918 21 -3479252 65536 800 480\n" {
+		t.Fatalf("WritePointercal: have %q", have)
+	}
+
+	// Older versions do not store the resolution.
+	cal, err = ReadPointercal(strings.NewReader("65536 0 0 0 65536 0 65536"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cal.Apply(3, 4); p != image.Pt(3, 4) {
+		t.Fatalf("identity: have %v", p)
+	}
+
+	// Which can not be rotated without knowing it.
+	rotated := *cal
+	rotated.Rotation = Rotate90
+	if err := new(Device).Calibrate(&rotated); !errors.Is(err, ErrNoResolution) {
+		t.Errorf("rotated without resolution: have %v, want ErrNoResolution", err)
+	}
+
+	rotated.XRes, rotated.YRes = 800, 480
+	if err := new(Device).Calibrate(&rotated); err != nil {
+		t.Errorf("rotated with resolution: %v", err)
+	}
+
+	for _, bad := range []string{"", "1 2 3", "1 2 3 4 5 6 0", "a b c d e f g"} {
+		if _, err := ReadPointercal(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pointercal")
+	t.Setenv("TSLIB_CALIBFILE", path)
+
+	if err := cal.SavePointercal(""); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadPointercal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *loaded != *cal {
+		t.Fatalf("LoadPointercal: want %+v, have %+v", cal, loaded)
+	}
+}
+
+func TestCalibrator(t *testing.T) {
+	dst := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	c := &Calibrator{Margin: 20}
+	targets := c.Targets(dst.Bounds())
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+
+		for i, p := range targets {
+			raw := resistive(p)
+
+			// Other events and touches outside slot 0 are ignored.
+			events <- &MotionEvent{DX: 1}
+			events <- &TouchEvent{State: TouchDown, Slot: 1, X: 1, Y: 1}
+
+			events <- &TouchEvent{State: TouchDown, X: raw.X + 40, Y: raw.Y}
+			events <- &TouchEvent{State: TouchMove, X: raw.X, Y: raw.Y + 1}
+			events <- &TouchEvent{State: TouchMove, X: raw.X, Y: raw.Y}
+			events <- &TouchEvent{State: TouchMove, X: raw.X - 1, Y: raw.Y}
+
+			// The crosshair for the current target is visible.
+			if dst.RGBAAt(p.X, p.Y) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+				t.Errorf("target %d at %v not drawn", i, p)
+			}
+
+			events <- &TouchEvent{State: TouchUp, X: raw.X - 1, Y: raw.Y}
+		}
+	}()
+
+	cal, err := c.Run(dst, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cal.XRes != 320 || cal.YRes != 240 {
+		t.Fatalf("resolution: have %dx%d", cal.XRes, cal.YRes)
+	}
+
+	for _, p := range []image.Point{{0, 0}, {319, 239}, {100, 50}} {
+		raw := resistive(p)
+		if have := cal.Apply(raw.X, raw.Y); have != p {
+			t.Errorf("Apply(%v): want %v, have %v", raw, p, have)
+		}
+	}
+
+	events = make(chan Event)
+	close(events)
+	if _, err := c.Run(dst, events); !errors.Is(err, ErrAborted) {
+		t.Fatalf("closed channel: want ErrAborted, have %v", err)
+	}
+}
+
+func TestDeviceCalibrate(t *testing.T) {
+	d := replay(t, "touchscreen-st.evemu")
+	if err := d.Calibrate(&Calibration{A: 0.1, E: 0.1, F: -100, XRes: 400, YRes: 300, Rotation: Rotate180}); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := d.ReadEvent()
+	for err == nil {
+		if te, ok := ev.(*TouchEvent); ok {
+			if te.Pos != image.Pt(299, 99) {
+				t.Fatalf("Pos: want (299,99), have %v", te.Pos)
+			}
+			return
+		}
+		ev, err = d.ReadEvent()
+	}
+
+	t.Fatal(err)
+}
@@ -0,0 +1,286 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"slices"
+
+	"github.com/sparques/framebuffer"
+)
+
+// slot holds the state of a single contact.
+type slot struct {
+	id       int // Tracking ID, or -1 if there is no contact.
+	down     int // Tracking ID of the contact reported as down.
+	x, y     int
+	pressure int
+	major    int
+	active   bool // Contact was reported as down.
+	changed  bool // Slot changed in the current frame.
+}
+
+// maxSlots limits the number of contacts tracked. Devices report
+// far fewer; larger slot numbers are ignored, so a bogus device can
+// not make us allocate huge tables.
+const maxSlots = 64
+
+// decoder turns raw events into typed ones. The kernel sends events
+// in frames, terminated by SYN_REPORT. Everything in a frame is
+// combined and reported once the frame is complete.
+//
+// Multi-touch devices must use protocol B, with slots. Devices which
+// only report ABS_X, ABS_Y and BTN_TOUCH are treated as having a single
+// slot. The legacy protocol A is not supported.
+type decoder struct {
+	dev     *Device
+	keys    framebuffer.KeyState
+	frame   []Event // Events of the current frame.
+	queue   []Event // Events of completed frames.
+	motion  MotionEvent
+	moved   bool
+	abs     map[Axis]int // Changed axes which are not part of a touch.
+	slots   []slot
+	cur     int  // Current slot.
+	mt      bool // Device uses multi-touch slots.
+	single  bool // Device is a single-touch device.
+	dropped bool // Events were dropped; ignore the rest of the frame.
+	nextID  int  // Next tracking ID for single-touch devices.
+}
+
+func (d *decoder) init(dev *Device) {
+	d.dev = dev
+	d.abs = make(map[Axis]int)
+	d.mt = dev.HasAbs(AxisMTX)
+	d.single = !d.mt && dev.HasAbs(AxisX) && dev.keys.has(_BTN_TOUCH)
+
+	n := 1
+	if info, ok := dev.Abs[_ABS_MT_SLOT]; ok && d.mt {
+		n = min(max(info.Max+1, 1), maxSlots)
+	}
+
+	d.slots = make([]slot, n)
+	for i := range d.slots {
+		d.slots[i].id = -1
+	}
+
+	if d.single {
+		d.slots[0].x = dev.Abs[AxisX].Value
+		d.slots[0].y = dev.Abs[AxisY].Value
+	}
+}
+
+// next returns the next decoded event, or nil if there is none.
+func (d *decoder) next() Event {
+	if len(d.queue) == 0 {
+		return nil
+	}
+
+	ev := d.queue[0]
+	d.queue[0] = nil
+	d.queue = d.queue[1:]
+	return ev
+}
+
+// feed decodes a single raw event.
+func (d *decoder) feed(ev inputEvent) {
+	if d.dropped {
+		if ev.typ == _EV_SYN && ev.code == _SYN_REPORT {
+			d.dropped = false
+		}
+		return
+	}
+
+	switch ev.typ {
+	case _EV_SYN:
+		switch ev.code {
+		case _SYN_REPORT:
+			d.report(ev)
+		case _SYN_DROPPED:
+			d.reset()
+			d.dropped = true
+		}
+
+	case _EV_KEY:
+		d.key(ev)
+
+	case _EV_REL:
+		d.moved = true
+		switch ev.code {
+		case _REL_X:
+			d.motion.DX += int(ev.value)
+		case _REL_Y:
+			d.motion.DY += int(ev.value)
+		case _REL_WHEEL:
+			d.motion.Wheel += int(ev.value)
+		case _REL_HWHEEL:
+			d.motion.HWheel += int(ev.value)
+		}
+
+	case _EV_ABS:
+		d.absolute(ev)
+	}
+}
+
+// key handles a key or button event.
+func (d *decoder) key(ev inputEvent) {
+	key := framebuffer.Key(ev.code)
+
+	// Lock keys would toggle on each repeat.
+	if ev.value == 2 && key == framebuffer.KeyCapsLock {
+		return
+	}
+
+	if d.single && ev.code == _BTN_TOUCH {
+		s := &d.slots[0]
+		s.changed = true
+		s.id = -1
+		if ev.value != 0 {
+			s.id = d.nextID
+			d.nextID++
+		}
+	}
+
+	d.frame = append(d.frame, &KeyEvent{
+		KeyEvent: d.keys.Translate(key, ev.value != 0),
+		Repeat:   ev.value == 2,
+	})
+}
+
+// absolute handles an absolute axis event.
+func (d *decoder) absolute(ev inputEvent) {
+	v := int(ev.value)
+
+	if d.mt {
+		if ev.code == _ABS_MT_SLOT {
+			d.cur = v
+			for d.cur >= len(d.slots) && d.cur < maxSlots {
+				d.slots = append(d.slots, slot{id: -1})
+			}
+			return
+		}
+
+		if d.cur < 0 || d.cur >= len(d.slots) {
+			return
+		}
+
+		s := &d.slots[d.cur]
+		switch ev.code {
+		case _ABS_MT_TRACKING_ID:
+			s.id = v
+		case _ABS_MT_POSITION_X:
+			s.x = v
+		case _ABS_MT_POSITION_Y:
+			s.y = v
+		case _ABS_MT_PRESSURE:
+			s.pressure = v
+		case _ABS_MT_TOUCH_MAJOR:
+			s.major = v
+		default:
+			// Single-touch emulation, such as ABS_X, is ignored.
+			if ev.code < _ABS_MT_SLOT {
+				return
+			}
+		}
+
+		s.changed = true
+		return
+	}
+
+	if d.single {
+		s := &d.slots[0]
+		switch ev.code {
+		case _ABS_X:
+			s.x = v
+			s.changed = true
+			return
+		case _ABS_Y:
+			s.y = v
+			s.changed = true
+			return
+		case _ABS_PRESSURE:
+			s.pressure = v
+			s.changed = true
+			return
+		}
+	}
+
+	d.abs[Axis(ev.code)] = v
+}
+
+// report completes a frame.
+func (d *decoder) report(ev inputEvent) {
+	h := Header{Time: eventTime(ev.time), Device: d.dev}
+
+	for _, e := range d.frame {
+		*e.header() = h
+	}
+	d.queue = append(d.queue, d.frame...)
+	d.frame = d.frame[:0]
+
+	if d.moved {
+		m := d.motion
+		m.Header = h
+		d.queue = append(d.queue, &m)
+	}
+
+	axes := make([]Axis, 0, len(d.abs))
+	for axis := range d.abs {
+		axes = append(axes, axis)
+	}
+	slices.Sort(axes)
+
+	for _, axis := range axes {
+		d.queue = append(d.queue, &AbsEvent{Header: h, Axis: axis, Value: d.abs[axis]})
+	}
+
+	for i := range d.slots {
+		s := &d.slots[i]
+		if !s.changed {
+			continue
+		}
+		s.changed = false
+
+		var state TouchState
+		switch {
+		case s.id >= 0 && !s.active:
+			state = TouchDown
+		case s.id >= 0:
+			state = TouchMove
+		case s.active:
+			state = TouchUp
+		default:
+			continue
+		}
+
+		te := &TouchEvent{
+			Header:   h,
+			State:    state,
+			Slot:     i,
+			ID:       s.id,
+			X:        s.x,
+			Y:        s.y,
+			Pressure: s.pressure,
+			Major:    s.major,
+			Pos:      d.dev.toScreen(s.x, s.y),
+		}
+
+		if state == TouchUp {
+			te.ID = s.down
+		}
+
+		s.active = s.id >= 0
+		s.down = s.id
+		d.queue = append(d.queue, te)
+	}
+
+	d.reset()
+}
+
+// reset discards the changes of the current frame.
+func (d *decoder) reset() {
+	d.frame = d.frame[:0]
+	d.motion = MotionEvent{}
+	d.moved = false
+	clear(d.abs)
+}
@@ -0,0 +1,484 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/sparques/framebuffer"
+)
+
+// devInput is the directory holding the event devices.
+var devInput = "/dev/input"
+
+// Kind is a bit set describing the sort of device,
+// derived from the events it supports.
+type Kind uint8
+
+// Known kinds.
+const (
+	Keyboard Kind = 1 << iota
+	Mouse
+	Touchscreen
+	Touchpad
+	Joystick
+)
+
+func (k Kind) String() string {
+	var names []string
+	for i, name := range []string{"keyboard", "mouse", "touchscreen", "touchpad", "joystick"} {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "other"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Axis identifies an absolute axis.
+type Axis uint16
+
+// Common absolute axes.
+const (
+	AxisX        Axis = _ABS_X
+	AxisY        Axis = _ABS_Y
+	AxisPressure Axis = _ABS_PRESSURE
+	AxisMTX      Axis = _ABS_MT_POSITION_X
+	AxisMTY      Axis = _ABS_MT_POSITION_Y
+)
+
+// Rel identifies a relative axis.
+type Rel uint16
+
+// Common relative axes.
+const (
+	RelX      Rel = _REL_X
+	RelY      Rel = _REL_Y
+	RelHWheel Rel = _REL_HWHEEL
+	RelWheel  Rel = _REL_WHEEL
+)
+
+// ID identifies the hardware of a device.
+type ID struct {
+	Bus     uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+}
+
+// AbsInfo describes the range of an absolute axis.
+type AbsInfo struct {
+	Value      int // Value at the time the device was opened.
+	Min, Max   int // Range of values.
+	Fuzz       int // Noise filtered by the kernel.
+	Flat       int // Dead zone, reported as 0.
+	Resolution int // Units per millimeter, or 0 if unknown.
+}
+
+// Info describes an event device and its capabilities.
+type Info struct {
+	Path string // Device node, e.g. /dev/input/event0.
+	Name string // Name reported by the driver.
+	Phys string // Physical location, e.g. usb-0000:00:14.0-1/input0.
+	Uniq string // Unique identifier, e.g. a serial number.
+	ID   ID     // Hardware identifiers.
+	Kind Kind   // Sort of device.
+
+	Abs map[Axis]AbsInfo // Supported absolute axes.
+
+	events bitset
+	keys   bitset
+	rels   bitset
+	props  bitset
+}
+
+// HasKey returns true if the device has the given key or button.
+func (i *Info) HasKey(k framebuffer.Key) bool {
+	return i.keys.has(int(k))
+}
+
+// HasRel returns true if the device has the given relative axis.
+func (i *Info) HasRel(r Rel) bool {
+	return i.rels.has(int(r))
+}
+
+// HasAbs returns true if the device has the given absolute axis.
+func (i *Info) HasAbs(a Axis) bool {
+	_, ok := i.Abs[a]
+	return ok
+}
+
+// classify derives the kind of device from its capabilities.
+func (i *Info) classify() {
+	i.Kind = 0
+
+	if i.HasKey(framebuffer.KeyA) && i.HasKey(framebuffer.KeySpace) {
+		i.Kind |= Keyboard
+	}
+
+	if i.HasRel(RelX) && i.HasRel(RelY) && i.keys.has(_BTN_LEFT) {
+		i.Kind |= Mouse
+	}
+
+	if (i.HasAbs(AxisX) || i.HasAbs(AxisMTX)) && i.keys.has(_BTN_TOUCH) {
+		switch {
+		case i.props.has(_INPUT_PROP_DIRECT):
+			i.Kind |= Touchscreen
+		case i.props.has(_INPUT_PROP_POINTER), i.keys.has(_BTN_TOOL_FINGER):
+			i.Kind |= Touchpad
+		default:
+			i.Kind |= Touchscreen
+		}
+	}
+
+	if i.keys.has(_BTN_JOYSTICK) || i.keys.has(_BTN_GAMEPAD) {
+		i.Kind |= Joystick
+	}
+}
+
+// bitset is a kernel bitmask, as returned by EVIOCGBIT.
+type bitset []byte
+
+func (b bitset) has(n int) bool {
+	return n >= 0 && n/8 < len(b) && b[n/8]&(1<<(n%8)) != 0
+}
+
+// List returns all event devices, in order of their number. Devices
+// which can not be opened, usually for lack of permissions, are
+// included with only their path filled in.
+func List() ([]*Info, error) {
+	paths, err := filepath.Glob(filepath.Join(devInput, "event*"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return eventNumber(paths[i]) < eventNumber(paths[j])
+	})
+
+	var list []*Info
+	for _, path := range paths {
+		info := &Info{Path: path}
+
+		if fd, err := os.OpenFile(path, os.O_RDONLY, 0); err == nil {
+			if i, err := query(fd); err == nil {
+				info = i
+				info.Path = path
+			}
+			fd.Close()
+		}
+
+		list = append(list, info)
+	}
+
+	return list, nil
+}
+
+// eventNumber returns the number of an event device.
+func eventNumber(path string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "event"))
+	return n
+}
+
+// query reads the device information through the EVIOCG* ioctls.
+func query(fd *os.File) (*Info, error) {
+	var info Info
+	var version int32
+
+	err := ioctl(fd.Fd(), _EVIOCGVERSION, unsafe.Pointer(&version))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not an event device: %w", fd.Name(), err)
+	}
+
+	var id inputID
+	if ioctl(fd.Fd(), _EVIOCGID, unsafe.Pointer(&id)) == nil {
+		info.ID = ID{id.bustype, id.vendor, id.product, id.version}
+	}
+
+	info.Name = queryString(fd, _EVIOCGNAME)
+	info.Phys = queryString(fd, _EVIOCGPHYS)
+	info.Uniq = queryString(fd, _EVIOCGUNIQ)
+
+	info.props = queryBits(fd, _EVIOCGPROP(_INPUT_PROP_CNT/8), _INPUT_PROP_CNT)
+	info.events = queryBits(fd, _EVIOCGBIT(0, _EV_CNT/8), _EV_CNT)
+	info.keys = queryBits(fd, _EVIOCGBIT(_EV_KEY, _KEY_CNT/8), _KEY_CNT)
+	info.rels = queryBits(fd, _EVIOCGBIT(_EV_REL, _REL_CNT/8), _REL_CNT)
+	abs := queryBits(fd, _EVIOCGBIT(_EV_ABS, _ABS_CNT/8), _ABS_CNT)
+
+	info.Abs = make(map[Axis]AbsInfo)
+	for a := 0; a < _ABS_CNT; a++ {
+		if !abs.has(a) {
+			continue
+		}
+
+		var ai inputAbsinfo
+		if ioctl(fd.Fd(), _EVIOCGABS(uintptr(a)), unsafe.Pointer(&ai)) == nil {
+			info.Abs[Axis(a)] = AbsInfo{
+				Value:      int(ai.value),
+				Min:        int(ai.minimum),
+				Max:        int(ai.maximum),
+				Fuzz:       int(ai.fuzz),
+				Flat:       int(ai.flat),
+				Resolution: int(ai.resolution),
+			}
+		}
+	}
+
+	info.classify()
+	return &info, nil
+}
+
+// queryString reads a string through one of the EVIOCGNAME-style ioctls.
+func queryString(fd *os.File, req func(uintptr) uintptr) string {
+	var buf [256]byte
+	if ioctl(fd.Fd(), req(uintptr(len(buf))), unsafe.Pointer(&buf[0])) != nil {
+		return ""
+	}
+	return string(bytes.TrimRight(buf[:], "\x00"))
+}
+
+// queryBits reads a bitmask of n bits.
+func queryBits(fd *os.File, req uintptr, n int) bitset {
+	b := make(bitset, n/8)
+	if ioctl(fd.Fd(), req, unsafe.Pointer(&b[0])) != nil {
+		return nil
+	}
+	return b
+}
+
+func ioctl(fd, name uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, name, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Device reads events from an input device.
+// A device must not be read from multiple goroutines at the same time.
+type Device struct {
+	*Info
+
+	f       *os.File  // Event device, or nil for a replay.
+	r       io.Closer // Replay source, if it must be closed.
+	read    func() (inputEvent, error)
+	dec     decoder
+	mapping func(x, y int) image.Point
+}
+
+// Open opens the given event device, e.g. /dev/input/event0.
+func Open(path string) (*Device, error) {
+	fd, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := query(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	info.Path = path
+	d := newDevice(info, newRecordReader(fd))
+	d.f = fd
+	return d, nil
+}
+
+// OpenAll opens all devices of the given kinds. Devices which
+// can not be opened are skipped. It is an error if none can be.
+func OpenAll(kinds Kind) ([]*Device, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	var devs []*Device
+	var lastErr error = errors.New("input: no matching devices")
+
+	for _, info := range list {
+		if info.Name != "" && info.Kind&kinds == 0 {
+			continue
+		}
+
+		d, err := Open(info.Path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if d.Kind&kinds == 0 {
+			d.Close()
+			continue
+		}
+
+		devs = append(devs, d)
+	}
+
+	if len(devs) == 0 {
+		return nil, lastErr
+	}
+
+	return devs, nil
+}
+
+// newDevice creates a device with the given information,
+// reading raw events from read.
+func newDevice(info *Info, read func() (inputEvent, error)) *Device {
+	d := &Device{Info: info, read: read}
+	d.dec.init(d)
+	return d
+}
+
+// Close closes the device.
+func (d *Device) Close() error {
+	if d.f != nil {
+		return d.f.Close()
+	}
+
+	if d.r != nil {
+		return d.r.Close()
+	}
+
+	return nil
+}
+
+// Grab gives us exclusive access to the device, or releases it.
+// While grabbed, events do not reach other programs, nor the
+// console. Closing the device releases it as well.
+func (d *Device) Grab(grab bool) error {
+	if d.f == nil {
+		return errors.New("input: Grab: not an event device")
+	}
+
+	var v uintptr
+	if grab {
+		v = 1
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), _EVIOCGRAB, v)
+	if errno != 0 {
+		return fmt.Errorf("input: Grab %s: %w", d.Path, errno)
+	}
+
+	return nil
+}
+
+// MapTo maps the touch area of the device onto the rectangle r, which
+// is used to compute TouchEvent.Pos. By default, Pos is the same as the
+// device coordinates.
+func (d *Device) MapTo(r image.Rectangle) {
+	xi, ok := d.Abs[AxisMTX]
+	if !ok {
+		xi = d.Abs[AxisX]
+	}
+
+	yi, ok := d.Abs[AxisMTY]
+	if !ok {
+		yi = d.Abs[AxisY]
+	}
+
+	d.mapping = func(x, y int) image.Point {
+		return image.Pt(scale(x, xi.Min, xi.Max, r.Min.X, r.Max.X),
+			scale(y, yi.Min, yi.Max, r.Min.Y, r.Max.Y))
+	}
+}
+
+// MapToCanvas maps the touch area of the device onto the
+// visible area of the canvas.
+func (d *Device) MapToCanvas(c *framebuffer.Canvas) error {
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return err
+	}
+
+	d.MapTo(image.Rect(0, 0, mode.Geometry.XRes, mode.Geometry.YRes))
+	return nil
+}
+
+// scale maps v from the inclusive range [first, last]
+// onto the pixel range [lo, hi), clamping it.
+func scale(v, first, last, lo, hi int) int {
+	if last <= first || hi <= lo {
+		return lo
+	}
+
+	p := lo + int(int64(v-first)*int64(hi-lo)/int64(last-first+1))
+	if p < lo {
+		return lo
+	}
+	if p >= hi {
+		return hi - 1
+	}
+	return p
+}
+
+// toScreen maps device coordinates to screen coordinates.
+func (d *Device) toScreen(x, y int) image.Point {
+	if d.mapping == nil {
+		return image.Pt(x, y)
+	}
+	return d.mapping(x, y)
+}
+
+// ReadEvent blocks until the next event is available. It returns
+// io.EOF at the end of a replay, or an error wrapping os.ErrClosed
+// once the device has been closed.
+func (d *Device) ReadEvent() (Event, error) {
+	for {
+		if ev := d.dec.next(); ev != nil {
+			return ev, nil
+		}
+
+		raw, err := d.read()
+		if err != nil {
+			return nil, err
+		}
+
+		d.dec.feed(raw)
+	}
+}
+
+// newRecordReader reads raw input_event records from r.
+func newRecordReader(r io.Reader) func() (inputEvent, error) {
+	const size = int(unsafe.Sizeof(inputEvent{}))
+	buf := make([]byte, 64*size)
+	var pending []byte
+
+	return func() (inputEvent, error) {
+		for len(pending) < size {
+			m := copy(buf, pending)
+			n, err := r.Read(buf[m:])
+			pending = buf[:m+n]
+
+			if n == 0 && err != nil {
+				return inputEvent{}, err
+			}
+		}
+
+		ev := *(*inputEvent)(unsafe.Pointer(&pending[0]))
+		pending = pending[size:]
+		return ev, nil
+	}
+}
+
+// eventTime converts a kernel timestamp.
+func eventTime(tv syscall.Timeval) time.Time {
+	return time.Unix(int64(tv.Sec), int64(tv.Usec)*1000)
+}
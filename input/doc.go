@@ -0,0 +1,18 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+/*
+Package input reads keyboards, mice and touch screens through the Linux
+evdev interface, at /dev/input/event*.
+
+List enumerates the devices and their capabilities, and Open opens one.
+Raw kernel events are combined into typed events: KeyEvent, MotionEvent,
+AbsEvent and TouchEvent. A Mux merges the events of several devices into
+a single channel.
+
+Touch positions can be mapped onto the screen with Device.MapToCanvas.
+
+Reading event devices usually requires membership of the input group.
+Use Device.Grab to keep events from also reaching the console.
+*/
+package input
@@ -0,0 +1,103 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"image"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Event is one of KeyEvent, MotionEvent, AbsEvent or TouchEvent.
+type Event interface {
+	header() *Header
+}
+
+// Header holds the fields common to all events.
+type Header struct {
+	Time   time.Time // Time the event was generated by the kernel.
+	Device *Device   // Device the event came from, or nil if it was injected.
+}
+
+func (h *Header) header() *Header { return h }
+
+// KeyEvent describes a key or button being pressed or released.
+// Buttons, such as those of a mouse, have a Key above the range
+// of keyboard keys, e.g. BtnLeft.
+//
+// Rune and Modifiers are derived from the keys pressed
+// on the same device, using a US keyboard layout.
+type KeyEvent struct {
+	Header
+	framebuffer.KeyEvent
+	Repeat bool // Key is held down and auto-repeating.
+}
+
+// Common buttons.
+const (
+	BtnLeft   framebuffer.Key = 0x110
+	BtnRight  framebuffer.Key = 0x111
+	BtnMiddle framebuffer.Key = 0x112
+	BtnTouch  framebuffer.Key = 0x14a
+)
+
+// MotionEvent describes relative movement, such as that of a mouse.
+// All movement reported by the device at once is combined.
+//
+// Pointers which know where they are, such as that of a remote
+// display, set Abs, and report their position in screen coordinates.
+type MotionEvent struct {
+	Header
+	DX, DY int         // Movement along the X and Y axes.
+	Wheel  int         // Vertical scroll wheel movement. Positive is away from the user.
+	HWheel int         // Horizontal scroll wheel movement. Positive is to the right.
+	Abs    bool        // Pos is valid.
+	Pos    image.Point // Absolute position, if Abs is set.
+}
+
+// AbsEvent describes a change of an absolute axis which is not part
+// of a touch, such as those of a joystick or a tablet without touch.
+type AbsEvent struct {
+	Header
+	Axis  Axis // Axis which changed.
+	Value int  // New value; see Device.Abs for its range.
+}
+
+// TouchState defines what happened to a contact.
+type TouchState int
+
+// Known touch states.
+const (
+	TouchDown TouchState = iota // Contact was made.
+	TouchMove                   // Contact moved or changed pressure.
+	TouchUp                     // Contact was lifted.
+)
+
+func (s TouchState) String() string {
+	switch s {
+	case TouchDown:
+		return "down"
+	case TouchMove:
+		return "move"
+	case TouchUp:
+		return "up"
+	}
+	return "unknown"
+}
+
+// TouchEvent describes a single contact on a touch screen or touch pad.
+//
+// Multi-touch devices report each contact in its own slot. Devices
+// which only support a single contact always use slot 0.
+type TouchEvent struct {
+	Header
+	State    TouchState
+	Slot     int         // Slot holding the contact.
+	ID       int         // Tracking ID, unique for the duration of the contact.
+	X, Y     int         // Position in device coordinates.
+	Pressure int         // Pressure, or 0 if not supported.
+	Major    int         // Length of the major axis of the contact, or 0 if not supported.
+	Pos      image.Point // Position in screen coordinates; see Device.MapTo.
+}
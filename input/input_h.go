@@ -0,0 +1,124 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+// <linux/input.h> and <linux/input-event-codes.h>
+
+import "syscall"
+
+// inputEvent is struct input_event.
+type inputEvent struct {
+	time  syscall.Timeval
+	typ   uint16
+	code  uint16
+	value int32
+}
+
+// inputID is struct input_id.
+type inputID struct {
+	bustype uint16
+	vendor  uint16
+	product uint16
+	version uint16
+}
+
+// inputAbsinfo is struct input_absinfo.
+type inputAbsinfo struct {
+	value      int32
+	minimum    int32
+	maximum    int32
+	fuzz       int32
+	flat       int32
+	resolution int32
+}
+
+// Event types.
+const (
+	_EV_SYN = 0x00
+	_EV_KEY = 0x01
+	_EV_REL = 0x02
+	_EV_ABS = 0x03
+	_EV_MSC = 0x04
+	_EV_CNT = 0x20
+)
+
+// Synchronization events.
+const (
+	_SYN_REPORT  = 0
+	_SYN_DROPPED = 3
+)
+
+// Relative axes.
+const (
+	_REL_X      = 0x00
+	_REL_Y      = 0x01
+	_REL_HWHEEL = 0x06
+	_REL_WHEEL  = 0x08
+	_REL_CNT    = 0x10
+)
+
+// Absolute axes.
+const (
+	_ABS_X              = 0x00
+	_ABS_Y              = 0x01
+	_ABS_PRESSURE       = 0x18
+	_ABS_MT_SLOT        = 0x2f
+	_ABS_MT_TOUCH_MAJOR = 0x30
+	_ABS_MT_POSITION_X  = 0x35
+	_ABS_MT_POSITION_Y  = 0x36
+	_ABS_MT_TRACKING_ID = 0x39
+	_ABS_MT_PRESSURE    = 0x3a
+	_ABS_CNT            = 0x40
+)
+
+// Keys and buttons which determine the kind of device.
+const (
+	_BTN_MOUSE       = 0x110
+	_BTN_LEFT        = 0x110
+	_BTN_JOYSTICK    = 0x120
+	_BTN_GAMEPAD     = 0x130
+	_BTN_TOOL_FINGER = 0x145
+	_BTN_TOUCH       = 0x14a
+	_KEY_CNT         = 0x300
+)
+
+// Device properties.
+const (
+	_INPUT_PROP_POINTER = 0x00
+	_INPUT_PROP_DIRECT  = 0x01
+	_INPUT_PROP_CNT     = 0x20
+)
+
+const (
+	_IOC_WRITE = 1
+	_IOC_READ  = 2
+)
+
+func _IOC(dir, t, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | t<<8 | nr
+}
+
+var (
+	_EVIOCGVERSION = _IOC(_IOC_READ, 'E', 0x01, 4)
+	_EVIOCGID      = _IOC(_IOC_READ, 'E', 0x02, 8)
+	_EVIOCGRAB     = _IOC(_IOC_WRITE, 'E', 0x90, 4)
+)
+
+// get name
+func _EVIOCGNAME(size uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x06, size) }
+
+// get physical location
+func _EVIOCGPHYS(size uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x07, size) }
+
+// get unique identifier
+func _EVIOCGUNIQ(size uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x08, size) }
+
+// get device properties
+func _EVIOCGPROP(size uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x09, size) }
+
+// get event bits
+func _EVIOCGBIT(ev, size uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x20+ev, size) }
+
+// get abs value/limits
+func _EVIOCGABS(abs uintptr) uintptr { return _IOC(_IOC_READ, 'E', 0x40+abs, 24) }
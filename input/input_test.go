@@ -0,0 +1,332 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/sparques/framebuffer"
+)
+
+func replay(t *testing.T, name string) *Device {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Replay(f)
+	if err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// readAll reads all events, clearing their headers for comparison.
+func readAll(t *testing.T, d *Device) []Event {
+	t.Helper()
+
+	var list []Event
+	for {
+		ev, err := d.ReadEvent()
+		if err == io.EOF {
+			return list
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h := ev.header(); h.Device != d {
+			t.Fatalf("%T: wrong device", ev)
+		}
+		*ev.header() = Header{}
+		list = append(list, ev)
+	}
+}
+
+func compare(t *testing.T, have, want []Event) {
+	t.Helper()
+
+	if len(have) != len(want) {
+		t.Fatalf("want %d events, have %d", len(want), len(have))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(have[i], want[i]) {
+			t.Fatalf("event %d:\nwant %+v\nhave %+v", i, want[i], have[i])
+		}
+	}
+}
+
+func key(k framebuffer.Key, r rune, mod framebuffer.Modifiers, pressed, repeat bool) *KeyEvent {
+	return &KeyEvent{
+		KeyEvent: framebuffer.KeyEvent{Key: k, Rune: r, Modifiers: mod, Pressed: pressed},
+		Repeat:   repeat,
+	}
+}
+
+func TestReplayKeyboard(t *testing.T) {
+	d := replay(t, "keyboard.evemu")
+
+	if d.Name != "AT Translated Set 2 keyboard" {
+		t.Fatalf("Name: have %q", d.Name)
+	}
+
+	if d.ID != (ID{Bus: 0x11, Vendor: 1, Product: 1, Version: 0xab41}) {
+		t.Fatalf("ID: have %+v", d.ID)
+	}
+
+	if d.Kind != Keyboard {
+		t.Fatalf("Kind: want keyboard, have %v", d.Kind)
+	}
+
+	shift := framebuffer.ModShift
+	compare(t, readAll(t, d), []Event{
+		key(framebuffer.KeyLeftShift, 0, shift, true, false),
+		key(framebuffer.KeyH, 'H', shift, true, false),
+		key(framebuffer.KeyH, 'H', shift, false, false),
+		key(framebuffer.KeyLeftShift, 0, 0, false, false),
+		key(framebuffer.KeyI, 'i', 0, true, false),
+		key(framebuffer.KeyI, 'i', 0, true, true),
+		key(framebuffer.KeyI, 'i', 0, false, false),
+		key(framebuffer.KeyCapsLock, 0, 0, true, false),
+		key(framebuffer.KeyCapsLock, 0, 0, false, false),
+		key(framebuffer.KeyI, 'I', 0, true, false),
+	})
+}
+
+func TestReplayMouse(t *testing.T) {
+	d := replay(t, "mouse.evemu")
+
+	if d.Kind != Mouse {
+		t.Fatalf("Kind: want mouse, have %v", d.Kind)
+	}
+
+	if !d.HasRel(RelWheel) || !d.HasKey(BtnMiddle) || d.HasRel(Rel(2)) {
+		t.Fatal("wrong capabilities")
+	}
+
+	compare(t, readAll(t, d), []Event{
+		&MotionEvent{DX: 3, DY: -2},
+		&MotionEvent{DX: 1},
+		key(BtnLeft, 0, 0, true, false),
+		&MotionEvent{Wheel: -1},
+		key(BtnLeft, 0, 0, false, false),
+	})
+}
+
+func TestReplayMultiTouch(t *testing.T) {
+	d := replay(t, "touchscreen-mt.evemu")
+
+	if d.Kind != Touchscreen {
+		t.Fatalf("Kind: want touchscreen, have %v", d.Kind)
+	}
+
+	if ai := d.Abs[AxisMTX]; ai.Max != 4095 {
+		t.Fatalf("Abs: have %+v", ai)
+	}
+
+	d.MapTo(image.Rect(0, 0, 800, 480))
+
+	compare(t, readAll(t, d), []Event{
+		key(BtnTouch, 0, 0, true, false),
+		&TouchEvent{State: TouchDown, Slot: 0, ID: 10, X: 2048, Y: 1024, Pos: image.Pt(400, 120)},
+		&TouchEvent{State: TouchMove, Slot: 0, ID: 10, X: 2050, Y: 1024, Pos: image.Pt(400, 120)},
+		&TouchEvent{State: TouchDown, Slot: 1, ID: 11, X: 100, Y: 200, Pos: image.Pt(19, 23)},
+		&TouchEvent{State: TouchUp, Slot: 0, ID: 10, X: 2050, Y: 1024, Pos: image.Pt(400, 120)},
+		key(BtnTouch, 0, 0, false, false),
+		&TouchEvent{State: TouchUp, Slot: 1, ID: 11, X: 100, Y: 200, Pos: image.Pt(19, 23)},
+	})
+}
+
+func TestSlotLimit(t *testing.T) {
+	d, err := Replay(bytes.NewBufferString(`N: bogus
+B: 00 0b 00 00 00 00 00 00 00
+B: 03 00 00 00 00 00 80 60 02
+A: 2f 0 2147483646 0 0 0
+A: 35 0 4095 0 0 0
+A: 36 0 4095 0 0 0
+A: 39 0 65535 0 0 0
+E: 0.000000 0003 002f 2000000000
+E: 0.000000 0003 0039 0010
+E: 0.000000 0003 0035 0100
+E: 0.000000 0000 0000 0000
+E: 0.010000 0003 002f 0000
+E: 0.010000 0003 0039 0011
+E: 0.010000 0003 0035 0200
+E: 0.010000 0000 0000 0000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if len(d.dec.slots) > maxSlots {
+		t.Fatalf("%d slots", len(d.dec.slots))
+	}
+
+	// The contact in the slot beyond the limit is ignored.
+	compare(t, readAll(t, d), []Event{
+		&TouchEvent{State: TouchDown, Slot: 0, ID: 11, X: 200, Pos: image.Pt(200, 0)},
+	})
+}
+
+func TestReplaySingleTouch(t *testing.T) {
+	d := replay(t, "touchscreen-st.evemu")
+
+	if d.Kind != Touchscreen {
+		t.Fatalf("Kind: want touchscreen, have %v", d.Kind)
+	}
+
+	compare(t, readAll(t, d), []Event{
+		key(BtnTouch, 0, 0, true, false),
+		&TouchEvent{State: TouchDown, X: 1000, Y: 3000, Pressure: 100, Pos: image.Pt(1000, 3000)},
+		&TouchEvent{State: TouchMove, X: 1010, Y: 3000, Pressure: 100, Pos: image.Pt(1010, 3000)},
+		key(BtnTouch, 0, 0, false, false),
+		&TouchEvent{State: TouchUp, X: 1010, Y: 3000, Pos: image.Pt(1010, 3000)},
+	})
+}
+
+// encode creates raw input_event records, as read from a device.
+func encode(events ...inputEvent) []byte {
+	var buf bytes.Buffer
+	for _, ev := range events {
+		buf.Write(unsafe.Slice((*byte)(unsafe.Pointer(&ev)), unsafe.Sizeof(ev)))
+	}
+	return buf.Bytes()
+}
+
+// oneByteReader returns a single byte per read, to test reassembly of records.
+type oneByteReader struct{ r io.Reader }
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	return o.r.Read(p[:1])
+}
+
+func TestRecords(t *testing.T) {
+	tv := syscall.NsecToTimeval(int64(1500 * time.Millisecond))
+	data := encode(
+		inputEvent{tv, _EV_REL, _REL_X, 5},
+		inputEvent{tv, _EV_SYN, _SYN_REPORT, 0},
+		inputEvent{tv, _EV_REL, _REL_X, 7},
+		inputEvent{tv, _EV_SYN, _SYN_DROPPED, 0},
+		inputEvent{tv, _EV_REL, _REL_Y, 9},
+		inputEvent{tv, _EV_SYN, _SYN_REPORT, 0},
+		inputEvent{tv, _EV_REL, _REL_Y, 1},
+		inputEvent{tv, _EV_SYN, _SYN_REPORT, 0},
+	)
+
+	info := &Info{}
+	d := newDevice(info, newRecordReader(oneByteReader{bytes.NewReader(data)}))
+
+	ev, err := d.ReadEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := ev.(*MotionEvent); !ok || m.DX != 5 || !m.Time.Equal(time.Unix(1, 5e8)) {
+		t.Fatalf("want motion 5,0 at 1.5s, have %+v", ev)
+	}
+
+	// Everything up to the report after SYN_DROPPED is discarded.
+	ev, err = d.ReadEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := ev.(*MotionEvent); !ok || m.DX != 0 || m.DY != 1 {
+		t.Fatalf("want motion 0,1, have %+v", ev)
+	}
+
+	if _, err = d.ReadEvent(); err != io.EOF {
+		t.Fatalf("want EOF, have %v", err)
+	}
+}
+
+func TestMux(t *testing.T) {
+	m := NewMux(replay(t, "mouse.evemu"), replay(t, "keyboard.evemu"))
+
+	var keys, motions int
+	for i := 0; i < 15; i++ {
+		switch (<-m.Events()).(type) {
+		case *KeyEvent:
+			keys++
+		case *MotionEvent:
+			motions++
+		}
+	}
+
+	if keys != 12 || motions != 3 {
+		t.Fatalf("want 12 keys and 3 motions, have %d and %d", keys, motions)
+	}
+
+	injected := &MotionEvent{DX: 42}
+	go m.Inject(injected)
+	if ev := <-m.Events(); ev != injected {
+		t.Fatalf("want injected event, have %+v", ev)
+	}
+
+	if err := m.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-m.Events(); ok {
+		t.Fatal("channel not closed")
+	}
+
+	if m.Inject(injected) {
+		t.Fatal("Inject succeeded after Close")
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	_, err := Replay(bytes.NewBufferString("N: test\nX: bogus\n"))
+	if err == nil {
+		t.Fatal("expected error for unknown line")
+	}
+
+	d, err := Replay(bytes.NewBufferString("N: test\nE: 0.000000 0002 zz 0001\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = d.ReadEvent(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected parse error, have %v", err)
+	}
+}
+
+func TestScale(t *testing.T) {
+	for _, tt := range []struct{ v, min, max, lo, hi, want int }{
+		{0, 0, 4095, 0, 800, 0},
+		{4095, 0, 4095, 0, 800, 799},
+		{2048, 0, 4095, 0, 800, 400},
+		{-10, 0, 4095, 0, 800, 0},
+		{5000, 0, 4095, 0, 800, 799},
+		{150, 100, 199, 10, 20, 15},
+		{5, 5, 5, 0, 800, 0},
+	} {
+		if have := scale(tt.v, tt.min, tt.max, tt.lo, tt.hi); have != tt.want {
+			t.Errorf("scale(%d, %d, %d, %d, %d): want %d, have %d",
+				tt.v, tt.min, tt.max, tt.lo, tt.hi, tt.want, have)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Mux merges the events of multiple devices into a single channel.
+// Each device is read in its own goroutine.
+//
+// Events can also be injected from other sources, such as a remote
+// display, so they are handled the same way as local input.
+type Mux struct {
+	events chan Event
+	done   chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	devs   []*Device
+	err    error
+	closed bool
+}
+
+// NewMux creates a Mux reading from the given devices.
+// More devices can be added later with Add.
+func NewMux(devs ...*Device) *Mux {
+	m := &Mux{
+		events: make(chan Event, 64),
+		done:   make(chan struct{}),
+	}
+
+	for _, d := range devs {
+		m.Add(d)
+	}
+
+	return m
+}
+
+// Events returns the channel on which all events are delivered.
+// It is closed by Close.
+func (m *Mux) Events() <-chan Event {
+	return m.events
+}
+
+// Add starts reading events from the given device. The device
+// is closed along with the Mux. Adding to a closed Mux closes
+// the device.
+func (m *Mux) Add(d *Device) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		d.Close()
+		return
+	}
+
+	m.devs = append(m.devs, d)
+	m.wg.Add(1)
+	go m.read(d)
+}
+
+// read delivers events from d until it fails or the Mux is closed.
+func (m *Mux) read(d *Device) {
+	defer m.wg.Done()
+
+	for {
+		ev, err := d.ReadEvent()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				m.mu.Lock()
+				if m.err == nil {
+					m.err = err
+				}
+				m.mu.Unlock()
+			}
+			return
+		}
+
+		if !m.send(ev) {
+			return
+		}
+	}
+}
+
+// Inject delivers an event as if it came from one of the devices.
+// It blocks until the event is received, and returns false if the
+// Mux was closed in the meantime.
+func (m *Mux) Inject(ev Event) bool {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return false
+	}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	defer m.wg.Done()
+	return m.send(ev)
+}
+
+// send delivers an event, unless the Mux is closed first.
+func (m *Mux) send(ev Event) bool {
+	select {
+	case m.events <- ev:
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// Err returns the first error reading from any of the devices,
+// other than reaching the end of a replay. A device which fails,
+// for instance because it was unplugged, stops delivering events.
+func (m *Mux) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Close closes all devices and the event channel.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	close(m.done)
+
+	var err error
+	for _, d := range m.devs {
+		if e := d.Close(); err == nil {
+			err = e
+		}
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	close(m.events)
+	return err
+}
@@ -0,0 +1,214 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package input
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Replay creates a device which replays events recorded with
+// evemu-record. The device description is read from the recording,
+// after which ReadEvent returns the recorded events, as fast as they
+// are read. It returns io.EOF at the end of the recording.
+//
+// If r is an io.Closer, it is closed along with the device.
+func Replay(r io.Reader) (*Device, error) {
+	s := bufio.NewScanner(r)
+	info := &Info{Abs: make(map[Axis]AbsInfo)}
+
+	if f, ok := r.(*os.File); ok {
+		info.Path = f.Name()
+	}
+
+	var line int
+	var first string
+
+	for s.Scan() {
+		line++
+
+		text, _, _ := strings.Cut(s.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "E:") {
+			first = text
+			break
+		}
+
+		err := parseHeader(info, text)
+		if err != nil {
+			return nil, fmt.Errorf("input: replay line %d: %w", line, err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	info.classify()
+
+	read := func() (inputEvent, error) {
+		for first == "" {
+			if !s.Scan() {
+				if err := s.Err(); err != nil {
+					return inputEvent{}, err
+				}
+				return inputEvent{}, io.EOF
+			}
+
+			line++
+			text, _, _ := strings.Cut(s.Text(), "#")
+			first = strings.TrimSpace(text)
+		}
+
+		text := first
+		first = ""
+
+		ev, err := parseEvent(text)
+		if err != nil {
+			return ev, fmt.Errorf("input: replay line %d: %w", line, err)
+		}
+		return ev, nil
+	}
+
+	d := newDevice(info, read)
+	if c, ok := r.(io.Closer); ok {
+		d.r = c
+	}
+
+	return d, nil
+}
+
+// parseHeader parses a line of the device description.
+func parseHeader(info *Info, line string) error {
+	kind, rest, _ := strings.Cut(line, ":")
+	rest = strings.TrimSpace(rest)
+	fields := strings.Fields(rest)
+
+	switch kind {
+	case "N":
+		info.Name = rest
+
+	case "I":
+		v, err := parseHex(fields, 4)
+		if err != nil {
+			return err
+		}
+		info.ID = ID{uint16(v[0]), uint16(v[1]), uint16(v[2]), uint16(v[3])}
+
+	case "P":
+		v, err := parseHex(fields, len(fields))
+		if err != nil {
+			return err
+		}
+		info.props = appendBits(info.props, v)
+
+	case "B":
+		v, err := parseHex(fields, len(fields))
+		if err != nil || len(v) == 0 {
+			return fmt.Errorf("invalid bits %q", rest)
+		}
+
+		switch v[0] {
+		case 0:
+			info.events = appendBits(info.events, v[1:])
+		case _EV_KEY:
+			info.keys = appendBits(info.keys, v[1:])
+		case _EV_REL:
+			info.rels = appendBits(info.rels, v[1:])
+		}
+
+	case "A":
+		if len(fields) < 5 {
+			return fmt.Errorf("invalid axis %q", rest)
+		}
+
+		code, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return err
+		}
+
+		var v [5]int
+		for i := 1; i < len(fields) && i <= len(v); i++ {
+			v[i-1], err = strconv.Atoi(fields[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		info.Abs[Axis(code)] = AbsInfo{Min: v[0], Max: v[1], Fuzz: v[2], Flat: v[3], Resolution: v[4]}
+
+	case "L", "S":
+		// LED and switch states are not used.
+
+	default:
+		return fmt.Errorf("unknown line %q", line)
+	}
+
+	return nil
+}
+
+// parseEvent parses an event line: E: <sec>.<usec> <type> <code> <value>
+func parseEvent(line string) (inputEvent, error) {
+	var ev inputEvent
+
+	fields := strings.Fields(strings.TrimPrefix(line, "E:"))
+	if len(fields) != 4 {
+		return ev, fmt.Errorf("invalid event %q", line)
+	}
+
+	sec, usec, _ := strings.Cut(fields[0], ".")
+	s, err1 := strconv.ParseInt(sec, 10, 64)
+	us, err2 := strconv.ParseInt(usec, 10, 64)
+	typ, err3 := strconv.ParseUint(fields[1], 16, 16)
+	code, err4 := strconv.ParseUint(fields[2], 16, 16)
+	value, err5 := strconv.ParseInt(fields[3], 10, 32)
+
+	for _, err := range []error{err1, err2, err3, err4, err5} {
+		if err != nil {
+			return ev, fmt.Errorf("invalid event %q: %w", line, err)
+		}
+	}
+
+	ev.time = syscall.NsecToTimeval(s*1e9 + us*1e3)
+	ev.typ = uint16(typ)
+	ev.code = uint16(code)
+	ev.value = int32(value)
+	return ev, nil
+}
+
+// parseHex parses n hexadecimal numbers.
+func parseHex(fields []string, n int) ([]int, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d values, have %d", n, len(fields))
+	}
+
+	v := make([]int, n)
+	for i := range v {
+		x, err := strconv.ParseUint(fields[i], 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = int(x)
+	}
+
+	return v, nil
+}
+
+// appendBits appends bytes of a bitmask. The bitmask is spread over
+// multiple lines, each continuing where the previous one ended.
+func appendBits(b bitset, v []int) bitset {
+	for _, x := range v {
+		b = append(b, byte(x))
+	}
+	return b
+}
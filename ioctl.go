@@ -9,12 +9,29 @@ import (
 	"unsafe"
 )
 
+// sysIoctl performs the actual ioctl system call. Exactly one of ptr
+// and val is used as the argument, depending on whether ptr is nil.
+//
+// It is a variable, so tests can substitute an emulated device.
+var sysIoctl = func(fd, name uintptr, ptr unsafe.Pointer, val uintptr) syscall.Errno {
+	var errno syscall.Errno
+
+	if ptr != nil {
+		_, _, errno = syscall.RawSyscall(syscall.SYS_IOCTL, fd, name, uintptr(ptr))
+	} else {
+		_, _, errno = syscall.RawSyscall(syscall.SYS_IOCTL, fd, name, val)
+	}
+
+	return errno
+}
+
 func ioctl(fd, name uintptr, data interface{}) error {
+	var p unsafe.Pointer
 	var v uintptr
 
 	switch dd := data.(type) {
 	case unsafe.Pointer:
-		v = uintptr(dd)
+		p = dd
 
 	case int:
 		v = uintptr(dd)
@@ -26,12 +43,12 @@ func ioctl(fd, name uintptr, data interface{}) error {
 		return fmt.Errorf("ioctl: Invalid argument.")
 	}
 
-	_, _, errno := syscall.RawSyscall(syscall.SYS_IOCTL, fd, name, v)
+	errno := sysIoctl(fd, name, p, v)
 	if errno == 0 {
 		return nil
 	}
 
-	return errno
+	return &IoctlError{Op: ioctlName(name), Request: name, Errno: errno}
 }
 
 const (
@@ -9,4 +9,12 @@ const (
 	_KD_GRAPHICS = 0x01
 	_KDSETMODE   = 0x4B3A // set text/graphics mode
 	_KDGETMODE   = 0x4B3B // get current mode
+
+	_K_RAW       = 0x00   // raw (scancode) mode
+	_K_XLATE     = 0x01   // translate keycodes using keymap
+	_K_MEDIUMRAW = 0x02   // medium raw (keycode) mode
+	_K_UNICODE   = 0x03   // unicode mode
+	_K_OFF       = 0x04   // disabled mode
+	_KDGKBMODE   = 0x4B44 // gets current keyboard mode
+	_KDSKBMODE   = 0x4B45 // sets current keyboard mode
 )
@@ -0,0 +1,352 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"os"
+	"syscall"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Flags for KeyboardFromTTY.
+const (
+	// KeyboardMediumRaw switches the console keyboard to K_MEDIUMRAW,
+	// which reports keycodes for every key press and release, including
+	// modifier keys. This only works on a virtual terminal. While in this
+	// mode, the kernel does not handle key combinations such as Alt+Fn
+	// to switch consoles, so the program has to do so itself.
+	KeyboardMediumRaw = 1 << iota
+)
+
+// KeyEvent describes a key being pressed or released.
+type KeyEvent struct {
+	Key       Key       // Key which was pressed or released.
+	Rune      rune      // Printable character produced by the key, or 0.
+	Modifiers Modifiers // Modifier keys held down.
+	Pressed   bool      // True for key presses, false for releases.
+}
+
+// Keyboard reads key events from a tty.
+//
+// By default, the tty is put in raw mode and the escape sequences it
+// sends are decoded. Only key presses are reported in this mode, and
+// modifiers are only known as far as the sequences encode them.
+// With KeyboardMediumRaw, keycodes are read directly from the console,
+// which reports releases and modifiers as well.
+//
+// Either way, signal generating keys such as Ctrl+C are delivered as
+// key events, not as signals.
+type Keyboard struct {
+	tty     *os.File
+	termios syscall.Termios // Original terminal settings.
+	kbMode  int             // Original keyboard mode; -1 if unchanged.
+	buf     [64]byte
+	queue   []KeyEvent // Decoded events not yet returned.
+	partial []byte     // Incomplete multi-byte keycode.
+	state   KeyState   // Modifier state, in medium raw mode.
+}
+
+// KeyboardFromTTY starts reading key events from the given tty.
+// Close must be called to restore the tty to its original state.
+// The tty itself is not closed.
+//
+// flags is a bit set of Keyboard* flags.
+func KeyboardFromTTY(tty *os.File, flags int) (kb *Keyboard, err error) {
+	kb = &Keyboard{tty: tty, kbMode: -1}
+
+	err = ioctl(tty.Fd(), syscall.TCGETS, unsafe.Pointer(&kb.termios))
+	if err != nil {
+		return nil, notVT(tty)
+	}
+
+	// Equivalent of cfmakeraw(3).
+	raw := kb.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	err = ioctl(tty.Fd(), syscall.TCSETS, unsafe.Pointer(&raw))
+	if err != nil {
+		return nil, err
+	}
+
+	if flags&KeyboardMediumRaw == 0 {
+		return kb, nil
+	}
+
+	var mode int32
+	err = ioctl(tty.Fd(), _KDGKBMODE, unsafe.Pointer(&mode))
+	if err == nil {
+		err = ioctl(tty.Fd(), _KDSKBMODE, _K_MEDIUMRAW)
+	}
+
+	if err != nil {
+		ioctl(tty.Fd(), syscall.TCSETS, unsafe.Pointer(&kb.termios))
+		return nil, notVT(tty)
+	}
+
+	kb.kbMode = int(mode)
+	return kb, nil
+}
+
+// Close restores the original keyboard mode and terminal settings.
+func (kb *Keyboard) Close() (err error) {
+	if kb.kbMode >= 0 {
+		err = ioctl(kb.tty.Fd(), _KDSKBMODE, kb.kbMode)
+		kb.kbMode = -1
+	}
+
+	if e := ioctl(kb.tty.Fd(), syscall.TCSETS, unsafe.Pointer(&kb.termios)); err == nil {
+		err = e
+	}
+
+	return
+}
+
+// ReadEvent blocks until the next key event is available.
+func (kb *Keyboard) ReadEvent() (KeyEvent, error) {
+	for len(kb.queue) == 0 {
+		n, err := kb.tty.Read(kb.buf[:])
+		if n == 0 && err != nil {
+			return KeyEvent{}, err
+		}
+
+		if kb.kbMode >= 0 {
+			kb.decodeKeycodes(kb.buf[:n])
+		} else {
+			kb.decodeSequences(kb.buf[:n])
+		}
+	}
+
+	ev := kb.queue[0]
+	kb.queue = kb.queue[1:]
+	return ev, nil
+}
+
+// decodeKeycodes decodes K_MEDIUMRAW data. Each byte holds a keycode
+// in the low 7 bits and a release flag in the high bit. Larger keycodes
+// are sent as a zero keycode, followed by two bytes with 7 bits each.
+func (kb *Keyboard) decodeKeycodes(b []byte) {
+	data := append(kb.partial, b...)
+	kb.partial = nil
+
+	for len(data) > 0 {
+		pressed := data[0]&0x80 == 0
+		code := Key(data[0] & 0x7f)
+
+		if code == 0 {
+			if len(data) < 3 {
+				kb.partial = append([]byte(nil), data...)
+				return
+			}
+
+			code = Key(data[1]&0x7f)<<7 | Key(data[2]&0x7f)
+			data = data[3:]
+		} else {
+			data = data[1:]
+		}
+
+		kb.queue = append(kb.queue, kb.state.Translate(code, pressed))
+	}
+}
+
+// decodeSequences decodes the characters and escape sequences which
+// a terminal sends for key presses. Sequences are expected to arrive
+// in a single read, which is how an ESC on its own is told apart from
+// the start of a sequence.
+func (kb *Keyboard) decodeSequences(b []byte) {
+	for len(b) > 0 {
+		ev, n := decodeSequence(b)
+		if ev.Key != KeyNone || ev.Rune != 0 {
+			ev.Pressed = true
+			kb.queue = append(kb.queue, ev)
+		}
+		b = b[n:]
+	}
+}
+
+// decodeSequence decodes the first key in b and returns
+// it, along with the number of bytes it took up.
+func decodeSequence(b []byte) (KeyEvent, int) {
+	if b[0] != 0x1b {
+		return decodeChar(b)
+	}
+
+	if len(b) == 1 {
+		return KeyEvent{Key: KeyEsc}, 1
+	}
+
+	switch b[1] {
+	case '[':
+		return decodeCSI(b)
+
+	case 'O':
+		// SS3, sent for cursor keys in application mode and F1-F4.
+		// Some terminals insert a modifier parameter.
+		n := 2
+		var mod int
+		for n < len(b) && b[n] >= '0' && b[n] <= '9' {
+			mod = mod*10 + int(b[n]-'0')
+			n++
+		}
+
+		if n == len(b) {
+			return KeyEvent{}, n
+		}
+
+		ev := KeyEvent{Key: csiKeys[b[n]], Modifiers: csiModifiers(mod)}
+		return ev, n + 1
+	}
+
+	// ESC followed by a character means the character was typed with Alt.
+	ev, n := decodeChar(b[1:])
+	ev.Modifiers |= ModAlt
+	return ev, n + 1
+}
+
+// csiKeys maps the final byte of CSI and SS3 sequences to keys.
+var csiKeys = map[byte]Key{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'E': KeyKP5,
+	'F': KeyEnd,
+	'H': KeyHome,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// tildeKeys maps the parameter of CSI n ~ sequences to keys.
+var tildeKeys = map[int]Key{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+// decodeCSI decodes a sequence starting with ESC [.
+func decodeCSI(b []byte) (KeyEvent, int) {
+	// The Linux console sends ESC [ [ A through E for F1 to F5.
+	if len(b) >= 4 && b[2] == '[' {
+		if b[3] >= 'A' && b[3] <= 'E' {
+			return KeyEvent{Key: KeyF1 + Key(b[3]-'A')}, 4
+		}
+		return KeyEvent{}, 4
+	}
+
+	params := []int{0}
+	n := 2
+	for ; n < len(b); n++ {
+		c := b[n]
+		if c == ';' {
+			params = append(params, 0)
+		} else if c >= '0' && c <= '9' {
+			params[len(params)-1] = params[len(params)-1]*10 + int(c-'0')
+		} else {
+			break
+		}
+	}
+
+	if n == len(b) {
+		return KeyEvent{}, n
+	}
+
+	var mod Modifiers
+	if len(params) > 1 {
+		mod = csiModifiers(params[1])
+	}
+
+	final := b[n]
+	switch final {
+	case '~':
+		return KeyEvent{Key: tildeKeys[params[0]], Modifiers: mod}, n + 1
+	case 'Z':
+		return KeyEvent{Key: KeyTab, Modifiers: mod | ModShift}, n + 1
+	}
+
+	return KeyEvent{Key: csiKeys[final], Modifiers: mod}, n + 1
+}
+
+// csiModifiers decodes the xterm modifier parameter,
+// which is one plus a bit set of modifiers.
+func csiModifiers(p int) Modifiers {
+	if p < 2 {
+		return 0
+	}
+
+	p--
+
+	var mod Modifiers
+	if p&1 != 0 {
+		mod |= ModShift
+	}
+	if p&2 != 0 {
+		mod |= ModAlt
+	}
+	if p&4 != 0 {
+		mod |= ModCtrl
+	}
+	if p&8 != 0 {
+		mod |= ModMeta
+	}
+	return mod
+}
+
+// decodeChar decodes a single, possibly multi-byte, character.
+func decodeChar(b []byte) (KeyEvent, int) {
+	switch c := b[0]; {
+	case c == '\r' || c == '\n':
+		return KeyEvent{Key: KeyEnter}, 1
+	case c == '\t':
+		return KeyEvent{Key: KeyTab}, 1
+	case c == 0x7f:
+		return KeyEvent{Key: KeyBackspace}, 1
+	case c == 0x08:
+		return KeyEvent{Key: KeyBackspace, Modifiers: ModCtrl}, 1
+	case c == 0x1b:
+		return KeyEvent{Key: KeyEsc}, 1
+	case c == 0:
+		return KeyEvent{Key: KeySpace, Rune: ' ', Modifiers: ModCtrl}, 1
+	case c < 0x20:
+		// Control characters are typed as Ctrl plus a letter or @[\]^_.
+		ev := runeKeys[rune(c)|0x60]
+		if c >= 0x1c {
+			ev = runeKeys[rune(c)|0x40]
+		}
+		ev.Modifiers |= ModCtrl
+		return ev, 1
+	}
+
+	r, n := utf8.DecodeRune(b)
+	if ev, ok := runeKeys[r]; ok {
+		return ev, n
+	}
+
+	return KeyEvent{Rune: r}, n
+}
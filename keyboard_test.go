@@ -0,0 +1,218 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPTY opens a pseudo-terminal pair, to stand in for a console.
+func openPTY(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pty support: %v", err)
+	}
+
+	var unlock int32
+	var n uint32
+	err = ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+	if err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		slave.Close()
+		master.Close()
+	})
+	return master, slave
+}
+
+// expectEvents writes input to the terminal and checks the events read back.
+func expectEvents(t *testing.T, kb *Keyboard, master *os.File, input string, want ...KeyEvent) {
+	t.Helper()
+
+	if _, err := master.Write([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range want {
+		have, err := kb.ReadEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if have != w {
+			t.Fatalf("%q: want %+v, have %+v", input, w, have)
+		}
+	}
+}
+
+func TestKeyboardSequences(t *testing.T) {
+	master, slave := openPTY(t)
+
+	var orig syscall.Termios
+	ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&orig))
+
+	kb, err := KeyboardFromTTY(slave, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		input string
+		want  []KeyEvent
+	}{
+		{"a", []KeyEvent{{Key: KeyA, Rune: 'a'}}},
+		{"A", []KeyEvent{{Key: KeyA, Rune: 'A', Modifiers: ModShift}}},
+		{"?", []KeyEvent{{Key: KeySlash, Rune: '?', Modifiers: ModShift}}},
+		{"é", []KeyEvent{{Rune: 'é'}}},
+		{"hi", []KeyEvent{{Key: KeyH, Rune: 'h'}, {Key: KeyI, Rune: 'i'}}},
+		{"\r", []KeyEvent{{Key: KeyEnter}}},
+		{"\t", []KeyEvent{{Key: KeyTab}}},
+		{"\x7f", []KeyEvent{{Key: KeyBackspace}}},
+		{"\x03", []KeyEvent{{Key: KeyC, Rune: 'c', Modifiers: ModCtrl}}},
+		{"\x1c", []KeyEvent{{Key: KeyBackslash, Rune: '\\', Modifiers: ModCtrl}}},
+		{"\x1b", []KeyEvent{{Key: KeyEsc}}},
+		{"\x1bx", []KeyEvent{{Key: KeyX, Rune: 'x', Modifiers: ModAlt}}},
+		{"\x1b[A", []KeyEvent{{Key: KeyUp}}},
+		{"\x1bOD", []KeyEvent{{Key: KeyLeft}}},
+		{"\x1b[1;5C", []KeyEvent{{Key: KeyRight, Modifiers: ModCtrl}}},
+		{"\x1b[3~", []KeyEvent{{Key: KeyDelete}}},
+		{"\x1b[6;2~", []KeyEvent{{Key: KeyPageDown, Modifiers: ModShift}}},
+		{"\x1b[Z", []KeyEvent{{Key: KeyTab, Modifiers: ModShift}}},
+		{"\x1b[[B", []KeyEvent{{Key: KeyF2}}},
+		{"\x1bOP", []KeyEvent{{Key: KeyF1}}},
+		{"\x1b[24~", []KeyEvent{{Key: KeyF12}}},
+		{"\x1b[Hq", []KeyEvent{{Key: KeyHome}, {Key: KeyQ, Rune: 'q'}}},
+	} {
+		for i := range tc.want {
+			tc.want[i].Pressed = true
+		}
+		expectEvents(t, kb, master, tc.input, tc.want...)
+	}
+
+	if err := kb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored syscall.Termios
+	ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&restored))
+	if restored != orig {
+		t.Fatalf("terminal settings not restored")
+	}
+}
+
+func TestKeyboardMediumRaw(t *testing.T) {
+	master, slave := openPTY(t)
+
+	// A pty has no keyboard, so emulate the keyboard mode ioctls.
+	kbMode := int32(_K_UNICODE)
+	realIoctl := sysIoctl
+	sysIoctl = func(fd, name uintptr, ptr unsafe.Pointer, val uintptr) syscall.Errno {
+		switch name {
+		case _KDGKBMODE:
+			*(*int32)(ptr) = kbMode
+		case _KDSKBMODE:
+			kbMode = int32(val)
+		default:
+			return realIoctl(fd, name, ptr, val)
+		}
+		return 0
+	}
+	defer func() { sysIoctl = realIoctl }()
+
+	kb, err := KeyboardFromTTY(slave, KeyboardMediumRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kbMode != _K_MEDIUMRAW {
+		t.Fatalf("keyboard mode: want %d, have %d", _K_MEDIUMRAW, kbMode)
+	}
+
+	press := func(k Key) byte { return byte(k) }
+	release := func(k Key) byte { return byte(k) | 0x80 }
+
+	expectEvents(t, kb, master, string([]byte{press(KeyA), release(KeyA)}),
+		KeyEvent{Key: KeyA, Rune: 'a', Pressed: true},
+		KeyEvent{Key: KeyA, Rune: 'a'})
+
+	expectEvents(t, kb, master, string([]byte{press(KeyLeftShift), press(Key1), release(KeyLeftShift)}),
+		KeyEvent{Key: KeyLeftShift, Modifiers: ModShift, Pressed: true},
+		KeyEvent{Key: Key1, Rune: '!', Modifiers: ModShift, Pressed: true},
+		KeyEvent{Key: KeyLeftShift})
+
+	expectEvents(t, kb, master, string([]byte{press(KeyCapsLock), release(KeyCapsLock), press(KeyQ), press(Key2)}),
+		KeyEvent{Key: KeyCapsLock, Pressed: true},
+		KeyEvent{Key: KeyCapsLock},
+		KeyEvent{Key: KeyQ, Rune: 'Q', Pressed: true},
+		KeyEvent{Key: Key2, Rune: '2', Pressed: true})
+
+	// Keycodes above 127 take three bytes.
+	expectEvents(t, kb, master, "\x00\x82\x90\x80\x82\x90",
+		KeyEvent{Key: 272, Pressed: true},
+		KeyEvent{Key: 272})
+
+	// Which may be split across reads.
+	kb.decodeKeycodes([]byte{0x00, 0x82})
+	kb.decodeKeycodes([]byte{0x90})
+	if ev, _ := kb.ReadEvent(); ev != (KeyEvent{Key: 272, Pressed: true}) {
+		t.Fatalf("split keycode: have %+v", ev)
+	}
+
+	if err := kb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if kbMode != _K_UNICODE {
+		t.Fatalf("keyboard mode not restored: have %d", kbMode)
+	}
+}
+
+func TestKeyboardErrors(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "notatty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = KeyboardFromTTY(f, 0)
+	if !errors.Is(err, ErrNotATTY) {
+		t.Fatalf("regular file: want ErrNotATTY, have %v", err)
+	}
+
+	// A pty is a terminal, but not a virtual terminal with a keyboard.
+	_, slave := openPTY(t)
+
+	var orig syscall.Termios
+	ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&orig))
+
+	_, err = KeyboardFromTTY(slave, KeyboardMediumRaw)
+	if !errors.Is(err, ErrNotATTY) {
+		t.Fatalf("pty: want ErrNotATTY, have %v", err)
+	}
+
+	var restored syscall.Termios
+	ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&restored))
+	if restored != orig {
+		t.Fatalf("terminal settings not restored after failure")
+	}
+}
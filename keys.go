@@ -0,0 +1,357 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import "fmt"
+
+// Key identifies a physical key. The values are the Linux input
+// keycodes from <linux/input-event-codes.h>, so they are the same
+// for the console keyboard and for evdev devices.
+type Key uint16
+
+// Known keys.
+const (
+	KeyNone       Key = 0
+	KeyEsc        Key = 1
+	Key1          Key = 2
+	Key2          Key = 3
+	Key3          Key = 4
+	Key4          Key = 5
+	Key5          Key = 6
+	Key6          Key = 7
+	Key7          Key = 8
+	Key8          Key = 9
+	Key9          Key = 10
+	Key0          Key = 11
+	KeyMinus      Key = 12
+	KeyEqual      Key = 13
+	KeyBackspace  Key = 14
+	KeyTab        Key = 15
+	KeyQ          Key = 16
+	KeyW          Key = 17
+	KeyE          Key = 18
+	KeyR          Key = 19
+	KeyT          Key = 20
+	KeyY          Key = 21
+	KeyU          Key = 22
+	KeyI          Key = 23
+	KeyO          Key = 24
+	KeyP          Key = 25
+	KeyLeftBrace  Key = 26
+	KeyRightBrace Key = 27
+	KeyEnter      Key = 28
+	KeyLeftCtrl   Key = 29
+	KeyA          Key = 30
+	KeyS          Key = 31
+	KeyD          Key = 32
+	KeyF          Key = 33
+	KeyG          Key = 34
+	KeyH          Key = 35
+	KeyJ          Key = 36
+	KeyK          Key = 37
+	KeyL          Key = 38
+	KeySemicolon  Key = 39
+	KeyApostrophe Key = 40
+	KeyGrave      Key = 41
+	KeyLeftShift  Key = 42
+	KeyBackslash  Key = 43
+	KeyZ          Key = 44
+	KeyX          Key = 45
+	KeyC          Key = 46
+	KeyV          Key = 47
+	KeyB          Key = 48
+	KeyN          Key = 49
+	KeyM          Key = 50
+	KeyComma      Key = 51
+	KeyDot        Key = 52
+	KeySlash      Key = 53
+	KeyRightShift Key = 54
+	KeyKPAsterisk Key = 55
+	KeyLeftAlt    Key = 56
+	KeySpace      Key = 57
+	KeyCapsLock   Key = 58
+	KeyF1         Key = 59
+	KeyF2         Key = 60
+	KeyF3         Key = 61
+	KeyF4         Key = 62
+	KeyF5         Key = 63
+	KeyF6         Key = 64
+	KeyF7         Key = 65
+	KeyF8         Key = 66
+	KeyF9         Key = 67
+	KeyF10        Key = 68
+	KeyNumLock    Key = 69
+	KeyScrollLock Key = 70
+	KeyKP7        Key = 71
+	KeyKP8        Key = 72
+	KeyKP9        Key = 73
+	KeyKPMinus    Key = 74
+	KeyKP4        Key = 75
+	KeyKP5        Key = 76
+	KeyKP6        Key = 77
+	KeyKPPlus     Key = 78
+	KeyKP1        Key = 79
+	KeyKP2        Key = 80
+	KeyKP3        Key = 81
+	KeyKP0        Key = 82
+	KeyKPDot      Key = 83
+	Key102nd      Key = 86
+	KeyF11        Key = 87
+	KeyF12        Key = 88
+	KeyKPEnter    Key = 96
+	KeyRightCtrl  Key = 97
+	KeyKPSlash    Key = 98
+	KeySysRq      Key = 99
+	KeyRightAlt   Key = 100
+	KeyHome       Key = 102
+	KeyUp         Key = 103
+	KeyPageUp     Key = 104
+	KeyLeft       Key = 105
+	KeyRight      Key = 106
+	KeyEnd        Key = 107
+	KeyDown       Key = 108
+	KeyPageDown   Key = 109
+	KeyInsert     Key = 110
+	KeyDelete     Key = 111
+	KeyPause      Key = 119
+	KeyLeftMeta   Key = 125
+	KeyRightMeta  Key = 126
+	KeyCompose    Key = 127
+)
+
+func (k Key) String() string {
+	if int(k) < len(keymap) && keymap[k].name != "" {
+		return keymap[k].name
+	}
+	return fmt.Sprintf("Key(%d)", uint16(k))
+}
+
+// Modifiers is a bit set of modifier keys held down.
+type Modifiers uint8
+
+// Known modifiers.
+const (
+	ModShift Modifiers = 1 << iota
+	ModCtrl
+	ModAlt
+	ModMeta
+)
+
+func (m Modifiers) String() string {
+	var s string
+	for i, name := range []string{"Shift", "Ctrl", "Alt", "Meta"} {
+		if m&(1<<i) == 0 {
+			continue
+		}
+		if s != "" {
+			s += "+"
+		}
+		s += name
+	}
+	return s
+}
+
+// KeyState tracks modifier and lock keys, to translate a stream
+// of keycodes into KeyEvents using a US keyboard layout.
+// The zero value has no modifiers held down.
+type KeyState struct {
+	mods Modifiers
+	caps bool
+}
+
+// Modifiers returns the modifiers currently held down.
+func (s *KeyState) Modifiers() Modifiers {
+	return s.mods
+}
+
+// Translate updates the state for the given key being pressed
+// or released, and returns the corresponding event.
+func (s *KeyState) Translate(key Key, pressed bool) KeyEvent {
+	var mod Modifiers
+
+	switch key {
+	case KeyLeftShift, KeyRightShift:
+		mod = ModShift
+	case KeyLeftCtrl, KeyRightCtrl:
+		mod = ModCtrl
+	case KeyLeftAlt, KeyRightAlt:
+		mod = ModAlt
+	case KeyLeftMeta, KeyRightMeta:
+		mod = ModMeta
+	case KeyCapsLock:
+		if pressed {
+			s.caps = !s.caps
+		}
+	}
+
+	if pressed {
+		s.mods |= mod
+	} else {
+		s.mods &^= mod
+	}
+
+	ev := KeyEvent{Key: key, Modifiers: s.mods, Pressed: pressed}
+
+	if int(key) < len(keymap) {
+		e := keymap[key]
+		shift := s.mods&ModShift != 0
+		if s.caps && e.normal >= 'a' && e.normal <= 'z' {
+			shift = !shift
+		}
+
+		ev.Rune = e.normal
+		if shift {
+			ev.Rune = e.shift
+		}
+	}
+
+	return ev
+}
+
+// keymapEntry describes a key on a US keyboard layout.
+type keymapEntry struct {
+	name          string
+	normal, shift rune // Characters produced, if any.
+}
+
+// keymap translates keycodes using a US keyboard layout.
+var keymap = [...]keymapEntry{
+	KeyEsc:        {"Esc", 0, 0},
+	Key1:          {"1", '1', '!'},
+	Key2:          {"2", '2', '@'},
+	Key3:          {"3", '3', '#'},
+	Key4:          {"4", '4', '$'},
+	Key5:          {"5", '5', '%'},
+	Key6:          {"6", '6', '^'},
+	Key7:          {"7", '7', '&'},
+	Key8:          {"8", '8', '*'},
+	Key9:          {"9", '9', '('},
+	Key0:          {"0", '0', ')'},
+	KeyMinus:      {"Minus", '-', '_'},
+	KeyEqual:      {"Equal", '=', '+'},
+	KeyBackspace:  {"Backspace", 0, 0},
+	KeyTab:        {"Tab", 0, 0},
+	KeyQ:          {"Q", 'q', 'Q'},
+	KeyW:          {"W", 'w', 'W'},
+	KeyE:          {"E", 'e', 'E'},
+	KeyR:          {"R", 'r', 'R'},
+	KeyT:          {"T", 't', 'T'},
+	KeyY:          {"Y", 'y', 'Y'},
+	KeyU:          {"U", 'u', 'U'},
+	KeyI:          {"I", 'i', 'I'},
+	KeyO:          {"O", 'o', 'O'},
+	KeyP:          {"P", 'p', 'P'},
+	KeyLeftBrace:  {"LeftBrace", '[', '{'},
+	KeyRightBrace: {"RightBrace", ']', '}'},
+	KeyEnter:      {"Enter", 0, 0},
+	KeyLeftCtrl:   {"LeftCtrl", 0, 0},
+	KeyA:          {"A", 'a', 'A'},
+	KeyS:          {"S", 's', 'S'},
+	KeyD:          {"D", 'd', 'D'},
+	KeyF:          {"F", 'f', 'F'},
+	KeyG:          {"G", 'g', 'G'},
+	KeyH:          {"H", 'h', 'H'},
+	KeyJ:          {"J", 'j', 'J'},
+	KeyK:          {"K", 'k', 'K'},
+	KeyL:          {"L", 'l', 'L'},
+	KeySemicolon:  {"Semicolon", ';', ':'},
+	KeyApostrophe: {"Apostrophe", '\'', '"'},
+	KeyGrave:      {"Grave", '`', '~'},
+	KeyLeftShift:  {"LeftShift", 0, 0},
+	KeyBackslash:  {"Backslash", '\\', '|'},
+	KeyZ:          {"Z", 'z', 'Z'},
+	KeyX:          {"X", 'x', 'X'},
+	KeyC:          {"C", 'c', 'C'},
+	KeyV:          {"V", 'v', 'V'},
+	KeyB:          {"B", 'b', 'B'},
+	KeyN:          {"N", 'n', 'N'},
+	KeyM:          {"M", 'm', 'M'},
+	KeyComma:      {"Comma", ',', '<'},
+	KeyDot:        {"Dot", '.', '>'},
+	KeySlash:      {"Slash", '/', '?'},
+	KeyRightShift: {"RightShift", 0, 0},
+	KeyKPAsterisk: {"KPAsterisk", '*', '*'},
+	KeyLeftAlt:    {"LeftAlt", 0, 0},
+	KeySpace:      {"Space", ' ', ' '},
+	KeyCapsLock:   {"CapsLock", 0, 0},
+	KeyF1:         {"F1", 0, 0},
+	KeyF2:         {"F2", 0, 0},
+	KeyF3:         {"F3", 0, 0},
+	KeyF4:         {"F4", 0, 0},
+	KeyF5:         {"F5", 0, 0},
+	KeyF6:         {"F6", 0, 0},
+	KeyF7:         {"F7", 0, 0},
+	KeyF8:         {"F8", 0, 0},
+	KeyF9:         {"F9", 0, 0},
+	KeyF10:        {"F10", 0, 0},
+	KeyNumLock:    {"NumLock", 0, 0},
+	KeyScrollLock: {"ScrollLock", 0, 0},
+	KeyKP7:        {"KP7", '7', '7'},
+	KeyKP8:        {"KP8", '8', '8'},
+	KeyKP9:        {"KP9", '9', '9'},
+	KeyKPMinus:    {"KPMinus", '-', '-'},
+	KeyKP4:        {"KP4", '4', '4'},
+	KeyKP5:        {"KP5", '5', '5'},
+	KeyKP6:        {"KP6", '6', '6'},
+	KeyKPPlus:     {"KPPlus", '+', '+'},
+	KeyKP1:        {"KP1", '1', '1'},
+	KeyKP2:        {"KP2", '2', '2'},
+	KeyKP3:        {"KP3", '3', '3'},
+	KeyKP0:        {"KP0", '0', '0'},
+	KeyKPDot:      {"KPDot", '.', '.'},
+	Key102nd:      {"102nd", '<', '>'},
+	KeyF11:        {"F11", 0, 0},
+	KeyF12:        {"F12", 0, 0},
+	KeyKPEnter:    {"KPEnter", 0, 0},
+	KeyRightCtrl:  {"RightCtrl", 0, 0},
+	KeyKPSlash:    {"KPSlash", '/', '/'},
+	KeySysRq:      {"SysRq", 0, 0},
+	KeyRightAlt:   {"RightAlt", 0, 0},
+	KeyHome:       {"Home", 0, 0},
+	KeyUp:         {"Up", 0, 0},
+	KeyPageUp:     {"PageUp", 0, 0},
+	KeyLeft:       {"Left", 0, 0},
+	KeyRight:      {"Right", 0, 0},
+	KeyEnd:        {"End", 0, 0},
+	KeyDown:       {"Down", 0, 0},
+	KeyPageDown:   {"PageDown", 0, 0},
+	KeyInsert:     {"Insert", 0, 0},
+	KeyDelete:     {"Delete", 0, 0},
+	KeyPause:      {"Pause", 0, 0},
+	KeyLeftMeta:   {"LeftMeta", 0, 0},
+	KeyRightMeta:  {"RightMeta", 0, 0},
+	KeyCompose:    {"Compose", 0, 0},
+}
+
+// RuneKey returns the key which produces r on a US keyboard layout,
+// along with the modifiers needed. It returns KeyNone for runes
+// which no key produces.
+func RuneKey(r rune) (Key, Modifiers) {
+	ev := runeKeys[r]
+	return ev.Key, ev.Modifiers
+}
+
+// runeKeys maps printable ASCII characters back to the key which
+// produces them, and whether shift is needed to do so.
+var runeKeys = func() map[rune]KeyEvent {
+	m := make(map[rune]KeyEvent)
+
+	// Go through the main keys only; keypad keys produce
+	// the same characters, but are not what a terminal means.
+	for k := KeyEsc; k <= KeySpace; k++ {
+		if k == KeyKPAsterisk {
+			continue
+		}
+
+		e := keymap[k]
+		if e.shift != 0 && e.shift != e.normal {
+			m[e.shift] = KeyEvent{Key: k, Rune: e.shift, Modifiers: ModShift}
+		}
+		if e.normal != 0 {
+			m[e.normal] = KeyEvent{Key: k, Rune: e.normal}
+		}
+	}
+
+	return m
+}()
@@ -0,0 +1,183 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"image"
+	"syscall"
+	"unsafe"
+)
+
+// NewMemoryCanvas creates a canvas in ordinary memory, with the given
+// display mode. It needs no device or privileges, which makes it useful
+// for rendering on servers, and for comparing the output of programs
+// with golden images in tests.
+//
+// The canvas supports the same drawing operations as one opened on a
+// device, including back buffers and snapshots. If the virtual height
+// of the mode holds two screens, flipping pans, as it would on a device.
+// Indexed formats start out with a grayscale palette. Mode changes and
+// anything beyond drawing, such as Capabilities, report no support.
+//
+// Geometry.Depth selects the pixel size. Depths of 1, 2 and 4 bits
+// are packed, with 0 as black. Format.FourCC selects a YUV format
+// instead, which starts out black; its depth is 16 bits for packed
+// formats, and 12 for planar ones. Virtual resolutions of zero default
+// to the visible ones.
+func NewMemoryCanvas(mode *DisplayMode) (*Canvas, error) {
+	if mode == nil {
+		return nil, errors.New("framebuffer: memory canvas needs a display mode")
+	}
+
+	dm := *mode
+	g := &dm.Geometry
+
+	if g.Depth == 0 {
+		g.Depth = int(dm.Format.Depth)
+	}
+	dm.Format.Depth = uint8(g.Depth)
+
+	if g.XVRes == 0 {
+		g.XVRes = g.XRes
+	}
+	if g.YVRes == 0 {
+		g.YVRes = g.YRes
+	}
+
+	if g.XRes <= 0 || g.YRes <= 0 || g.XVRes < g.XRes || g.YVRes < g.YRes {
+		return nil, errors.New("framebuffer: invalid memory canvas geometry")
+	}
+
+	d := new(memDevice)
+	d.vi.setMode(&dm)
+	d.vi.nonstd = uint32(dm.Nonstandard)
+	if dm.Grayscale && dm.Format.FourCC == 0 {
+		d.vi.grayscale = 1
+	}
+
+	d.fi.typ = _TYPE_PACKED_PIXELS
+	d.fi.visual = _VISUAL_TRUECOLOR
+	d.fi.lineLength = uint32(dm.Stride())
+	d.fi.smemlen = uint32(dm.Format.frameSize(dm.Stride(), g.YVRes))
+	d.fi.ypanstep = 1
+	copy(d.fi.id[:], "memory")
+
+	switch dm.Format.Type() {
+	case PF_MONO:
+		d.fi.visual = _VISUAL_MONO10
+
+	case PF_YUYV, PF_UYVY, PF_NV12, PF_NV21, PF_I420:
+		d.fi.typ = _TYPE_FOURCC
+		d.fi.visual = _VISUAL_FOURCC
+		d.fi.capabilities = _CAP_FOURCC
+
+	case PF_INDEXED:
+		d.fi.visual = _VISUAL_PSEUDOCOLOR
+		for i := range d.cmap[0] {
+			v := uint16(i) * 0x0101
+			d.cmap[0][i], d.cmap[1][i], d.cmap[2][i], d.cmap[3][i] = v, v, v, 0xffff
+		}
+	}
+
+	c := &Canvas{
+		dev:         "memory",
+		virt:        d,
+		switchState: _FB_ACTIVE,
+		origFi:      d.fi,
+		origVi:      d.vi,
+		mem:         make([]byte, d.fi.smemlen),
+	}
+	c.zero = make([]byte, len(c.mem))
+	c.clearYUV()
+	c.Clear()
+
+	// Reject formats no image type exists for.
+	_, err := newImage(dm.Format, packing{}, c.mem, int(d.fi.lineLength), image.Rect(0, 0, g.XVRes, g.YVRes))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// memDevice emulates the framebuffer device of a memory canvas.
+type memDevice struct {
+	fi   fbFixScreenInfo
+	vi   fbVarScreenInfo
+	cmap [4][256]uint16 // Red, green, blue and transparency.
+}
+
+// ioctl implements the requests a canvas makes for drawing. Others
+// fail as they would on a device which does not support them.
+func (d *memDevice) ioctl(name uintptr, data interface{}) error {
+	p, _ := data.(unsafe.Pointer)
+	fail := func(errno syscall.Errno) error {
+		return &IoctlError{Op: ioctlName(name), Request: name, Errno: errno}
+	}
+
+	switch name {
+	case _IOGET_FSCREENINFO:
+		*(*fbFixScreenInfo)(p) = d.fi
+
+	case _IOGET_VSCREENINFO:
+		*(*fbVarScreenInfo)(p) = d.vi
+
+	case _IOPUT_VSCREENINFO:
+		// Memory has a fixed size; only the viewport may move.
+		v := (*fbVarScreenInfo)(p)
+		if v.xres != d.vi.xres || v.yres != d.vi.yres ||
+			v.xresVirtual != d.vi.xresVirtual || v.yresVirtual != d.vi.yresVirtual ||
+			v.bitsPerPixel != d.vi.bitsPerPixel {
+			return fail(syscall.EINVAL)
+		}
+
+		if v.activate&_ACTIVATE_MASK != _ACTIVATE_TEST {
+			return d.pan(v)
+		}
+
+	case _IOPAN_DISPLAY:
+		return d.pan((*fbVarScreenInfo)(p))
+
+	case _IOGET_CMAP, _IOPUT_CMAP:
+		cm := (*fb_cmap)(p)
+		if cm.start+cm.len > 256 {
+			return fail(syscall.EINVAL)
+		}
+
+		for i, ptr := range []unsafe.Pointer{cm.red, cm.green, cm.blue, cm.transp} {
+			if ptr == nil {
+				continue
+			}
+
+			entries := unsafe.Slice((*uint16)(ptr), cm.len)
+			table := d.cmap[i][cm.start : cm.start+cm.len]
+			if name == _IOGET_CMAP {
+				copy(entries, table)
+			} else {
+				copy(table, entries)
+			}
+		}
+
+	default:
+		return fail(syscall.ENOTTY)
+	}
+
+	return nil
+}
+
+func (d *memDevice) close() error {
+	return nil
+}
+
+// pan moves the viewport to the offsets of v.
+func (d *memDevice) pan(v *fbVarScreenInfo) error {
+	if v.xoffset+d.vi.xres > d.vi.xresVirtual || v.yoffset+d.vi.yres > d.vi.yresVirtual {
+		return &IoctlError{Op: ioctlName(_IOPAN_DISPLAY), Request: _IOPAN_DISPLAY, Errno: syscall.EINVAL}
+	}
+
+	d.vi.xoffset = v.xoffset
+	d.vi.yoffset = v.yoffset
+	return nil
+}
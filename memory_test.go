@@ -0,0 +1,180 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"syscall"
+	"testing"
+)
+
+// memoryMode returns a display mode for a memory canvas.
+func memoryMode(w, h, vh, depth int) *DisplayMode {
+	var dm DisplayMode
+	dm.Geometry = Geometry{XRes: w, YRes: h, YVRes: vh, Depth: depth}
+
+	switch depth {
+	case 32:
+		dm.Format = PixelFormat{
+			RedBits: 8, RedShift: 16, GreenBits: 8, GreenShift: 8,
+			BlueBits: 8, AlphaBits: 8, AlphaShift: 24,
+		}
+	case 16:
+		dm.Format = PixelFormat{RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5}
+	case 8:
+		dm.Format = PixelFormat{RedBits: 8, GreenBits: 8, BlueBits: 8}
+	}
+
+	return &dm
+}
+
+func TestMemoryCanvas(t *testing.T) {
+	c, err := NewMemoryCanvas(memoryMode(10, 6, 0, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	mode, err := c.CurrentMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode.Geometry != (Geometry{10, 6, 10, 6, 16}) || mode.Format.Type() != PF_RGB_565 {
+		t.Fatalf("mode: %+v", mode)
+	}
+
+	if len(c.Buffer()) != 10*6*2 || c.File() != nil {
+		t.Fatalf("buffer of %d bytes, file %v", len(c.Buffer()), c.File())
+	}
+
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := img.(*RGB565); !ok {
+		t.Fatalf("image: have %T", img)
+	}
+
+	draw.Draw(img, image.Rect(2, 1, 5, 3), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+
+	snap, err := c.Snapshot(image.Rectangle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := snap.RGBAAt(2, 1); have != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("drawn pixel: have %v", have)
+	}
+	if have := snap.RGBAAt(5, 1); have != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("background: have %v", have)
+	}
+
+	c.Clear()
+	for i, b := range c.Buffer() {
+		if b != 0 {
+			t.Fatalf("byte %d not cleared", i)
+		}
+	}
+
+	// Modes can not change, but are reported as a device would.
+	if err := c.setMode(memoryMode(20, 6, 0, 16)); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("mode change: %v", err)
+	}
+
+	if _, err := c.Capabilities(); err != nil {
+		t.Errorf("capabilities: %v", err)
+	}
+}
+
+func TestMemoryCanvasFlip(t *testing.T) {
+	for _, vh := range []int{8, 4} {
+		c, err := NewMemoryCanvas(memoryMode(6, 4, vh, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			back, err := c.BackBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			col := color.RGBA{uint8(i + 1), 2, 3, 0xff}
+			draw.Draw(back, back.Bounds(), image.NewUniform(col), image.Point{}, draw.Src)
+
+			if err := c.Flip(); err != nil {
+				t.Fatal(err)
+			}
+
+			snap, err := c.Snapshot(image.Rect(0, 0, 6, 4))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if have := snap.RGBAAt(5, 3); have != col {
+				t.Fatalf("height %d, flip %d: displayed %v, want %v", vh, i, have, col)
+			}
+		}
+
+		// Panning moves the viewport; copying leaves it.
+		mode, _ := c.CurrentMode()
+		if c.canPan(mode) != (vh == 8) || c.virt.(*memDevice).vi.yoffset != uint32(vh-4) {
+			t.Errorf("height %d: yoffset %d", vh, c.virt.(*memDevice).vi.yoffset)
+		}
+
+		c.Close()
+	}
+}
+
+func TestMemoryCanvasPalette(t *testing.T) {
+	c, err := NewMemoryCanvas(memoryMode(4, 4, 0, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	pal, err := c.Palette()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pal) != 256 || pal[0x80] != (color.NRGBA{0x80, 0x80, 0x80, 0xff}) {
+		t.Fatalf("default palette: %d entries, %v", len(pal), pal[0x80])
+	}
+
+	pal[7] = color.NRGBA{0x10, 0x20, 0x30, 0xff}
+	if err := c.SetPalette(pal); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Buffer()[1*4+2] = 7
+
+	snap, err := c.Snapshot(image.Rectangle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := snap.RGBAAt(2, 1); have != (color.RGBA{0x10, 0x20, 0x30, 0xff}) {
+		t.Errorf("indexed pixel: have %v", have)
+	}
+}
+
+func TestMemoryCanvasInvalid(t *testing.T) {
+	for _, mode := range []*DisplayMode{
+		nil,
+		memoryMode(0, 4, 0, 32),
+		memoryMode(4, 4, 2, 32),
+		memoryMode(4, 4, 0, 24),
+	} {
+		if c, err := NewMemoryCanvas(mode); err == nil {
+			c.Close()
+			t.Errorf("mode %+v accepted", mode)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// shmDir holds POSIX shared memory objects. It is a variable,
+// so tests can use a directory of their own.
+var shmDir = "/dev/shm"
+
+// ErrMirrorClosed is returned by Mirror.Serve after the mirror is closed.
+var ErrMirrorClosed = errors.New("framebuffer: mirror closed")
+
+const (
+	mirrorMagic   = "FBMIRROR"
+	mirrorVersion = 3
+	mirrorData    = 4096 // Offset of the pixel data in the segment.
+	mirrorClosed  = 1    // Flag set when the mirror is closed.
+)
+
+// mirrorHeader starts a shared memory segment of a mirror. It is
+// protected by a sequence lock: seq is odd while the writer updates
+// the frame, and readers retry when it changed while they copied.
+type mirrorHeader struct {
+	magic    [8]byte
+	version  uint32
+	flags    atomic.Uint32
+	seq      atomic.Uint64
+	frame    atomic.Uint64 // Number of the last frame.
+	time     int64         // Time the frame was taken, in Unix nanoseconds.
+	capacity uint32        // Size of the data area.
+	size     uint32        // Size of the frame in the data area.
+	stride   uint32
+	xres     uint32
+	yres     uint32
+	gray     uint8
+	packing  packing // Of formats of less than 8 bits.
+	format   PixelFormat
+	palette  [256]color.NRGBA // Colors of indexed formats.
+}
+
+// MirrorOptions configures a Mirror.
+type MirrorOptions struct {
+	// Rate is the number of frames published per second. Zero
+	// means frames are only published by calling Publish.
+	Rate float64
+
+	// Perm holds the permissions of a named segment. Zero means 0600,
+	// so only processes of the same user can read the screen.
+	Perm os.FileMode
+}
+
+// Mirror publishes the frames shown by a canvas into shared memory,
+// from which other processes, such as test harnesses, recorders or
+// viewers, read them without copying through pipes or sockets.
+//
+// Each frame holds the visible pixels in the format of the canvas,
+// along with the display mode and a frame number. A sequence lock in
+// the header lets readers detect frames which changed while they
+// were reading, so they never see a torn frame. Readers use
+// OpenMirror or DialMirror.
+type Mirror struct {
+	c    *Canvas
+	f    *os.File
+	path string // Name of the segment in shmDir; empty if anonymous.
+	mem  []byte
+	hdr  *mirrorHeader
+
+	mu     sync.Mutex // Guards publishing and closing.
+	closed bool
+	err    error // Error of the last timed frame.
+
+	lmu       sync.Mutex
+	listeners map[net.Listener]struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMirror creates a shared memory segment for c and publishes its
+// current frame. A non-empty name creates the POSIX shared memory object
+// of that name, as shm_open would, which is removed again on Close.
+// Without a name, the segment is anonymous, and only handed out to
+// processes connecting to Serve. Opts may be nil.
+func NewMirror(c *Canvas, name string, opts *MirrorOptions) (*Mirror, error) {
+	var o MirrorOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Perm == 0 {
+		o.Perm = 0600
+	}
+
+	m := &Mirror{
+		c:         c,
+		listeners: make(map[net.Listener]struct{}),
+		done:      make(chan struct{}),
+	}
+
+	var err error
+	if name != "" {
+		m.path, err = shmPath(name)
+		if err != nil {
+			return nil, err
+		}
+
+		m.f, err = os.OpenFile(m.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, o.Perm)
+	} else {
+		// An unlinked file in shared memory works like a memfd.
+		m.f, err = os.CreateTemp(shmDir, "framebuffer-mirror-*")
+		if err == nil {
+			os.Remove(m.f.Name())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+
+	// The visible frame never exceeds the canvas memory.
+	capacity := len(c.mem)
+	size := mirrorData + capacity
+
+	if err := m.f.Truncate(int64(size)); err != nil {
+		m.remove()
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+
+	m.mem, err = syscall.Mmap(int(m.f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		m.remove()
+		return nil, fmt.Errorf("framebuffer: mirror: mmap: %w", err)
+	}
+
+	m.hdr = (*mirrorHeader)(unsafe.Pointer(&m.mem[0]))
+	copy(m.hdr.magic[:], mirrorMagic)
+	m.hdr.version = mirrorVersion
+	m.hdr.capacity = uint32(capacity)
+
+	if err := m.Publish(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	if o.Rate > 0 {
+		m.wg.Add(1)
+		go m.run(time.Duration(float64(time.Second) / o.Rate))
+	}
+
+	return m, nil
+}
+
+// shmPath returns the file of the POSIX shared memory object name.
+func shmPath(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+		return "", fmt.Errorf("framebuffer: invalid shared memory name %q", name)
+	}
+	return filepath.Join(shmDir, name), nil
+}
+
+// remove closes the segment, and removes its name.
+func (m *Mirror) remove() {
+	m.f.Close()
+	if m.path != "" {
+		os.Remove(m.path)
+	}
+}
+
+func (m *Mirror) run(period time.Duration) {
+	defer m.wg.Done()
+
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := m.Publish()
+
+			m.mu.Lock()
+			m.err = err
+			m.mu.Unlock()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Err returns the error of the last frame published at the mirror's
+// rate, if it failed.
+func (m *Mirror) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Frame returns the number of the last frame published. Frames are
+// numbered from 1.
+func (m *Mirror) Frame() uint64 {
+	return m.hdr.frame.Load()
+}
+
+// Publish copies the frame currently shown into the segment, for
+// instance after calling Flip.
+func (m *Mirror) Publish() error {
+	c := m.c
+
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return err
+	}
+
+	var vi fbVarScreenInfo
+	if err := c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&vi)); err != nil {
+		return err
+	}
+
+	var pal color.Palette
+	if mode.Format.Type() == PF_INDEXED {
+		if pal, err = c.Palette(); err != nil {
+			return err
+		}
+	}
+
+	// The visible rows, from the pan offset on.
+	g := mode.Geometry
+	stride := c.stride(mode)
+	start := int(vi.yoffset)*stride + mode.Format.rowSize(int(vi.xoffset))
+	size := stride*(g.YRes-1) + mode.Format.rowSize(g.XRes)
+	if mode.Format.planar() {
+		// Planar formats do not pan; their chroma planes follow
+		// all rows.
+		start, size = 0, mode.Format.frameSize(stride, g.YVRes)
+	}
+
+	if start+size > len(c.mem) {
+		return errors.New("framebuffer: mirror: visible area exceeds framebuffer memory")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrMirrorClosed
+	}
+
+	h := m.hdr
+	h.seq.Add(1)
+
+	copy(m.mem[mirrorData:], c.mem[start:start+size])
+	h.time = time.Now().UnixNano()
+	h.size = uint32(size)
+	h.stride = uint32(stride)
+	h.xres = uint32(g.XRes)
+	h.yres = uint32(g.YRes)
+	h.format = mode.Format
+	h.packing = c.packing(mode)
+	h.gray = 0
+	if mode.Grayscale {
+		h.gray = 1
+	}
+
+	for i, col := range pal {
+		h.palette[i] = color.NRGBAModel.Convert(col).(color.NRGBA)
+	}
+
+	h.frame.Add(1)
+	h.seq.Add(1)
+	return nil
+}
+
+// Serve hands the segment to each process connecting to the Unix
+// socket listener l, as SCM_RIGHTS ancillary data. It returns when l
+// fails, or ErrMirrorClosed once the mirror is closed.
+func (m *Mirror) Serve(l net.Listener) error {
+	m.lmu.Lock()
+	if m.listeners == nil {
+		m.lmu.Unlock()
+		return ErrMirrorClosed
+	}
+	m.listeners[l] = struct{}{}
+	m.lmu.Unlock()
+
+	defer func() {
+		m.lmu.Lock()
+		delete(m.listeners, l)
+		m.lmu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return ErrMirrorClosed
+			default:
+				return err
+			}
+		}
+
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.WriteMsgUnix([]byte{0}, syscall.UnixRights(int(m.f.Fd())), nil)
+		}
+		conn.Close()
+	}
+}
+
+// Close stops publishing, and tells readers the mirror is gone.
+// They keep the last frame. A named segment is removed, so no new
+// readers can open it.
+func (m *Mirror) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	m.lmu.Lock()
+	for l := range m.listeners {
+		l.Close()
+	}
+	m.listeners = nil
+	m.lmu.Unlock()
+
+	m.wg.Wait()
+
+	m.hdr.flags.Or(mirrorClosed)
+	err := syscall.Munmap(m.mem)
+	m.remove()
+	return err
+}
+
+// MirrorFrame is a frame read from a mirror.
+type MirrorFrame struct {
+	Number  uint64        // Frame number, counting from 1.
+	Time    time.Time     // Time the frame was published.
+	Mode    DisplayMode   // Visible geometry and pixel format.
+	Stride  int           // Length of a row of pixels, in bytes.
+	Pix     []byte        // Pixels, in the format of Mode.
+	Palette color.Palette // Colors of indexed formats.
+
+	packing packing
+}
+
+// Image returns the pixels of the frame, in the image type of its
+// format. Indexed formats return an *image.Paletted.
+func (f *MirrorFrame) Image() (draw.Image, error) {
+	r := image.Rect(0, 0, f.Mode.Geometry.XRes, f.Mode.Geometry.YRes)
+
+	if f.Mode.Format.Type() == PF_INDEXED {
+		return &image.Paletted{Pix: f.Pix, Stride: f.Stride, Rect: r, Palette: f.Palette}, nil
+	}
+
+	return newImage(f.Mode.Format, f.packing, f.Pix, f.Stride, r)
+}
+
+// MirrorReader reads frames from a Mirror in another process.
+type MirrorReader struct {
+	mem []byte
+	hdr *mirrorHeader
+}
+
+// OpenMirror maps the named segment of a mirror.
+func OpenMirror(name string) (*MirrorReader, error) {
+	path, err := shmPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+	defer f.Close()
+
+	return mapMirror(f)
+}
+
+// DialMirror receives the segment of a mirror from the Unix socket
+// at path, on which the mirror's Serve method listens, and maps it.
+func DialMirror(path string) (*MirrorReader, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return nil, errors.New("framebuffer: mirror: no segment received")
+	}
+
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return nil, errors.New("framebuffer: mirror: no segment received")
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "mirror")
+	defer f.Close()
+
+	return mapMirror(f)
+}
+
+// mapMirror maps the segment in f, read-only.
+func mapMirror(f *os.File) (*MirrorReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: %w", err)
+	}
+
+	if fi.Size() < mirrorData {
+		return nil, errors.New("framebuffer: mirror: segment too small")
+	}
+
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("framebuffer: mirror: mmap: %w", err)
+	}
+
+	r := &MirrorReader{mem: mem, hdr: (*mirrorHeader)(unsafe.Pointer(&mem[0]))}
+	if string(r.hdr.magic[:]) != mirrorMagic || r.hdr.version != mirrorVersion ||
+		int(r.hdr.capacity) > len(mem)-mirrorData {
+		r.Close()
+		return nil, errors.New("framebuffer: mirror: not a mirror segment")
+	}
+
+	return r, nil
+}
+
+// Frame returns the number of the last frame published, so readers
+// can tell whether a new one is available without reading it.
+func (r *MirrorReader) Frame() uint64 {
+	return r.hdr.frame.Load()
+}
+
+// Closed returns true once the mirror has been closed. The last
+// frame can still be read.
+func (r *MirrorReader) Closed() bool {
+	return r.hdr.flags.Load()&mirrorClosed != 0
+}
+
+// Read copies the last frame into f, reusing the memory of its
+// pixels and palette.
+func (r *MirrorReader) Read(f *MirrorFrame) error {
+	h := r.hdr
+
+	for {
+		seq := h.seq.Load()
+		if seq&1 != 0 {
+			// The writer is busy.
+			runtime.Gosched()
+			continue
+		}
+
+		size := int(h.size)
+		if size > int(h.capacity) {
+			return errors.New("framebuffer: mirror: invalid frame size")
+		}
+
+		if cap(f.Pix) < size {
+			f.Pix = make([]byte, size)
+		}
+		f.Pix = f.Pix[:size]
+		copy(f.Pix, r.mem[mirrorData:mirrorData+size])
+
+		f.Number = h.frame.Load()
+		f.Time = time.Unix(0, h.time)
+		f.Stride = int(h.stride)
+		f.packing = h.packing
+		f.Mode = DisplayMode{Grayscale: h.gray != 0, Format: h.format}
+		f.Mode.Geometry = Geometry{
+			XRes: int(h.xres), YRes: int(h.yres),
+			XVRes: int(h.xres), YVRes: int(h.yres),
+			Depth: int(h.format.Depth),
+		}
+
+		f.Palette = f.Palette[:0]
+		if h.format.Type() == PF_INDEXED {
+			for _, c := range h.palette {
+				f.Palette = append(f.Palette, c)
+			}
+		}
+
+		if h.seq.Load() == seq {
+			return nil
+		}
+	}
+}
+
+// Close unmaps the segment.
+func (r *MirrorReader) Close() error {
+	return syscall.Munmap(r.mem)
+}
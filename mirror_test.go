@@ -0,0 +1,309 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The reader process is this test binary, running TestMirrorReader
+// with these variables set.
+const (
+	envMirrorName   = "FRAMEBUFFER_TEST_MIRROR"
+	envMirrorSocket = "FRAMEBUFFER_TEST_MIRROR_SOCKET"
+	envMirrorDir    = "FRAMEBUFFER_TEST_SHMDIR"
+	envMirrorFrames = "FRAMEBUFFER_TEST_MIRROR_FRAMES"
+)
+
+// startReader runs the reader process, which opens the mirror of
+// the given name or socket and reads frames until it saw the given
+// number of them.
+func startReader(t *testing.T, name, socket string, frames int) (*exec.Cmd, *bytes.Buffer) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMirrorReader$", "-test.v")
+	cmd.Env = append(os.Environ(),
+		envMirrorName+"="+name,
+		envMirrorSocket+"="+socket,
+		envMirrorDir+"="+shmDir,
+		fmt.Sprintf("%s=%d", envMirrorFrames, frames),
+	)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd, &out
+}
+
+// TestMirrorReader is the reader process. It checks that every frame
+// it reads has a single color, so torn frames are detected, and
+// reports the last one.
+func TestMirrorReader(t *testing.T) {
+	name, socket := os.Getenv(envMirrorName), os.Getenv(envMirrorSocket)
+	if name == "" && socket == "" {
+		t.Skip("only run as the reader process of other tests")
+	}
+
+	shmDir = os.Getenv(envMirrorDir)
+
+	var frames int
+	fmt.Sscan(os.Getenv(envMirrorFrames), &frames)
+
+	var r *MirrorReader
+	var err error
+	if socket != "" {
+		r, err = DialMirror(socket)
+	} else {
+		r, err = OpenMirror(name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var f MirrorFrame
+	var last uint64
+	deadline := time.Now().Add(10 * time.Second)
+
+	for seen := 0; seen < frames; {
+		if r.Frame() == last {
+			if time.Now().After(deadline) {
+				t.Fatalf("saw %d of %d frames", seen, frames)
+			}
+			runtime.Gosched()
+			continue
+		}
+
+		if err := r.Read(&f); err != nil {
+			t.Fatal(err)
+		}
+		last = f.Number
+		seen++
+
+		img, err := f.Image()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := img.At(0, 0)
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if img.At(x, y) != want {
+					t.Fatalf("frame %d torn at (%d, %d)", f.Number, x, y)
+				}
+			}
+		}
+	}
+
+	img, _ := f.Image()
+	r8, g8, b8, _ := img.At(0, 0).RGBA()
+	fmt.Printf("frame %d %dx%d %T %02x%02x%02x\n", f.Number, f.Mode.Geometry.XRes, f.Mode.Geometry.YRes, img, r8>>8, g8>>8, b8>>8)
+}
+
+// fill draws a frame of a single color, and shows it.
+func fill(t *testing.T, c *Canvas, col color.Color) {
+	t.Helper()
+
+	back, err := c.BackBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draw.Draw(back, back.Bounds(), image.NewUniform(col), image.Point{}, draw.Src)
+
+	if err := c.Flip(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	oldDir := shmDir
+	shmDir = t.TempDir()
+	defer func() { shmDir = oldDir }()
+
+	// Two pages, so frames alternate between them.
+	c, err := NewMemoryCanvas(memoryMode(64, 48, 96, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fill(t, c, color.RGBA{0, 0, 0, 0xff})
+
+	m, err := NewMirror(c, "/fbmirror-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(shmDir, "fbmirror-test")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, out := startReader(t, "fbmirror-test", "", 100)
+
+	// Publish frames as fast as possible, until the reader has seen
+	// enough of them. Each has a single color.
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var n int
+	for err = nil; ; n++ {
+		select {
+		case err = <-exited:
+		default:
+			fill(t, c, color.RGBA{uint8(n), uint8(n >> 8), 0x80, 0xff})
+			if err := m.Publish(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		t.Fatalf("reader: %v\n%s", err, out)
+	}
+
+	// The last frame the reader saw must be one which was published.
+	var number uint64
+	var size, typ, rgb string
+	line := out.String()[strings.Index(out.String(), "frame "):]
+	fmt.Sscan(line, new(string), &number, &size, &typ, &rgb)
+
+	i := int(number) - 2 // Frame 1 was the black one.
+	want := fmt.Sprintf("%02x%02x80", uint8(i), uint8(i>>8))
+	if size != "64x48" || typ != "*framebuffer.BGRA" || rgb != want || number > m.Frame() {
+		t.Errorf("reader saw %q; %d frames published, want color %s", line, m.Frame(), want)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(shmDir, "fbmirror-test")); !os.IsNotExist(err) {
+		t.Errorf("segment not removed: %v", err)
+	}
+	if err := m.Publish(); err != ErrMirrorClosed {
+		t.Errorf("publish after close: %v", err)
+	}
+}
+
+func TestMirrorSocket(t *testing.T) {
+	oldDir := shmDir
+	shmDir = t.TempDir()
+	defer func() { shmDir = oldDir }()
+
+	c, err := NewMemoryCanvas(memoryMode(16, 8, 0, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	pal, _ := c.Palette()
+	pal[3] = color.NRGBA{0x12, 0x34, 0x56, 0xff}
+	c.SetPalette(pal)
+	fill(t, c, color.Alpha{3})
+
+	// Anonymous segments leave no name behind.
+	m, err := NewMirror(c, "", &MirrorOptions{Rate: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if names, _ := os.ReadDir(shmDir); len(names) != 0 {
+		t.Errorf("segment has a name: %v", names)
+	}
+
+	socket := filepath.Join(t.TempDir(), "mirror.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- m.Serve(l) }()
+
+	// Frames are published at the mirror's rate.
+	cmd, out := startReader(t, "", socket, 3)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("reader: %v\n%s", err, out)
+	}
+
+	if !strings.Contains(out.String(), "16x8 *image.Paletted 123456") {
+		t.Errorf("reader saw %q", out)
+	}
+
+	m.Close()
+	if err := <-served; err != ErrMirrorClosed {
+		t.Errorf("serve: %v", err)
+	}
+}
+
+func TestMirrorInProcess(t *testing.T) {
+	oldDir := shmDir
+	shmDir = t.TempDir()
+	defer func() { shmDir = oldDir }()
+
+	c, err := NewMemoryCanvas(memoryMode(4, 2, 0, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, _ := c.Image()
+	img.Set(1, 1, color.White)
+
+	if _, err := NewMirror(c, "a/b", nil); err == nil {
+		t.Error("invalid name accepted")
+	}
+
+	m, err := NewMirror(c, "mirror", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	r, err := OpenMirror("mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var f MirrorFrame
+	if err := r.Read(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Number != 1 || f.Stride != 8 || len(f.Pix) != 16 || f.Mode.Format.Type() != PF_RGB_565 {
+		t.Fatalf("frame %d, stride %d, %d bytes, format %+v", f.Number, f.Stride, len(f.Pix), f.Mode.Format)
+	}
+
+	fi, _ := f.Image()
+	if have := color.RGBAModel.Convert(fi.At(1, 1)); have != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("pixel: %v", have)
+	}
+
+	m.Close()
+	if !r.Closed() {
+		t.Error("reader does not see the mirror closed")
+	}
+}
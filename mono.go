@@ -0,0 +1,83 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+)
+
+// MonoModel converts colors to black or white, whichever is nearer
+// in brightness.
+var MonoModel = grayLevelModel(2)
+
+// Mono is an image with one bit per pixel, packed eight to a byte.
+// By default, the leftmost pixel is in the most significant bit, and
+// set bits are white, as with the MONO10 visual of framebuffers.
+type Mono struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+
+	Inverse  bool // Set bits are black, as with the MONO01 visual.
+	LSBFirst bool // The leftmost pixel is in the least significant bit.
+}
+
+func (i *Mono) Bounds() image.Rectangle { return i.Rect }
+func (i *Mono) ColorModel() color.Model { return MonoModel }
+
+func (i *Mono) At(x, y int) color.Color {
+	if i.Bit(x, y) {
+		return color.Gray{0xff}
+	}
+	return color.Gray{}
+}
+
+func (i *Mono) Set(x, y int, c color.Color) {
+	i.SetBit(x, y, MonoModel.Convert(c).(color.Gray).Y != 0)
+}
+
+// Bit reports whether the pixel at x, y is white.
+func (i *Mono) Bit(x, y int) bool {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return false
+	}
+
+	n, shift := packedOffset(i.Rect, i.Stride, 1, i.LSBFirst, x, y)
+	return (i.Pix[n]>>shift&1 != 0) != i.Inverse
+}
+
+// SetBit sets the pixel at x, y to white if on is true,
+// or to black otherwise.
+func (i *Mono) SetBit(x, y int, on bool) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+
+	n, shift := packedOffset(i.Rect, i.Stride, 1, i.LSBFirst, x, y)
+	if on != i.Inverse {
+		i.Pix[n] |= 1 << shift
+	} else {
+		i.Pix[n] &^= 1 << shift
+	}
+}
+
+// PixOffset returns the index of the byte holding the pixel at x, y.
+func (i *Mono) PixOffset(x, y int) int {
+	n, _ := packedOffset(i.Rect, i.Stride, 1, i.LSBFirst, x, y)
+	return n
+}
+
+func (i *Mono) levels() int { return 2 }
+
+func (i *Mono) level(x, y int) uint8 {
+	if i.Bit(x, y) {
+		return 1
+	}
+	return 0
+}
+
+func (i *Mono) setLevel(x, y int, v uint8) {
+	i.SetBit(x, y, v != 0)
+}
@@ -0,0 +1,231 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Gray2Model and Gray4Model convert colors to the nearest of 4
+// and 16 gray levels.
+var (
+	Gray2Model = grayLevelModel(4)
+	Gray4Model = grayLevelModel(16)
+)
+
+// grayLevelModel converts colors to the nearest of the given
+// number of gray levels.
+func grayLevelModel(levels int) color.Model {
+	step := 0xff / (levels - 1)
+	return color.ModelFunc(func(c color.Color) color.Color {
+		y := int(color.GrayModel.Convert(c).(color.Gray).Y)
+		return color.Gray{uint8((y + step/2) / step * step)}
+	})
+}
+
+// packing describes how a device stores pixels of less than a byte.
+type packing struct {
+	inverse  bool // Set bits are black, as with the MONO01 visual.
+	lsbFirst bool // The leftmost pixel is in the least significant bits.
+}
+
+// devicePacking returns the packing of a device with the given
+// visual, in the given mode.
+func devicePacking(visual uint32, mode *DisplayMode) packing {
+	return packing{
+		inverse:  visual == _VISUAL_MONO01,
+		lsbFirst: mode.Nonstandard&_NONSTD_REV_PIX_IN_B != 0,
+	}
+}
+
+// packedOffset returns the index of the byte holding the pixel at x, y
+// of a packed image with the given depth, and the shift of its bits.
+func packedOffset(r image.Rectangle, stride, depth int, lsbFirst bool, x, y int) (int, uint) {
+	bit := (x - r.Min.X) * depth
+	shift := uint(bit % 8)
+	if !lsbFirst {
+		shift = uint(8-depth) - shift
+	}
+	return (y-r.Min.Y)*stride + bit/8, shift
+}
+
+// Gray2 is an image with 2-bit gray levels, packed four to a byte.
+// By default, the leftmost pixel is in the most significant bits,
+// and level 0 is black.
+type Gray2 struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+
+	Inverse  bool // Level 0 is white.
+	LSBFirst bool // The leftmost pixel is in the least significant bits.
+}
+
+func (i *Gray2) Bounds() image.Rectangle { return i.Rect }
+func (i *Gray2) ColorModel() color.Model { return Gray2Model }
+
+func (i *Gray2) At(x, y int) color.Color {
+	return color.Gray{i.Level(x, y) * 0x55}
+}
+
+func (i *Gray2) Set(x, y int, c color.Color) {
+	i.SetLevel(x, y, Gray2Model.Convert(c).(color.Gray).Y/0x55)
+}
+
+// Level returns the brightness of the pixel at x, y, from 0 to 3.
+// With a pseudocolor visual, it is the index into the palette.
+func (i *Gray2) Level(x, y int) uint8 {
+	return getPacked(i.Pix, i.Rect, i.Stride, 2, i.Inverse, i.LSBFirst, x, y)
+}
+
+// SetLevel sets the brightness of the pixel at x, y, from 0 to 3.
+func (i *Gray2) SetLevel(x, y int, v uint8) {
+	setPacked(i.Pix, i.Rect, i.Stride, 2, i.Inverse, i.LSBFirst, x, y, v)
+}
+
+// PixOffset returns the index of the byte holding the pixel at x, y.
+func (i *Gray2) PixOffset(x, y int) int {
+	n, _ := packedOffset(i.Rect, i.Stride, 2, i.LSBFirst, x, y)
+	return n
+}
+
+func (i *Gray2) levels() int                { return 4 }
+func (i *Gray2) level(x, y int) uint8       { return i.Level(x, y) }
+func (i *Gray2) setLevel(x, y int, v uint8) { i.SetLevel(x, y, v) }
+
+// Gray4 is an image with 4-bit gray levels, packed two to a byte.
+// By default, the leftmost pixel is in the most significant bits,
+// and level 0 is black.
+type Gray4 struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+
+	Inverse  bool // Level 0 is white.
+	LSBFirst bool // The leftmost pixel is in the least significant bits.
+}
+
+func (i *Gray4) Bounds() image.Rectangle { return i.Rect }
+func (i *Gray4) ColorModel() color.Model { return Gray4Model }
+
+func (i *Gray4) At(x, y int) color.Color {
+	return color.Gray{i.Level(x, y) * 0x11}
+}
+
+func (i *Gray4) Set(x, y int, c color.Color) {
+	i.SetLevel(x, y, Gray4Model.Convert(c).(color.Gray).Y/0x11)
+}
+
+// Level returns the brightness of the pixel at x, y, from 0 to 15.
+// With a pseudocolor visual, it is the index into the palette.
+func (i *Gray4) Level(x, y int) uint8 {
+	return getPacked(i.Pix, i.Rect, i.Stride, 4, i.Inverse, i.LSBFirst, x, y)
+}
+
+// SetLevel sets the brightness of the pixel at x, y, from 0 to 15.
+func (i *Gray4) SetLevel(x, y int, v uint8) {
+	setPacked(i.Pix, i.Rect, i.Stride, 4, i.Inverse, i.LSBFirst, x, y, v)
+}
+
+// PixOffset returns the index of the byte holding the pixel at x, y.
+func (i *Gray4) PixOffset(x, y int) int {
+	n, _ := packedOffset(i.Rect, i.Stride, 4, i.LSBFirst, x, y)
+	return n
+}
+
+func (i *Gray4) levels() int                { return 16 }
+func (i *Gray4) level(x, y int) uint8       { return i.Level(x, y) }
+func (i *Gray4) setLevel(x, y int, v uint8) { i.SetLevel(x, y, v) }
+
+// getPacked returns the level of the pixel at x, y of a packed image.
+func getPacked(pix []byte, r image.Rectangle, stride, depth int, inverse, lsbFirst bool, x, y int) uint8 {
+	if !(image.Point{x, y}.In(r)) {
+		return 0
+	}
+
+	mask := uint8(1)<<depth - 1
+	n, shift := packedOffset(r, stride, depth, lsbFirst, x, y)
+	v := pix[n] >> shift & mask
+	if inverse {
+		v = mask - v
+	}
+	return v
+}
+
+// setPacked sets the level of the pixel at x, y of a packed image.
+// Levels beyond the depth are clamped.
+func setPacked(pix []byte, r image.Rectangle, stride, depth int, inverse, lsbFirst bool, x, y int, v uint8) {
+	if !(image.Point{x, y}.In(r)) {
+		return
+	}
+
+	mask := uint8(1)<<depth - 1
+	v = min(v, mask)
+	if inverse {
+		v = mask - v
+	}
+
+	n, shift := packedOffset(r, stride, depth, lsbFirst, x, y)
+	pix[n] = pix[n]&^(mask<<shift) | v<<shift
+}
+
+// leveled is implemented by the packed image types.
+type leveled interface {
+	draw.Image
+	levels() int
+	level(x, y int) uint8
+	setLevel(x, y int, v uint8)
+}
+
+// bayer4 is a 4x4 ordered dither matrix.
+var bayer4 = [4][4]int{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// OrderedDither draws onto the packed image types with a 4x4 ordered
+// dither, spreading intermediate brightness over a fixed pattern of
+// the nearest gray levels. Unlike draw.FloydSteinberg, which also works
+// with these types, the pattern of an area does not depend on its
+// surroundings, so it does not crawl in animations and redrawing part
+// of an image matches the rest. Other images are drawn with draw.Src.
+var OrderedDither draw.Drawer = orderedDither{}
+
+type orderedDither struct{}
+
+func (orderedDither) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	img, ok := dst.(leveled)
+	if !ok {
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+
+	// Clip to the destination and source, as draw.Draw does.
+	orig := r.Min
+	r = r.Intersect(dst.Bounds())
+	r = r.Intersect(src.Bounds().Add(orig.Sub(sp)))
+	sp = sp.Add(r.Min.Sub(orig))
+
+	top := img.levels() - 1
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := src.At(sp.X+x-r.Min.X, sp.Y+y-r.Min.Y)
+			lum := int(color.Gray16Model.Convert(c).(color.Gray16).Y)
+
+			// The level below, raised where the remainder exceeds
+			// the threshold of this position.
+			v := lum * top
+			level := v / 0xffff
+			if (v%0xffff)*32 > (2*bayer4[y&3][x&3]+1)*0xffff {
+				level++
+			}
+
+			img.setLevel(x, y, uint8(min(level, top)))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestPackedImages(t *testing.T) {
+	img, err := NewImage(PixelFormat{Depth: 1}, image.Rect(0, 0, 10, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The leftmost pixel is in the most significant bit, and rows
+	// start at byte boundaries.
+	m := img.(*Mono)
+	m.Set(1, 0, color.White)
+	m.Set(9, 1, color.Gray{0xc0})
+	m.Set(2, 0, color.Gray{0x40})
+	if !bytes.Equal(m.Pix, []byte{0x40, 0, 0, 0x40}) || m.At(1, 0) != (color.Gray{0xff}) {
+		t.Errorf("mono pixels % x", m.Pix)
+	}
+
+	// Set bits are black, from the least significant bit on.
+	m = &Mono{Pix: []byte{0xff}, Stride: 1, Rect: image.Rect(0, 0, 8, 1), Inverse: true, LSBFirst: true}
+	m.Set(1, 0, color.White)
+	if m.Pix[0] != 0xfd || m.Bit(0, 0) || !m.Bit(1, 0) {
+		t.Errorf("inverse mono pixels %02x", m.Pix[0])
+	}
+
+	img, _ = NewImage(PixelFormat{Depth: 2}, image.Rect(0, 0, 4, 1))
+	g2 := img.(*Gray2)
+	g2.Set(0, 0, color.White)
+	g2.Set(1, 0, color.Gray{0x50})
+	if g2.Pix[0] != 0xd0 || g2.At(1, 0) != (color.Gray{0x55}) || g2.Level(0, 0) != 3 {
+		t.Errorf("gray2 pixels %02x", g2.Pix[0])
+	}
+
+	g4 := &Gray4{Pix: make([]byte, 2), Stride: 1, Rect: image.Rect(0, 0, 2, 2), LSBFirst: true}
+	g4.Set(0, 1, color.Gray{0x55})
+	g4.SetLevel(1, 1, 20)
+	if g4.Pix[1] != 0xf5 || g4.Level(0, 1) != 5 || g4.At(5, 5) != (color.Gray{}) {
+		t.Errorf("gray4 pixels % x", g4.Pix)
+	}
+}
+
+func TestPackedCanvas(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 16, 4, 1)
+	fb.fi.visual = _VISUAL_MONO01
+	fb.vi.nonstd = _NONSTD_REV_PIX_IN_B
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, _ := c.Image()
+	m, ok := img.(*Mono)
+	if !ok || !m.Inverse || !m.LSBFirst || m.Stride != 2 {
+		t.Fatalf("image %T %+v", img, img)
+	}
+
+	m.Set(0, 1, color.Black)
+	if c.Buffer()[2] != 0x01 {
+		t.Errorf("buffer % x", c.Buffer()[:4])
+	}
+
+	snap, err := c.Snapshot(image.Rect(0, 0, 2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.RGBAAt(0, 1) != (color.RGBA{0, 0, 0, 0xff}) || snap.RGBAAt(1, 1) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("snapshot pixels %v, %v", snap.At(0, 1), snap.At(1, 1))
+	}
+
+	// With a pseudocolor visual, levels index the palette.
+	fb = s.addFB(1, "fb1", "drv", 6, 2, 4)
+	fb.cmap[0][3] = 0xffff
+
+	c4, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c4.Close()
+
+	img, _ = c4.Image()
+	img.(*Gray4).SetLevel(5, 1, 3)
+
+	snap, err = c4.Snapshot(image.Rectangle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.RGBAAt(5, 1) != (color.RGBA{0xff, 0, 0, 0xff}) || c4.Buffer()[5] != 0x03 {
+		t.Errorf("snapshot pixel %v", snap.At(5, 1))
+	}
+
+	// Memory canvases store white as set bits.
+	mc, err := NewMemoryCanvas(memoryMode(10, 2, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+
+	img, _ = mc.Image()
+	if m, ok := img.(*Mono); !ok || m.Inverse || m.LSBFirst || len(mc.Buffer()) != 4 {
+		t.Fatalf("memory image %T, %d bytes", img, len(mc.Buffer()))
+	}
+}
+
+func TestOrderedDither(t *testing.T) {
+	gray := image.NewUniform(color.Gray{0x80})
+	r := image.Rect(0, 0, 8, 8)
+
+	m := &Mono{Pix: make([]byte, 8), Stride: 1, Rect: r}
+	OrderedDither.Draw(m, r, gray, image.Point{})
+
+	// Half of the pixels are white, in the same pattern in each
+	// block of 4x4 pixels.
+	var white int
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if m.Bit(x, y) {
+				white++
+			}
+			if m.Bit(x, y) != m.Bit(x&3, y&3) {
+				t.Fatalf("pattern differs at %d, %d", x, y)
+			}
+		}
+	}
+	if white != 32 {
+		t.Errorf("%d white pixels", white)
+	}
+
+	// Exact levels are not dithered.
+	g2 := &Gray2{Pix: make([]byte, 2), Stride: 1, Rect: image.Rect(0, 0, 4, 2)}
+	OrderedDither.Draw(g2, g2.Rect, image.NewUniform(color.Gray{0x55}), image.Point{})
+	if !bytes.Equal(g2.Pix, []byte{0x55, 0x55}) {
+		t.Errorf("gray2 pixels % x", g2.Pix)
+	}
+
+	// Error diffusion works through Set and At.
+	m = &Mono{Pix: make([]byte, 8), Stride: 1, Rect: r}
+	draw.FloydSteinberg.Draw(m, r, gray, image.Point{})
+	if bytes.Count(m.Pix, []byte{0}) == 8 || bytes.Count(m.Pix, []byte{0xff}) == 8 {
+		t.Errorf("floyd-steinberg pixels % x", m.Pix)
+	}
+}
@@ -0,0 +1,202 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package panel
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Bus carries commands and data to a display controller. It is an
+// interface, so tests can record what a panel sends.
+type Bus interface {
+	// Command sends bytes which the controller takes as commands:
+	// with the data/command line low on SPI, or after a control
+	// byte of 0x00 on I²C.
+	Command(p []byte) error
+
+	// Data sends command parameters or pixel data.
+	Data(p []byte) error
+
+	// Close releases the bus, and the lines it controls.
+	Close() error
+}
+
+// Resetter is implemented by buses which control the reset line of
+// the controller. Panels reset the controller before initializing it.
+type Resetter interface {
+	Reset() error
+}
+
+// Pin is a GPIO line, configured as an output.
+type Pin interface {
+	Set(high bool) error
+	Close() error
+}
+
+// SPI and I²C requests, from <linux/spi/spidev.h> and <linux/i2c-dev.h>.
+const (
+	_SPI_IOC_WR_MODE          = 0x40016b01
+	_SPI_IOC_WR_BITS_PER_WORD = 0x40016b03
+	_SPI_IOC_WR_MAX_SPEED_HZ  = 0x40046b04
+
+	_I2C_SLAVE = 0x0703
+)
+
+// maxTransfer is the most spidev transfers in a single write, unless
+// its bufsiz parameter was raised. I²C writes are split likewise.
+const maxTransfer = 4096
+
+func ioctl(fd, name uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, name, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SPIOptions configure an SPI bus.
+type SPIOptions struct {
+	Speed uint32 // Clock rate in Hz. Zero means 16 MHz.
+	Mode  uint8  // SPI mode, 0 to 3.
+	DC    Pin    // Data/command line: low for commands. Required.
+	Reset Pin    // Reset line, active low. Nil if there is none.
+}
+
+// spiBus sends through a spidev device, such as /dev/spidev0.0.
+type spiBus struct {
+	f     *os.File
+	dc    Pin
+	reset Pin
+}
+
+// OpenSPI opens a spidev device for a controller wired to it with a
+// separate data/command line, as the ILI9341, ST7789 and SSD1306 are
+// in four-wire mode. The bus owns the pins of opts, and closes them.
+func OpenSPI(dev string, opts *SPIOptions) (Bus, error) {
+	if opts == nil || opts.DC == nil {
+		return nil, errors.New("panel: SPI bus needs a data/command line")
+	}
+
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, bits, speed := opts.Mode, uint8(8), opts.Speed
+	if speed == 0 {
+		speed = 16000000
+	}
+
+	for _, req := range []struct {
+		name uintptr
+		arg  unsafe.Pointer
+	}{
+		{_SPI_IOC_WR_MODE, unsafe.Pointer(&mode)},
+		{_SPI_IOC_WR_BITS_PER_WORD, unsafe.Pointer(&bits)},
+		{_SPI_IOC_WR_MAX_SPEED_HZ, unsafe.Pointer(&speed)},
+	} {
+		if err := ioctl(f.Fd(), req.name, req.arg); err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "ioctl", Path: dev, Err: err}
+		}
+	}
+
+	return &spiBus{f: f, dc: opts.DC, reset: opts.Reset}, nil
+}
+
+func (b *spiBus) Command(p []byte) error {
+	if err := b.dc.Set(false); err != nil {
+		return err
+	}
+	return b.write(p)
+}
+
+func (b *spiBus) Data(p []byte) error {
+	if err := b.dc.Set(true); err != nil {
+		return err
+	}
+	return b.write(p)
+}
+
+func (b *spiBus) write(p []byte) error {
+	for len(p) > 0 {
+		n, err := b.f.Write(p[:min(len(p), maxTransfer)])
+		if err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+// Reset pulses the reset line, if there is one.
+func (b *spiBus) Reset() error {
+	if b.reset == nil {
+		return nil
+	}
+
+	for _, high := range []bool{true, false, true} {
+		if err := b.reset.Set(high); err != nil {
+			return err
+		}
+		sleep(resetDelay)
+	}
+	return nil
+}
+
+func (b *spiBus) Close() error {
+	err := b.f.Close()
+	b.dc.Close()
+	if b.reset != nil {
+		b.reset.Close()
+	}
+	return err
+}
+
+// i2cBus sends through an i2c-dev device, such as /dev/i2c-1.
+type i2cBus struct {
+	f   *os.File
+	buf []byte
+}
+
+// OpenI2C opens an i2c-dev device for the controller at the given
+// address; SSD1306 modules are usually at 0x3c.
+func OpenI2C(dev string, addr uint16) (Bus, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// I2C_SLAVE takes the address itself, not a pointer to it.
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), _I2C_SLAVE, uintptr(addr)); errno != 0 {
+		f.Close()
+		return nil, &os.PathError{Op: "ioctl", Path: dev, Err: errno}
+	}
+
+	return &i2cBus{f: f}, nil
+}
+
+func (b *i2cBus) Command(p []byte) error { return b.write(0x00, p) }
+func (b *i2cBus) Data(p []byte) error    { return b.write(0x40, p) }
+
+// write sends p in messages starting with the given control byte.
+func (b *i2cBus) write(control byte, p []byte) error {
+	for len(p) > 0 {
+		n := min(len(p), maxTransfer-1)
+		b.buf = append(append(b.buf[:0], control), p[:n]...)
+
+		if _, err := b.f.Write(b.buf); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+func (b *i2cBus) Close() error {
+	return b.f.Close()
+}
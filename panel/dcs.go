@@ -0,0 +1,205 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package panel
+
+import (
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Size of the memory of the MIPI DCS controllers, in pixels.
+const (
+	dcsWidth  = 240
+	dcsHeight = 320
+)
+
+// MIPI DCS commands, which the ILI9341 and ST7789 share.
+const (
+	dcsSoftReset    = 0x01
+	dcsSleepIn      = 0x10
+	dcsSleepOut     = 0x11
+	dcsNormalMode   = 0x13
+	dcsInvertOff    = 0x20
+	dcsInvertOn     = 0x21
+	dcsDisplayOff   = 0x28
+	dcsDisplayOn    = 0x29
+	dcsColumnRange  = 0x2a
+	dcsPageRange    = 0x2b
+	dcsMemoryWrite  = 0x2c
+	dcsAddressMode  = 0x36
+	dcsPixelFormat  = 0x3a
+	dcsPixelsRGB565 = 0x55
+)
+
+// Bits of the address mode.
+const (
+	madctlMY  = 0x80 // Rows from bottom to top.
+	madctlMX  = 0x40 // Columns from right to left.
+	madctlMV  = 0x20 // Rows and columns exchanged.
+	madctlBGR = 0x08
+)
+
+// step is a command of an initialization sequence.
+type step struct {
+	cmd    byte
+	params []byte
+	delay  time.Duration // Time the controller needs afterwards.
+}
+
+// ili9341Init sets up power and gamma as the usual modules need it.
+var ili9341Init = []step{
+	{cmd: 0xef, params: []byte{0x03, 0x80, 0x02}},
+	{cmd: 0xcf, params: []byte{0x00, 0xc1, 0x30}},       // Power control B.
+	{cmd: 0xed, params: []byte{0x64, 0x03, 0x12, 0x81}}, // Power on sequence.
+	{cmd: 0xe8, params: []byte{0x85, 0x00, 0x78}},       // Driver timing A.
+	{cmd: 0xcb, params: []byte{0x39, 0x2c, 0x00, 0x34, 0x02}},
+	{cmd: 0xf7, params: []byte{0x20}},       // Pump ratio.
+	{cmd: 0xea, params: []byte{0x00, 0x00}}, // Driver timing B.
+	{cmd: 0xc0, params: []byte{0x23}},       // Power control 1.
+	{cmd: 0xc1, params: []byte{0x10}},       // Power control 2.
+	{cmd: 0xc5, params: []byte{0x3e, 0x28}}, // VCOM control 1.
+	{cmd: 0xc7, params: []byte{0x86}},       // VCOM control 2.
+	{cmd: 0x37, params: []byte{0x00}},       // No vertical scrolling.
+	{cmd: 0xb1, params: []byte{0x00, 0x18}}, // Frame rate: 79 Hz.
+	{cmd: 0xb6, params: []byte{0x08, 0x82, 0x27}},
+	{cmd: 0xf2, params: []byte{0x00}}, // No 3-gamma.
+	{cmd: 0x26, params: []byte{0x01}}, // Gamma curve 1.
+	{cmd: 0xe0, params: []byte{0x0f, 0x31, 0x2b, 0x0c, 0x0e, 0x08, 0x4e, 0xf1, 0x37, 0x07, 0x10, 0x03, 0x0e, 0x09, 0x00}},
+	{cmd: 0xe1, params: []byte{0x00, 0x0e, 0x14, 0x03, 0x11, 0x07, 0x31, 0xc1, 0x48, 0x08, 0x0f, 0x0c, 0x31, 0x36, 0x0f}},
+}
+
+// Address modes for each rotation. Modules with an ILI9341 mostly
+// show the memory mirrored.
+var (
+	ili9341Modes = [4]byte{madctlMX, madctlMV, madctlMY, madctlMX | madctlMY | madctlMV}
+	st7789Modes  = [4]byte{0, madctlMY | madctlMV, madctlMX | madctlMY, madctlMX | madctlMV}
+)
+
+// dcs drives the MIPI DCS controllers, ILI9341 and ST7789.
+type dcs struct {
+	model  Controller
+	opts   *Options
+	origin image.Point // Position of the image in the memory.
+	buf    []byte
+}
+
+// sendCommand sends a command, and its parameters as data.
+func sendCommand(bus Bus, cmd byte, params ...byte) error {
+	if err := bus.Command([]byte{cmd}); err != nil {
+		return err
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return bus.Data(params)
+}
+
+func (d *dcs) init(bus Bus) error {
+	steps := []step{{cmd: dcsSoftReset, delay: 150 * time.Millisecond}}
+	if d.model == ILI9341 {
+		steps = append(steps, ili9341Init...)
+	}
+
+	invert := byte(dcsInvertOff)
+	if d.opts.Invert {
+		invert = dcsInvertOn
+	}
+
+	steps = append(steps,
+		step{cmd: dcsPixelFormat, params: []byte{dcsPixelsRGB565}, delay: 10 * time.Millisecond},
+		step{cmd: invert},
+		step{cmd: dcsSleepOut, delay: 120 * time.Millisecond},
+		step{cmd: dcsNormalMode},
+	)
+
+	for _, s := range steps {
+		if err := sendCommand(bus, s.cmd, s.params...); err != nil {
+			return err
+		}
+		sleep(s.delay)
+	}
+	return nil
+}
+
+func (d *dcs) rotate(bus Bus, rot Rotation) error {
+	mode := st7789Modes[rot]
+	if d.model == ILI9341 {
+		mode = ili9341Modes[rot]
+	}
+	if d.opts.BGR {
+		mode |= madctlBGR
+	}
+
+	if err := sendCommand(bus, dcsAddressMode, mode); err != nil {
+		return err
+	}
+
+	// Where the panel starts depends on the direction the
+	// memory is addressed in.
+	start := func(mirrored bool, ram, size, offset int) int {
+		if mirrored {
+			return ram - size - offset
+		}
+		return offset
+	}
+
+	o := d.opts
+	mx, my := mode&madctlMX != 0, mode&madctlMY != 0
+	if mode&madctlMV != 0 {
+		d.origin = image.Pt(start(mx, dcsHeight, o.Height, o.Offset.Y), start(my, dcsWidth, o.Width, o.Offset.X))
+	} else {
+		d.origin = image.Pt(start(mx, dcsWidth, o.Width, o.Offset.X), start(my, dcsHeight, o.Height, o.Offset.Y))
+	}
+	return nil
+}
+
+func (d *dcs) newImage(r image.Rectangle) draw.Image {
+	return &framebuffer.RGB565{Pix: make([]byte, r.Dx()*r.Dy()*2), Stride: r.Dx() * 2, Rect: r}
+}
+
+func (d *dcs) flush(bus Bus, img draw.Image, r image.Rectangle) error {
+	w := r.Add(d.origin)
+	if err := sendCommand(bus, dcsColumnRange, be16(w.Min.X, w.Max.X-1)...); err != nil {
+		return err
+	}
+	if err := sendCommand(bus, dcsPageRange, be16(w.Min.Y, w.Max.Y-1)...); err != nil {
+		return err
+	}
+
+	// Images keep pixels in little endian order; the
+	// controllers take them in big endian order.
+	src := img.(*framebuffer.RGB565)
+	d.buf = d.buf[:0]
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := src.Pix[src.PixOffset(r.Min.X, y):src.PixOffset(r.Max.X, y)]
+		for i := 0; i < len(row); i += 2 {
+			d.buf = append(d.buf, row[i+1], row[i])
+		}
+	}
+
+	return sendCommand(bus, dcsMemoryWrite, d.buf...)
+}
+
+func (d *dcs) display(bus Bus, on bool) error {
+	if on {
+		return sendCommand(bus, dcsDisplayOn)
+	}
+
+	if err := sendCommand(bus, dcsDisplayOff); err != nil {
+		return err
+	}
+	return sendCommand(bus, dcsSleepIn)
+}
+
+// be16 returns the values as 16-bit big endian parameters.
+func be16(v ...int) []byte {
+	b := make([]byte, 0, 2*len(v))
+	for _, n := range v {
+		b = append(b, byte(n>>8), byte(n))
+	}
+	return b
+}
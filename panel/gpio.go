@@ -0,0 +1,80 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package panel
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// Definitions from <linux/gpio.h>.
+
+const _GPIO_V2_LINE_FLAG_OUTPUT = 1 << 3
+
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [10 * 3]uint64 // struct gpio_v2_line_config_attribute[10]
+}
+
+type gpioV2LineRequest struct {
+	offsets         [64]uint32
+	consumer        [32]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+var (
+	_GPIO_V2_GET_LINE_IOCTL        = 0xc000b407 | unsafe.Sizeof(gpioV2LineRequest{})<<16
+	_GPIO_V2_LINE_SET_VALUES_IOCTL = 0xc000b40f | unsafe.Sizeof(gpioV2LineValues{})<<16
+)
+
+// gpioLine is a line requested from a GPIO character device.
+type gpioLine struct {
+	f *os.File
+}
+
+// OpenGPIO requests a line of a GPIO chip, such as /dev/gpiochip0,
+// as an output. The line is low until set otherwise.
+func OpenGPIO(chip string, line int) (Pin, error) {
+	f, err := os.OpenFile(chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var req gpioV2LineRequest
+	req.offsets[0] = uint32(line)
+	req.numLines = 1
+	req.config.flags = _GPIO_V2_LINE_FLAG_OUTPUT
+	copy(req.consumer[:], "panel")
+
+	if err := ioctl(f.Fd(), _GPIO_V2_GET_LINE_IOCTL, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("panel: requesting line %d of %s: %w", line, chip, err)
+	}
+
+	return &gpioLine{f: os.NewFile(uintptr(req.fd), fmt.Sprintf("%s:%d", chip, line))}, nil
+}
+
+func (l *gpioLine) Set(high bool) error {
+	v := gpioV2LineValues{mask: 1}
+	if high {
+		v.bits = 1
+	}
+	return ioctl(l.f.Fd(), _GPIO_V2_LINE_SET_VALUES_IOCTL, unsafe.Pointer(&v))
+}
+
+func (l *gpioLine) Close() error {
+	return l.f.Close()
+}
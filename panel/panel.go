@@ -0,0 +1,300 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package panel drives small displays attached to SPI or I²C, which
+// have a controller with its own memory instead of a framebuffer
+// device: the ILI9341, the ST7789 and the SSD1306.
+//
+// A panel holds an image of the same types a canvas uses, a
+// framebuffer.RGB565 for the color controllers and a framebuffer.Mono
+// for the SSD1306. Applications draw on it, mark the areas which
+// changed with Invalidate, and call Flush to send just those areas
+// to the controller.
+//
+//	bus, err := panel.OpenSPI("/dev/spidev0.0", &panel.SPIOptions{DC: dc, Reset: reset})
+//	...
+//	p, err := panel.New(bus, panel.ILI9341, nil)
+//	...
+//	img := p.Image()
+//	draw.Draw(img, r, src, sp, draw.Src)
+//	p.Invalidate(r)
+//	p.Flush()
+package panel
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+)
+
+// sleep waits for the controller. It is a variable,
+// so tests need not wait.
+var sleep = time.Sleep
+
+// resetDelay is how long each phase of a reset pulse lasts.
+const resetDelay = 10 * time.Millisecond
+
+// maxRects is the number of areas waiting to be sent, before they are
+// reduced to their bounding box. Beyond this, the overhead of setting
+// up each window outweighs sending somewhat more pixels.
+const maxRects = 16
+
+// Controller identifies a display controller.
+type Controller int
+
+// Known controllers.
+const (
+	ILI9341 Controller = iota + 1 // 240x320 pixels, RGB565.
+	ST7789                        // Up to 240x320 pixels, RGB565.
+	SSD1306                       // Up to 128x64 pixels, monochrome.
+)
+
+func (c Controller) String() string {
+	switch c {
+	case ILI9341:
+		return "ILI9341"
+	case ST7789:
+		return "ST7789"
+	case SSD1306:
+		return "SSD1306"
+	}
+	return fmt.Sprintf("Controller(%d)", int(c))
+}
+
+// Rotation turns the image on the panel.
+type Rotation int
+
+// Rotations, clockwise.
+const (
+	Rotate0 Rotation = iota
+	Rotate90
+	Rotate180
+	Rotate270
+)
+
+// Options configure a panel.
+type Options struct {
+	// Width and Height are the size of the panel, unrotated.
+	// Zero means the largest the controller supports.
+	Width, Height int
+
+	// Offset is where the panel starts in the memory of the
+	// controller. Modules with panels smaller than the memory,
+	// such as 135x240 ST7789 ones, often need it.
+	Offset image.Point
+
+	Rotation Rotation
+	BGR      bool // Panel has its subpixels in blue-green-red order.
+	Invert   bool // Show colors inverted.
+}
+
+// defaultOptions are the options of the modules usually sold.
+var defaultOptions = map[Controller]Options{
+	ILI9341: {BGR: true},
+	ST7789:  {Invert: true},
+	SSD1306: {},
+}
+
+// driver is the part of a panel specific to its controller.
+type driver interface {
+	// init initializes the controller, leaving the display off.
+	init(bus Bus) error
+
+	// rotate sets the rotation of the panel.
+	rotate(bus Bus, rot Rotation) error
+
+	// newImage allocates an image of the given size.
+	newImage(r image.Rectangle) draw.Image
+
+	// flush sends the area r of the image.
+	flush(bus Bus, img draw.Image, r image.Rectangle) error
+
+	// display turns the display on or off.
+	display(bus Bus, on bool) error
+}
+
+// Panel is a display attached to a bus.
+type Panel struct {
+	bus   Bus
+	drv   driver
+	opts  Options
+	img   draw.Image
+	dirty []image.Rectangle
+}
+
+// New initializes the controller on the bus, and clears the panel.
+// Nil options select those of the modules usually sold.
+func New(bus Bus, c Controller, opts *Options) (*Panel, error) {
+	o, ok := defaultOptions[c]
+	if !ok {
+		return nil, fmt.Errorf("panel: unknown controller %v", c)
+	}
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Rotation < Rotate0 || o.Rotation > Rotate270 {
+		return nil, errors.New("panel: invalid rotation")
+	}
+
+	p := &Panel{bus: bus, opts: o}
+
+	var err error
+	if p.drv, err = newDriver(c, &p.opts); err != nil {
+		return nil, err
+	}
+
+	if r, ok := bus.(Resetter); ok {
+		if err := r.Reset(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.drv.init(bus); err != nil {
+		return nil, err
+	}
+
+	if err := p.SetRotation(o.Rotation); err != nil {
+		return nil, err
+	}
+
+	if err := p.drv.display(bus, true); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// newDriver returns the driver for the controller c, filling in the
+// size of the panel in o.
+func newDriver(c Controller, o *Options) (driver, error) {
+	var limit image.Point
+	switch c {
+	case ILI9341, ST7789:
+		limit = image.Pt(dcsWidth, dcsHeight)
+	case SSD1306:
+		limit = image.Pt(ssd1306Width, ssd1306Height)
+	}
+
+	if o.Width == 0 {
+		o.Width = limit.X - o.Offset.X
+	}
+	if o.Height == 0 {
+		o.Height = limit.Y - o.Offset.Y
+	}
+
+	if o.Width <= 0 || o.Height <= 0 || o.Offset.X < 0 || o.Offset.Y < 0 ||
+		o.Offset.X+o.Width > limit.X || o.Offset.Y+o.Height > limit.Y {
+		return nil, fmt.Errorf("panel: %v does not support %dx%d pixels at %v", c, o.Width, o.Height, o.Offset)
+	}
+
+	if c == SSD1306 {
+		if o.Height%8 != 0 || o.Offset.Y%8 != 0 {
+			return nil, errors.New("panel: SSD1306 rows must come in pages of 8")
+		}
+		return &ssd1306{opts: o}, nil
+	}
+
+	return &dcs{model: c, opts: o}, nil
+}
+
+// Image returns the image shown on the panel. Its size depends on
+// the rotation; after SetRotation, a new image must be retrieved.
+func (p *Panel) Image() draw.Image {
+	return p.img
+}
+
+// Bounds returns the bounds of the image.
+func (p *Panel) Bounds() image.Rectangle {
+	return p.img.Bounds()
+}
+
+// Invalidate marks the area r of the image as changed,
+// so the next Flush sends it.
+func (p *Panel) Invalidate(r image.Rectangle) {
+	r = r.Intersect(p.img.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	for i := 0; i < len(p.dirty); {
+		v := p.dirty[i]
+
+		if r.In(v) {
+			return
+		}
+
+		if v.Overlaps(r) {
+			r = r.Union(v)
+			p.dirty = append(p.dirty[:i], p.dirty[i+1:]...)
+
+			// The union may overlap rectangles which were checked before.
+			i = 0
+			continue
+		}
+
+		i++
+	}
+
+	p.dirty = append(p.dirty, r)
+
+	if len(p.dirty) > maxRects {
+		var b image.Rectangle
+		for _, v := range p.dirty {
+			b = b.Union(v)
+		}
+		p.dirty = append(p.dirty[:0], b)
+	}
+}
+
+// Flush sends the areas marked by Invalidate to the controller.
+func (p *Panel) Flush() error {
+	for len(p.dirty) > 0 {
+		if err := p.drv.flush(p.bus, p.img, p.dirty[0]); err != nil {
+			return err
+		}
+		p.dirty = p.dirty[1:]
+	}
+
+	p.dirty = nil
+	return nil
+}
+
+// SetRotation turns the image on the panel. It allocates an
+// image of the new size, which is cleared and sent.
+func (p *Panel) SetRotation(rot Rotation) error {
+	if rot < Rotate0 || rot > Rotate270 {
+		return errors.New("panel: invalid rotation")
+	}
+
+	if err := p.drv.rotate(p.bus, rot); err != nil {
+		return err
+	}
+	p.opts.Rotation = rot
+
+	size := image.Pt(p.opts.Width, p.opts.Height)
+	if rot == Rotate90 || rot == Rotate270 {
+		size.X, size.Y = size.Y, size.X
+	}
+
+	p.img = p.drv.newImage(image.Rectangle{Max: size})
+	p.dirty = nil
+	p.Invalidate(p.img.Bounds())
+	return p.Flush()
+}
+
+// Rotation returns the rotation of the panel.
+func (p *Panel) Rotation() Rotation {
+	return p.opts.Rotation
+}
+
+// Close turns the display off, and closes the bus.
+func (p *Panel) Close() error {
+	err := p.drv.display(p.bus, false)
+	if cerr := p.bus.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,307 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package panel
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+// fakeBus records what is sent, one line per transfer. Long
+// transfers are recorded by their length.
+type fakeBus struct {
+	ops    []string
+	resets int
+	closed bool
+}
+
+func (b *fakeBus) Command(p []byte) error {
+	b.ops = append(b.ops, fmt.Sprintf("C % x", p))
+	return nil
+}
+
+func (b *fakeBus) Data(p []byte) error {
+	if len(p) > 16 {
+		b.ops = append(b.ops, fmt.Sprintf("D %d bytes", len(p)))
+	} else {
+		b.ops = append(b.ops, fmt.Sprintf("D % x", p))
+	}
+	return nil
+}
+
+func (b *fakeBus) Reset() error {
+	b.resets++
+	return nil
+}
+
+func (b *fakeBus) Close() error {
+	b.closed = true
+	return nil
+}
+
+// take returns the recorded transfers, and forgets them.
+func (b *fakeBus) take() string {
+	s := strings.Join(b.ops, "; ")
+	b.ops = nil
+	return s
+}
+
+func noSleep(t *testing.T) *time.Duration {
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept += d }
+	t.Cleanup(func() { sleep = time.Sleep })
+	return &slept
+}
+
+func TestILI9341(t *testing.T) {
+	slept := noSleep(t)
+	bus := new(fakeBus)
+
+	p, err := New(bus, ILI9341, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reset, initialize, clear the whole panel, and turn it on.
+	ops := bus.take()
+	for _, want := range []string{
+		"C 01; C ef; D 03 80 02; ",
+		"C e0; D 0f 31 2b 0c",
+		"C 3a; D 55; C 20; C 11; C 13; C 36; D 48; ",
+		"C 2a; D 00 00 00 ef; C 2b; D 00 00 01 3f; C 2c; D 153600 bytes; C 29",
+	} {
+		if !strings.Contains(ops, want) {
+			t.Errorf("missing %q in %s", want, ops)
+		}
+	}
+	if bus.resets != 1 || *slept < 270*time.Millisecond {
+		t.Errorf("%d resets, slept %v", bus.resets, *slept)
+	}
+
+	img, ok := p.Image().(*framebuffer.RGB565)
+	if !ok || img.Bounds() != image.Rect(0, 0, 240, 320) {
+		t.Fatalf("image %T %v", p.Image(), p.Image().Bounds())
+	}
+
+	// Only what was invalidated is sent, in big endian order.
+	img.Set(10, 20, color.RGBA{0xff, 0, 0, 0xff})
+	img.Set(12, 20, color.RGBA{0, 0, 0xff, 0xff})
+	p.Invalidate(image.Rect(10, 20, 12, 21))
+	p.Invalidate(image.Rect(11, 20, 13, 21))
+	p.Invalidate(image.Rect(11, 20, 12, 21))
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "C 2a; D 00 0a 00 0c; C 2b; D 00 14 00 14; C 2c; D f8 00 00 00 00 1f"
+	if ops := bus.take(); ops != want {
+		t.Errorf("flush sent %s, want %s", ops, want)
+	}
+
+	// Separate areas are sent separately.
+	p.Invalidate(image.Rect(0, 0, 1, 1))
+	p.Invalidate(image.Rect(239, 319, 250, 330))
+	p.Flush()
+
+	want = "C 2a; D 00 00 00 00; C 2b; D 00 00 00 00; C 2c; D 00 00; " +
+		"C 2a; D 00 ef 00 ef; C 2b; D 01 3f 01 3f; C 2c; D 00 00"
+	if ops := bus.take(); ops != want {
+		t.Errorf("flush sent %s, want %s", ops, want)
+	}
+
+	if err := p.Flush(); err != nil || len(bus.ops) != 0 {
+		t.Errorf("flush without changes: %v, %v", bus.ops, err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ops := bus.take(); ops != "C 28; C 10" || !bus.closed {
+		t.Errorf("close sent %s", ops)
+	}
+}
+
+func TestST7789Rotation(t *testing.T) {
+	noSleep(t)
+	bus := new(fakeBus)
+
+	// A 135x240 module.
+	p, err := New(bus, ST7789, &Options{Width: 135, Height: 240, Offset: image.Pt(52, 40), Invert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := bus.take(); !strings.Contains(ops, "C 21; C 11; C 13; C 36; D 00; C 2a; D 00 34 00 ba; C 2b; D 00 28 01 17;") {
+		t.Errorf("init sent %s", ops)
+	}
+
+	for _, test := range []struct {
+		rot  Rotation
+		size image.Point
+		want string
+	}{
+		{Rotate90, image.Pt(240, 135), "C 36; D a0; C 2a; D 00 28 00 28; C 2b; D 00 35 00 35"},
+		{Rotate180, image.Pt(135, 240), "C 36; D c0; C 2a; D 00 35 00 35; C 2b; D 00 28 00 28"},
+		{Rotate270, image.Pt(240, 135), "C 36; D 60; C 2a; D 00 28 00 28; C 2b; D 00 34 00 34"},
+		{Rotate0, image.Pt(135, 240), "C 36; D 00; C 2a; D 00 34 00 34; C 2b; D 00 28 00 28"},
+	} {
+		if err := p.SetRotation(test.rot); err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Bounds().Size() != test.size || p.Rotation() != test.rot {
+			t.Errorf("rotation %d: size %v", test.rot, p.Bounds().Size())
+		}
+
+		// The whole image is sent after rotating; the position of
+		// its top left pixel is where the panel starts.
+		bus.take()
+		p.Invalidate(image.Rect(0, 0, 1, 1))
+		p.Flush()
+
+		rotated := strings.Replace(bus.take(), "; C 2c; D 00 00", "", 1)
+		if want := test.want[strings.Index(test.want, "C 2a"):]; rotated != want {
+			t.Errorf("rotation %d: sent %s, want %s", test.rot, rotated, want)
+		}
+	}
+
+	if err := p.SetRotation(Rotate270 + 1); err == nil {
+		t.Error("invalid rotation accepted")
+	}
+	if _, err := New(bus, ST7789, &Options{Width: 240, Height: 240, Offset: image.Pt(0, 100)}); err == nil {
+		t.Error("panel beyond the memory accepted")
+	}
+}
+
+func TestSSD1306(t *testing.T) {
+	noSleep(t)
+	bus := new(fakeBus)
+
+	p, err := New(bus, SSD1306, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands, with their parameters, are sent as commands.
+	ops := bus.take()
+	want := "C ae d5 80 a8 3f d3 00 40 8d 14 20 00 da 12 81 cf d9 f1 db 40 a4 a6 2e; C a1 c8; " +
+		"C 21 00 7f 22 00 07; D 1024 bytes; C af"
+	if ops != want {
+		t.Errorf("init sent %s, want %s", ops, want)
+	}
+
+	img, ok := p.Image().(*framebuffer.Mono)
+	if !ok || img.Bounds() != image.Rect(0, 0, 128, 64) {
+		t.Fatalf("image %T %v", p.Image(), p.Image().Bounds())
+	}
+
+	// Pixels are sent in columns of 8 rows.
+	img.Set(3, 9, color.White)
+	img.Set(4, 9, color.Gray{0x7f})
+	if img.At(3, 9) != (color.Gray{0xff}) || img.Bit(4, 9) || img.Pix[9*16] != 0x10 {
+		t.Errorf("image pixels %v, %v", img.At(3, 9), img.Pix[9*16])
+	}
+
+	p.Invalidate(image.Rect(3, 9, 5, 10))
+	p.Flush()
+	if ops := bus.take(); ops != "C 21 03 04 22 01 01; D 02 00" {
+		t.Errorf("flush sent %s", ops)
+	}
+
+	for _, test := range []struct {
+		rot  Rotation
+		want string
+	}{
+		{Rotate90, "C 21 7f 7f 22 00 00; D 01"},
+		{Rotate180, "C 21 00 00 22 00 00; D 01"},
+		{Rotate270, "C 21 00 00 22 07 07; D 80"},
+	} {
+		if err := p.SetRotation(test.rot); err != nil {
+			t.Fatal(err)
+		}
+
+		// The top left pixel of the image.
+		bus.take()
+		p.Image().Set(0, 0, color.White)
+		p.Invalidate(image.Rect(0, 0, 1, 1))
+		p.Flush()
+
+		if ops := bus.take(); ops != test.want {
+			t.Errorf("rotation %d: sent %s, want %s", test.rot, ops, test.want)
+		}
+	}
+
+	// Flipping by the controller.
+	p.SetRotation(Rotate180)
+	if ops := bus.take(); !strings.HasPrefix(ops, "C a0 c0;") {
+		t.Errorf("rotating sent %s", ops)
+	}
+
+	p.Close()
+	if ops := bus.take(); ops != "C ae" {
+		t.Errorf("close sent %s", ops)
+	}
+
+	// Smaller panels.
+	if _, err := New(bus, SSD1306, &Options{Height: 32}); err != nil {
+		t.Fatal(err)
+	}
+	if ops := bus.take(); !strings.Contains(ops, "a8 1f") || !strings.Contains(ops, "da 02") || !strings.Contains(ops, "D 512 bytes") {
+		t.Errorf("init sent %s", ops)
+	}
+	if _, err := New(bus, SSD1306, &Options{Height: 20}); err == nil {
+		t.Error("partial page accepted")
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	noSleep(t)
+	p, err := New(new(fakeBus), ST7789, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxRects; i++ {
+		p.Invalidate(image.Rect(i*10, i*10, i*10+5, i*10+5))
+	}
+	if len(p.dirty) != maxRects {
+		t.Fatalf("%d areas", len(p.dirty))
+	}
+
+	// Too many areas are merged.
+	p.Invalidate(image.Rect(0, 300, 1, 301))
+	if len(p.dirty) != 1 || p.dirty[0] != image.Rect(0, 0, 155, 301) {
+		t.Errorf("areas %v", p.dirty)
+	}
+}
+
+func TestI2C(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "i2c")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := &i2cBus{f: f}
+	bus.Command([]byte{0xaf})
+	bus.Data(bytes.Repeat([]byte{1}, 5000))
+	bus.Close()
+
+	// Every message starts with a control byte.
+	b, _ := os.ReadFile(path)
+	if len(b) != 2+maxTransfer+5000-(maxTransfer-1)+1 ||
+		!bytes.Equal(b[:3], []byte{0x00, 0xaf, 0x40}) || b[2+maxTransfer] != 0x40 {
+		t.Errorf("%d bytes written: % x...", len(b), b[:8])
+	}
+}
@@ -0,0 +1,140 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package panel
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Size of the memory of the SSD1306, in pixels. It is organized in
+// pages of eight rows; each byte holds a column of a page, with the
+// top pixel in the least significant bit.
+const (
+	ssd1306Width  = 128
+	ssd1306Height = 64
+)
+
+// SSD1306 commands.
+const (
+	ssdColumnRange   = 0x21
+	ssdPageRange     = 0x22
+	ssdSegmentNormal = 0xa0 // Columns from left to right.
+	ssdSegmentRemap  = 0xa1 // Columns from right to left.
+	ssdInvertOff     = 0xa6
+	ssdInvertOn      = 0xa7
+	ssdDisplayOff    = 0xae
+	ssdDisplayOn     = 0xaf
+	ssdScanUp        = 0xc0 // Rows from bottom to top.
+	ssdScanDown      = 0xc8 // Rows from top to bottom.
+)
+
+// ssd1306 drives the SSD1306. Only half turns are done by the
+// controller; quarter turns are done while sending pixels.
+type ssd1306 struct {
+	opts *Options
+	rot  Rotation
+	buf  []byte
+}
+
+func (d *ssd1306) init(bus Bus) error {
+	pins := byte(0x12) // Alternative COM pins, for 64 rows.
+	if d.opts.Offset.Y+d.opts.Height <= 32 {
+		pins = 0x02
+	}
+
+	invert := byte(ssdInvertOff)
+	if d.opts.Invert {
+		invert = ssdInvertOn
+	}
+
+	return bus.Command([]byte{
+		ssdDisplayOff,
+		0xd5, 0x80, // Clock divider.
+		0xa8, byte(d.opts.Offset.Y + d.opts.Height - 1), // Multiplex ratio.
+		0xd3, 0x00, // No display offset.
+		0x40,       // Start at row 0.
+		0x8d, 0x14, // Charge pump on.
+		0x20, 0x00, // Horizontal addressing.
+		0xda, pins,
+		0x81, 0xcf, // Contrast.
+		0xd9, 0xf1, // Precharge period.
+		0xdb, 0x40, // VCOMH level.
+		0xa4, // Show the memory.
+		invert,
+		0x2e, // No scrolling.
+	})
+}
+
+func (d *ssd1306) rotate(bus Bus, rot Rotation) error {
+	cmd := []byte{ssdSegmentRemap, ssdScanDown}
+	if rot == Rotate180 {
+		cmd = []byte{ssdSegmentNormal, ssdScanUp}
+	}
+
+	if err := bus.Command(cmd); err != nil {
+		return err
+	}
+	d.rot = rot
+	return nil
+}
+
+func (d *ssd1306) newImage(r image.Rectangle) draw.Image {
+	stride := (r.Dx() + 7) / 8
+	return &framebuffer.Mono{Pix: make([]byte, stride*r.Dy()), Stride: stride, Rect: r}
+}
+
+func (d *ssd1306) flush(bus Bus, img draw.Image, r image.Rectangle) error {
+	src := img.(*framebuffer.Mono)
+	w, h := d.opts.Width, d.opts.Height
+
+	// Find the area of the panel, and the pixel of the image shown
+	// at each of its positions.
+	at := func(x, y int) bool { return src.Bit(x, y) }
+	switch d.rot {
+	case Rotate90:
+		r = image.Rect(w-r.Max.Y, r.Min.X, w-r.Min.Y, r.Max.X)
+		at = func(x, y int) bool { return src.Bit(y, w-1-x) }
+	case Rotate270:
+		r = image.Rect(r.Min.Y, h-r.Max.X, r.Max.Y, h-r.Min.X)
+		at = func(x, y int) bool { return src.Bit(h-1-y, x) }
+	}
+
+	// Only whole pages can be written.
+	r.Min.Y &^= 7
+	r.Max.Y = (r.Max.Y + 7) &^ 7
+
+	col, page := d.opts.Offset.X, d.opts.Offset.Y/8
+	err := bus.Command([]byte{
+		ssdColumnRange, byte(col + r.Min.X), byte(col + r.Max.X - 1),
+		ssdPageRange, byte(page + r.Min.Y/8), byte(page + r.Max.Y/8 - 1),
+	})
+	if err != nil {
+		return err
+	}
+
+	d.buf = d.buf[:0]
+	for y := r.Min.Y; y < r.Max.Y; y += 8 {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			var b byte
+			for i := 0; i < 8; i++ {
+				if at(x, y+i) {
+					b |= 1 << i
+				}
+			}
+			d.buf = append(d.buf, b)
+		}
+	}
+
+	return bus.Data(d.buf)
+}
+
+func (d *ssd1306) display(bus Bus, on bool) error {
+	if on {
+		return bus.Command([]byte{ssdDisplayOn})
+	}
+	return bus.Command([]byte{ssdDisplayOff})
+}
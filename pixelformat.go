@@ -13,6 +13,14 @@ const (
 	PF_BGR_555 // 16-bit color
 	PF_BGR_565 // 16-bit color
 	PF_INDEXED // 8-bit color (grayscale or paletted).
+	PF_MONO    // 1-bit monochrome, packed.
+	PF_GRAY_2  // 2-bit grayscale, packed.
+	PF_GRAY_4  // 4-bit grayscale, packed.
+	PF_YUYV    // 16-bit YUV 4:2:2, packed.
+	PF_UYVY    // 16-bit YUV 4:2:2, packed.
+	PF_NV12    // 12-bit YUV 4:2:0, planar with interleaved chroma.
+	PF_NV21    // 12-bit YUV 4:2:0, planar with interleaved chroma.
+	PF_I420    // 12-bit YUV 4:2:0, planar.
 )
 
 // PixelFormat describes the color layout of a single pixel
@@ -50,26 +58,82 @@ const (
 //	g := (pixel >> green_shift) & green_mask
 //	b := (pixel >> blue_shift) & blue_mask
 //	a := (pixel >> alpha_shift) & alpha_mask
+//
+// YUV formats have no channel bits. They are identified by the V4L2
+// FOURCC code of their layout, and the V4L2 colorspace selecting how
+// they convert to RGB.
 type PixelFormat struct {
-	Depth      uint8 // Total bit count for each pixel.
-	RedBits    uint8 // Bit count for the red channel.
-	RedShift   uint8 // Shift offset for the red channel.
-	GreenBits  uint8 // Bit count for the green channel.
-	GreenShift uint8 // Shift offset for the green channel.
-	BlueBits   uint8 // Bit count for the blue channel.
-	BlueShift  uint8 // Shift offset for the blue channel.
-	AlphaBits  uint8 // Bit count for the alpha channel.
-	AlphaShift uint8 // Shift offset for the alpha channel.
+	Depth      uint8  // Total bit count for each pixel.
+	RedBits    uint8  // Bit count for the red channel.
+	RedShift   uint8  // Shift offset for the red channel.
+	GreenBits  uint8  // Bit count for the green channel.
+	GreenShift uint8  // Shift offset for the green channel.
+	BlueBits   uint8  // Bit count for the blue channel.
+	BlueShift  uint8  // Shift offset for the blue channel.
+	AlphaBits  uint8  // Bit count for the alpha channel.
+	AlphaShift uint8  // Shift offset for the alpha channel.
+	FourCC     uint32 // Layout of YUV formats, such as FourCCNV12. Zero otherwise.
+	Colorspace uint32 // V4L2 colorspace of YUV formats.
 }
 
 // Stride returns the width, in bytes, for a single pixel.
+// Formats of less than 8 bits pack several pixels into a byte.
 func (p PixelFormat) Stride() int {
 	return int(p.Depth+7) / 8
 }
 
+// rowSize returns the size, in bytes, of w pixels. For planar
+// formats, it is the size of their luma samples.
+func (p PixelFormat) rowSize(w int) int {
+	if p.planar() {
+		return w
+	}
+	if p.Depth < 8 {
+		return (w*int(p.Depth) + 7) / 8
+	}
+	return w * p.Stride()
+}
+
+// planar returns true for formats which keep their luma and chroma
+// samples in separate planes.
+func (p PixelFormat) planar() bool {
+	switch p.Type() {
+	case PF_NV12, PF_NV21, PF_I420:
+		return true
+	}
+	return false
+}
+
+// frameSize returns the size, in bytes, of a frame of the given number
+// of rows. The chroma planes of planar formats follow the luma plane,
+// with half as many rows.
+func (p PixelFormat) frameSize(stride, rows int) int {
+	if p.planar() {
+		rows = (rows + 1) &^ 1
+		return stride * rows * 3 / 2
+	}
+	return stride * rows
+}
+
 // Type returns an integer constant from the PF_XXX list, which
 // identifies the type of pixelformat.
 func (p PixelFormat) Type() int {
+	if p.FourCC != 0 {
+		switch p.FourCC {
+		case FourCCYUYV:
+			return PF_YUYV
+		case FourCCUYVY:
+			return PF_UYVY
+		case FourCCNV12:
+			return PF_NV12
+		case FourCCNV21:
+			return PF_NV21
+		case FourCCI420:
+			return PF_I420
+		}
+		return PF_UNKNOWN
+	}
+
 	switch p.Stride() {
 	case 4: // 32-bit color
 		if p.RedShift > p.BlueShift {
@@ -97,7 +161,15 @@ func (p PixelFormat) Type() int {
 			return PF_RGB_555
 		}
 
-	case 1: // 8-bit color
+	case 1: // 8-bit color, or several pixels to a byte
+		switch p.Depth {
+		case 1:
+			return PF_MONO
+		case 2:
+			return PF_GRAY_2
+		case 4:
+			return PF_GRAY_4
+		}
 		return PF_INDEXED
 	}
 
@@ -0,0 +1,181 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package pointer
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cursor is a pointer shape.
+type Cursor struct {
+	Image   image.Image // Shape, with transparency.
+	Hotspot image.Point // Pixel of Image which marks the pointer position.
+}
+
+// offset returns the translation from cursor image
+// coordinates to screen coordinates, at position p.
+func (c *Cursor) offset(p image.Point) image.Point {
+	return p.Sub(c.Hotspot)
+}
+
+// LoadCursor loads a cursor from a PNG file.
+func LoadCursor(path string, hotspot image.Point) (*Cursor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &Cursor{Image: img, Hotspot: hotspot.Add(img.Bounds().Min)}, nil
+}
+
+// Theme is a set of cursors by name, such as "left_ptr" or "xterm".
+type Theme map[string]*Cursor
+
+// LoadTheme loads a cursor theme from a directory of PNG images and
+// xcursorgen configuration files, as used to build X cursor themes.
+// Each NAME.cursor file defines the cursor NAME, with lines of the form:
+//
+//	size xhot yhot image.png [delay]
+//
+// For each cursor, the image nearest to the given size is used.
+// Animated cursors show their first frame.
+func LoadTheme(dir string, size int) (Theme, error) {
+	configs, err := filepath.Glob(filepath.Join(dir, "*.cursor"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s: no cursors found", dir)
+	}
+
+	theme := make(Theme)
+	for _, path := range configs {
+		c, err := loadConfig(path, size)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".cursor")
+		theme[name] = c
+	}
+
+	return theme, nil
+}
+
+// loadConfig loads the cursor defined by an xcursorgen configuration.
+func loadConfig(path string, size int) (*Cursor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var best string
+	var bestSize int
+	var hotspot image.Point
+
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s:%d: expected size, hotspot and image", path, line)
+		}
+
+		var v [3]int
+		for i := range v {
+			v[i], err = strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+
+		// Keep the first frame of the nearest size.
+		if best == "" || abs(v[0]-size) < abs(bestSize-size) {
+			best, bestSize = fields[3], v[0]
+			hotspot = image.Pt(v[1], v[2])
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if best == "" {
+		return nil, fmt.Errorf("%s: no images", path)
+	}
+
+	if !filepath.IsAbs(best) {
+		best = filepath.Join(filepath.Dir(path), best)
+	}
+
+	return LoadCursor(best, hotspot)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Arrow is the default cursor: a plain arrow, pointing up and left.
+var Arrow = bitmapCursor(image.Pt(0, 0),
+	"X           ",
+	"XX          ",
+	"X.X         ",
+	"X..X        ",
+	"X...X       ",
+	"X....X      ",
+	"X.....X     ",
+	"X......X    ",
+	"X.......X   ",
+	"X........X  ",
+	"X.........X ",
+	"X......XXXXX",
+	"X...X..X    ",
+	"X..XX..X    ",
+	"X.X  X..X   ",
+	"XX   X..X   ",
+	"X     X..X  ",
+	"      X..X  ",
+	"       XX   ",
+)
+
+// bitmapCursor creates a cursor from rows of text, where X is black,
+// a dot is white and anything else is transparent.
+func bitmapCursor(hotspot image.Point, rows ...string) *Cursor {
+	img := image.NewNRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+
+	for y, row := range rows {
+		for x, c := range row {
+			switch c {
+			case 'X':
+				img.Set(x, y, color.Black)
+			case '.':
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	return &Cursor{Image: img, Hotspot: hotspot}
+}
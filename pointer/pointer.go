@@ -0,0 +1,249 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package pointer draws a software mouse pointer onto the framebuffer.
+//
+// The pointer is drawn directly into the image, after saving the pixels
+// underneath it. Those are restored whenever the pointer moves or is
+// hidden. Anything else drawing to the same area must do so while the
+// pointer is hidden, for which Pointer.Paint is the easiest way.
+package pointer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/input"
+)
+
+// Pointer is a mouse pointer overlaid on an image.
+// It is safe for concurrent use.
+type Pointer struct {
+	mu     sync.Mutex
+	dst    draw.Image
+	area   image.Rectangle // Area the pointer can move in.
+	pos    image.Point     // Current position.
+	cursor *Cursor
+	hidden int             // Number of Hide calls not yet matched by Show.
+	drawn  image.Rectangle // Area covered by the drawn cursor, if any.
+
+	// Pixels covered by the cursor, as raw data
+	// or, for unknown image types, as colors.
+	under  []byte
+	colors []color.Color
+}
+
+// New creates a pointer for dst, which moves within the given area.
+// It starts out in the centre of the area, showing the Arrow cursor.
+// It is not drawn until Show is called.
+func New(dst draw.Image, area image.Rectangle) *Pointer {
+	area = area.Intersect(dst.Bounds())
+
+	return &Pointer{
+		dst:    dst,
+		area:   area,
+		pos:    image.Pt(area.Min.X+area.Dx()/2, area.Min.Y+area.Dy()/2),
+		cursor: Arrow,
+		hidden: 1,
+	}
+}
+
+// Open creates a pointer for the canvas. It moves within the
+// visible part of the framebuffer, not the virtual resolution.
+func Open(c *framebuffer.Canvas) (*Pointer, error) {
+	img, err := c.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := c.CurrentMode()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(img, image.Rect(0, 0, mode.Geometry.XRes, mode.Geometry.YRes)), nil
+}
+
+// Position returns the current position.
+func (p *Pointer) Position() image.Point {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pos
+}
+
+// SetCursor changes the pointer shape.
+func (p *Pointer) SetCursor(c *Cursor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cursor = c
+	p.redraw()
+}
+
+// MoveTo moves the pointer to pt, clamped to its area.
+func (p *Pointer) MoveTo(pt image.Point) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pos = p.clamp(pt)
+	p.redraw()
+}
+
+// Move moves the pointer by the given amount, clamped to its area.
+func (p *Pointer) Move(dx, dy int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pos = p.clamp(p.pos.Add(image.Pt(dx, dy)))
+	p.redraw()
+}
+
+// Handle moves the pointer in response to mouse movement and touches.
+// It returns true if the event was of either kind.
+func (p *Pointer) Handle(ev input.Event) bool {
+	switch e := ev.(type) {
+	case *input.MotionEvent:
+		if e.Abs {
+			p.MoveTo(e.Pos)
+		} else if e.DX != 0 || e.DY != 0 {
+			p.Move(e.DX, e.DY)
+		}
+		return true
+
+	case *input.TouchEvent:
+		if e.Slot == 0 {
+			p.MoveTo(e.Pos)
+		}
+		return true
+	}
+
+	return false
+}
+
+// Hide removes the pointer from the image. Calls to Hide nest;
+// the pointer is shown again once Show has been called as often.
+func (p *Pointer) Hide() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.hidden++
+	p.restore()
+}
+
+// Show draws the pointer, undoing a call to Hide.
+// A new pointer starts out hidden.
+func (p *Pointer) Show() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.hidden > 0 {
+		p.hidden--
+	}
+	p.redraw()
+}
+
+// Visible returns true if the pointer is shown.
+func (p *Pointer) Visible() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hidden == 0
+}
+
+// Paint hides the pointer while fn draws to the image, so the pointer
+// is neither drawn over nor saved as part of the background.
+func (p *Pointer) Paint(fn func(dst draw.Image)) {
+	p.Hide()
+	defer p.Show()
+	fn(p.dst)
+}
+
+// clamp limits pt to the pointer area.
+func (p *Pointer) clamp(pt image.Point) image.Point {
+	if pt.X < p.area.Min.X {
+		pt.X = p.area.Min.X
+	}
+	if pt.X >= p.area.Max.X {
+		pt.X = p.area.Max.X - 1
+	}
+	if pt.Y < p.area.Min.Y {
+		pt.Y = p.area.Min.Y
+	}
+	if pt.Y >= p.area.Max.Y {
+		pt.Y = p.area.Max.Y - 1
+	}
+	return pt
+}
+
+// redraw draws the cursor at the current position, if it is shown.
+func (p *Pointer) redraw() {
+	p.restore()
+
+	if p.hidden > 0 || p.cursor == nil {
+		return
+	}
+
+	off := p.cursor.offset(p.pos)
+	r := p.cursor.Image.Bounds().Add(off).Intersect(p.area)
+	if r.Empty() {
+		return
+	}
+
+	p.save(r)
+	draw.Draw(p.dst, r, p.cursor.Image, r.Min.Sub(off), draw.Over)
+	p.drawn = r
+}
+
+// save copies the pixels in r, so they can be restored later.
+// Where possible, the raw pixel data is copied, so nothing is
+// lost to color conversion.
+func (p *Pointer) save(r image.Rectangle) {
+	if src, ok := framebuffer.RawPixels(p.dst); ok {
+		stride := r.Dx() * src.Bpp
+		if cap(p.under) < stride*r.Dy() {
+			p.under = make([]byte, stride*r.Dy())
+		}
+		p.under = p.under[:stride*r.Dy()]
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			copy(p.under[(y-r.Min.Y)*stride:], src.Row(y, r.Min.X, r.Max.X))
+		}
+		return
+	}
+
+	// Other images keep their own color values, which
+	// they can be set to again without conversion.
+	p.colors = p.colors[:0]
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p.colors = append(p.colors, p.dst.At(x, y))
+		}
+	}
+}
+
+// restore puts back the pixels covered by the cursor.
+func (p *Pointer) restore() {
+	r := p.drawn
+	if r.Empty() {
+		return
+	}
+	p.drawn = image.Rectangle{}
+
+	if dst, ok := framebuffer.RawPixels(p.dst); ok {
+		stride := r.Dx() * dst.Bpp
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			copy(dst.Row(y, r.Min.X, r.Max.X), p.under[(y-r.Min.Y)*stride:])
+		}
+		return
+	}
+
+	i := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p.dst.Set(x, y, p.colors[i])
+			i++
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package pointer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/input"
+)
+
+// images returns one image of each pixel format, filled with a pattern.
+func images(r image.Rectangle) map[string]draw.Image {
+	n := r.Dx() * r.Dy()
+	m := map[string]draw.Image{
+		"RGBA":   image.NewRGBA(r),
+		"BGRA":   &framebuffer.BGRA{Pix: make([]byte, 4*n), Stride: 4 * r.Dx(), Rect: r},
+		"RGB565": &framebuffer.RGB565{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r},
+		"BGR565": &framebuffer.BGR565{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r},
+		"RGB555": &framebuffer.RGB555{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r},
+		"BGR555": &framebuffer.BGR555{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r},
+		"Gray":   image.NewGray(r),
+		"CMYK":   image.NewCMYK(r), // Not a known raw format.
+	}
+
+	for _, img := range m {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 5), uint8(x ^ y), 0xff})
+			}
+		}
+	}
+
+	return m
+}
+
+// snapshot copies all pixel colors, to compare images of any type.
+func snapshot(img image.Image) []color.Color {
+	var c []color.Color
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c = append(c, img.At(x, y))
+		}
+	}
+	return c
+}
+
+func equal(a, b []color.Color) bool {
+	for i := range a {
+		r1, g1, b1, a1 := a[i].RGBA()
+		r2, g2, b2, a2 := b[i].RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSaveRestore(t *testing.T) {
+	for name, img := range images(image.Rect(0, 0, 64, 48)) {
+		orig := snapshot(img)
+
+		p := New(img, img.Bounds())
+		p.Show()
+
+		if equal(orig, snapshot(img)) {
+			t.Fatalf("%s: pointer not drawn", name)
+		}
+
+		for _, d := range []image.Point{{5, 3}, {-20, 7}, {100, 100}, {-100, -100}} {
+			p.Move(d.X, d.Y)
+		}
+
+		p.Hide()
+		if !equal(orig, snapshot(img)) {
+			t.Fatalf("%s: pixels not restored", name)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	// Like a framebuffer with a virtual resolution larger than the screen.
+	p := New(img, image.Rect(0, 0, 100, 60))
+	p.Show()
+
+	if pos := p.Position(); pos != image.Pt(50, 30) {
+		t.Fatalf("initial position: have %v", pos)
+	}
+
+	p.Move(1000, 1000)
+	if pos := p.Position(); pos != image.Pt(99, 59) {
+		t.Fatalf("clamped position: have %v", pos)
+	}
+
+	// Nothing may be drawn outside the visible area.
+	for y := 60; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if img.RGBAAt(x, y) != (color.RGBA{}) {
+				t.Fatalf("pixel %d,%d drawn outside area", x, y)
+			}
+		}
+	}
+
+	p.MoveTo(image.Pt(-5, 10))
+	if pos := p.Position(); pos != image.Pt(0, 10) {
+		t.Fatalf("clamped position: have %v", pos)
+	}
+
+	// The arrow's hotspot is its tip, which is black.
+	if img.RGBAAt(0, 10) != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Fatalf("tip not drawn at hotspot: %v", img.RGBAAt(0, 10))
+	}
+}
+
+func TestHandle(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	p := New(img, img.Bounds())
+
+	if !p.Handle(&input.MotionEvent{DX: 5, DY: -10}) {
+		t.Fatal("motion not handled")
+	}
+
+	if pos := p.Position(); pos != image.Pt(55, 40) {
+		t.Fatalf("have %v", pos)
+	}
+
+	p.Handle(&input.TouchEvent{Pos: image.Pt(7, 8)})
+	if pos := p.Position(); pos != image.Pt(7, 8) {
+		t.Fatalf("have %v", pos)
+	}
+
+	if p.Handle(&input.KeyEvent{}) {
+		t.Fatal("key event handled")
+	}
+}
+
+func TestPaint(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	p := New(img, img.Bounds())
+	p.MoveTo(image.Pt(10, 10))
+	p.Show()
+
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	p.Paint(func(dst draw.Image) {
+		if p.Visible() {
+			t.Fatal("pointer visible while painting")
+		}
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(blue), image.Point{}, draw.Src)
+	})
+
+	if !p.Visible() {
+		t.Fatal("pointer not shown after painting")
+	}
+
+	// The new background is restored when the pointer moves away.
+	p.MoveTo(image.Pt(30, 30))
+	if c := img.RGBAAt(11, 12); c != blue {
+		t.Fatalf("pixel under old position: have %v", c)
+	}
+
+	// Hide nests.
+	p.Hide()
+	p.Hide()
+	p.Show()
+	if p.Visible() {
+		t.Fatal("visible after unbalanced Show")
+	}
+	p.Show()
+	if !p.Visible() {
+		t.Fatal("not visible after balanced Show")
+	}
+}
+
+func TestTheme(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, size int, c color.Color) {
+		img := image.NewNRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	red := color.NRGBA{0xff, 0, 0, 0xff}
+	write("left_ptr_16.png", 16, red)
+	write("left_ptr_32.png", 32, red)
+	write("xterm_24.png", 24, color.White)
+
+	os.WriteFile(filepath.Join(dir, "left_ptr.cursor"),
+		[]byte("# size xhot yhot image\n16 1 2 left_ptr_16.png\n32 3 4 left_ptr_32.png\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "xterm.cursor"),
+		[]byte("24 12 12 xterm_24.png 50\n24 12 12 xterm_24.png 50\n"), 0644)
+
+	theme, err := LoadTheme(dir, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(theme) != 2 {
+		t.Fatalf("want 2 cursors, have %d", len(theme))
+	}
+
+	c := theme["left_ptr"]
+	if c == nil || c.Image.Bounds().Dx() != 16 || c.Hotspot != image.Pt(1, 2) {
+		t.Fatalf("left_ptr: have %+v", c)
+	}
+
+	theme, _ = LoadTheme(dir, 30)
+	if c := theme["left_ptr"]; c.Image.Bounds().Dx() != 32 || c.Hotspot != image.Pt(3, 4) {
+		t.Fatalf("left_ptr at 30: have %+v", c)
+	}
+
+	// The hotspot is placed at the pointer position.
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	p := New(img, img.Bounds())
+	p.SetCursor(theme["xterm"])
+	p.MoveTo(image.Pt(50, 50))
+	p.Show()
+
+	if img.RGBAAt(38, 38) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) || img.RGBAAt(37, 38) != (color.RGBA{}) {
+		t.Fatal("cursor not placed at its hotspot")
+	}
+
+	if _, err := LoadTheme(t.TempDir(), 24); err == nil {
+		t.Fatal("empty theme: expected error")
+	}
+}
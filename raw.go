@@ -0,0 +1,66 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import "image"
+
+// Raw describes the memory of an image which keeps its pixels in a
+// byte slice, such as the images returned by Canvas.Image. It allows
+// pixels to be copied without converting colors, regardless of the
+// pixel format.
+type Raw struct {
+	Pix    []byte          // Pixel data.
+	Stride int             // Distance between rows, in bytes.
+	Rect   image.Rectangle // Image bounds.
+	Bpp    int             // Bytes per pixel.
+}
+
+// RawPixels returns the memory layout of img. It returns false
+// for image types which it does not know.
+func RawPixels(img image.Image) (Raw, bool) {
+	switch i := img.(type) {
+	case *image.RGBA:
+		return Raw{i.Pix, i.Stride, i.Rect, 4}, true
+	case *image.NRGBA:
+		return Raw{i.Pix, i.Stride, i.Rect, 4}, true
+	case *image.RGBA64:
+		return Raw{i.Pix, i.Stride, i.Rect, 8}, true
+	case *image.NRGBA64:
+		return Raw{i.Pix, i.Stride, i.Rect, 8}, true
+	case *image.Alpha:
+		return Raw{i.Pix, i.Stride, i.Rect, 1}, true
+	case *image.Alpha16:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	case *image.Gray:
+		return Raw{i.Pix, i.Stride, i.Rect, 1}, true
+	case *image.Gray16:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	case *image.Paletted:
+		return Raw{i.Pix, i.Stride, i.Rect, 1}, true
+	case *BGRA:
+		return Raw{i.Pix, i.Stride, i.Rect, 4}, true
+	case *RGB565:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	case *BGR565:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	case *RGB555:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	case *BGR555:
+		return Raw{i.Pix, i.Stride, i.Rect, 2}, true
+	}
+
+	return Raw{}, false
+}
+
+// Offset returns the index of the first byte of the pixel at x, y.
+func (r Raw) Offset(x, y int) int {
+	return (y-r.Rect.Min.Y)*r.Stride + (x-r.Rect.Min.X)*r.Bpp
+}
+
+// Row returns the bytes of the pixels in row y, from x0 up to x1.
+// The range must lie within the image bounds.
+func (r Raw) Row(y, x0, x1 int) []byte {
+	n := r.Offset(x0, y)
+	return r.Pix[n : n+(x1-x0)*r.Bpp]
+}
@@ -0,0 +1,52 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRawPixels(t *testing.T) {
+	r := image.Rect(2, 3, 10, 8)
+
+	for _, tt := range []struct {
+		img image.Image
+		bpp int
+	}{
+		{image.NewRGBA(r), 4},
+		{image.NewAlpha(r), 1},
+		{image.NewGray16(r), 2},
+		{&BGRA{Pix: make([]byte, 4*40), Stride: 32, Rect: r}, 4},
+		{&RGB565{Pix: make([]byte, 2*40), Stride: 16, Rect: r}, 2},
+		{&BGR555{Pix: make([]byte, 2*40), Stride: 16, Rect: r}, 2},
+	} {
+		raw, ok := RawPixels(tt.img)
+		if !ok {
+			t.Fatalf("%T: not recognised", tt.img)
+		}
+
+		if raw.Bpp != tt.bpp || raw.Rect != r {
+			t.Fatalf("%T: have bpp %d, rect %v", tt.img, raw.Bpp, raw.Rect)
+		}
+
+		// Setting bytes of a row must change the expected pixel.
+		for i := range raw.Row(4, 5, 6) {
+			raw.Row(4, 5, 6)[i] = 0xff
+		}
+
+		if _, _, _, a := tt.img.At(5, 4).RGBA(); a == 0 {
+			t.Fatalf("%T: pixel 5,4 not set", tt.img)
+		}
+
+		if c := tt.img.At(6, 4); c == tt.img.ColorModel().Convert(color.White) {
+			t.Fatalf("%T: pixel 6,4 set", tt.img)
+		}
+	}
+
+	if _, ok := RawPixels(image.NewUniform(color.Black)); ok {
+		t.Fatal("Uniform: recognised")
+	}
+}
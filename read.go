@@ -42,15 +42,22 @@ func readInt(v []byte, bits int) int {
 // readFBModes reads display mode data from the given stream.
 // This is expected to come in the format defined at
 // http://manned.org/fb.modes/81e6dc49
+//
+// Malformed values yield a *ParseError.
 func readFBModes(r io.Reader) (list []*DisplayMode, err error) {
+	var line []byte
+	var lineNo int
+
 	defer func() {
 		if x := recover(); x != nil {
-			err = fmt.Errorf("%v", x)
+			xerr, ok := x.(error)
+			if !ok {
+				xerr = fmt.Errorf("%v", x)
+			}
+			err = &ParseError{Line: lineNo, Err: xerr}
 		}
 	}()
 
-	var line []byte
-
 	rdr := bufio.NewReader(r)
 	dm := new(DisplayMode)
 
@@ -63,6 +70,7 @@ func readFBModes(r io.Reader) (list []*DisplayMode, err error) {
 			break
 		}
 
+		lineNo++
 		line = bytes.TrimSpace(line)
 		if len(line) == 0 {
 			continue
@@ -175,13 +183,13 @@ func readFBModes(r io.Reader) (list []*DisplayMode, err error) {
 		matches = regFormat.FindSubmatch(line)
 		if len(matches) > 1 {
 			dm.Format.RedBits = uint8(readInt(matches[1], 8))
-			dm.Format.RedShift = uint8(readInt(matches[1], 8))
-			dm.Format.GreenBits = uint8(readInt(matches[1], 8))
-			dm.Format.GreenShift = uint8(readInt(matches[1], 8))
-			dm.Format.BlueBits = uint8(readInt(matches[1], 8))
-			dm.Format.BlueShift = uint8(readInt(matches[1], 8))
-			dm.Format.AlphaBits = uint8(readInt(matches[1], 8))
-			dm.Format.AlphaShift = uint8(readInt(matches[1], 8))
+			dm.Format.RedShift = uint8(readInt(matches[2], 8))
+			dm.Format.GreenBits = uint8(readInt(matches[3], 8))
+			dm.Format.GreenShift = uint8(readInt(matches[4], 8))
+			dm.Format.BlueBits = uint8(readInt(matches[5], 8))
+			dm.Format.BlueShift = uint8(readInt(matches[6], 8))
+			dm.Format.AlphaBits = uint8(readInt(matches[7], 8))
+			dm.Format.AlphaShift = uint8(readInt(matches[8], 8))
 		}
 	}
 
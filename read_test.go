@@ -4,7 +4,9 @@
 package framebuffer
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +24,33 @@ func Test(t *testing.T) {
 		return
 	}
 }
+
+func TestReadFBModes(t *testing.T) {
+	const db = `
+mode "640x480-60"
+    geometry 640 480 640 480 16
+    timings 39722 48 16 33 10 96 2
+    rgba 5/11,6/5,5/0,0/0
+endmode
+`
+
+	list, err := readFBModes(strings.NewReader(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name != "640x480-60" {
+		t.Fatalf("unexpected modes: %+v", list)
+	}
+
+	if pf := list[0].Format; pf.RedShift != 11 || pf.GreenBits != 6 || pf.BlueShift != 0 {
+		t.Errorf("unexpected pixel format: %+v", pf)
+	}
+
+	_, err = readFBModes(strings.NewReader("mode \"x\"\n  geometry 99999999999 1 1 1 8\nendmode\n"))
+
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Errorf("have %v, want ParseError on line 2", err)
+	}
+}
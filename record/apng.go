@@ -0,0 +1,198 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+// APNG writes an animated PNG, which keeps all colors of the frames.
+//
+// The frame count is stored ahead of the frames, so it is filled in
+// by seeking back once the recording is closed. Programs which do
+// not know APNG show the first frame.
+type APNG struct {
+	w      io.WriteSeeker
+	actl   int64  // Offset of the animation control chunk.
+	ihdr   []byte // Header of the first frame; later frames must match.
+	frames int
+	seq    uint32 // Sequence number of the next fcTL or fdAT chunk.
+	buf    bytes.Buffer
+	enc    png.Encoder
+}
+
+// NewAPNG creates an APNG encoder writing to w. The animation loops.
+func NewAPNG(w io.WriteSeeker) *APNG {
+	return &APNG{w: w, enc: png.Encoder{CompressionLevel: png.BestSpeed}}
+}
+
+// WriteFrame implements Encoder. Delays are stored
+// in hundredths of a second.
+func (a *APNG) WriteFrame(img *image.RGBA, delay time.Duration) error {
+	a.buf.Reset()
+	if err := a.enc.Encode(&a.buf, img); err != nil {
+		return err
+	}
+
+	chunks, err := readChunks(a.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var ihdr []byte
+	var idat [][]byte
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "IDAT":
+			idat = append(idat, c.data)
+		}
+	}
+
+	if a.frames == 0 {
+		a.ihdr = bytes.Clone(ihdr)
+
+		if _, err := a.w.Write(a.buf.Bytes()[:8]); err != nil {
+			return err
+		}
+
+		if err := a.writeChunk("IHDR", ihdr); err != nil {
+			return err
+		}
+
+		a.actl, err = a.w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if err := a.writeChunk("acTL", actl(0)); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(ihdr, a.ihdr) {
+		// Size or color type changed.
+		return errors.New("record: frame format changed")
+	}
+
+	cs := (delay + 5*time.Millisecond) / (10 * time.Millisecond)
+	if cs > 0xffff {
+		cs = 0xffff
+	}
+
+	// Frame control: the whole image, replacing the previous frame.
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], a.seq)
+	copy(fctl[4:12], ihdr[0:8]) // Width and height.
+	binary.BigEndian.PutUint16(fctl[20:], uint16(cs))
+	binary.BigEndian.PutUint16(fctl[22:], 100)
+	a.seq++
+
+	if err := a.writeChunk("fcTL", fctl); err != nil {
+		return err
+	}
+
+	for _, data := range idat {
+		if a.frames == 0 {
+			err = a.writeChunk("IDAT", data)
+		} else {
+			fdat := make([]byte, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, a.seq)
+			copy(fdat[4:], data)
+			a.seq++
+			err = a.writeChunk("fdAT", fdat)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	a.frames++
+	return nil
+}
+
+// Close implements Encoder. It writes the end of the image, and
+// fills in the frame count.
+func (a *APNG) Close() error {
+	if a.frames == 0 {
+		return errors.New("record: no frames recorded")
+	}
+
+	if err := a.writeChunk("IEND", nil); err != nil {
+		return err
+	}
+
+	end, err := a.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.w.Seek(a.actl, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := a.writeChunk("acTL", actl(a.frames)); err != nil {
+		return err
+	}
+
+	_, err = a.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// actl returns the animation control data, for a looping animation.
+func actl(frames int) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(frames))
+	return data
+}
+
+func (a *APNG) writeChunk(typ string, data []byte) error {
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+
+	chunk := append(hdr, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc.Sum32())
+
+	_, err := a.w.Write(chunk)
+	return err
+}
+
+// chunk is a PNG chunk.
+type chunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits a PNG file into chunks.
+func readChunks(b []byte) ([]chunk, error) {
+	if len(b) < 8 {
+		return nil, errors.New("record: short PNG")
+	}
+	b = b[8:]
+
+	var chunks []chunk
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		if 12+n > len(b) {
+			return nil, errors.New("record: truncated PNG chunk")
+		}
+
+		chunks = append(chunks, chunk{string(b[4:8]), b[8 : 8+n]})
+		b = b[12+n:]
+	}
+
+	return chunks, nil
+}
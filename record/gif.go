@@ -0,0 +1,152 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package record
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"image"
+	"io"
+	"time"
+)
+
+// GIF writes an animated GIF. Each frame gets its own palette of up
+// to 256 colors. Unlike image/gif, frames are written as they come,
+// rather than being kept in memory until the end.
+type GIF struct {
+	w      *bufio.Writer
+	size   image.Point // Size of the first frame; later frames must match.
+	frames int
+}
+
+// NewGIF creates a GIF encoder writing to w. The animation loops.
+func NewGIF(w io.Writer) *GIF {
+	return &GIF{w: bufio.NewWriter(w)}
+}
+
+// WriteFrame implements Encoder. GIF delays are in hundredths of
+// a second, so shorter delays are rounded.
+func (g *GIF) WriteFrame(img *image.RGBA, delay time.Duration) error {
+	b := img.Bounds()
+
+	if g.frames == 0 {
+		g.size = b.Size()
+		if g.size.X > 0xffff || g.size.Y > 0xffff {
+			return errors.New("record: image too large for GIF")
+		}
+
+		g.w.WriteString("GIF89a")
+		g.writeUint16(g.size.X)
+		g.writeUint16(g.size.Y)
+		g.w.Write([]byte{0x00, 0x00, 0x00}) // No global color table.
+
+		// Loop forever.
+		g.w.Write([]byte{0x21, 0xff, 0x0b})
+		g.w.WriteString("NETSCAPE2.0")
+		g.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	}
+
+	if b.Size() != g.size {
+		return errors.New("record: frame size changed")
+	}
+
+	g.frames++
+	p := quantize(img)
+
+	// Graphic control extension, with the delay.
+	cs := (delay + 5*time.Millisecond) / (10 * time.Millisecond)
+	if cs > 0xffff {
+		cs = 0xffff
+	}
+	g.w.Write([]byte{0x21, 0xf9, 0x04, 0x00})
+	g.writeUint16(int(cs))
+	g.w.Write([]byte{0x00, 0x00})
+
+	// The color table size is a power of two, of at least 2 entries.
+	bits := 1
+	for 1<<bits < len(p.Palette) {
+		bits++
+	}
+
+	// Image descriptor, with a local color table.
+	g.w.WriteByte(0x2c)
+	g.writeUint16(0)
+	g.writeUint16(0)
+	g.writeUint16(g.size.X)
+	g.writeUint16(g.size.Y)
+	g.w.WriteByte(0x80 | byte(bits-1))
+
+	for i := 0; i < 1<<bits; i++ {
+		if i < len(p.Palette) {
+			r, gr, bl, _ := p.Palette[i].RGBA()
+			g.w.Write([]byte{byte(r >> 8), byte(gr >> 8), byte(bl >> 8)})
+		} else {
+			g.w.Write([]byte{0, 0, 0})
+		}
+	}
+
+	// Image data, LZW compressed, in sub-blocks.
+	litWidth := max(bits, 2)
+	g.w.WriteByte(byte(litWidth))
+
+	bw := &blockWriter{w: g.w}
+	lw := lzw.NewWriter(bw, lzw.LSB, litWidth)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		lw.Write(p.Pix[p.PixOffset(b.Min.X, y):p.PixOffset(b.Max.X, y)])
+	}
+	lw.Close()
+	bw.close()
+
+	return g.w.Flush()
+}
+
+// Close implements Encoder. It writes the GIF trailer.
+func (g *GIF) Close() error {
+	if g.frames == 0 {
+		return errors.New("record: no frames recorded")
+	}
+
+	g.w.WriteByte(0x3b)
+	return g.w.Flush()
+}
+
+func (g *GIF) writeUint16(v int) {
+	g.w.Write([]byte{byte(v), byte(v >> 8)})
+}
+
+// blockWriter splits data into GIF sub-blocks of at most 255 bytes.
+type blockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		k := copy(b.buf[b.n:], p)
+		b.n += k
+		p = p[k:]
+
+		if b.n == len(b.buf) {
+			b.flush()
+		}
+	}
+	return total, nil
+}
+
+func (b *blockWriter) flush() {
+	if b.n > 0 {
+		b.w.WriteByte(byte(b.n))
+		b.w.Write(b.buf[:b.n])
+		b.n = 0
+	}
+}
+
+// close writes the remaining data and the block terminator.
+func (b *blockWriter) close() {
+	b.flush()
+	b.w.WriteByte(0)
+}
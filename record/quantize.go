@@ -0,0 +1,183 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package record
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// quantize converts img to a paletted image of at most 256 colors.
+// Images which use no more colors keep them exactly, which is common
+// for user interfaces. Others get a palette chosen by median cut.
+func quantize(img *image.RGBA) *image.Paletted {
+	b := img.Bounds()
+	counts := make(map[color.RGBA]int)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			counts[color.RGBA{row[i], row[i+1], row[i+2], 0xff}]++
+		}
+	}
+
+	var pal color.Palette
+	if len(counts) <= 256 {
+		pal = make(color.Palette, 0, len(counts))
+		for c := range counts {
+			pal = append(pal, c)
+		}
+	} else {
+		pal = medianCut(counts, 256)
+	}
+
+	// Always at least two colors, as GIF needs a code size of 2 bits.
+	for len(pal) < 2 {
+		pal = append(pal, color.RGBA{0, 0, 0, 0xff})
+	}
+
+	dst := image.NewPaletted(b, pal)
+	exact := make(map[color.RGBA]uint8, len(counts))
+
+	// Without an exact palette, nearby colors map to the same entry.
+	// Looking them up by their top five bits saves most searches.
+	var approx []int16
+	if len(counts) > 256 {
+		approx = make([]int16, 1<<15)
+		for i := range approx {
+			approx[i] = -1
+		}
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		out := dst.Pix[dst.PixOffset(b.Min.X, y):]
+
+		for i := 0; i < len(row); i += 4 {
+			c := color.RGBA{row[i], row[i+1], row[i+2], 0xff}
+
+			if approx != nil {
+				k := int(c.R>>3)<<10 | int(c.G>>3)<<5 | int(c.B>>3)
+				if approx[k] < 0 {
+					approx[k] = int16(pal.Index(c))
+				}
+				out[i/4] = uint8(approx[k])
+				continue
+			}
+
+			n, ok := exact[c]
+			if !ok {
+				n = uint8(pal.Index(c))
+				exact[c] = n
+			}
+			out[i/4] = n
+		}
+	}
+
+	return dst
+}
+
+// box is a set of colors for median cut.
+type box struct {
+	colors []color.RGBA
+	counts []int
+}
+
+// medianCut picks n colors representing the given histogram.
+// Boxes are split at the median of their widest channel, until
+// there are n of them; the palette holds their weighted averages.
+func medianCut(hist map[color.RGBA]int, n int) color.Palette {
+	all := box{}
+	for c, k := range hist {
+		all.colors = append(all.colors, c)
+		all.counts = append(all.counts, k)
+	}
+
+	boxes := []box{all}
+	for len(boxes) < n {
+		// Split the box with the most colors.
+		bi := 0
+		for i, b := range boxes {
+			if len(b.colors) > len(boxes[bi].colors) {
+				bi = i
+			}
+		}
+
+		b := boxes[bi]
+		if len(b.colors) < 2 {
+			break
+		}
+
+		ch := b.widest()
+		sort.Sort(byChannel{b, ch})
+
+		mid := len(b.colors) / 2
+		boxes[bi] = box{b.colors[:mid], b.counts[:mid]}
+		boxes = append(boxes, box{b.colors[mid:], b.counts[mid:]})
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		pal[i] = b.average()
+	}
+	return pal
+}
+
+// widest returns the channel with the largest range.
+func (b box) widest() int {
+	lo := [3]uint8{0xff, 0xff, 0xff}
+	var hi [3]uint8
+
+	for _, c := range b.colors {
+		for i, v := range [3]uint8{c.R, c.G, c.B} {
+			lo[i] = min(lo[i], v)
+			hi[i] = max(hi[i], v)
+		}
+	}
+
+	ch := 0
+	for i := 1; i < 3; i++ {
+		if hi[i]-lo[i] > hi[ch]-lo[ch] {
+			ch = i
+		}
+	}
+	return ch
+}
+
+func (b box) average() color.RGBA {
+	var r, g, bl, n int
+	for i, c := range b.colors {
+		k := b.counts[i]
+		r += int(c.R) * k
+		g += int(c.G) * k
+		bl += int(c.B) * k
+		n += k
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 0xff}
+}
+
+// byChannel sorts a box by one color channel.
+type byChannel struct {
+	box
+	ch int
+}
+
+func (s byChannel) Len() int { return len(s.colors) }
+
+func (s byChannel) Less(i, j int) bool {
+	a, b := s.colors[i], s.colors[j]
+	switch s.ch {
+	case 0:
+		return a.R < b.R
+	case 1:
+		return a.G < b.G
+	}
+	return a.B < b.B
+}
+
+func (s byChannel) Swap(i, j int) {
+	s.colors[i], s.colors[j] = s.colors[j], s.colors[i]
+	s.counts[i], s.counts[j] = s.counts[j], s.counts[i]
+}
@@ -0,0 +1,220 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package record records what a canvas shows over time, as an animated
+// GIF or PNG, or as a YUV4MPEG2 stream for external video encoders.
+//
+// Frames are taken at a fixed rate, or whenever the application calls
+// Recorder.Present, and encoded on a separate goroutine. At most a
+// fixed number of frames wait to be encoded; when the encoder falls
+// behind, new frames are dropped rather than piling up in memory.
+package record
+
+import (
+	"bytes"
+	"image"
+	"sync"
+	"time"
+)
+
+// Source provides the frames to record. It is implemented
+// by framebuffer.Canvas.
+type Source interface {
+	Snapshot(r image.Rectangle) (*image.RGBA, error)
+}
+
+// Encoder writes frames to a file or stream.
+type Encoder interface {
+	// WriteFrame writes a frame, which is shown for the given time.
+	WriteFrame(img *image.RGBA, delay time.Duration) error
+
+	// Close finishes the output. It does not close the
+	// underlying writer.
+	Close() error
+}
+
+// Options configure a recorder.
+type Options struct {
+	Rate   float64         // Frames per second to take. Zero means only on Present.
+	Rect   image.Rectangle // Area to record. Empty means the whole screen.
+	Dedupe bool            // Skip frames identical to the previous one, showing that one longer.
+	Queue  int             // Frames waiting to be encoded before dropping new ones. Zero means 4.
+}
+
+// Recorder takes frames from a source and encodes them.
+type Recorder struct {
+	src  Source
+	enc  Encoder
+	opts Options
+
+	present chan struct{} // Requests a frame.
+	done    chan struct{} // Closed to stop taking frames.
+	frames  chan frame    // Frames waiting to be encoded.
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error     // First error.
+	stopped time.Time // Time Close was called; ends the last frame.
+	taken   int
+	dropped int
+}
+
+// frame is a frame waiting to be encoded.
+type frame struct {
+	img *image.RGBA
+	t   time.Time
+}
+
+// New starts recording frames from src into enc.
+// Close must be called to finish the recording.
+func New(src Source, enc Encoder, opts *Options) *Recorder {
+	r := &Recorder{
+		src:     src,
+		enc:     enc,
+		present: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if opts != nil {
+		r.opts = *opts
+	}
+
+	if r.opts.Queue <= 0 {
+		r.opts.Queue = 4
+	}
+
+	r.frames = make(chan frame, r.opts.Queue)
+
+	r.wg.Add(2)
+	go r.sample()
+	go r.encode()
+	return r
+}
+
+// Present takes a frame, for instance after the application has
+// finished drawing one. It does not wait for the frame to be taken.
+func (r *Recorder) Present() {
+	select {
+	case r.present <- struct{}{}:
+	default:
+		// A frame is about to be taken already.
+	}
+}
+
+// Stats returns the number of frames taken, and the number
+// dropped because the encoder could not keep up.
+func (r *Recorder) Stats() (taken, dropped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.taken, r.dropped
+}
+
+// Close stops recording and waits for the remaining frames to be
+// encoded. It returns the first error which occurred while taking
+// or encoding frames.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.stopped.IsZero() {
+		r.stopped = time.Now()
+		close(r.done)
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// sample takes frames until the recorder is closed.
+func (r *Recorder) sample() {
+	defer r.wg.Done()
+	defer close(r.frames)
+
+	var tick <-chan time.Time
+	if r.opts.Rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / r.opts.Rate))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var prev *image.RGBA
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-tick:
+		case <-r.present:
+		}
+
+		img, err := r.src.Snapshot(r.opts.Rect)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+
+		if r.opts.Dedupe && prev != nil && bytes.Equal(img.Pix, prev.Pix) {
+			continue
+		}
+		prev = img
+
+		select {
+		case r.frames <- frame{img, time.Now()}:
+			r.count(&r.taken)
+		default:
+			r.count(&r.dropped)
+		}
+	}
+}
+
+// encode writes queued frames. Each frame is written once the next
+// one arrives, as that determines how long it was shown.
+func (r *Recorder) encode() {
+	defer r.wg.Done()
+
+	var pending *frame
+	for f := range r.frames {
+		if pending != nil {
+			r.write(pending, f.t)
+		}
+		pending = &f
+	}
+
+	if pending != nil {
+		r.mu.Lock()
+		end := r.stopped
+		r.mu.Unlock()
+		r.write(pending, end)
+	}
+
+	if err := r.enc.Close(); err != nil {
+		r.fail(err)
+	}
+}
+
+func (r *Recorder) write(f *frame, end time.Time) {
+	delay := end.Sub(f.t)
+	if delay < 0 {
+		delay = 0
+	}
+
+	if err := r.enc.WriteFrame(f.img, delay); err != nil {
+		r.fail(err)
+	}
+}
+
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Recorder) count(n *int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*n++
+}
@@ -0,0 +1,390 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// source returns its frames in turn, repeating the last one.
+type source struct {
+	mu     sync.Mutex
+	frames []*image.RGBA
+	n      int
+	taken  chan struct{}
+}
+
+func newSource(frames ...*image.RGBA) *source {
+	return &source{frames: frames, taken: make(chan struct{}, 100)}
+}
+
+func (s *source) Snapshot(r image.Rectangle) (*image.RGBA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img := s.frames[min(s.n, len(s.frames)-1)]
+	s.n++
+	s.taken <- struct{}{}
+	return img, nil
+}
+
+// present takes a frame and waits for it.
+func (s *source) present(t *testing.T, r *Recorder) {
+	r.Present()
+	select {
+	case <-s.taken:
+	case <-time.After(5 * time.Second):
+		t.Fatal("frame not taken")
+	}
+}
+
+// encoder keeps the frames written to it.
+type encoder struct {
+	mu     sync.Mutex
+	frames []*image.RGBA
+	delays []time.Duration
+	block  chan struct{} // If set, writes wait until it is closed.
+	closed bool
+}
+
+func (e *encoder) WriteFrame(img *image.RGBA, delay time.Duration) error {
+	if e.block != nil {
+		<-e.block
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.frames = append(e.frames, img)
+	e.delays = append(e.delays, delay)
+	return nil
+}
+
+func (e *encoder) Close() error {
+	e.closed = true
+	return nil
+}
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+var (
+	red   = color.RGBA{0xff, 0, 0, 0xff}
+	green = color.RGBA{0, 0xff, 0, 0xff}
+	blue  = color.RGBA{0, 0, 0xff, 0xff}
+	white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+func TestRecorderPresent(t *testing.T) {
+	a, b := solid(2, 2, red), solid(2, 2, green)
+	src := newSource(a, a, b, b)
+	enc := &encoder{}
+
+	r := New(src, enc, &Options{Dedupe: true})
+	for i := 0; i < 4; i++ {
+		src.present(t, r)
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(enc.frames) != 2 || enc.frames[0] != a || enc.frames[1] != b || !enc.closed {
+		t.Fatalf("have %d frames, closed %v", len(enc.frames), enc.closed)
+	}
+
+	// The first frame was shown while its duplicate was skipped.
+	if enc.delays[0] < 2*time.Millisecond {
+		t.Errorf("duplicate did not extend delay: %v", enc.delays[0])
+	}
+
+	if taken, dropped := r.Stats(); taken != 2 || dropped != 0 {
+		t.Errorf("stats: %d taken, %d dropped", taken, dropped)
+	}
+
+	// Closing again is harmless.
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorderRate(t *testing.T) {
+	src := newSource(solid(2, 2, red))
+	enc := &encoder{}
+
+	r := New(src, enc, &Options{Rate: 200})
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+
+	if len(enc.frames) < 2 {
+		t.Fatalf("have %d frames at 200 fps in 100 ms", len(enc.frames))
+	}
+}
+
+func TestRecorderDrop(t *testing.T) {
+	var frames []*image.RGBA
+	for i := 0; i < 5; i++ {
+		frames = append(frames, solid(1, 1, color.RGBA{uint8(i), 0, 0, 0xff}))
+	}
+
+	src := newSource(frames...)
+	enc := &encoder{block: make(chan struct{})}
+
+	r := New(src, enc, &Options{Queue: 1})
+	for range frames {
+		src.present(t, r)
+	}
+
+	// Wait for the last frame to be queued or dropped.
+	r.Present()
+	<-src.taken
+
+	close(enc.block)
+	r.Close()
+
+	taken, dropped := r.Stats()
+	if dropped < 2 || taken+dropped != 6 || len(enc.frames) != taken {
+		t.Fatalf("%d taken, %d dropped, %d encoded", taken, dropped, len(enc.frames))
+	}
+}
+
+func TestGIF(t *testing.T) {
+	frames := []*image.RGBA{solid(5, 3, red), solid(5, 3, green), solid(5, 3, blue)}
+	frames[1].SetRGBA(2, 1, white)
+
+	var buf bytes.Buffer
+	enc := NewGIF(&buf)
+	for i, d := range []time.Duration{100 * time.Millisecond, 254 * time.Millisecond, 0} {
+		if err := enc.WriteFrame(frames[i], d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g.Image) != 3 || g.LoopCount != 0 {
+		t.Fatalf("have %d frames, loop count %d", len(g.Image), g.LoopCount)
+	}
+
+	if fmt.Sprint(g.Delay) != "[10 25 0]" {
+		t.Errorf("delays: have %v", g.Delay)
+	}
+
+	for i, img := range g.Image {
+		compare(t, fmt.Sprintf("frame %d", i), img, frames[i], 0)
+	}
+
+	if err := enc.WriteFrame(solid(4, 3, red), 0); err == nil {
+		t.Error("frame size change accepted")
+	}
+}
+
+func TestGIFQuantize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 0xff})
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := NewGIF(&buf)
+	enc.WriteFrame(img, 0)
+	enc.Close()
+
+	g, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(g.(*image.Paletted).Palette); n != 256 {
+		t.Errorf("palette has %d colors", n)
+	}
+
+	compare(t, "gradient", g, img, 24)
+}
+
+func TestAPNG(t *testing.T) {
+	frames := []*image.RGBA{solid(4, 4, red), solid(4, 4, green), solid(4, 4, blue)}
+	frames[2].SetRGBA(1, 2, white)
+
+	path := filepath.Join(t.TempDir(), "a.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := NewAPNG(f)
+	for i, img := range frames {
+		if err := enc.WriteFrame(img, time.Duration(i)*100*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	data, _ := os.ReadFile(path)
+
+	// Decoders without APNG support show the first frame.
+	first, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, "default image", first, frames[0], 0)
+
+	chunks, err := readChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ihdr []byte
+	var seq uint32
+	var delays []uint16
+	var decoded []image.Image
+
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			if n := binary.BigEndian.Uint32(c.data); n != 3 {
+				t.Errorf("acTL: %d frames", n)
+			}
+		case "fcTL", "fdAT":
+			if s := binary.BigEndian.Uint32(c.data); s != seq {
+				t.Fatalf("%s: sequence %d, want %d", c.typ, s, seq)
+			}
+			seq++
+
+			if c.typ == "fcTL" {
+				delays = append(delays, binary.BigEndian.Uint16(c.data[20:]))
+				continue
+			}
+
+			// Rebuild a plain PNG from the frame data.
+			img, err := png.Decode(bytes.NewReader(rebuild(ihdr, c.data[4:])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded = append(decoded, img)
+		}
+	}
+
+	if fmt.Sprint(delays) != "[0 10 20]" {
+		t.Errorf("delays: have %v", delays)
+	}
+
+	if len(decoded) != 2 {
+		t.Fatalf("have %d fdAT frames", len(decoded))
+	}
+
+	compare(t, "frame 1", decoded[0], frames[1], 0)
+	compare(t, "frame 2", decoded[1], frames[2], 0)
+}
+
+// rebuild creates a PNG file with the given header and image data.
+func rebuild(ihdr, idat []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+
+	for _, c := range []chunk{{"IHDR", ihdr}, {"IDAT", idat}, {"IEND", nil}} {
+		binary.Write(&b, binary.BigEndian, uint32(len(c.data)))
+		b.WriteString(c.typ)
+		b.Write(c.data)
+		binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(c.typ), c.data...)))
+	}
+
+	return b.Bytes()
+}
+
+func TestY4M(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewY4M(&buf, 10)
+
+	img := solid(3, 3, white)
+	img.SetRGBA(0, 0, color.RGBA{0, 0, 0, 0xff})
+
+	// 250 ms at 10 fps is 3 frames, the next 100 ms is one more.
+	enc.WriteFrame(img, 250*time.Millisecond)
+	enc.WriteFrame(solid(3, 3, white), 100*time.Millisecond)
+	enc.Close()
+
+	header, data, ok := strings.Cut(buf.String(), "\n")
+	if !ok || header != "YUV4MPEG2 W3 H3 F10:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL" {
+		t.Fatalf("header %q", header)
+	}
+
+	// Luma of 9 pixels, two chroma planes of 2x2.
+	const size = len("FRAME\n") + 9 + 4 + 4
+	if len(data) != 4*size {
+		t.Fatalf("have %d bytes, want %d frames of %d", len(data), 4, size)
+	}
+
+	frame := data[:size]
+	if !strings.HasPrefix(frame, "FRAME\n") {
+		t.Fatal("no frame header")
+	}
+
+	y := frame[6:15]
+	if y[0] != 0 || y[1] != 0xff {
+		t.Errorf("luma: have %v", []byte(y))
+	}
+
+	cb := frame[15:19]
+	for i := range cb {
+		if cb[i] != 0x80 {
+			t.Errorf("chroma: have %v", []byte(cb))
+			break
+		}
+	}
+}
+
+func compare(t *testing.T, name string, have image.Image, want *image.RGBA, tolerance int) {
+	t.Helper()
+
+	b := want.Bounds()
+	if have.Bounds() != b {
+		t.Fatalf("%s: bounds %v, want %v", name, have.Bounds(), b)
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			h := color.RGBAModel.Convert(have.At(x, y)).(color.RGBA)
+			w := want.RGBAAt(x, y)
+
+			for i, d := range []int{int(h.R) - int(w.R), int(h.G) - int(w.G), int(h.B) - int(w.B)} {
+				if d < -tolerance || d > tolerance {
+					t.Fatalf("%s: pixel %d,%d channel %d: have %v, want %v", name, x, y, i, h, w)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package record
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+// Y4M writes an uncompressed YUV4MPEG2 stream, with 4:2:0 chroma
+// subsampling, which video encoders such as ffmpeg can read.
+//
+// The stream has a constant frame rate, so frames are repeated as
+// often as needed to show them for their delay.
+type Y4M struct {
+	w      *bufio.Writer
+	fps    int
+	size   image.Point
+	frames int           // Frames written, including repeats.
+	shown  time.Duration // Time covered by the frames written.
+	total  time.Duration // Time covered by all delays so far.
+	y, cb  []byte
+	cr     []byte
+}
+
+// NewY4M creates a YUV4MPEG2 encoder writing to w at the given
+// frame rate. Use the rate the recorder samples at, if any.
+func NewY4M(w io.Writer, fps int) *Y4M {
+	if fps <= 0 {
+		fps = 25
+	}
+	return &Y4M{w: bufio.NewWriter(w), fps: fps}
+}
+
+// WriteFrame implements Encoder. The frame is written as often
+// as fits its delay; at least once.
+func (e *Y4M) WriteFrame(img *image.RGBA, delay time.Duration) error {
+	b := img.Bounds()
+
+	if e.frames == 0 {
+		e.size = b.Size()
+
+		// Colors are converted as for JPEG, using the full range.
+		_, err := fmt.Fprintf(e.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n",
+			e.size.X, e.size.Y, e.fps)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.Size() != e.size {
+		return errors.New("record: frame size changed")
+	}
+
+	e.convert(img)
+
+	// Repeat the frame until the stream catches up with the delays.
+	period := time.Second / time.Duration(e.fps)
+	e.total += delay
+
+	n := 1
+	for e.shown+time.Duration(n)*period+period/2 <= e.total {
+		n++
+	}
+
+	for i := 0; i < n; i++ {
+		e.w.WriteString("FRAME\n")
+		e.w.Write(e.y)
+		e.w.Write(e.cb)
+		if _, err := e.w.Write(e.cr); err != nil {
+			return err
+		}
+	}
+
+	e.frames += n
+	e.shown += time.Duration(n) * period
+	return e.w.Flush()
+}
+
+// Close implements Encoder.
+func (e *Y4M) Close() error {
+	if e.frames == 0 {
+		return errors.New("record: no frames recorded")
+	}
+	return e.w.Flush()
+}
+
+// convert fills the planes from img. Chroma is averaged
+// over blocks of 2x2 pixels.
+func (e *Y4M) convert(img *image.RGBA) {
+	w, h := e.size.X, e.size.Y
+	cw, ch := (w+1)/2, (h+1)/2
+
+	if len(e.y) != w*h {
+		e.y = make([]byte, w*h)
+		e.cb = make([]byte, cw*ch)
+		e.cr = make([]byte, cw*ch)
+	}
+
+	cbSum := make([]int, cw*ch)
+	crSum := make([]int, cw*ch)
+	count := make([]int, cw*ch)
+
+	b := img.Bounds()
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+
+		for x := 0; x < w; x++ {
+			p := row[x*4:]
+			yy, cb, cr := color.RGBToYCbCr(p[0], p[1], p[2])
+			e.y[y*w+x] = yy
+
+			i := (y/2)*cw + x/2
+			cbSum[i] += int(cb)
+			crSum[i] += int(cr)
+			count[i]++
+		}
+	}
+
+	for i := range count {
+		e.cb[i] = byte((cbSum[i] + count[i]/2) / count[i])
+		e.cr[i] = byte((crSum[i] + count[i]/2) / count[i])
+	}
+}
@@ -8,6 +8,9 @@ const (
 	mask6 = 1<<6 - 1
 )
 
+// RGBColor is an opaque color with 8 bits per channel.
+// It is used by the 15- and 16-bit image types, whose SetRGB
+// methods take it with the channel values of the image instead.
 type RGBColor struct {
 	R, G, B uint8
 }
@@ -19,6 +22,18 @@ func (c RGBColor) RGBA() (r, g, b, a uint32) {
 	g |= g << 8
 	b = uint32(c.B)
 	b |= b << 8
-	a = 0xff
+	a = 0xffff
 	return
 }
+
+// expand5 scales the lowest 5 bits of v to 8 bits.
+func expand5(v uint16) uint8 {
+	v &= mask5
+	return uint8(v<<3 | v>>2)
+}
+
+// expand6 scales the lowest 6 bits of v to 8 bits.
+func expand6(v uint16) uint8 {
+	v &= mask6
+	return uint8(v<<2 | v>>4)
+}
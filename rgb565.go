@@ -8,6 +8,8 @@ import (
 	"image/color"
 )
 
+// RGB565Model converts colors to the nearest color which can be
+// represented with 5-6-5 bits per channel.
 var RGB565Model = color.ModelFunc(
 	func(c color.Color) color.Color {
 		if _, ok := c.(RGBColor); ok {
@@ -16,9 +18,9 @@ var RGB565Model = color.ModelFunc(
 
 		r, g, b, _ := c.RGBA()
 		return RGBColor{
-			uint8(r >> (8 + (8 - 5))),
-			uint8(g >> (8 + (8 - 6))),
-			uint8(b >> (8 + (8 - 5))),
+			expand5(uint16(r >> (16 - 5))),
+			expand6(uint16(g >> (16 - 6))),
+			expand5(uint16(b >> (16 - 5))),
 		}
 	})
 
@@ -37,19 +39,28 @@ func (i *RGB565) At(x, y int) color.Color {
 	}
 
 	pix := i.Pix[i.PixOffset(x, y):]
-	clr := uint16(pix[0])<<8 | uint16(pix[1])
+	clr := uint16(pix[0]) | uint16(pix[1])<<8
 
-	return RGBColor{
-		uint8(clr>>11) & mask5,
-		uint8(clr>>5) & mask6,
-		uint8(clr) & mask5,
-	}
+	var c RGBColor
+	c.R = expand5(clr >> 11)
+	c.G = expand6(clr >> 5)
+	c.B = expand5(clr)
+	return c
 }
 
 func (i *RGB565) Set(x, y int, c color.Color) {
-	i.SetRGB(x, y, RGB565Model.Convert(c).(RGBColor))
+	i.SetRGB8(x, y, RGB565Model.Convert(c).(RGBColor))
+}
+
+// SetRGB8 sets the pixel at x, y to the given color. Channels are
+// truncated to the bit depth of the image.
+func (i *RGB565) SetRGB8(x, y int, c RGBColor) {
+	i.SetRGB(x, y, RGBColor{c.R >> 3, c.G >> 2, c.B >> 3})
 }
 
+// SetRGB sets the pixel at x, y to the given channel values, which
+// are in the range of the bit depth of the image: 0-31 for red and blue, and 0-63 for green.
+// Use SetRGB8 for colors with 8-bit channels.
 func (i *RGB565) SetRGB(x, y int, c RGBColor) {
 	if !(image.Point{x, y}.In(i.Rect)) {
 		return
@@ -57,7 +68,7 @@ func (i *RGB565) SetRGB(x, y int, c RGBColor) {
 
 	n := i.PixOffset(x, y)
 	pix := i.Pix[n:]
-	clr := (uint16(c.R) << 11) | (uint16(c.G) << 5) | uint16(c.B)
+	clr := uint16(c.R&mask5)<<11 | uint16(c.G&mask6)<<5 | uint16(c.B&mask5)
 
 	pix[0] = uint8(clr)
 	pix[1] = uint8(clr >> 8)
@@ -0,0 +1,65 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestRGBImages(t *testing.T) {
+	r := image.Rect(0, 0, 1, 1)
+	c := color.RGBA{0x12, 0x34, 0x56, 0xff}
+
+	for _, test := range []struct {
+		img   draw.Image
+		pix   []byte   // Little-endian pixel value of c.
+		want  RGBColor // c, truncated and scaled back to 8 bits.
+		white []byte   // Pixel value of the 8-bit white channels.
+		raw   RGBColor // Channels of c at the depth of the image.
+	}{
+		{&RGB565{Pix: make([]byte, 2), Stride: 2, Rect: r}, []byte{0xaa, 0x11}, RGBColor{0x10, 0x34, 0x52}, []byte{0xff, 0xff}, RGBColor{2, 13, 10}},
+		{&BGR565{Pix: make([]byte, 2), Stride: 2, Rect: r}, []byte{0xa2, 0x51}, RGBColor{0x10, 0x34, 0x52}, []byte{0xff, 0xff}, RGBColor{2, 13, 10}},
+		{&RGB555{Pix: make([]byte, 2), Stride: 2, Rect: r}, []byte{0xca, 0x08}, RGBColor{0x10, 0x31, 0x52}, []byte{0xff, 0x7f}, RGBColor{2, 6, 10}},
+		{&BGR555{Pix: make([]byte, 2), Stride: 2, Rect: r}, []byte{0xc2, 0x28}, RGBColor{0x10, 0x31, 0x52}, []byte{0xff, 0x7f}, RGBColor{2, 6, 10}},
+	} {
+		test.img.Set(0, 0, c)
+		raw, _ := RawPixels(test.img)
+		if !bytes.Equal(raw.Pix, test.pix) {
+			t.Errorf("%T: pixel % x, want % x", test.img, raw.Pix, test.pix)
+		}
+
+		if have := test.img.At(0, 0); have != test.want {
+			t.Errorf("%T: %v, want %v", test.img, have, test.want)
+		}
+		if have := test.img.ColorModel().Convert(c); have != test.want {
+			t.Errorf("%T: converted to %v, want %v", test.img, have, test.want)
+		}
+
+		// SetRGB8 takes 8-bit channels, dropping the low bits.
+		rgb := test.img.(interface {
+			SetRGB(x, y int, c RGBColor)
+			SetRGB8(x, y int, c RGBColor)
+		})
+		rgb.SetRGB8(0, 0, RGBColor{0xff, 0xff, 0xff})
+		if !bytes.Equal(raw.Pix, test.white) || test.img.At(0, 0) != (RGBColor{0xff, 0xff, 0xff}) {
+			t.Errorf("%T: white as % x", test.img, raw.Pix)
+		}
+
+		// SetRGB takes the channels as stored.
+		rgb.SetRGB(0, 0, RGBColor{})
+		rgb.SetRGB(0, 0, test.raw)
+		if !bytes.Equal(raw.Pix, test.pix) {
+			t.Errorf("%T: raw channels as % x, want % x", test.img, raw.Pix, test.pix)
+		}
+	}
+
+	// The colors are opaque.
+	if _, _, _, a := (RGBColor{}).RGBA(); a != 0xffff {
+		t.Errorf("alpha %x", a)
+	}
+}
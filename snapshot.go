@@ -0,0 +1,193 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Snapshot copies part of the visible screen into a new image. The
+// rectangle is in screen coordinates, relative to the current pan
+// offset; an empty rectangle means the whole screen. The returned
+// image has the bounds of the copied area. All pixels are opaque,
+// as the alpha channel of a framebuffer does not affect the display.
+func (c *Canvas) Snapshot(r image.Rectangle) (*image.RGBA, error) {
+	var fi fbFixScreenInfo
+	var vi fbVarScreenInfo
+
+	err := c.ioctl(_IOGET_FSCREENINFO, unsafe.Pointer(&fi))
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.ioctl(_IOGET_VSCREENINFO, unsafe.Pointer(&vi))
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot(c.mem, c.ioctl, &fi, &vi, r)
+}
+
+// Grab takes a snapshot of the given framebuffer device, as
+// Canvas.Snapshot does. Unlike opening a Canvas, it leaves the
+// display and its settings untouched, so it can be used to capture
+// the output of other programs.
+func Grab(dev string, r image.Rectangle) (*image.RGBA, error) {
+	fd, err := os.Open(dev)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var fi fbFixScreenInfo
+	var vi fbVarScreenInfo
+
+	err = ioctl(fd.Fd(), _IOGET_FSCREENINFO, unsafe.Pointer(&fi))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dev, err)
+	}
+
+	err = ioctl(fd.Fd(), _IOGET_VSCREENINFO, unsafe.Pointer(&vi))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dev, err)
+	}
+
+	if fi.typ != _TYPE_PACKED_PIXELS && fi.typ != _TYPE_FOURCC {
+		return nil, ErrNotPackedPixels
+	}
+
+	size := int(fi.smemlen)
+	if size == 0 {
+		size = int(vi.xresVirtual * vi.yresVirtual * vi.bitsPerPixel / 8)
+	}
+
+	mem, err := syscall.Mmap(int(fd.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("%s: mmap: %w", dev, err)
+	}
+	defer syscall.Munmap(mem)
+
+	ctl := func(name uintptr, data interface{}) error {
+		return ioctl(fd.Fd(), name, data)
+	}
+	return snapshot(mem, ctl, &fi, &vi, r)
+}
+
+// snapshot copies the visible area r of the framebuffer memory mem.
+// The palette of indexed formats is read from the device using ctl.
+func snapshot(mem []byte, ctl ioctlFunc, fi *fbFixScreenInfo, vi *fbVarScreenInfo, r image.Rectangle) (*image.RGBA, error) {
+	mode := newDisplayMode(vi, false)
+	g := mode.Geometry
+
+	screen := image.Rect(0, 0, g.XRes, g.YRes)
+	if r.Empty() {
+		r = screen
+	}
+
+	r = r.Intersect(screen)
+	if r.Empty() {
+		return nil, errors.New("framebuffer: snapshot outside the screen")
+	}
+
+	stride := int(fi.lineLength)
+	if stride == 0 {
+		stride = mode.Stride()
+	}
+
+	// The area, in framebuffer memory.
+	off := image.Pt(int(vi.xoffset), int(vi.yoffset))
+	sr := r.Add(off)
+
+	if (sr.Max.Y-1)*stride+mode.Format.rowSize(sr.Max.X) > len(mem) {
+		return nil, errors.New("framebuffer: snapshot exceeds framebuffer memory")
+	}
+
+	mem, err := planes(mode.Format, mem, stride, g.YVRes)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := devicePacking(fi.visual, mode)
+	src, err := newImage(mode.Format, pk, mem, stride, image.Rect(0, 0, sr.Max.X, sr.Max.Y))
+	if err != nil {
+		return nil, err
+	}
+
+	dst := image.NewRGBA(r)
+
+	switch s := src.(type) {
+	case *image.RGBA:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row := dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)]
+			copy(row, s.Pix[s.PixOffset(sr.Min.X, y+off.Y):])
+
+			for i := 3; i < len(row); i += 4 {
+				row[i] = 0xff
+			}
+		}
+
+	case *BGRA:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row := dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)]
+			pix := s.Pix[s.PixOffset(sr.Min.X, y+off.Y):]
+
+			for i := 0; i < len(row); i += 4 {
+				row[i+0] = pix[i+2]
+				row[i+1] = pix[i+1]
+				row[i+2] = pix[i+0]
+				row[i+3] = 0xff
+			}
+		}
+
+	case *image.Alpha:
+		// Indexed colors; look them up in the palette.
+		pal, err := readPalette(ctl)
+		if err != nil {
+			return nil, err
+		}
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := pal[s.Pix[s.PixOffset(x+off.X, y+off.Y)]]
+				dst.Set(x, y, opaque(c))
+			}
+		}
+
+	case leveled:
+		if fi.visual != _VISUAL_PSEUDOCOLOR {
+			draw.Draw(dst, r, src, sr.Min, draw.Src)
+			break
+		}
+
+		// Levels are indices into the palette.
+		pal, err := readPalette(ctl)
+		if err != nil {
+			return nil, err
+		}
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				dst.Set(x, y, opaque(pal[s.level(x+off.X, y+off.Y)]))
+			}
+		}
+
+	default:
+		draw.Draw(dst, r, src, sr.Min, draw.Src)
+	}
+
+	return dst, nil
+}
+
+// opaque returns c without transparency.
+func opaque(c color.Color) color.RGBA {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{n.R, n.G, n.B, 0xff}
+}
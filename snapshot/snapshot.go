@@ -0,0 +1,97 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package snapshot saves screenshots, as taken with Canvas.Snapshot
+// or framebuffer.Grab, in common image formats.
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+)
+
+// Format is an image file format.
+type Format string
+
+// Known formats.
+const (
+	PNG Format = "png"
+	PPM Format = "ppm" // Binary portable pixmap (P6).
+	BMP Format = "bmp"
+)
+
+// FormatOf returns the format matching the extension of path.
+// It returns PNG for unknown extensions.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ppm", ".pnm":
+		return PPM
+	case ".bmp":
+		return BMP
+	}
+	return PNG
+}
+
+// Encode writes img to w in the given format.
+func Encode(w io.Writer, img image.Image, f Format) error {
+	switch f {
+	case PNG:
+		return png.Encode(w, img)
+	case PPM:
+		return EncodePPM(w, img)
+	case BMP:
+		return bmp.Encode(w, img)
+	}
+	return fmt.Errorf("snapshot: unknown format %q", f)
+}
+
+// Save writes img to a file, in the format matching its extension.
+func Save(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = Encode(f, img, FormatOf(path))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// EncodePPM writes img to w as a binary portable pixmap. The
+// format has no alpha channel, so colors are written as they
+// would appear on black.
+func EncodePPM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(b.Min.X, y):rgba.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				bw.Write(row[i : i+3])
+			}
+		}
+		return bw.Flush()
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			bw.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,104 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package snapshot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(2, 1, 5, 3))
+	for y := 1; y < 3; y++ {
+		for x := 2; x < 5; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 40), uint8(y * 60), 0x33, 0xff})
+		}
+	}
+	return img
+}
+
+func TestPPM(t *testing.T) {
+	img := testImage()
+
+	want := []byte("P6\n3 2\n255\n" +
+		"\x50\x3c\x33\x78\x3c\x33\xa0\x3c\x33" +
+		"\x50\x78\x33\x78\x78\x33\xa0\x78\x33")
+
+	for _, src := range []image.Image{img, &generic{img}} {
+		var buf bytes.Buffer
+		if err := EncodePPM(&buf, src); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%T: have %q, want %q", src, buf.Bytes(), want)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	img := testImage()
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name   string
+		decode func([]byte) (image.Image, error)
+	}{
+		{"a.png", func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }},
+		{"a.BMP", func(b []byte) (image.Image, error) { return bmp.Decode(bytes.NewReader(b)) }},
+		{"a.ppm", nil},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if err := Save(path, img); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.decode == nil {
+			if !bytes.HasPrefix(data, []byte("P6\n3 2\n")) {
+				t.Errorf("%s: not a pixmap", tc.name)
+			}
+			continue
+		}
+
+		have, err := tc.decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if have.Bounds().Size() != img.Bounds().Size() {
+			t.Fatalf("%s: size %v", tc.name, have.Bounds().Size())
+		}
+
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				hr, hg, hb, _ := have.At(x+have.Bounds().Min.X, y+have.Bounds().Min.Y).RGBA()
+				wr, wg, wb, _ := img.At(x+2, y+1).RGBA()
+				if hr != wr || hg != wg || hb != wb {
+					t.Fatalf("%s: pixel %d,%d differs", tc.name, x, y)
+				}
+			}
+		}
+	}
+
+	if err := Encode(&bytes.Buffer{}, img, "gif"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+// generic hides the type of an image.
+type generic struct {
+	image.Image
+}
@@ -0,0 +1,172 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+// pattern returns a distinct, opaque color for each pixel.
+func pattern(x, y int) color.RGBA {
+	return color.RGBA{uint8(x * 16), uint8(y * 8), uint8(x ^ y), 0xff}
+}
+
+func TestSnapshot(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 16, 8, 32)
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, _ := c.Image()
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Alpha is not shown, so it must not end up in snapshots.
+			col := pattern(x, y)
+			col.A = 0
+			img.(*BGRA).SetRGBA(x, y, col)
+		}
+	}
+
+	// Show the second page.
+	fb.vi.yoffset = 8
+
+	for _, r := range []image.Rectangle{
+		{},
+		image.Rect(2, 3, 10, 5),
+		image.Rect(-4, 4, 100, 100),
+	} {
+		have, err := c.Snapshot(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := r.Intersect(image.Rect(0, 0, 16, 8))
+		if r.Empty() {
+			want = image.Rect(0, 0, 16, 8)
+		}
+
+		if have.Bounds() != want {
+			t.Fatalf("%v: bounds %v, want %v", r, have.Bounds(), want)
+		}
+
+		checkPattern(t, have, image.Pt(0, 8))
+	}
+
+	if _, err := c.Snapshot(image.Rect(20, 0, 30, 10)); err == nil {
+		t.Error("snapshot outside the screen succeeded")
+	}
+}
+
+func TestGrab(t *testing.T) {
+	s := newFakeSystem(t)
+
+	for _, depth := range []int{32, 16} {
+		fb := s.addFB(depth/16, "fb", "drv", 6, 4, depth)
+
+		// Rows are padded by the driver.
+		fb.fi.lineLength += 8
+		fb.fi.smemlen = fb.fi.lineLength * fb.vi.yresVirtual
+		mem := make([]byte, fb.fi.smemlen)
+
+		bpp := depth / 8
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 6; x++ {
+				c := pattern(x, y)
+				p := mem[y*int(fb.fi.lineLength)+x*bpp:]
+
+				if depth == 32 {
+					p[0], p[1], p[2] = c.B, c.G, c.R
+				} else {
+					v := uint16(c.R>>3)<<11 | uint16(c.G>>2)<<5 | uint16(c.B>>3)
+					p[0], p[1] = byte(v), byte(v>>8)
+				}
+			}
+		}
+
+		if err := os.WriteFile(fb.path, mem, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		fb.vi.xoffset = 0
+		fb.vi.yoffset = 3
+
+		img, err := Grab(fb.path, image.Rectangle{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.Bounds() != image.Rect(0, 0, 6, 4) {
+			t.Fatalf("%d bits: bounds %v", depth, img.Bounds())
+		}
+
+		if depth == 32 {
+			checkPattern(t, img, image.Pt(0, 3))
+			continue
+		}
+
+		// 16 bits lose precision; compare the conversion.
+		want := &RGB565{Pix: mem, Stride: int(fb.fi.lineLength), Rect: image.Rect(0, 0, 6, 8)}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 6; x++ {
+				w := color.RGBAModel.Convert(want.At(x, y+3))
+				if have := img.At(x, y); have != w {
+					t.Fatalf("16 bits: pixel %d,%d: have %v, want %v", x, y, have, w)
+				}
+			}
+		}
+	}
+}
+
+func TestGrabIndexed(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 4, 2, 8)
+
+	for i := 0; i < 256; i++ {
+		fb.cmap[0][i] = uint16(i) << 8
+		fb.cmap[1][i] = uint16(255-i) << 8
+		fb.cmap[2][i] = 0x8000
+	}
+
+	mem := make([]byte, fb.fi.smemlen)
+	for i := range mem {
+		mem[i] = byte(i * 10)
+	}
+	os.WriteFile(fb.path, mem, 0644)
+
+	img, err := Grab(fb.path, image.Rect(1, 1, 3, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 1; x < 3; x++ {
+		i := uint8((4 + x) * 10)
+		want := color.RGBA{i, 255 - i, 0x80, 0xff}
+		if have := img.At(x, 1); have != want {
+			t.Errorf("pixel %d,1: have %v, want %v", x, have, want)
+		}
+	}
+}
+
+// checkPattern checks that img holds the pattern, shifted by off.
+func checkPattern(t *testing.T, img *image.RGBA, off image.Point) {
+	t.Helper()
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			want := pattern(x+off.X, y+off.Y)
+			if have := img.RGBAAt(x, y); have != want {
+				t.Fatalf("pixel %d,%d: have %v, want %v", x, y, have, want)
+			}
+		}
+	}
+}
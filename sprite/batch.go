@@ -0,0 +1,85 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Batch draws a set of sprites, in the order they were added.
+// It is not safe for concurrent use.
+type Batch struct {
+	// Background is drawn beneath the sprites. If it is nil,
+	// the sprites are drawn over whatever the image holds.
+	Background image.Image
+
+	sprites []*Sprite
+}
+
+// Add adds sprites to the batch, on top of those already in it.
+func (b *Batch) Add(s ...*Sprite) {
+	b.sprites = append(b.sprites, s...)
+}
+
+// Remove removes a sprite from the batch.
+func (b *Batch) Remove(s *Sprite) {
+	for i, v := range b.sprites {
+		if v == s {
+			b.sprites = append(b.sprites[:i], b.sprites[i+1:]...)
+			return
+		}
+	}
+}
+
+// Sprites returns the sprites in the batch, in drawing order.
+func (b *Batch) Sprites() []*Sprite {
+	return b.sprites
+}
+
+// Update advances the animations of all sprites by dt.
+func (b *Batch) Update(dt time.Duration) {
+	for _, s := range b.sprites {
+		s.Update(dt)
+	}
+}
+
+// Draw draws the background and all sprites onto dst.
+func (b *Batch) Draw(dst draw.Image) {
+	if b.Background != nil {
+		r := dst.Bounds()
+		draw.Draw(dst, r, b.Background, r.Min, draw.Src)
+	}
+
+	for _, s := range b.sprites {
+		s.Draw(dst)
+	}
+}
+
+// Render draws a frame onto the back buffer of the canvas,
+// then flips it onto the screen.
+func (b *Batch) Render(c *framebuffer.Canvas) error {
+	dst, err := c.BackBuffer()
+	if err != nil {
+		return err
+	}
+
+	b.Draw(dst)
+	return c.Flip()
+}
+
+// Collisions returns the sprites in the batch, other than s,
+// which collide with s at pixel level.
+func (b *Batch) Collisions(s *Sprite) []*Sprite {
+	var hits []*Sprite
+	for _, o := range b.sprites {
+		if o != s && s.Collides(o) {
+			hits = append(hits, o)
+		}
+	}
+	return hits
+}
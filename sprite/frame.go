@@ -0,0 +1,287 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+
+	"github.com/sparques/framebuffer"
+)
+
+// Options define which pixels of a frame are transparent.
+// Without options, all pixels are drawn.
+type Options struct {
+	Key   color.Color // Pixels of exactly this color are transparent. Nil means none.
+	Alpha bool        // Pixels take their transparency from the alpha channel.
+	Mask  image.Image // If set, its alpha channel is used instead; it is aligned with the source.
+}
+
+// Flip selects mirrored versions of a frame.
+type Flip uint8
+
+// Known flips. They can be combined.
+const (
+	FlipH Flip = 1 << iota // Mirrored left to right.
+	FlipV                  // Mirrored top to bottom.
+)
+
+// Frame is a single sprite image, converted to the pixel format
+// of the framebuffer. Drawing it onto an image of that format
+// copies rows of opaque pixels as they are; only translucent
+// pixels need color conversion and blending.
+type Frame struct {
+	img   draw.Image      // Converted pixels.
+	raw   framebuffer.Raw // Memory of img; empty for packed and YUV formats.
+	runs  [][]span        // Opaque pixels, per row.
+	blend []pixel         // Translucent pixels.
+	mask  []uint64        // Bit per pixel which is not transparent.
+	words int             // Mask words per row.
+
+	// Source, for creating flipped versions.
+	src    image.Image
+	format framebuffer.PixelFormat
+	opts   Options
+	flips  [4]*Frame
+}
+
+// span is a range of pixels in a row, from x0 up to x1.
+type span struct {
+	x0, x1 int
+}
+
+// pixel is a translucent pixel, premultiplied by alpha.
+type pixel struct {
+	p image.Point
+	c color.RGBA64
+}
+
+// NewFrame converts src into a frame with the given pixel format.
+// The frame bounds start at (0, 0), whatever the bounds of src.
+func NewFrame(src image.Image, format framebuffer.PixelFormat, opts *Options) (*Frame, error) {
+	b := src.Bounds()
+	r := image.Rect(0, 0, b.Dx(), b.Dy())
+
+	img, err := framebuffer.NewImage(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	draw.Draw(img, r, src, b.Min, draw.Src)
+	raw, _ := framebuffer.RawPixels(img)
+
+	f := &Frame{
+		img:    img,
+		raw:    raw,
+		runs:   make([][]span, r.Dy()),
+		mask:   make([]uint64, (r.Dx()+63)/64*r.Dy()),
+		words:  (r.Dx() + 63) / 64,
+		src:    src,
+		format: format,
+	}
+
+	if opts != nil {
+		f.opts = *opts
+	}
+
+	var kr, kg, kb, ka uint32
+	if f.opts.Key != nil {
+		kr, kg, kb, ka = f.opts.Key.RGBA()
+	}
+
+	for y := 0; y < r.Dy(); y++ {
+		start := -1
+
+		for x := 0; x <= r.Dx(); x++ {
+			opaque := false
+
+			if x < r.Dx() {
+				c := src.At(b.Min.X+x, b.Min.Y+y)
+				if f.opts.Mask != nil {
+					n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+					_, _, _, ma := f.opts.Mask.At(b.Min.X+x, b.Min.Y+y).RGBA()
+					n.A = uint16(ma)
+					c = n
+				}
+				cr, cg, cb, ca := c.RGBA()
+
+				switch {
+				case f.opts.Key != nil && cr == kr && cg == kg && cb == kb && ca == ka:
+				case !(f.opts.Alpha || f.opts.Mask != nil) || ca == 0xffff:
+					opaque = true
+				case ca > 0:
+					f.blend = append(f.blend, pixel{image.Pt(x, y), color.RGBA64{uint16(cr), uint16(cg), uint16(cb), uint16(ca)}})
+					f.setMask(x, y)
+				}
+			}
+
+			if opaque {
+				f.setMask(x, y)
+				if start < 0 {
+					start = x
+				}
+			} else if start >= 0 {
+				f.runs[y] = append(f.runs[y], span{start, x})
+				start = -1
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Sheet cuts a sprite sheet into frames of the given size. The frames
+// are returned left to right, then top to bottom. Cells which do not
+// fit completely within src are skipped.
+func Sheet(src image.Image, size image.Point, format framebuffer.PixelFormat, opts *Options) ([]*Frame, error) {
+	b := src.Bounds()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, nil
+	}
+
+	var frames []*Frame
+	for y := b.Min.Y; y+size.Y <= b.Max.Y; y += size.Y {
+		for x := b.Min.X; x+size.X <= b.Max.X; x += size.X {
+			r := image.Rectangle{image.Pt(x, y), image.Pt(x, y).Add(size)}
+
+			f, err := NewFrame(&cell{src, r}, format, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			frames = append(frames, f)
+		}
+	}
+
+	return frames, nil
+}
+
+// Bounds returns the frame bounds, which start at (0, 0).
+func (f *Frame) Bounds() image.Rectangle {
+	return f.img.Bounds()
+}
+
+// Image returns the converted pixels. It must not be modified.
+func (f *Frame) Image() image.Image {
+	return f.img
+}
+
+// Opaque returns true if the pixel at x, y is drawn,
+// either because it is opaque or translucent.
+func (f *Frame) Opaque(x, y int) bool {
+	if !(image.Point{x, y}.In(f.img.Bounds())) {
+		return false
+	}
+	return f.mask[y*f.words+x/64]&(1<<(x%64)) != 0
+}
+
+func (f *Frame) setMask(x, y int) {
+	f.mask[y*f.words+x/64] |= 1 << (x % 64)
+}
+
+// Flipped returns the frame mirrored as given. Flipped
+// frames are created once, and reused afterwards.
+func (f *Frame) Flipped(fl Flip) *Frame {
+	fl &= FlipH | FlipV
+	if fl == 0 {
+		return f
+	}
+
+	if f.flips[fl] == nil {
+		opts := f.opts
+		if opts.Mask != nil {
+			opts.Mask = &flipped{&cell{opts.Mask, f.src.Bounds()}, fl}
+		}
+
+		// The source was converted before, so this can not fail.
+		f.flips[fl], _ = NewFrame(&flipped{f.src, fl}, f.format, &opts)
+	}
+
+	return f.flips[fl]
+}
+
+// Draw draws the frame onto dst, with its top-left corner at pt.
+// If dst has the pixel format of the frame, such as an image from
+// Canvas.Image or Canvas.BackBuffer, opaque pixels are copied a row
+// at a time. Other images, and formats of less than a byte per pixel
+// or with chroma shared between pixels, are drawn pixel by pixel.
+func (f *Frame) Draw(dst draw.Image, pt image.Point) {
+	r := f.img.Bounds().Add(pt).Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	// Visible columns, in frame coordinates.
+	x0, x1 := r.Min.X-pt.X, r.Max.X-pt.X
+
+	d, ok := framebuffer.RawPixels(dst)
+	ok = ok && f.raw.Bpp > 0 && reflect.TypeOf(dst) == reflect.TypeOf(f.img)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := y - pt.Y
+
+		for _, s := range f.runs[sy] {
+			s.x0, s.x1 = max(s.x0, x0), min(s.x1, x1)
+			if s.x0 >= s.x1 {
+				continue
+			}
+
+			if ok {
+				copy(d.Row(y, s.x0+pt.X, s.x1+pt.X), f.raw.Row(sy, s.x0, s.x1))
+				continue
+			}
+
+			for x := s.x0; x < s.x1; x++ {
+				dst.Set(x+pt.X, y, f.img.At(x, sy))
+			}
+		}
+	}
+
+	for _, p := range f.blend {
+		q := p.p.Add(pt)
+		if q.In(r) {
+			dst.Set(q.X, q.Y, over(p.c, dst.At(q.X, q.Y)))
+		}
+	}
+}
+
+// over blends src over dst.
+func over(src color.RGBA64, dst color.Color) color.Color {
+	dr, dg, db, da := dst.RGBA()
+	a := 0xffff - uint32(src.A)
+
+	return color.RGBA64{
+		R: uint16(uint32(src.R) + dr*a/0xffff),
+		G: uint16(uint32(src.G) + dg*a/0xffff),
+		B: uint16(uint32(src.B) + db*a/0xffff),
+		A: uint16(uint32(src.A) + da*a/0xffff),
+	}
+}
+
+// cell is a part of a sprite sheet.
+type cell struct {
+	image.Image
+	r image.Rectangle
+}
+
+func (c *cell) Bounds() image.Rectangle { return c.r }
+
+// flipped is a mirrored view of an image.
+type flipped struct {
+	image.Image
+	fl Flip
+}
+
+func (f *flipped) At(x, y int) color.Color {
+	b := f.Image.Bounds()
+	if f.fl&FlipH != 0 {
+		x = b.Max.X - 1 - (x - b.Min.X)
+	}
+	if f.fl&FlipV != 0 {
+		y = b.Max.Y - 1 - (y - b.Min.Y)
+	}
+	return f.Image.At(x, y)
+}
@@ -0,0 +1,142 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package sprite draws animated images, for games and dashboards.
+//
+// Sprite images are converted to the pixel format of the framebuffer
+// when they are loaded, so drawing them is mostly a matter of copying
+// memory. Transparency is defined by a color key, or by an alpha
+// channel, in which case translucent pixels are blended.
+//
+// A Batch draws a set of sprites for each frame, usually onto the
+// back buffer of a Canvas.
+package sprite
+
+import (
+	"image"
+	"image/draw"
+	"time"
+)
+
+// Animation is a sequence of frames, each shown for the same time.
+type Animation struct {
+	Frames []*Frame
+	Delay  time.Duration // Time each frame is shown.
+	Loop   bool          // Start over after the last frame.
+}
+
+// Sprite is a positioned, possibly animated, image.
+// It is not safe for concurrent use.
+type Sprite struct {
+	Pos    image.Point // Position of the top-left corner.
+	Flip   Flip        // Mirrors the frames.
+	Hidden bool        // Hidden sprites are not drawn and do not collide.
+
+	anim    *Animation
+	frame   int           // Index of the current frame.
+	elapsed time.Duration // Time the current frame has been shown.
+}
+
+// New creates a sprite showing the given frames. With
+// more than one frame, use Play to animate them.
+func New(frames ...*Frame) *Sprite {
+	return &Sprite{anim: &Animation{Frames: frames}}
+}
+
+// Play starts an animation from its first frame.
+func (s *Sprite) Play(a *Animation) {
+	s.anim = a
+	s.frame = 0
+	s.elapsed = 0
+}
+
+// Animation returns the current animation.
+func (s *Sprite) Animation() *Animation {
+	return s.anim
+}
+
+// Update advances the animation by dt.
+func (s *Sprite) Update(dt time.Duration) {
+	a := s.anim
+	if a == nil || a.Delay <= 0 || len(a.Frames) < 2 {
+		return
+	}
+
+	s.elapsed += dt
+	for s.elapsed >= a.Delay {
+		if s.frame == len(a.Frames)-1 {
+			if !a.Loop {
+				s.elapsed = 0
+				return
+			}
+			s.frame = -1
+		}
+
+		s.frame++
+		s.elapsed -= a.Delay
+	}
+}
+
+// Done returns true if an animation which does not loop
+// has reached its last frame.
+func (s *Sprite) Done() bool {
+	a := s.anim
+	return a == nil || (!a.Loop && s.frame >= len(a.Frames)-1)
+}
+
+// Frame returns the frame currently shown, flipped as
+// requested. It returns nil if there are no frames.
+func (s *Sprite) Frame() *Frame {
+	if s.anim == nil || len(s.anim.Frames) == 0 {
+		return nil
+	}
+
+	return s.anim.Frames[s.frame].Flipped(s.Flip)
+}
+
+// Bounds returns the area covered by the current frame.
+func (s *Sprite) Bounds() image.Rectangle {
+	f := s.Frame()
+	if f == nil {
+		return image.Rectangle{}
+	}
+
+	return f.Bounds().Add(s.Pos)
+}
+
+// Draw draws the current frame onto dst.
+func (s *Sprite) Draw(dst draw.Image) {
+	if f := s.Frame(); f != nil && !s.Hidden {
+		f.Draw(dst, s.Pos)
+	}
+}
+
+// Overlaps returns true if the bounding boxes of both sprites overlap.
+func (s *Sprite) Overlaps(o *Sprite) bool {
+	if s.Hidden || o.Hidden {
+		return false
+	}
+
+	return s.Bounds().Overlaps(o.Bounds())
+}
+
+// Collides returns true if any pixel drawn by one
+// sprite is also drawn by the other.
+func (s *Sprite) Collides(o *Sprite) bool {
+	if !s.Overlaps(o) {
+		return false
+	}
+
+	f, g := s.Frame(), o.Frame()
+	r := s.Bounds().Intersect(o.Bounds())
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if f.Opaque(x-s.Pos.X, y-s.Pos.Y) && g.Opaque(x-o.Pos.X, y-o.Pos.Y) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,397 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+
+	"github.com/sparques/framebuffer"
+)
+
+var formats = map[string]framebuffer.PixelFormat{
+	"RGBA":   {Depth: 32, RedBits: 8, RedShift: 0, GreenBits: 8, GreenShift: 8, BlueBits: 8, BlueShift: 16, AlphaBits: 8, AlphaShift: 24},
+	"BGRA":   {Depth: 32, RedBits: 8, RedShift: 16, GreenBits: 8, GreenShift: 8, BlueBits: 8, BlueShift: 0, AlphaBits: 8, AlphaShift: 24},
+	"RGB565": {Depth: 16, RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5, BlueShift: 0},
+	"BGR555": {Depth: 16, RedBits: 5, RedShift: 0, GreenBits: 5, GreenShift: 5, BlueBits: 5, BlueShift: 10},
+}
+
+var (
+	red     = color.NRGBA{0xff, 0, 0, 0xff}
+	blue    = color.NRGBA{0, 0, 0xff, 0xff}
+	magenta = color.NRGBA{0xff, 0, 0xff, 0xff}
+	clear   = color.NRGBA{}
+	glass   = color.NRGBA{0, 0xff, 0, 0x80}
+	bg      = color.RGBA{0x40, 0x40, 0x40, 0xff}
+)
+
+// bitmap creates an image from rows of text, using the given colors.
+func bitmap(colors map[rune]color.Color, rows ...string) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			img.Set(x, y, colors[c])
+		}
+	}
+	return img
+}
+
+var palette = map[rune]color.Color{'r': red, 'b': blue, 'm': magenta, '.': clear, 'g': glass}
+
+func TestFrameDraw(t *testing.T) {
+	solid := bitmap(palette,
+		"rrbm",
+		"bmmb",
+		"rbmr",
+	)
+
+	for _, tc := range []struct {
+		name string
+		src  image.Image
+		opts *Options
+		ref  image.Image // Source as it should appear.
+	}{
+		{"opaque", solid, nil, solid},
+		{"key", solid, &Options{Key: magenta}, bitmap(palette, "rrb.", "b..b", "rb.r")},
+		{"alpha", bitmap(palette, "rrbm", "g.mb", "rbgr"), &Options{Alpha: true}, bitmap(palette, "rrbm", "g.mb", "rbgr")},
+		{"mask", solid, &Options{Mask: bitmap(map[rune]color.Color{'x': color.Alpha{0xff}, '.': color.Alpha{}},
+			"xxx.", "xxx.", "....")}, bitmap(palette, "rrb.", "bmm.", "....")},
+	} {
+		for name, pf := range formats {
+			f, err := NewFrame(tc.src, pf, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Partially outside the destination, to test clipping.
+			pt := image.Pt(-1, 2)
+
+			dst := newImage(t, pf, 4, 4)
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+			f.Draw(dst, pt)
+
+			want := newImage(t, pf, 4, 4)
+			draw.Draw(want, want.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+			draw.Draw(want, tc.ref.Bounds().Add(pt), tc.ref, image.Point{}, draw.Over)
+			compare(t, tc.name+"/"+name, dst, want)
+
+			// Images of another type take the slow path.
+			slow := image.NewRGBA(dst.Bounds())
+			draw.Draw(slow, slow.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+			f.Draw(slow, pt)
+			compare(t, tc.name+"/"+name+"/slow", slow, dst)
+		}
+	}
+}
+
+func TestFramePacked(t *testing.T) {
+	gray := map[rune]color.Color{'w': color.White, 'k': color.Black, '.': clear}
+	src := bitmap(gray,
+		"wk.w",
+		"kww.",
+	)
+
+	for _, pf := range []framebuffer.PixelFormat{{Depth: 1}, {Depth: 4}} {
+		f, err := NewFrame(src, pf, &Options{Alpha: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Bounds() != image.Rect(0, 0, 4, 2) {
+			t.Fatalf("depth %d: bounds %v", pf.Depth, f.Bounds())
+		}
+
+		pt := image.Pt(3, 1)
+		dst := newImage(t, pf, 9, 3)
+		f.Draw(dst, pt)
+
+		want := newImage(t, pf, 9, 3)
+		draw.Draw(want, src.Bounds().Add(pt), src, image.Point{}, draw.Over)
+		compare(t, "packed", dst, want)
+
+		if a := New(f); !a.Collides(New(f)) {
+			t.Errorf("depth %d: sprite does not collide with itself", pf.Depth)
+		}
+	}
+}
+
+func TestFrameYUV(t *testing.T) {
+	// Pairs and blocks of one color, which survive shared chroma.
+	src := bitmap(palette,
+		"rrbb",
+		"rrbb",
+	)
+
+	for _, pf := range []framebuffer.PixelFormat{
+		{Depth: 16, FourCC: framebuffer.FourCCYUYV},
+		{Depth: 12, FourCC: framebuffer.FourCCNV12},
+	} {
+		f, err := NewFrame(src, pf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Bounds() != image.Rect(0, 0, 4, 2) {
+			t.Fatalf("%T: bounds %v", f.img, f.Bounds())
+		}
+
+		pt := image.Pt(2, 0)
+		dst := newImage(t, pf, 8, 4)
+		f.Draw(dst, pt)
+
+		want := newImage(t, pf, 8, 4)
+		draw.Draw(want, src.Bounds().Add(pt), src, image.Point{}, draw.Src)
+		compare(t, "yuv", dst, want)
+
+		if a := New(f); !a.Collides(New(f)) {
+			t.Errorf("%T: sprite does not collide with itself", f.img)
+		}
+	}
+}
+
+func TestFrameFlip(t *testing.T) {
+	src := bitmap(palette,
+		"rb.",
+		"mmg",
+	)
+
+	f, err := NewFrame(src, formats["RGBA"], &Options{Alpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		flip Flip
+		want *image.NRGBA
+	}{
+		{0, src},
+		{FlipH, bitmap(palette, ".br", "gmm")},
+		{FlipV, bitmap(palette, "mmg", "rb.")},
+		{FlipH | FlipV, bitmap(palette, "gmm", ".br")},
+	} {
+		ff := f.Flipped(tc.flip)
+		if ff != f.Flipped(tc.flip) {
+			t.Errorf("flip %d: not cached", tc.flip)
+		}
+
+		dst := image.NewRGBA(ff.Bounds())
+		ff.Draw(dst, image.Point{})
+
+		want := image.NewRGBA(ff.Bounds())
+		draw.Draw(want, want.Bounds(), tc.want, image.Point{}, draw.Over)
+		compare(t, "flip", dst, want)
+
+		if ff.Opaque(2, 0) != (tc.flip != 0) {
+			t.Errorf("flip %d: mask not flipped", tc.flip)
+		}
+	}
+}
+
+func TestSheet(t *testing.T) {
+	src := bitmap(palette,
+		"rrbbmmr",
+		"rrbbmmr",
+		"bbrrggr",
+		"bbrrggr",
+		"rrrrrrr",
+	)
+
+	frames, err := Sheet(src.SubImage(image.Rect(0, 0, 7, 5)), image.Pt(2, 2), formats["RGB565"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 6 {
+		t.Fatalf("have %d frames, want 6", len(frames))
+	}
+
+	for i, want := range []color.Color{red, blue, magenta, blue, red, color.NRGBA{0, 0x80, 0, 0xff}} {
+		f := frames[i]
+		if f.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Fatalf("frame %d: bounds %v", i, f.Bounds())
+		}
+
+		have := f.Image().At(1, 1)
+		if !sameColor(have, want, 8) {
+			t.Errorf("frame %d: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	var frames []*Frame
+	for i := 0; i < 3; i++ {
+		f, _ := NewFrame(image.NewRGBA(image.Rect(0, 0, i+1, 1)), formats["RGBA"], nil)
+		frames = append(frames, f)
+	}
+
+	s := New(frames[0])
+	s.Update(time.Hour)
+	if s.Frame() != frames[0] {
+		t.Fatal("single frame changed")
+	}
+
+	a := &Animation{Frames: frames, Delay: 100 * time.Millisecond}
+	s.Play(a)
+
+	for _, step := range []struct {
+		dt    time.Duration
+		frame int
+	}{
+		{50 * time.Millisecond, 0},
+		{50 * time.Millisecond, 1},
+		{150 * time.Millisecond, 2},
+		{time.Second, 2},
+	} {
+		s.Update(step.dt)
+		if s.Frame() != frames[step.frame] {
+			t.Fatalf("after %v: have frame %v, want %d", step.dt, s.Frame().Bounds(), step.frame)
+		}
+	}
+
+	if !s.Done() {
+		t.Error("animation not done")
+	}
+
+	a.Loop = true
+	s.Play(a)
+	s.Update(350 * time.Millisecond)
+	if s.Frame() != frames[0] || s.Done() {
+		t.Errorf("loop: have frame %v", s.Frame().Bounds())
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// Two L shapes which fit into each other.
+	l, err := NewFrame(bitmap(palette,
+		"r..",
+		"r..",
+		"rrr",
+	), formats["BGRA"], &Options{Alpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := NewFrame(bitmap(palette,
+		"bbb",
+		"..b",
+		"..b",
+	), formats["BGRA"], &Options{Alpha: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := New(l), New(j)
+	b.Pos = image.Pt(1, -1)
+
+	if !a.Overlaps(b) {
+		t.Error("bounding boxes do not overlap")
+	}
+	if a.Collides(b) || b.Collides(a) {
+		t.Error("pixels collide")
+	}
+
+	b.Pos = image.Pt(0, 0)
+	if !a.Collides(b) {
+		t.Error("pixels do not collide")
+	}
+
+	// Only the bounding boxes touch, until b is flipped.
+	b.Pos = image.Pt(2, 0)
+	if a.Collides(b) {
+		t.Error("pixels collide at the edge")
+	}
+
+	b.Flip = FlipH | FlipV
+	if !a.Collides(b) {
+		t.Error("flipped pixels do not collide")
+	}
+	b.Flip = 0
+
+	b.Pos = image.Pt(3, 0)
+	if a.Overlaps(b) {
+		t.Error("adjacent sprites overlap")
+	}
+
+	b.Pos = image.Pt(0, 0)
+	b.Hidden = true
+	if a.Collides(b) {
+		t.Error("hidden sprite collides")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	pf := formats["RGB565"]
+	f, err := NewFrame(bitmap(palette, "rr", "rr"), pf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b Batch
+	b.Background = image.NewUniform(bg)
+
+	s1, s2, s3 := New(f), New(f), New(f)
+	s2.Pos = image.Pt(1, 1)
+	s3.Pos = image.Pt(6, 6)
+	b.Add(s1, s2, s3)
+
+	dst := newImage(t, pf, 4, 4)
+	b.Draw(dst)
+
+	want := newImage(t, pf, 4, 4)
+	draw.Draw(want, want.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(want, image.Rect(0, 0, 3, 3), image.NewUniform(red), image.Point{}, draw.Src)
+	want.Set(2, 0, bg)
+	want.Set(0, 2, bg)
+	compare(t, "batch", dst, want)
+
+	hits := b.Collisions(s1)
+	if len(hits) != 1 || hits[0] != s2 {
+		t.Errorf("collisions: have %v", hits)
+	}
+
+	b.Remove(s2)
+	if len(b.Sprites()) != 2 || len(b.Collisions(s1)) != 0 {
+		t.Errorf("remove: have %d sprites", len(b.Sprites()))
+	}
+}
+
+func newImage(t *testing.T, pf framebuffer.PixelFormat, w, h int) draw.Image {
+	img, err := framebuffer.NewImage(pf, image.Rect(0, 0, w, h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func compare(t *testing.T, name string, have, want image.Image) {
+	t.Helper()
+
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !sameColor(have.At(x, y), want.At(x, y), 8) {
+				t.Fatalf("%s: pixel %d,%d: have %v, want %v", name, x, y, have.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+// sameColor compares colors with a tolerance per 8-bit channel,
+// which allows for rounding in 16-bit formats.
+func sameColor(a, b color.Color, tolerance int) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+
+	for _, d := range []int{
+		int(ar>>8) - int(br>>8), int(ag>>8) - int(bg>>8),
+		int(ab>>8) - int(bb>>8), int(aa>>8) - int(ba>>8),
+	} {
+		if d < -tolerance || d > tolerance {
+			return false
+		}
+	}
+	return true
+}
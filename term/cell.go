@@ -0,0 +1,68 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+// Attr holds the rendering attributes of a cell.
+type Attr uint8
+
+// Known attributes.
+const (
+	AttrBold Attr = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+// Color is a cell color. It is either the default color, an index
+// into the 256 color palette, or a 24-bit truecolor value.
+type Color uint32
+
+const (
+	colorIndexed = 1 << 24
+	colorRGB     = 2 << 24
+	colorKind    = 3 << 24
+)
+
+// DefaultColor selects the default foreground or background color.
+const DefaultColor Color = 0
+
+// Indexed returns the palette color with the given index.
+// Indices 0-15 are the standard and bright ANSI colors.
+func Indexed(n uint8) Color {
+	return colorIndexed | Color(n)
+}
+
+// RGB returns a truecolor value.
+func RGB(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// IsDefault returns true if c is the default color.
+func (c Color) IsDefault() bool { return c&colorKind == 0 }
+
+// IsIndexed returns true if c is a palette color.
+func (c Color) IsIndexed() bool { return c&colorKind == colorIndexed }
+
+// IsRGB returns true if c is a truecolor value.
+func (c Color) IsRGB() bool { return c&colorKind == colorRGB }
+
+// Index returns the palette index of an indexed color.
+func (c Color) Index() uint8 { return uint8(c) }
+
+// RGB returns the components of a truecolor value.
+func (c Color) RGB() (r, g, b uint8) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c)
+}
+
+// Cell is a single character cell on the screen.
+type Cell struct {
+	Rune rune  // Character in the cell. Zero for an empty cell.
+	FG   Color // Foreground color.
+	BG   Color // Background color.
+	Attr Attr  // Rendering attributes.
+}
@@ -0,0 +1,179 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/sparques/framebuffer/font"
+)
+
+// Console runs a program in a pseudo-terminal and displays its
+// output in a rectangle of an image, usually the framebuffer.
+//
+// Output is parsed in the background, but only drawn when Draw is
+// called. This keeps all drawing on the caller's goroutine. Updates
+// signals when there is something new to draw.
+type Console struct {
+	Terminal *Terminal // Terminal state of the program.
+	Renderer *Renderer // Draws the terminal.
+
+	cmd     *exec.Cmd
+	pty     *os.File
+	updates chan struct{}
+	done    chan struct{} // Closed when all output has been read.
+
+	mu      sync.Mutex
+	waitErr error
+	waited  bool
+}
+
+// NewConsole starts cmd in a new pseudo-terminal, sized to fit the
+// rectangle r of dst with the given font.
+//
+// The standard input, output and error of cmd are connected to the
+// terminal and must not be set by the caller. The program becomes a
+// session leader with the terminal as its controlling terminal.
+func NewConsole(cmd *exec.Cmd, f *font.Font, dst draw.Image, r image.Rectangle) (*Console, error) {
+	if cmd.Stdin != nil || cmd.Stdout != nil || cmd.Stderr != nil {
+		return nil, errors.New("NewConsole: cmd already has standard streams")
+	}
+
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	defer slave.Close()
+
+	c := &Console{
+		cmd:     cmd,
+		pty:     master,
+		updates: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	c.Terminal = New(1, 1)
+	c.Terminal.SetReply(master)
+	c.Renderer = NewRenderer(c.Terminal, f, dst, r)
+
+	cols, rows := c.Renderer.GridSize()
+	c.Terminal.Resize(cols, rows)
+
+	err = setWinsize(master, cols, rows, c.Renderer.rect.Dx(), c.Renderer.rect.Dy())
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0 // Child's stdin.
+
+	err = cmd.Start()
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	go c.read()
+	return c, nil
+}
+
+// read copies program output into the terminal until the program
+// and all of its children have closed the terminal.
+func (c *Console) read() {
+	defer close(c.done)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.pty.Read(buf)
+		if n > 0 {
+			c.Terminal.Write(buf[:n])
+
+			select {
+			case c.updates <- struct{}{}:
+			default:
+			}
+		}
+
+		if err != nil {
+			return // EIO once the other side is closed.
+		}
+	}
+}
+
+// Updates returns a channel which receives a value whenever new output
+// is available to be drawn. Values are coalesced, so one receive may
+// stand for several updates.
+func (c *Console) Updates() <-chan struct{} {
+	return c.updates
+}
+
+// Draw draws any changes to the console.
+func (c *Console) Draw() {
+	c.Renderer.Draw()
+}
+
+// Write sends keyboard input to the program.
+func (c *Console) Write(p []byte) (int, error) {
+	return c.pty.Write(p)
+}
+
+// Resize moves the console to the rectangle r of the image. The terminal
+// is resized to fit and the program is notified of the new size.
+func (c *Console) Resize(r image.Rectangle) error {
+	c.Renderer.SetRect(r)
+
+	cols, rows := c.Renderer.GridSize()
+	c.Terminal.Resize(cols, rows)
+
+	return setWinsize(c.pty, cols, rows, c.Renderer.rect.Dx(), c.Renderer.rect.Dy())
+}
+
+// Wait waits for the program to exit and for all of its output to be
+// processed. It returns the program's exit status, like exec.Cmd.Wait.
+func (c *Console) Wait() error {
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.waited {
+		c.waitErr = c.cmd.Wait()
+		c.waited = true
+	}
+
+	return c.waitErr
+}
+
+// Close kills the program if it is still running and releases the terminal.
+func (c *Console) Close() error {
+	c.mu.Lock()
+	if !c.waited && c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.mu.Unlock()
+
+	err := c.pty.Close()
+	c.Wait()
+
+	if errors.Is(err, os.ErrClosed) {
+		err = nil
+	}
+	return err
+}
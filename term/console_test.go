@@ -0,0 +1,100 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"image"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runConsole runs a shell script in a console of 20x6 cells.
+func runConsole(t *testing.T, script string) (*Console, *image.RGBA) {
+	img := image.NewRGBA(image.Rect(0, 0, 20*8, 6*8))
+	c, err := NewConsole(exec.Command("/bin/sh", "-c", script), testFont(t), img, img.Bounds())
+	if err != nil {
+		t.Skipf("no pseudo-terminal available: %v", err)
+	}
+
+	t.Cleanup(func() { c.Close() })
+	return c, img
+}
+
+// waitFor waits until the given line of the console reads want.
+func waitFor(t *testing.T, c *Console, y int, want string) {
+	deadline := time.After(5 * time.Second)
+
+	for c.Terminal.Line(y) != want {
+		select {
+		case <-c.Updates():
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("line %d: have %q, want %q", y, c.Terminal.Line(y), want)
+		}
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	c, img := runConsole(t, `printf 'hello\033[1;31m red\033[m\n'; stty size`)
+
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Draw()
+
+	// Compare with a snapshot of the same output rendered directly.
+	want, _, _ := renderPlain(t, "hello\x1b[1;31m red\x1b[m\r\n6 20\r\n")
+	compare(t, img, want)
+}
+
+func TestConsoleInput(t *testing.T) {
+	c, _ := runConsole(t, `read x; echo "got $x"; read y`)
+
+	c.Write([]byte("abc\r"))
+	waitFor(t, c, 1, "got abc")
+
+	c.Write([]byte("\r"))
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsoleResize(t *testing.T) {
+	c, _ := runConsole(t, `read x; stty size`)
+
+	err := c.Resize(image.Rect(0, 0, 10*8, 4*8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Write([]byte("\r"))
+	c.Wait()
+
+	if cols, rows := c.Terminal.Size(); cols != 10 || rows != 4 {
+		t.Errorf("terminal size: have %dx%d, want 10x4", cols, rows)
+	}
+
+	if line := c.Terminal.Line(1); strings.TrimSpace(line) != "4 10" {
+		t.Errorf("stty size: have %q, want \"4 10\"", line)
+	}
+}
+
+func TestConsoleClose(t *testing.T) {
+	c, _ := runConsole(t, `sleep 60`)
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the program")
+	}
+}
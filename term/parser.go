@@ -0,0 +1,543 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Parser states.
+const (
+	stateGround = iota
+	stateEscape
+	stateCharset // ESC ( and friends: skip one byte.
+	stateCSI
+	stateString       // OSC, DCS, APC, PM and SOS strings: ignored.
+	stateStringEscape // ESC seen inside a string.
+)
+
+const maxParams = 16
+
+// parser is the escape sequence state machine. It follows the
+// DEC VT500 parser model, simplified to what xterm-like programs use.
+type parser struct {
+	state   int
+	params  [maxParams]int
+	nparams int
+	hasDig  bool // Digits seen for the current parameter.
+	private byte // Private marker, e.g. '?' in CSI ? 25 h.
+	inter   byte // Intermediate byte, e.g. ' ' in CSI 2 SP q.
+
+	utf8 [utf8.UTFMax]byte // Partial UTF-8 sequence.
+	nutf int
+}
+
+func (p *parser) feed(t *Terminal, b byte) {
+	// Strings swallow everything until their terminator.
+	switch p.state {
+	case stateString:
+		switch b {
+		case 0x07:
+			p.state = stateGround
+		case 0x1b:
+			p.state = stateStringEscape
+		}
+		return
+
+	case stateStringEscape:
+		// ESC \ terminates the string. Anything else aborts it and
+		// is handled as a new escape sequence.
+		p.state = stateGround
+		if b == '\\' {
+			return
+		}
+		p.state = stateEscape
+		p.escape(t, b)
+		return
+	}
+
+	if b < 0x20 || b == 0x7f {
+		p.control(t, b)
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		p.print(t, b)
+
+	case stateEscape:
+		p.escape(t, b)
+
+	case stateCharset:
+		p.state = stateGround
+
+	case stateCSI:
+		p.csiByte(t, b)
+	}
+}
+
+// control executes a C0 control character.
+func (p *parser) control(t *Terminal, b byte) {
+	switch b {
+	case 0x1b: // ESC
+		p.nutf = 0
+		p.state = stateEscape
+		return
+
+	case 0x18, 0x1a: // CAN, SUB
+		p.state = stateGround
+
+	case 0x08: // BS
+		if t.cur.x > 0 {
+			t.cur.x--
+		}
+		t.wrapNext = false
+
+	case 0x09: // HT
+		t.cur.x = min((t.cur.x/8+1)*8, t.cols-1)
+
+	case 0x0a, 0x0b, 0x0c: // LF, VT, FF
+		t.lineFeed()
+		t.wrapNext = false
+
+	case 0x0d: // CR
+		t.cur.x = 0
+		t.wrapNext = false
+	}
+}
+
+// print handles a printable byte, decoding UTF-8 along the way.
+func (p *parser) print(t *Terminal, b byte) {
+	if b < utf8.RuneSelf && p.nutf == 0 {
+		t.put(rune(b))
+		return
+	}
+
+	p.utf8[p.nutf] = b
+	p.nutf++
+
+	if !utf8.FullRune(p.utf8[:p.nutf]) {
+		if p.nutf == len(p.utf8) {
+			p.nutf = 0
+			t.put(utf8.RuneError)
+		}
+		return
+	}
+
+	r, _ := utf8.DecodeRune(p.utf8[:p.nutf])
+	p.nutf = 0
+	t.put(r)
+}
+
+// escape handles the byte following an ESC.
+func (p *parser) escape(t *Terminal, b byte) {
+	p.state = stateGround
+
+	switch b {
+	case '[':
+		p.state = stateCSI
+		p.nparams = 0
+		p.hasDig = false
+		p.private = 0
+		p.inter = 0
+		p.params[0] = 0
+
+	case ']', 'P', '_', '^', 'X':
+		p.state = stateString
+
+	case '(', ')', '*', '+', '#', '%':
+		p.state = stateCharset
+
+	case '7': // DECSC
+		t.saved = t.cur
+
+	case '8': // DECRC
+		t.cur = t.saved
+		t.moveTo(t.cur.x, t.cur.y-t.originTop())
+
+	case 'D': // IND
+		t.lineFeed()
+
+	case 'E': // NEL
+		t.cur.x = 0
+		t.lineFeed()
+
+	case 'M': // RI
+		t.reverseLineFeed()
+
+	case 'c': // RIS
+		t.reset()
+	}
+}
+
+// csiByte collects the parameters of a control sequence
+// and dispatches it when the final byte arrives.
+func (p *parser) csiByte(t *Terminal, b byte) {
+	switch {
+	case b >= '0' && b <= '9':
+		if p.nparams < maxParams {
+			p.params[p.nparams] = min(p.params[p.nparams]*10+int(b-'0'), 65535)
+			p.hasDig = true
+		}
+
+	case b == ';' || b == ':':
+		if p.nparams < maxParams {
+			if !p.hasDig {
+				p.params[p.nparams] = -1
+			}
+			p.nparams++
+			if p.nparams < maxParams {
+				p.params[p.nparams] = 0
+			}
+		}
+		p.hasDig = false
+
+	case b >= '<' && b <= '?':
+		p.private = b
+
+	case b >= 0x20 && b <= 0x2f:
+		p.inter = b
+
+	case b >= 0x40 && b <= 0x7e:
+		if p.nparams < maxParams {
+			if !p.hasDig {
+				p.params[p.nparams] = -1
+			}
+			p.nparams++
+		}
+
+		p.state = stateGround
+		p.dispatch(t, b)
+	}
+}
+
+// param returns parameter i, or def if it is missing or zero.
+func (p *parser) param(i, def int) int {
+	if i >= p.nparams || p.params[i] <= 0 {
+		return def
+	}
+
+	return p.params[i]
+}
+
+// dispatch executes a complete control sequence.
+func (p *parser) dispatch(t *Terminal, final byte) {
+	if p.inter != 0 {
+		return // No supported sequence uses intermediates.
+	}
+
+	if p.private == '?' {
+		switch final {
+		case 'h':
+			p.setMode(t, true)
+		case 'l':
+			p.setMode(t, false)
+		}
+		return
+	}
+
+	if p.private != 0 {
+		return
+	}
+
+	n := p.param(0, 1)
+
+	switch final {
+	case 'A': // CUU
+		t.cur.y = max(t.cur.y-n, p.upperBound(t))
+		t.wrapNext = false
+
+	case 'B', 'e': // CUD, VPR
+		t.cur.y = min(t.cur.y+n, p.lowerBound(t))
+		t.wrapNext = false
+
+	case 'C', 'a': // CUF, HPR
+		t.cur.x = min(t.cur.x+n, t.cols-1)
+		t.wrapNext = false
+
+	case 'D': // CUB
+		t.cur.x = max(t.cur.x-n, 0)
+		t.wrapNext = false
+
+	case 'E': // CNL
+		t.cur.x = 0
+		t.cur.y = min(t.cur.y+n, p.lowerBound(t))
+		t.wrapNext = false
+
+	case 'F': // CPL
+		t.cur.x = 0
+		t.cur.y = max(t.cur.y-n, p.upperBound(t))
+		t.wrapNext = false
+
+	case 'G', '`': // CHA, HPA
+		t.moveTo(n-1, t.cur.y-t.originTop())
+
+	case 'H', 'f': // CUP, HVP
+		t.moveTo(p.param(1, 1)-1, n-1)
+
+	case 'd': // VPA
+		t.moveTo(t.cur.x, n-1)
+
+	case 'J': // ED
+		pos := t.cur.y*t.cols + t.cur.x
+		switch p.param(0, 0) {
+		case 0:
+			t.erase(pos, len(t.cells))
+		case 1:
+			t.erase(0, pos+1)
+		case 2, 3:
+			t.erase(0, len(t.cells))
+		}
+
+	case 'K': // EL
+		row := t.cur.y * t.cols
+		switch p.param(0, 0) {
+		case 0:
+			t.erase(row+t.cur.x, row+t.cols)
+		case 1:
+			t.erase(row, row+t.cur.x+1)
+		case 2:
+			t.erase(row, row+t.cols)
+		}
+
+	case 'L': // IL
+		if t.cur.y >= t.top && t.cur.y <= t.bottom {
+			t.scrollDown(t.cur.y, n)
+			t.cur.x = 0
+		}
+
+	case 'M': // DL
+		if t.cur.y >= t.top && t.cur.y <= t.bottom {
+			t.scrollUp(t.cur.y, n)
+			t.cur.x = 0
+		}
+
+	case '@': // ICH
+		row := t.cells[t.cur.y*t.cols : (t.cur.y+1)*t.cols]
+		n = min(n, t.cols-t.cur.x)
+		copy(row[t.cur.x+n:], row[t.cur.x:])
+		t.erase(t.cur.y*t.cols+t.cur.x, t.cur.y*t.cols+t.cur.x+n)
+		t.damageCols(t.cur.x, t.cols)
+
+	case 'P': // DCH
+		row := t.cells[t.cur.y*t.cols : (t.cur.y+1)*t.cols]
+		n = min(n, t.cols-t.cur.x)
+		copy(row[t.cur.x:], row[t.cur.x+n:])
+		t.erase((t.cur.y+1)*t.cols-n, (t.cur.y+1)*t.cols)
+		t.damageCols(t.cur.x, t.cols)
+
+	case 'X': // ECH
+		pos := t.cur.y*t.cols + t.cur.x
+		t.erase(pos, pos+min(n, t.cols-t.cur.x))
+
+	case 'S': // SU
+		t.scrollUp(t.top, n)
+
+	case 'T': // SD
+		t.scrollDown(t.top, n)
+
+	case 'm': // SGR
+		p.sgr(t)
+
+	case 'r': // DECSTBM
+		top := p.param(0, 1) - 1
+		bottom := p.param(1, t.rows) - 1
+		if top < bottom && bottom < t.rows {
+			t.top, t.bottom = top, bottom
+			t.moveTo(0, 0)
+		}
+
+	case 's': // SCOSC
+		t.saved = t.cur
+
+	case 'u': // SCORC
+		t.cur = t.saved
+		t.moveTo(t.cur.x, t.cur.y-t.originTop())
+
+	case 'n': // DSR
+		switch p.param(0, 0) {
+		case 5:
+			t.respond("\x1b[0n")
+		case 6:
+			t.respond(fmt.Sprintf("\x1b[%d;%dR", t.cur.y-t.originTop()+1, t.cur.x+1))
+		}
+
+	case 'c': // DA
+		if p.param(0, 0) == 0 {
+			t.respond("\x1b[?62;22c")
+		}
+	}
+}
+
+// setMode handles DEC private mode changes.
+func (p *parser) setMode(t *Terminal, on bool) {
+	for i := 0; i < p.nparams; i++ {
+		switch p.params[i] {
+		case 6: // DECOM
+			t.origin = on
+			t.moveTo(0, 0)
+		case 7: // DECAWM
+			t.noWrap = !on
+		case 25: // DECTCEM
+			t.hidden = !on
+		case 47, 1047:
+			t.setAltScreen(on, false)
+		case 1049:
+			t.setAltScreen(on, true)
+		}
+	}
+}
+
+// sgr handles Select Graphic Rendition.
+func (p *parser) sgr(t *Terminal) {
+	c := &t.cur
+
+	for i := 0; i < p.nparams; i++ {
+		v := p.params[i]
+		if v < 0 {
+			v = 0
+		}
+
+		switch {
+		case v == 0:
+			c.fg, c.bg, c.attr = DefaultColor, DefaultColor, 0
+		case v == 1:
+			c.attr |= AttrBold
+		case v == 2:
+			c.attr |= AttrDim
+		case v == 3:
+			c.attr |= AttrItalic
+		case v == 4:
+			c.attr |= AttrUnderline
+		case v == 5 || v == 6:
+			c.attr |= AttrBlink
+		case v == 7:
+			c.attr |= AttrReverse
+		case v == 8:
+			c.attr |= AttrHidden
+		case v == 9:
+			c.attr |= AttrStrike
+		case v == 21 || v == 22:
+			c.attr &^= AttrBold | AttrDim
+		case v == 23:
+			c.attr &^= AttrItalic
+		case v == 24:
+			c.attr &^= AttrUnderline
+		case v == 25:
+			c.attr &^= AttrBlink
+		case v == 27:
+			c.attr &^= AttrReverse
+		case v == 28:
+			c.attr &^= AttrHidden
+		case v == 29:
+			c.attr &^= AttrStrike
+		case v >= 30 && v <= 37:
+			c.fg = Indexed(uint8(v - 30))
+		case v == 38:
+			c.fg, i = p.extColor(i, c.fg)
+		case v == 39:
+			c.fg = DefaultColor
+		case v >= 40 && v <= 47:
+			c.bg = Indexed(uint8(v - 40))
+		case v == 48:
+			c.bg, i = p.extColor(i, c.bg)
+		case v == 49:
+			c.bg = DefaultColor
+		case v >= 90 && v <= 97:
+			c.fg = Indexed(uint8(v - 90 + 8))
+		case v >= 100 && v <= 107:
+			c.bg = Indexed(uint8(v - 100 + 8))
+		}
+	}
+}
+
+// extColor parses a 256 color or truecolor specification following
+// SGR 38 or 48 at index i. It returns the color and the index of the
+// last parameter consumed.
+func (p *parser) extColor(i int, old Color) (Color, int) {
+	arg := func(n int) int {
+		if n >= p.nparams || p.params[n] < 0 {
+			return 0
+		}
+		return min(p.params[n], 255)
+	}
+
+	if i+1 >= p.nparams {
+		return old, i
+	}
+
+	switch p.params[i+1] {
+	case 5:
+		return Indexed(uint8(arg(i + 2))), i + 2
+	case 2:
+		return RGB(uint8(arg(i+2)), uint8(arg(i+3)), uint8(arg(i+4))), i + 4
+	}
+
+	return old, i + 1
+}
+
+// upperBound returns the topmost row relative cursor movement can reach.
+func (p *parser) upperBound(t *Terminal) int {
+	if t.cur.y >= t.top {
+		return t.top
+	}
+	return 0
+}
+
+// lowerBound returns the bottom row relative cursor movement can reach.
+func (p *parser) lowerBound(t *Terminal) int {
+	if t.cur.y <= t.bottom {
+		return t.bottom
+	}
+	return t.rows - 1
+}
+
+// originTop returns the row cursor addressing is relative to.
+func (t *Terminal) originTop() int {
+	if t.origin {
+		return t.top
+	}
+	return 0
+}
+
+// damageCols marks columns [from, to) of the cursor row as dirty.
+func (t *Terminal) damageCols(from, to int) {
+	row := t.cur.y * t.cols
+	for i := row + from; i < row+to; i++ {
+		t.dirty[i] = true
+	}
+}
+
+// respond queues a reply to a status query, if anyone is listening.
+func (t *Terminal) respond(s string) {
+	if t.reply == nil || len(t.replies)+len(s) > maxReplies {
+		return
+	}
+
+	t.replies = append(t.replies, s...)
+	if !t.replying {
+		t.replying = true
+		go t.sendReplies()
+	}
+}
+
+// sendReplies writes queued replies until there are none left.
+// The lock is not held while writing, as the reader of the replies
+// may be waiting for its output to be consumed by Write.
+func (t *Terminal) sendReplies() {
+	for {
+		t.mu.Lock()
+		p, w := t.replies, t.reply
+		t.replies = nil
+		if len(p) == 0 || w == nil {
+			t.replying = false
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		w.Write(p)
+	}
+}
@@ -0,0 +1,201 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/sparques/framebuffer/font"
+)
+
+// Renderer draws a Terminal onto a rectangle of an image.
+type Renderer struct {
+	Palette [256]color.RGBA // Indexed colors. Initialized to the xterm palette.
+	FG      color.RGBA      // Default foreground color.
+	BG      color.RGBA      // Default background color.
+
+	term *Terminal
+	font *font.Font
+	dst  draw.Image
+	rect image.Rectangle
+
+	cx, cy  int  // Where the cursor was last drawn.
+	cursor  bool // Cursor was drawn.
+	drawn   bool // Initial full draw was done.
+	lastCol int  // Terminal width at the last draw.
+	lastRow int  // Terminal height at the last draw.
+}
+
+// NewRenderer creates a renderer which draws t onto the rectangle r of
+// dst, using the given font. Cells which do not fit in r are clipped.
+func NewRenderer(t *Terminal, f *font.Font, dst draw.Image, r image.Rectangle) *Renderer {
+	return &Renderer{
+		Palette: xtermPalette(),
+		FG:      color.RGBA{0xaa, 0xaa, 0xaa, 0xff},
+		BG:      color.RGBA{0x00, 0x00, 0x00, 0xff},
+		term:    t,
+		font:    f,
+		dst:     dst,
+		rect:    r.Intersect(dst.Bounds()),
+	}
+}
+
+// SetRect moves the renderer to the rectangle r of its image.
+// The next call to Draw redraws everything.
+func (r *Renderer) SetRect(rect image.Rectangle) {
+	r.rect = rect.Intersect(r.dst.Bounds())
+	r.drawn = false
+}
+
+// GridSize returns the number of cells which fit in the
+// renderer's rectangle. Use this to size the terminal.
+func (r *Renderer) GridSize() (cols, rows int) {
+	return r.rect.Dx() / r.font.Width, r.rect.Dy() / r.font.Height
+}
+
+// Draw redraws all cells which changed since the previous call.
+// The first call draws the whole terminal.
+func (r *Renderer) Draw() {
+	cols, rows := r.term.Size()
+	if !r.drawn || cols != r.lastCol || rows != r.lastRow {
+		r.Redraw()
+		return
+	}
+
+	r.draw()
+}
+
+// Redraw draws the whole terminal, regardless of what changed.
+func (r *Renderer) Redraw() {
+	draw.Draw(r.dst, r.rect, image.NewUniform(r.BG), image.Point{}, draw.Src)
+
+	r.term.mu.Lock()
+	r.term.damageAll()
+	r.lastCol, r.lastRow = r.term.cols, r.term.rows
+	r.term.mu.Unlock()
+
+	r.drawn = true
+	r.cursor = false
+	r.draw()
+}
+
+func (r *Renderer) draw() {
+	t := r.term
+	x, y, visible := t.Cursor()
+
+	// Erase the old cursor by redrawing the cell underneath.
+	if r.cursor && (r.cx != x || r.cy != y || !visible) {
+		r.drawCell(r.cx, r.cy, t.Cell(r.cx, r.cy), false)
+		r.cursor = false
+	}
+
+	t.Damage(func(cx, cy int, c Cell) {
+		r.drawCell(cx, cy, c, visible && cx == x && cy == y)
+	})
+
+	if visible && !r.cursor {
+		r.drawCell(x, y, t.Cell(x, y), true)
+	}
+
+	r.cx, r.cy, r.cursor = x, y, visible
+}
+
+// drawCell draws a single cell, optionally with the cursor on top.
+func (r *Renderer) drawCell(x, y int, c Cell, cursor bool) {
+	f := r.font
+	pt := r.rect.Min.Add(image.Pt(x*f.Width, y*f.Height))
+	fg, bg := r.colors(c)
+
+	if cursor {
+		fg, bg = bg, fg
+	}
+
+	cell := image.Rect(pt.X, pt.Y, pt.X+f.Width, pt.Y+f.Height)
+	draw.Draw(r.dst, cell.Intersect(r.rect), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	if c.Rune != 0 && c.Rune != ' ' && c.Attr&AttrHidden == 0 {
+		idx, ok := f.Index(c.Rune)
+		if !ok {
+			idx, _ = f.Index('?')
+		}
+
+		f.DrawGlyph(r.dst, r.rect, pt, idx, fg, nil)
+	}
+
+	if c.Attr&AttrUnderline != 0 {
+		line := image.Rect(cell.Min.X, cell.Max.Y-1, cell.Max.X, cell.Max.Y)
+		draw.Draw(r.dst, line.Intersect(r.rect), image.NewUniform(fg), image.Point{}, draw.Src)
+	}
+
+	if c.Attr&AttrStrike != 0 {
+		mid := cell.Min.Y + f.Height/2
+		line := image.Rect(cell.Min.X, mid, cell.Max.X, mid+1)
+		draw.Draw(r.dst, line.Intersect(r.rect), image.NewUniform(fg), image.Point{}, draw.Src)
+	}
+}
+
+// colors resolves the foreground and background colors of a cell.
+func (r *Renderer) colors(c Cell) (fg, bg color.RGBA) {
+	fgc := c.FG
+
+	// Bold text with one of the basic colors uses the bright variant.
+	if c.Attr&AttrBold != 0 && fgc.IsIndexed() && fgc.Index() < 8 {
+		fgc = Indexed(fgc.Index() + 8)
+	}
+
+	fg = r.resolve(fgc, r.FG)
+	bg = r.resolve(c.BG, r.BG)
+
+	if c.Attr&AttrDim != 0 {
+		fg = color.RGBA{fg.R / 2, fg.G / 2, fg.B / 2, fg.A}
+	}
+
+	if c.Attr&AttrReverse != 0 {
+		fg, bg = bg, fg
+	}
+
+	return
+}
+
+func (r *Renderer) resolve(c Color, def color.RGBA) color.RGBA {
+	switch {
+	case c.IsIndexed():
+		return r.Palette[c.Index()]
+	case c.IsRGB():
+		cr, cg, cb := c.RGB()
+		return color.RGBA{cr, cg, cb, 0xff}
+	}
+
+	return def
+}
+
+// xtermPalette returns the default xterm 256 color palette.
+func xtermPalette() (p [256]color.RGBA) {
+	base := [16][3]uint8{
+		{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}, {0x00, 0xcd, 0x00}, {0xcd, 0xcd, 0x00},
+		{0x00, 0x00, 0xee}, {0xcd, 0x00, 0xcd}, {0x00, 0xcd, 0xcd}, {0xe5, 0xe5, 0xe5},
+		{0x7f, 0x7f, 0x7f}, {0xff, 0x00, 0x00}, {0x00, 0xff, 0x00}, {0xff, 0xff, 0x00},
+		{0x5c, 0x5c, 0xff}, {0xff, 0x00, 0xff}, {0x00, 0xff, 0xff}, {0xff, 0xff, 0xff},
+	}
+
+	for i, c := range base {
+		p[i] = color.RGBA{c[0], c[1], c[2], 0xff}
+	}
+
+	// 6x6x6 color cube.
+	levels := [6]uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+	for i := 0; i < 216; i++ {
+		p[16+i] = color.RGBA{levels[i/36], levels[(i/6)%6], levels[i%6], 0xff}
+	}
+
+	// Grayscale ramp.
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + i*10)
+		p[232+i] = color.RGBA{v, v, v, 0xff}
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/sparques/framebuffer/font"
+)
+
+var update = flag.Bool("update", false, "Update golden images.")
+
+// testFont builds an 8x8 PSF2 font with 128 glyphs and no Unicode
+// table. Each glyph has a distinct pattern derived from its index.
+func testFont(t *testing.T) *font.Font {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{0x864ab572, 0, 32, 0, 128, 8, 8, 8})
+
+	for n := 0; n < 128; n++ {
+		glyph := make([]byte, 8)
+		if n > ' ' {
+			for y := 1; y < 7; y++ {
+				glyph[y] = byte(n*(y+3)) | 0x81
+			}
+		}
+		buf.Write(glyph)
+	}
+
+	f, err := font.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// render renders the given terminal output onto a new image,
+// with a two pixel border around the terminal.
+func render(t *testing.T, data []byte) (*image.RGBA, *Terminal, *Renderer) {
+	f := testFont(t)
+	img := image.NewRGBA(image.Rect(0, 0, 20*8+4, 6*8+4))
+	term := New(20, 6)
+	r := NewRenderer(term, f, img, img.Bounds().Inset(2))
+
+	term.Write(data)
+	r.Draw()
+	return img, term, r
+}
+
+// renderPlain renders the given terminal output onto a new image,
+// without a border.
+func renderPlain(t *testing.T, data string) (*image.RGBA, *Terminal, *Renderer) {
+	f := testFont(t)
+	img := image.NewRGBA(image.Rect(0, 0, 20*8, 6*8))
+	term := New(20, 6)
+	r := NewRenderer(term, f, img, img.Bounds())
+
+	term.Write([]byte(data))
+	r.Draw()
+	return img, term, r
+}
+
+func TestRenderGolden(t *testing.T) {
+	data, err := os.ReadFile("testdata/session.vt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, _, _ := render(t, data)
+	golden := "testdata/session.png"
+
+	if *update {
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		os.WriteFile(golden, buf.Bytes(), 0644)
+	}
+
+	fd, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	want, err := png.Decode(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, img, want)
+}
+
+func TestRenderIncremental(t *testing.T) {
+	data, err := os.ReadFile("testdata/session.vt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Draw in two steps, then compare with a single full draw.
+	half := len(data) / 2
+	img, term, r := render(t, data[:half])
+	term.Write(data[half:])
+	r.Draw()
+
+	full, _, _ := render(t, data)
+	compare(t, img, full)
+}
+
+func compare(t *testing.T, have *image.RGBA, want image.Image) {
+	if have.Bounds() != want.Bounds() {
+		t.Fatalf("bounds: have %v, want %v", have.Bounds(), want.Bounds())
+	}
+
+	b := have.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			hr, hg, hb, ha := have.At(x, y).RGBA()
+			wr, wg, wb, wa := want.At(x, y).RGBA()
+			if hr != wr || hg != wg || hb != wb || ha != wa {
+				t.Fatalf("pixel %d,%d: have %v, want %v", x, y, have.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package term implements a terminal emulator which can be drawn
+// onto the framebuffer.
+//
+// A Terminal parses a VT100/ANSI/xterm escape stream into a grid of
+// character cells. A Renderer draws that grid onto a rectangle of any
+// draw.Image, such as the one returned by Canvas.Image(), using a
+// bitmap console font. Only cells which changed are redrawn.
+package term
+
+import (
+	"io"
+	"sync"
+)
+
+// cursor holds the cursor position and the attributes used for new text.
+type cursor struct {
+	x, y   int
+	fg, bg Color
+	attr   Attr
+}
+
+// Terminal is the state of a virtual terminal screen.
+// It implements io.Writer and is safe for concurrent use.
+type Terminal struct {
+	mu sync.Mutex
+
+	cols, rows int
+	cells      []Cell // Active screen.
+	main       []Cell // Main screen.
+	alt        []Cell // Alternate screen.
+	dirty      []bool // Cells changed since the last call to Damage.
+	altActive  bool   // Alternate screen is active.
+
+	cur      cursor // Cursor and current attributes.
+	saved    cursor // Cursor saved by DECSC.
+	altSaved cursor // Cursor saved when entering the alternate screen.
+	wrapNext bool   // Next printed rune wraps to a new line first.
+	hidden   bool   // Cursor is hidden.
+	noWrap   bool   // Autowrap is disabled.
+	origin   bool   // Origin mode: cursor addressing is relative to the scroll region.
+
+	top, bottom int // Scroll region, inclusive.
+
+	parser   parser
+	reply    io.Writer // Receives responses to status queries.
+	replies  []byte    // Responses not yet written to reply.
+	replying bool      // A goroutine is writing replies.
+}
+
+// maxReplies limits the responses waiting to be written. Beyond it,
+// the program is not reading them, and further ones are dropped.
+const maxReplies = 4096
+
+// New creates a terminal with the given size in cells.
+func New(cols, rows int) *Terminal {
+	t := new(Terminal)
+	t.resize(cols, rows)
+	return t
+}
+
+// SetReply sets the writer which receives responses to device status
+// queries, such as cursor position reports. This is normally the input
+// of the program whose output is written to the terminal.
+//
+// Responses are written from a separate goroutine, so Write does not
+// block when the program does not read its input.
+func (t *Terminal) SetReply(w io.Writer) {
+	t.mu.Lock()
+	t.reply = w
+	t.mu.Unlock()
+}
+
+// Size returns the size of the terminal in cells.
+func (t *Terminal) Size() (cols, rows int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cols, t.rows
+}
+
+// Cell returns the cell at the given position.
+func (t *Terminal) Cell(x, y int) Cell {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if x < 0 || y < 0 || x >= t.cols || y >= t.rows {
+		return Cell{}
+	}
+
+	return t.cells[y*t.cols+x]
+}
+
+// Cursor returns the cursor position and whether it is visible.
+func (t *Terminal) Cursor() (x, y int, visible bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cur.x, t.cur.y, !t.hidden
+}
+
+// AltScreen returns true if the alternate screen is active.
+func (t *Terminal) AltScreen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.altActive
+}
+
+// Line returns the text on the given row, with trailing blanks removed.
+func (t *Terminal) Line(y int) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if y < 0 || y >= t.rows {
+		return ""
+	}
+
+	row := t.cells[y*t.cols : (y+1)*t.cols]
+	end := len(row)
+	for end > 0 && (row[end-1].Rune == 0 || row[end-1].Rune == ' ') {
+		end--
+	}
+
+	buf := make([]rune, end)
+	for i, c := range row[:end] {
+		buf[i] = c.Rune
+		if c.Rune == 0 {
+			buf[i] = ' '
+		}
+	}
+
+	return string(buf)
+}
+
+// Resize changes the size of the terminal. Content is kept where it
+// fits. The scroll region is reset and the whole screen is marked dirty.
+func (t *Terminal) Resize(cols, rows int) {
+	t.mu.Lock()
+	t.resize(cols, rows)
+	t.mu.Unlock()
+}
+
+func (t *Terminal) resize(cols, rows int) {
+	if cols < 1 {
+		cols = 1
+	}
+
+	if rows < 1 {
+		rows = 1
+	}
+
+	t.main = resizeCells(t.main, t.cols, t.rows, cols, rows)
+	t.alt = resizeCells(t.alt, t.cols, t.rows, cols, rows)
+	t.cols, t.rows = cols, rows
+	t.cells = t.main
+	if t.altActive {
+		t.cells = t.alt
+	}
+
+	t.dirty = make([]bool, cols*rows)
+	t.damageAll()
+
+	t.top, t.bottom = 0, rows-1
+	t.wrapNext = false
+
+	// Saved cursors are restored without checks, so they must fit too.
+	for _, c := range []*cursor{&t.cur, &t.saved, &t.altSaved} {
+		c.x = clamp(c.x, 0, cols-1)
+		c.y = clamp(c.y, 0, rows-1)
+	}
+}
+
+func resizeCells(old []Cell, ocols, orows, cols, rows int) []Cell {
+	cells := make([]Cell, cols*rows)
+
+	for y := 0; y < rows && y < orows; y++ {
+		copy(cells[y*cols:y*cols+min(cols, ocols)], old[y*ocols:])
+	}
+
+	return cells
+}
+
+// Damage calls fn for every cell which changed since the previous call,
+// then marks all cells as clean. The terminal is locked while fn runs.
+func (t *Terminal) Damage(fn func(x, y int, c Cell)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, d := range t.dirty {
+		if d {
+			fn(i%t.cols, i/t.cols, t.cells[i])
+			t.dirty[i] = false
+		}
+	}
+}
+
+// Write parses the given terminal output and updates the screen.
+// It always consumes all of p.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range p {
+		t.parser.feed(t, b)
+	}
+
+	return len(p), nil
+}
+
+// Reset restores the terminal to its initial state.
+func (t *Terminal) Reset() {
+	t.mu.Lock()
+	t.reset()
+	t.mu.Unlock()
+}
+
+func (t *Terminal) reset() {
+	t.altActive = false
+	t.cells = t.main
+	t.cur = cursor{}
+	t.saved = cursor{}
+	t.wrapNext = false
+	t.hidden = false
+	t.noWrap = false
+	t.origin = false
+	t.top, t.bottom = 0, t.rows-1
+	t.parser = parser{}
+	t.erase(0, len(t.cells))
+}
+
+// damageAll marks every cell as dirty.
+func (t *Terminal) damageAll() {
+	for i := range t.dirty {
+		t.dirty[i] = true
+	}
+}
+
+// blank returns an empty cell in the current background color.
+func (t *Terminal) blank() Cell {
+	return Cell{BG: t.cur.bg}
+}
+
+// erase clears cells [from, to) of the screen.
+func (t *Terminal) erase(from, to int) {
+	from = clamp(from, 0, len(t.cells))
+	to = clamp(to, from, len(t.cells))
+
+	b := t.blank()
+	for i := from; i < to; i++ {
+		t.cells[i] = b
+		t.dirty[i] = true
+	}
+}
+
+// put writes r at the cursor position and advances the cursor.
+func (t *Terminal) put(r rune) {
+	if t.wrapNext {
+		t.wrapNext = false
+		t.cur.x = 0
+		t.lineFeed()
+	}
+
+	i := t.cur.y*t.cols + t.cur.x
+	t.cells[i] = Cell{Rune: r, FG: t.cur.fg, BG: t.cur.bg, Attr: t.cur.attr}
+	t.dirty[i] = true
+
+	if t.cur.x < t.cols-1 {
+		t.cur.x++
+	} else if !t.noWrap {
+		t.wrapNext = true
+	}
+}
+
+// lineFeed moves the cursor down, scrolling at the bottom of the scroll region.
+func (t *Terminal) lineFeed() {
+	if t.cur.y == t.bottom {
+		t.scrollUp(t.top, 1)
+	} else if t.cur.y < t.rows-1 {
+		t.cur.y++
+	}
+}
+
+// reverseLineFeed moves the cursor up, scrolling at the top of the scroll region.
+func (t *Terminal) reverseLineFeed() {
+	if t.cur.y == t.top {
+		t.scrollDown(t.top, 1)
+	} else if t.cur.y > 0 {
+		t.cur.y--
+	}
+}
+
+// scrollUp moves rows [from, bottom] up by n lines. New lines are blank.
+func (t *Terminal) scrollUp(from, n int) {
+	if from < t.top || from > t.bottom {
+		return
+	}
+
+	n = clamp(n, 0, t.bottom-from+1)
+	start := from * t.cols
+	end := (t.bottom + 1) * t.cols
+
+	copy(t.cells[start:end], t.cells[start+n*t.cols:end])
+	t.erase(end-n*t.cols, end)
+	t.damageRows(from, t.bottom)
+}
+
+// scrollDown moves rows [from, bottom] down by n lines. New lines are blank.
+func (t *Terminal) scrollDown(from, n int) {
+	if from < t.top || from > t.bottom {
+		return
+	}
+
+	n = clamp(n, 0, t.bottom-from+1)
+	start := from * t.cols
+	end := (t.bottom + 1) * t.cols
+
+	copy(t.cells[start+n*t.cols:end], t.cells[start:end])
+	t.erase(start, start+n*t.cols)
+	t.damageRows(from, t.bottom)
+}
+
+// damageRows marks rows [from, to] as dirty.
+func (t *Terminal) damageRows(from, to int) {
+	for i := from * t.cols; i < (to+1)*t.cols; i++ {
+		t.dirty[i] = true
+	}
+}
+
+// moveTo moves the cursor to the given position, honouring origin mode.
+func (t *Terminal) moveTo(x, y int) {
+	minY, maxY := 0, t.rows-1
+	if t.origin {
+		y += t.top
+		minY, maxY = t.top, t.bottom
+	}
+
+	t.cur.x = clamp(x, 0, t.cols-1)
+	t.cur.y = clamp(y, minY, maxY)
+	t.wrapNext = false
+}
+
+// setAltScreen switches between the main and alternate screen.
+func (t *Terminal) setAltScreen(on, saveCursor bool) {
+	if on == t.altActive {
+		return
+	}
+
+	if on {
+		if saveCursor {
+			t.altSaved = t.cur
+		}
+
+		t.altActive = true
+		t.cells = t.alt
+		t.erase(0, len(t.cells))
+	} else {
+		t.altActive = false
+		t.cells = t.main
+
+		if saveCursor {
+			t.cur = t.altSaved
+		}
+	}
+
+	t.wrapNext = false
+	t.damageAll()
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+
+	if v > hi {
+		return hi
+	}
+
+	return v
+}
@@ -0,0 +1,172 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package term
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordedSession(t *testing.T) {
+	data, err := os.ReadFile("testdata/session.vt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	term := New(20, 6)
+
+	// Feed the data in small chunks, to exercise partial sequences.
+	for len(data) > 0 {
+		n := min(3, len(data))
+		term.Write(data[:n])
+		data = data[n:]
+	}
+
+	want := []string{
+		"top line",
+		"",
+		"scroll 1",
+		"scroll 2",
+		"scroll 3",
+		"         end",
+	}
+
+	for y, line := range want {
+		if have := term.Line(y); have != line {
+			t.Errorf("line %d: have %q, want %q", y, have, line)
+		}
+	}
+
+	if x, y, _ := term.Cursor(); x != 12 || y != 5 {
+		t.Errorf("cursor at %d,%d, want 12,5", x, y)
+	}
+
+	if term.AltScreen() {
+		t.Errorf("alternate screen still active")
+	}
+
+	if c := term.Cell(0, 5); c.BG != Indexed(4) || c.Rune != ' ' {
+		t.Errorf("cell 0,5: have %+v", c)
+	}
+}
+
+func TestSGR(t *testing.T) {
+	term := New(10, 1)
+	term.Write([]byte("\x1b[1;31ma\x1b[38;5;82;48;2;1;2;3mb\x1b[0;7mc\x1b[mr"))
+
+	for x, want := range []Cell{
+		{Rune: 'a', FG: Indexed(1), Attr: AttrBold},
+		{Rune: 'b', FG: Indexed(82), BG: RGB(1, 2, 3), Attr: AttrBold},
+		{Rune: 'c', Attr: AttrReverse},
+		{Rune: 'r'},
+	} {
+		if have := term.Cell(x, 0); have != want {
+			t.Errorf("cell %d: have %+v, want %+v", x, have, want)
+		}
+	}
+}
+
+func TestWrapAndUTF8(t *testing.T) {
+	term := New(4, 2)
+	term.Write([]byte("abcdé\xe2\x82"))
+	term.Write([]byte("\xac"))
+
+	if term.Line(0) != "abcd" || term.Line(1) != "é€" {
+		t.Errorf("have %q / %q", term.Line(0), term.Line(1))
+	}
+
+	// Writing past the end scrolls.
+	term.Write([]byte("fg\r\nxy"))
+	if term.Line(0) != "é€fg" || term.Line(1) != "xy" {
+		t.Errorf("after scroll: have %q / %q", term.Line(0), term.Line(1))
+	}
+}
+
+func TestEditing(t *testing.T) {
+	term := New(8, 3)
+	term.Write([]byte("abcdefgh\r\n12345678\r\nxyz"))
+
+	term.Write([]byte("\x1b[1;3H\x1b[2P")) // Delete "cd".
+	term.Write([]byte("\x1b[2;2H\x1b[1@")) // Insert a blank before "2".
+	term.Write([]byte("\x1b[3;2H\x1b[K"))  // Erase after "x".
+	term.Write([]byte("\x1b[1;1H\x1b[1L")) // Insert a line at the top.
+
+	want := []string{"", "abefgh", "1 234567"}
+	for y, line := range want {
+		if have := term.Line(y); have != line {
+			t.Errorf("line %d: have %q, want %q", y, have, line)
+		}
+	}
+}
+
+func TestStatusReports(t *testing.T) {
+	r, w := io.Pipe()
+
+	term := New(10, 5)
+	term.SetReply(w)
+	term.Write([]byte("\x1b[3;4H\x1b[6n"))
+
+	reply := make([]byte, 6)
+	if _, err := io.ReadFull(r, reply); err != nil || string(reply) != "\x1b[3;4R" {
+		t.Errorf("cursor report: have %q, %v", reply, err)
+	}
+
+	// Nobody reads the replies, which must not block the output.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			term.Write([]byte("\x1b[5n"))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked on unread replies")
+	}
+
+	// The queued replies follow, once they are read.
+	if _, err := io.ReadFull(r, reply[:4]); err != nil || string(reply[:4]) != "\x1b[0n" {
+		t.Errorf("status report: have %q, %v", reply[:4], err)
+	}
+}
+
+func TestDamage(t *testing.T) {
+	term := New(4, 2)
+	term.Damage(func(x, y int, c Cell) {})
+
+	term.Write([]byte("\x1b[2;2Hx"))
+
+	var n int
+	term.Damage(func(x, y int, c Cell) {
+		n++
+		if x != 1 || y != 1 || c.Rune != 'x' {
+			t.Errorf("unexpected damage at %d,%d: %+v", x, y, c)
+		}
+	})
+
+	if n != 1 {
+		t.Errorf("have %d damaged cells, want 1", n)
+	}
+}
+
+func TestResizeSavedCursors(t *testing.T) {
+	term := New(80, 24)
+
+	// Cursors saved before shrinking are restored inside the screen.
+	term.Write([]byte("\x1b[24;80H\x1b[?1049h\x1b[20;70H\x1b7"))
+	term.Resize(40, 10)
+	term.Write([]byte("\x1b8Y\x1b[?1049lX"))
+
+	if x, y, _ := term.Cursor(); x != 39 || y != 9 {
+		t.Errorf("cursor at %d,%d, want 39,9", x, y)
+	}
+	if term.Line(9) != strings.Repeat(" ", 39)+"X" {
+		t.Errorf("last line %q", term.Line(9))
+	}
+}
@@ -0,0 +1,50 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package termview
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// writeHalfBlocks draws the cells of the given rows which changed.
+// Each cell shows two pixels: the upper one as the foreground color
+// of "▀", and the lower one as the background.
+func (v *View) writeHalfBlocks(rows []int) error {
+	for _, r := range rows {
+		var fg, bg color.RGBA
+		var styled bool
+		next := -1 // Column the cursor is at.
+
+		for x := 0; x < v.area.X; x++ {
+			top := v.frame.RGBAAt(x, 2*r)
+			bottom := v.frame.RGBAAt(x, 2*r+1)
+
+			if v.prev != nil && v.prev.RGBAAt(x, 2*r) == top && v.prev.RGBAAt(x, 2*r+1) == bottom {
+				continue
+			}
+
+			if x != next {
+				v.moveTo(r, x)
+			}
+
+			if !styled || top != fg {
+				fmt.Fprintf(v.w, "\x1b[38;2;%d;%d;%dm", top.R, top.G, top.B)
+			}
+			if !styled || bottom != bg {
+				fmt.Fprintf(v.w, "\x1b[48;2;%d;%d;%dm", bottom.R, bottom.G, bottom.B)
+			}
+
+			v.w.WriteString("▀")
+			fg, bg, styled = top, bottom, true
+			next = x + 1
+		}
+
+		if styled {
+			v.w.WriteString("\x1b[0m")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package termview
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+)
+
+// writeITerm2 draws the given rows as iTerm2 inline images, one for
+// each run of consecutive rows. Their size is given in pixels, so the
+// terminal does not scale them.
+func (v *View) writeITerm2(rows []int) error {
+	for _, run := range runs(rows) {
+		r := image.Rect(0, run[0]*v.cell.Y, v.frame.Rect.Dx(), run[1]*v.cell.Y)
+		data, err := v.encodePNG(r)
+		if err != nil {
+			return err
+		}
+
+		v.moveTo(run[0], 0)
+		fmt.Fprintf(v.w, "\x1b]1337;File=inline=1;size=%d;width=%dpx;height=%dpx;preserveAspectRatio=0;doNotMoveCursor=1:%s\a",
+			len(data), r.Dx(), r.Dy(), base64.StdEncoding.EncodeToString(data))
+	}
+
+	return nil
+}
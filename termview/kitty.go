@@ -0,0 +1,61 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package termview
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// writeKitty draws the given rows with the Kitty graphics protocol.
+// Each row of cells is a separate image, with the row number plus one
+// as its id, so that a changed row replaces the image shown before.
+func (v *View) writeKitty(rows []int) error {
+	for _, r := range rows {
+		data, err := v.encodePNG(image.Rect(0, r*v.cell.Y, v.frame.Rect.Dx(), (r+1)*v.cell.Y))
+		if err != nil {
+			return err
+		}
+
+		id := r + 1
+		fmt.Fprintf(v.w, "\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", id)
+		v.moveTo(r, 0)
+
+		// Data is sent in chunks of at most 4096 bytes of base64, and
+		// the cursor stays where it is, so nothing scrolls.
+		enc := base64.StdEncoding.EncodeToString(data)
+		for first := true; first || len(enc) > 0; first = false {
+			chunk := enc[:min(len(enc), 4096)]
+			enc = enc[len(chunk):]
+
+			more := 0
+			if len(enc) > 0 {
+				more = 1
+			}
+
+			if first {
+				fmt.Fprintf(v.w, "\x1b_Ga=T,f=100,i=%d,q=2,C=1,m=%d;%s\x1b\\", id, more, chunk)
+			} else {
+				fmt.Fprintf(v.w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+			}
+		}
+	}
+
+	return nil
+}
+
+// encodePNG returns the area r of the frame as a PNG image.
+func (v *View) encodePNG(r image.Rectangle) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+
+	if err := enc.Encode(&buf, v.frame.SubImage(r)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
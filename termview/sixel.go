@@ -0,0 +1,154 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package termview
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// writeSixel draws the given rows as sixel images, one for each run
+// of consecutive rows.
+func (v *View) writeSixel(rows []int) error {
+	for _, run := range runs(rows) {
+		// Sixels are six pixels high. Rather than leave the last ones
+		// of a run blank, they are filled from the rows below it.
+		y0, y1 := run[0]*v.cell.Y, run[1]*v.cell.Y
+		y1 = min(y0+(y1-y0+5)/6*6, v.frame.Rect.Dy())
+
+		v.moveTo(run[0], 0)
+		encodeSixel(v.w, v.frame, image.Rect(0, y0, v.frame.Rect.Dx(), y1))
+	}
+
+	return nil
+}
+
+// encodeSixel writes the area r of img as a sixel image. Images with
+// up to 256 colors are exact; others use a 6x6x6 color cube.
+func encodeSixel(w *bufio.Writer, img *image.RGBA, r image.Rectangle) {
+	pal, idx := sixelPalette(img, r)
+	width, height := r.Dx(), r.Dy()
+
+	// Pixels of the background remain as they are, and
+	// the raster attributes make them square.
+	fmt.Fprintf(w, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range pal {
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, percent(c.R), percent(c.G), percent(c.B))
+	}
+
+	var lines [256][]byte
+	var seen [256]bool
+	var used []uint8
+
+	for y := 0; y < height; y += 6 {
+		if y > 0 {
+			w.WriteByte('-')
+		}
+
+		// Gather the six bits of each column, for each color.
+		used = used[:0]
+		for k := 0; k < 6 && y+k < height; k++ {
+			for x, c := range idx[(y+k)*width : (y+k+1)*width] {
+				if lines[c] == nil {
+					lines[c] = make([]byte, width)
+				}
+				if !seen[c] {
+					seen[c] = true
+					used = append(used, c)
+				}
+				lines[c][x] |= 1 << k
+			}
+		}
+
+		for i, c := range used {
+			if i > 0 {
+				w.WriteByte('$')
+			}
+			fmt.Fprintf(w, "#%d", c)
+
+			line := lines[c]
+			for x := range line {
+				line[x] += '?'
+			}
+			writeRuns(w, bytes.TrimRight(line, "?"))
+			clear(line)
+			seen[c] = false
+		}
+	}
+
+	w.WriteString("\x1b\\")
+}
+
+// sixelPalette returns the colors of the area r of img, and the
+// index of each pixel in it.
+func sixelPalette(img *image.RGBA, r image.Rectangle) ([]color.RGBA, []uint8) {
+	idx := make([]uint8, 0, r.Dx()*r.Dy())
+	colors := make(map[color.RGBA]uint8)
+	var pal []color.RGBA
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			i, ok := colors[c]
+			if !ok {
+				if len(pal) == 256 {
+					return cubePalette(img, r)
+				}
+
+				i = uint8(len(pal))
+				colors[c] = i
+				pal = append(pal, c)
+			}
+			idx = append(idx, i)
+		}
+	}
+
+	return pal, idx
+}
+
+// cubePalette maps the area r of img onto a 6x6x6 color cube.
+func cubePalette(img *image.RGBA, r image.Rectangle) ([]color.RGBA, []uint8) {
+	pal := make([]color.RGBA, 0, 216)
+	for i := 0; i < 216; i++ {
+		pal = append(pal, color.RGBA{uint8(i / 36 * 51), uint8(i / 6 % 6 * 51), uint8(i % 6 * 51), 0xff})
+	}
+
+	level := func(v uint8) uint8 { return uint8((int(v) + 25) / 51) }
+
+	idx := make([]uint8, 0, r.Dx()*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			idx = append(idx, level(c.R)*36+level(c.G)*6+level(c.B))
+		}
+	}
+
+	return pal, idx
+}
+
+// writeRuns writes sixels, compressing repeats.
+func writeRuns(w *bufio.Writer, line []byte) {
+	for len(line) > 0 {
+		n := 1
+		for n < len(line) && line[n] == line[0] {
+			n++
+		}
+
+		if n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, line[0])
+		} else {
+			w.Write(line[:n])
+		}
+		line = line[n:]
+	}
+}
+
+// percent converts a color component to the 0-100 range of sixel
+// palettes.
+func percent(v uint8) int {
+	return (int(v)*100 + 127) / 255
+}
@@ -0,0 +1,404 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package termview shows the screen in a terminal, for developing
+// over ssh, where the framebuffer can not be seen. Combined with a
+// memory canvas, programs run unchanged against either the device
+// or the terminal.
+//
+// Images are drawn with DEC Sixel graphics, the Kitty graphics protocol
+// or iTerm2 inline images. Other terminals get Unicode half blocks in
+// 24-bit color, which show two pixels per character cell.
+package termview
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Source provides the contents of the screen. It is implemented
+// by *framebuffer.Canvas.
+type Source interface {
+	Snapshot(r image.Rectangle) (*image.RGBA, error)
+}
+
+// Protocol selects how images are sent to the terminal.
+type Protocol int
+
+// Known protocols.
+const (
+	Auto      Protocol = iota // Pick one with Detect.
+	HalfBlock                 // Unicode upper half blocks, in 24-bit color.
+	Sixel                     // DEC Sixel graphics.
+	Kitty                     // Kitty graphics protocol.
+	ITerm2                    // iTerm2 inline images.
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case Auto:
+		return "auto"
+	case HalfBlock:
+		return "half block"
+	case Sixel:
+		return "sixel"
+	case Kitty:
+		return "kitty"
+	case ITerm2:
+		return "iterm2"
+	}
+	return fmt.Sprintf("Protocol(%d)", int(p))
+}
+
+// Detect guesses the best protocol the terminal supports, from the
+// environment variables it sets. Terminals can not be asked without
+// reading their replies from the input, which belongs to the program,
+// so terminals which are not recognised get half blocks.
+func Detect() Protocol {
+	term := os.Getenv("TERM")
+	prog := os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty", term == "xterm-ghostty":
+		return Kitty
+	case prog == "iTerm.app", prog == "WezTerm", os.Getenv("LC_TERMINAL") == "iTerm2":
+		return ITerm2
+	case strings.Contains(term, "sixel"), term == "foot", term == "mlterm", term == "yaft-256color":
+		return Sixel
+	}
+
+	return HalfBlock
+}
+
+// Options configures a View.
+type Options struct {
+	// Protocol is the way images are sent. Auto uses Detect.
+	Protocol Protocol
+
+	// Cols and Rows are the size of the terminal, in cells. Zero
+	// asks the terminal, if the output is one, or assumes 80x24.
+	Cols, Rows int
+
+	// CellSize is the size of a cell, in pixels. It does not matter
+	// for half blocks. The zero value asks the terminal, or assumes
+	// 8x16.
+	CellSize image.Point
+
+	// Rate is the number of times per second the screen is shown.
+	// Zero means 10 times. If it is negative, the screen is only
+	// shown when Update is called.
+	Rate float64
+}
+
+// View shows a Source in a terminal.
+//
+// The screen is scaled to fit the terminal, keeping its aspect ratio.
+// Only the rows of cells which changed since the last update are sent
+// again. The last row of the terminal is left alone, so that drawing
+// never scrolls it.
+type View struct {
+	w     *bufio.Writer
+	src   Source
+	proto Protocol
+	cols  int         // Size of the terminal area, in cells.
+	rows  int         //
+	cell  image.Point // Size of a cell, in pixels of the scaled frame.
+
+	mu    sync.Mutex
+	size  image.Point     // Size of the source, in pixels.
+	dst   image.Rectangle // Scaled image, in pixels of the frame.
+	area  image.Point     // Size of the frame, in cells.
+	prev  *image.RGBA     // Frame last shown, scaled.
+	frame *image.RGBA     // Frame being shown.
+	err   error           // Error of the last automatic update.
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a view of src, drawing on w; usually os.Stdout. It hides
+// the cursor until Close. Opts may be nil.
+func New(w io.Writer, src Source, opts *Options) (*View, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Protocol == Auto {
+		o.Protocol = Detect()
+	}
+
+	cols, rows, cell := terminalSize(w)
+	if o.Cols > 0 {
+		cols = o.Cols
+	}
+	if o.Rows > 0 {
+		rows = o.Rows
+	}
+	if o.CellSize.X > 0 && o.CellSize.Y > 0 {
+		cell = o.CellSize
+	}
+
+	// The last row is kept free.
+	if rows > 1 {
+		rows--
+	}
+
+	if o.Protocol == HalfBlock {
+		cell = image.Pt(1, 2)
+	}
+
+	v := &View{
+		w:     bufio.NewWriterSize(w, 64<<10),
+		src:   src,
+		proto: o.Protocol,
+		cols:  cols,
+		rows:  rows,
+		cell:  cell,
+		done:  make(chan struct{}),
+	}
+
+	v.w.WriteString("\x1b[?25l")
+	if err := v.Update(); err != nil {
+		return nil, err
+	}
+
+	if o.Rate >= 0 {
+		rate := o.Rate
+		if rate == 0 {
+			rate = 10
+		}
+
+		v.wg.Add(1)
+		go v.run(time.Duration(float64(time.Second) / rate))
+	}
+
+	return v, nil
+}
+
+// Protocol returns the protocol in use.
+func (v *View) Protocol() Protocol {
+	return v.proto
+}
+
+// Err returns the error of the last update made at the view's rate,
+// if it failed.
+func (v *View) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.err
+}
+
+func (v *View) run(period time.Duration) {
+	defer v.wg.Done()
+
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := v.Update()
+
+			v.mu.Lock()
+			v.err = err
+			v.mu.Unlock()
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// Close stops updating the view. The last frame stays on the terminal,
+// and the cursor is shown again, below it.
+func (v *View) Close() error {
+	select {
+	case <-v.done:
+		return nil
+	default:
+	}
+
+	close(v.done)
+	v.wg.Wait()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(v.w, "\x1b[%d;1H\x1b[?25h", v.area.Y+1)
+	return v.w.Flush()
+}
+
+// Update shows the current contents of the screen.
+func (v *View) Update() error {
+	img, err := v.src.Snapshot(image.Rectangle{})
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if img.Rect.Size() != v.size {
+		v.layout(img.Rect.Size())
+	}
+
+	v.scale(img)
+
+	rows := v.changedRows()
+	if len(rows) == 0 {
+		v.prev, v.frame = v.frame, v.prev
+		return nil
+	}
+
+	// Keep the cursor where the program left it.
+	v.w.WriteString("\x1b7")
+
+	switch v.proto {
+	case Sixel:
+		err = v.writeSixel(rows)
+	case Kitty:
+		err = v.writeKitty(rows)
+	case ITerm2:
+		err = v.writeITerm2(rows)
+	default:
+		err = v.writeHalfBlocks(rows)
+	}
+
+	v.w.WriteString("\x1b8")
+	if err != nil {
+		return err
+	}
+
+	v.prev, v.frame = v.frame, v.prev
+	return v.w.Flush()
+}
+
+// layout fits a source of the given size into the terminal.
+func (v *View) layout(size image.Point) {
+	v.size = size
+
+	// The largest scale at which the image fits.
+	w, h := v.cols*v.cell.X, v.rows*v.cell.Y
+	iw, ih := w, size.Y*w/max(size.X, 1)
+	if ih > h {
+		iw, ih = size.X*h/max(size.Y, 1), h
+	}
+
+	v.dst = image.Rect(0, 0, max(iw, 1), max(ih, 1))
+	v.area = image.Pt(
+		(v.dst.Dx()+v.cell.X-1)/v.cell.X,
+		(v.dst.Dy()+v.cell.Y-1)/v.cell.Y,
+	)
+
+	// The frame covers whole cells; the margin stays black.
+	v.frame = nil
+	v.prev = nil
+
+	if v.proto == Kitty {
+		v.w.WriteString("\x1b_Ga=d,d=A,q=2\x1b\\")
+	}
+	v.w.WriteString("\x1b[2J")
+}
+
+// scale draws img into the frame, at the size chosen by layout.
+func (v *View) scale(img *image.RGBA) {
+	if v.frame == nil {
+		v.frame = image.NewRGBA(image.Rect(0, 0, v.area.X*v.cell.X, v.area.Y*v.cell.Y))
+	}
+
+	if v.dst.Size() == img.Rect.Size() {
+		draw.Draw(v.frame, v.dst, img, img.Rect.Min, draw.Src)
+	} else {
+		xdraw.BiLinear.Scale(v.frame, v.dst, img, img.Rect, draw.Src, nil)
+	}
+
+	// The alpha channel of the screen means nothing.
+	for i := 3; i < len(v.frame.Pix); i += 4 {
+		v.frame.Pix[i] = 0xff
+	}
+}
+
+// changedRows returns the rows of cells which differ from the
+// frame last shown.
+func (v *View) changedRows() []int {
+	var rows []int
+	n := v.frame.Rect.Dx() * 4
+
+	for r := 0; r < v.area.Y; r++ {
+		if v.prev == nil {
+			rows = append(rows, r)
+			continue
+		}
+
+		for y := r * v.cell.Y; y < (r+1)*v.cell.Y; y++ {
+			i := v.frame.PixOffset(0, y)
+			if string(v.frame.Pix[i:i+n]) != string(v.prev.Pix[i:i+n]) {
+				rows = append(rows, r)
+				break
+			}
+		}
+	}
+
+	return rows
+}
+
+// runs groups consecutive rows into ranges [start, end).
+func runs(rows []int) [][2]int {
+	var rs [][2]int
+	for _, r := range rows {
+		if len(rs) > 0 && rs[len(rs)-1][1] == r {
+			rs[len(rs)-1][1]++
+		} else {
+			rs = append(rs, [2]int{r, r + 1})
+		}
+	}
+	return rs
+}
+
+// moveTo moves the cursor to the start of the given row of cells.
+func (v *View) moveTo(row, col int) {
+	fmt.Fprintf(v.w, "\x1b[%d;%dH", row+1, col+1)
+}
+
+// winsize is struct winsize from <asm-generic/termios.h>.
+type winsize struct {
+	row    uint16
+	col    uint16
+	xpixel uint16
+	ypixel uint16
+}
+
+// terminalSize asks the terminal w for its size in cells, and the
+// size of a cell in pixels. Unknown values get common defaults.
+func terminalSize(w io.Writer) (cols, rows int, cell image.Point) {
+	cols, rows, cell = 80, 24, image.Pt(8, 16)
+
+	f, ok := w.(interface{ Fd() uintptr })
+	if !ok {
+		return
+	}
+
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.col == 0 || ws.row == 0 {
+		return
+	}
+
+	cols, rows = int(ws.col), int(ws.row)
+	if ws.xpixel > 0 && ws.ypixel > 0 {
+		cell = image.Pt(int(ws.xpixel)/cols, int(ws.ypixel)/rows)
+	}
+
+	return
+}
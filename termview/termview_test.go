@@ -0,0 +1,457 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package termview
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sparques/framebuffer"
+)
+
+// source is a screen the tests draw on.
+type source struct {
+	img *image.RGBA
+}
+
+func newSource(w, h int, c color.RGBA) *source {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return &source{img: img}
+}
+
+func (s *source) Snapshot(r image.Rectangle) (*image.RGBA, error) {
+	dst := image.NewRGBA(s.img.Rect)
+	copy(dst.Pix, s.img.Pix)
+	return dst, nil
+}
+
+var (
+	red   = color.RGBA{0xff, 0, 0, 0xff}
+	blue  = color.RGBA{0, 0, 0xff, 0xff}
+	green = color.RGBA{0, 0xff, 0, 0xff}
+)
+
+// newView creates a view of src, updated by the test, with 2x2 pixel
+// cells, so that images are not scaled.
+func newView(t *testing.T, src Source, p Protocol, cols, rows int) (*View, *bytes.Buffer) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	v, err := New(&buf, src, &Options{Protocol: p, Cols: cols, Rows: rows, CellSize: image.Pt(2, 2), Rate: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Protocol() != p {
+		t.Fatalf("protocol %v", v.Protocol())
+	}
+
+	return v, &buf
+}
+
+// update updates v and returns what it wrote.
+func update(t *testing.T, v *View, buf *bytes.Buffer) string {
+	t.Helper()
+
+	buf.Reset()
+	if err := v.Update(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+var (
+	cursorPos  = regexp.MustCompile(`\x1b\[(\d+);(\d+)H`)
+	foreground = regexp.MustCompile(`\x1b\[38;2;(\d+);(\d+);(\d+)m`)
+)
+
+func TestHalfBlock(t *testing.T) {
+	src := newSource(4, 4, red)
+	src.img.SetRGBA(1, 1, blue)
+
+	// Two rows of cells, plus the one kept free.
+	v, buf := newView(t, src, HalfBlock, 4, 3)
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "\x1b[?25l") || strings.Count(out, "▀") != 8 {
+		t.Fatalf("first frame: %q", out)
+	}
+	if !strings.Contains(out, "\x1b[48;2;0;0;255m▀") {
+		t.Errorf("lower pixel of cell (1, 0) is not blue: %q", out)
+	}
+
+	if out := update(t, v, buf); out != "" {
+		t.Errorf("unchanged screen: %q", out)
+	}
+
+	// Only the changed cell is drawn.
+	src.img.SetRGBA(2, 2, green)
+	out = update(t, v, buf)
+
+	if strings.Count(out, "▀") != 1 || !strings.Contains(out, "\x1b[2;3H\x1b[38;2;0;255;0m") {
+		t.Errorf("changed cell: %q", out)
+	}
+	if !strings.HasPrefix(out, "\x1b7") || !strings.HasSuffix(out, "\x1b8") {
+		t.Errorf("cursor not kept: %q", out)
+	}
+
+	buf.Reset()
+	v.Close()
+	if buf.String() != "\x1b[3;1H\x1b[?25h" {
+		t.Errorf("close: %q", buf.String())
+	}
+}
+
+func TestScale(t *testing.T) {
+	src := newSource(16, 4, red)
+	for y := 0; y < 4; y++ {
+		for x := 8; x < 16; x++ {
+			src.img.SetRGBA(x, y, blue)
+		}
+	}
+
+	// 16x4 pixels fit 8 columns of 1x2 pixels, in one row.
+	v, buf := newView(t, src, HalfBlock, 8, 10)
+	if v.area != image.Pt(8, 1) {
+		t.Fatalf("area %v", v.area)
+	}
+
+	out := buf.String()
+	m := foreground.FindAllStringSubmatch(out, -1)
+	if len(m) < 2 || m[0][1] != "255" || m[len(m)-1][3] != "255" {
+		t.Errorf("scaled colors: %q", out)
+	}
+}
+
+// sixelImages decodes the sixel images in s, drawing them at the
+// positions of their cursor movements, with cells of the given size.
+func sixelImages(t *testing.T, s string, cell image.Point, dst *image.RGBA) (n int) {
+	t.Helper()
+
+	for {
+		start := strings.Index(s, "\x1bP")
+		if start < 0 {
+			return n
+		}
+
+		pos := cursorPos.FindAllStringSubmatch(s[:start], -1)
+		if len(pos) == 0 {
+			t.Fatal("sixel image without a position")
+		}
+		row, _ := strconv.Atoi(pos[len(pos)-1][1])
+
+		end := strings.Index(s[start:], "\x1b\\")
+		decodeSixel(t, s[start:start+end], image.Pt(0, (row-1)*cell.Y), dst)
+		s = s[start+end:]
+		n++
+	}
+}
+
+func decodeSixel(t *testing.T, s string, at image.Point, dst *image.RGBA) {
+	t.Helper()
+
+	if !strings.HasPrefix(s, "\x1bP0;1;0q\"1;1;") {
+		t.Fatalf("sixel header: %q", s)
+	}
+	s = s[len("\x1bP0;1;0q\"1;1;"):]
+
+	num := func() int {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n, _ := strconv.Atoi(s[:i])
+		s = s[i:]
+		return n
+	}
+
+	num()
+	s = s[1:]
+	num()
+
+	pal := map[int]color.RGBA{}
+	var c color.RGBA
+	x, y := at.X, at.Y
+
+	for len(s) > 0 {
+		ch := s[0]
+		s = s[1:]
+
+		repeat := 1
+		switch {
+		case ch == '#':
+			i := num()
+			if strings.HasPrefix(s, ";2;") {
+				s = s[3:]
+				r := num()
+				s = s[1:]
+				g := num()
+				s = s[1:]
+				b := num()
+				pal[i] = color.RGBA{uint8(r * 255 / 100), uint8(g * 255 / 100), uint8(b * 255 / 100), 0xff}
+			}
+			c = pal[i]
+			continue
+		case ch == '$':
+			x = at.X
+			continue
+		case ch == '-':
+			x, y = at.X, y+6
+			continue
+		case ch == '!':
+			repeat = num()
+			ch = s[0]
+			s = s[1:]
+		case ch < '?' || ch > '~':
+			t.Fatalf("sixel data %q", ch)
+		}
+
+		for ; repeat > 0; repeat-- {
+			for k := 0; k < 6; k++ {
+				if (ch-'?')&(1<<k) != 0 {
+					dst.SetRGBA(x, y+k, c)
+				}
+			}
+			x++
+		}
+	}
+}
+
+func TestSixel(t *testing.T) {
+	src := newSource(8, 16, red)
+	draw.Draw(src.img, image.Rect(2, 3, 5, 12), image.NewUniform(blue), image.Point{}, draw.Src)
+
+	v, buf := newView(t, src, Sixel, 4, 9)
+
+	have := image.NewRGBA(src.img.Rect)
+	if n := sixelImages(t, buf.String(), v.cell, have); n != 1 {
+		t.Fatalf("%d images", n)
+	}
+	if !bytes.Equal(have.Pix, src.img.Pix) {
+		t.Fatalf("decoded image differs")
+	}
+
+	if out := update(t, v, buf); out != "" {
+		t.Errorf("unchanged screen: %q", out)
+	}
+
+	// Rows 2 and 6 of cells change.
+	src.img.SetRGBA(0, 4, green)
+	src.img.SetRGBA(7, 13, green)
+	out := update(t, v, buf)
+
+	if pos := cursorPos.FindAllString(out, -1); len(pos) != 2 || pos[0] != "\x1b[3;1H" || pos[1] != "\x1b[7;1H" {
+		t.Errorf("positions %q", pos)
+	}
+	if n := sixelImages(t, out, v.cell, have); n != 2 {
+		t.Fatalf("%d images", n)
+	}
+	if !bytes.Equal(have.Pix, src.img.Pix) {
+		t.Errorf("decoded update differs")
+	}
+}
+
+func TestSixelColorCube(t *testing.T) {
+	src := newSource(32, 12, red)
+	for i := 0; i < 32*12; i++ {
+		src.img.SetRGBA(i%32, i/32, color.RGBA{uint8(i), uint8(i / 2), 0x80, 0xff})
+	}
+
+	v, buf := newView(t, src, Sixel, 16, 7)
+	defer v.Close()
+
+	have := image.NewRGBA(src.img.Rect)
+	sixelImages(t, buf.String(), v.cell, have)
+
+	// Colors are within half a step of the cube.
+	for i := 0; i < len(have.Pix); i++ {
+		if d := int(have.Pix[i]) - int(src.img.Pix[i]); d < -27 || d > 27 {
+			t.Fatalf("byte %d: have %d, want %d", i, have.Pix[i], src.img.Pix[i])
+		}
+	}
+}
+
+var kittyCommand = regexp.MustCompile(`\x1b_G([^;\x1b]*)(?:;([^\x1b]*))?\x1b\\`)
+
+func TestKitty(t *testing.T) {
+	src := newSource(4, 6, red)
+	src.img.SetRGBA(3, 5, blue)
+
+	v, buf := newView(t, src, Kitty, 2, 4)
+
+	// Each row is an image, with the row number as its id.
+	images := kittyImages(t, buf.String())
+	if len(images) != 3 {
+		t.Fatalf("%d images", len(images))
+	}
+	if images[3].Bounds() != image.Rect(0, 0, 4, 2) || images[3].At(3, 1) != blue {
+		t.Errorf("last row: %v, %v", images[3].Bounds(), images[3].At(3, 1))
+	}
+
+	if out := update(t, v, buf); out != "" {
+		t.Errorf("unchanged screen: %q", out)
+	}
+
+	src.img.SetRGBA(0, 2, green)
+	out := update(t, v, buf)
+	if !strings.Contains(out, "\x1b_Ga=d,d=I,i=2,q=2\x1b\\\x1b[2;1H\x1b_Ga=T,f=100,i=2,") {
+		t.Errorf("row 2 not replaced: %q", out)
+	}
+	if images := kittyImages(t, out); len(images) != 1 || images[2].At(0, 0) != green {
+		t.Errorf("update: %v", images)
+	}
+}
+
+// kittyImages returns the images transmitted in s, by id.
+func kittyImages(t *testing.T, s string) map[int]image.Image {
+	t.Helper()
+
+	images := make(map[int]image.Image)
+	var id int
+	var data string
+
+	for _, m := range kittyCommand.FindAllStringSubmatch(s, -1) {
+		keys := map[string]string{}
+		for _, kv := range strings.Split(m[1], ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			keys[k] = v
+		}
+
+		if keys["a"] == "T" {
+			if keys["f"] != "100" || keys["C"] != "1" {
+				t.Fatalf("command %q", m[1])
+			}
+			id, _ = strconv.Atoi(keys["i"])
+		}
+		if keys["a"] == "d" {
+			continue
+		}
+
+		data += m[2]
+		if keys["m"] == "0" {
+			raw, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img, err := png.Decode(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			images[id] = img
+			data = ""
+		}
+	}
+
+	return images
+}
+
+func TestKittyChunks(t *testing.T) {
+	// Noise does not compress.
+	src := newSource(2000, 8, red)
+	rand.New(rand.NewSource(1)).Read(src.img.Pix)
+
+	v, buf := newView(t, src, Kitty, 1000, 5)
+	defer v.Close()
+
+	if n := strings.Count(buf.String(), "\x1b_Gm=1;"); n == 0 {
+		t.Fatalf("no continued chunks")
+	}
+
+	for _, m := range kittyCommand.FindAllStringSubmatch(buf.String(), -1) {
+		if len(m[2]) > 4096 {
+			t.Fatalf("chunk of %d bytes", len(m[2]))
+		}
+	}
+
+	if images := kittyImages(t, buf.String()); len(images) != 4 {
+		t.Errorf("%d images", len(images))
+	}
+}
+
+func TestITerm2(t *testing.T) {
+	src := newSource(4, 4, red)
+	src.img.SetRGBA(1, 3, blue)
+
+	v, buf := newView(t, src, ITerm2, 2, 3)
+
+	file := regexp.MustCompile(`\x1b\[(\d+);1H\x1b\]1337;File=inline=1;size=(\d+);width=(\d+)px;height=(\d+)px;[^:]*:([^\a]*)\a`)
+	m := file.FindAllStringSubmatch(buf.String(), -1)
+	if len(m) != 1 || m[0][1] != "1" || m[0][3] != "4" || m[0][4] != "4" {
+		t.Fatalf("first frame: %q", buf.String())
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(m[0][5])
+	if size, _ := strconv.Atoi(m[0][2]); size != len(raw) {
+		t.Errorf("size %d of %d bytes", size, len(raw))
+	}
+
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.At(1, 3) != blue {
+		t.Errorf("pixel: %v", img.At(1, 3))
+	}
+
+	src.img.SetRGBA(0, 0, green)
+	if m := file.FindAllStringSubmatch(update(t, v, buf), -1); len(m) != 1 || m[0][1] != "1" || m[0][4] != "2" {
+		t.Errorf("update: %q", m)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, test := range []struct {
+		env  map[string]string
+		want Protocol
+	}{
+		{map[string]string{"TERM": "xterm-256color"}, HalfBlock},
+		{map[string]string{"TERM": "xterm-kitty"}, Kitty},
+		{map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, Kitty},
+		{map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "iTerm.app"}, ITerm2},
+		{map[string]string{"TERM": "foot"}, Sixel},
+		{map[string]string{"TERM": "mlterm"}, Sixel},
+	} {
+		for _, k := range []string{"TERM", "TERM_PROGRAM", "KITTY_WINDOW_ID", "LC_TERMINAL"} {
+			t.Setenv(k, test.env[k])
+		}
+
+		if have := Detect(); have != test.want {
+			t.Errorf("%v: have %v, want %v", test.env, have, test.want)
+		}
+	}
+}
+
+func TestMemoryCanvas(t *testing.T) {
+	var mode framebuffer.DisplayMode
+	mode.Geometry = framebuffer.Geometry{XRes: 8, YRes: 4, Depth: 16}
+	mode.Format = framebuffer.PixelFormat{RedBits: 5, RedShift: 11, GreenBits: 6, GreenShift: 5, BlueBits: 5}
+
+	c, err := framebuffer.NewMemoryCanvas(&mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	img, _ := c.Image()
+	img.Set(3, 2, color.White)
+
+	v, buf := newView(t, c, HalfBlock, 8, 3)
+	defer v.Close()
+
+	if !strings.Contains(buf.String(), "\x1b[38;2;255;255;255m") {
+		t.Errorf("white pixel not drawn: %q", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package text
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// subpixels is the number of horizontal sub-pixel positions
+// at which glyphs are rendered and cached.
+const subpixels = 4
+
+// cacheKey identifies a rendered glyph. A face is specific to a single
+// font and size, so together with the color this is all we need.
+type cacheKey struct {
+	face  font.Face
+	r     rune
+	subpx int
+	color color.RGBA64
+}
+
+// glyph is a rendered, colored glyph.
+type glyph struct {
+	img     *image.RGBA // Nil for blank glyphs such as space.
+	offset  image.Point // Top-left corner, relative to the dot.
+	advance fixed.Int26_6
+}
+
+// Cache holds rendered glyphs, keyed by face, size, sub-pixel position
+// and color. Redrawing the same text from a cache only copies pixels.
+//
+// A cache is safe for concurrent use. When it grows beyond its limit,
+// it is emptied and starts over.
+type Cache struct {
+	mu      sync.Mutex
+	glyphs  map[cacheKey]*glyph
+	limit   int
+	hits    int
+	misses  int
+	scratch *image.Uniform
+}
+
+// DefaultCache is used by Drawers which have no cache of their own.
+var DefaultCache = NewCache(4096)
+
+// NewCache creates a cache holding at most limit glyphs.
+func NewCache(limit int) *Cache {
+	return &Cache{
+		glyphs:  make(map[cacheKey]*glyph),
+		limit:   limit,
+		scratch: image.NewUniform(color.Black),
+	}
+}
+
+// Len returns the number of glyphs in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.glyphs)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Reset empties the cache. This must be called when a cached
+// face is closed, or it would be kept alive by the cache.
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	c.glyphs = make(map[cacheKey]*glyph)
+	c.mu.Unlock()
+}
+
+// glyph returns the rendered glyph for r at the given dot.
+// It returns nil if the face has no such glyph.
+func (c *Cache) glyph(face font.Face, clr color.Color, r rune, dot fixed.Point26_6) *glyph {
+	cr, cg, cb, ca := clr.RGBA()
+	key := cacheKey{
+		face:  face,
+		r:     r,
+		subpx: int(dot.X&63) * subpixels / 64,
+		color: color.RGBA64{uint16(cr), uint16(cg), uint16(cb), uint16(ca)},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if g, ok := c.glyphs[key]; ok {
+		c.hits++
+		return g
+	}
+
+	c.misses++
+
+	// Render at the quantized sub-pixel position, relative to the origin.
+	at := fixed.Point26_6{X: fixed.Int26_6(key.subpx * 64 / subpixels)}
+	dr, mask, maskp, advance, ok := face.Glyph(at, r)
+	if !ok {
+		return nil
+	}
+
+	g := &glyph{offset: dr.Min, advance: advance}
+
+	if !dr.Empty() {
+		c.scratch.C = clr
+		g.img = image.NewRGBA(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+		draw.DrawMask(g.img, g.img.Bounds(), c.scratch, image.Point{}, mask, maskp, draw.Src)
+	}
+
+	if len(c.glyphs) >= c.limit {
+		c.glyphs = make(map[cacheKey]*glyph)
+	}
+
+	c.glyphs[key] = g
+	return g
+}
@@ -0,0 +1,235 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package text draws anti-aliased text with scalable outline fonts.
+//
+// Fonts are supplied as a font.Face from golang.org/x/image/font. For
+// TrueType and OpenType fonts, use golang.org/x/image/font/opentype to
+// create one at the desired size. Text can be drawn onto any draw.Image,
+// including those returned by Canvas.Image() for every pixel format.
+//
+// Rendered glyphs are kept in a Cache, so redrawing text is cheap.
+package text
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Align defines the horizontal alignment of text.
+type Align int
+
+// Known alignments.
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Drawer draws text in a single face and color.
+//
+// Like the faces it uses, a Drawer must not be used
+// from multiple goroutines at the same time.
+type Drawer struct {
+	Face       font.Face   // Font face, which defines font and size.
+	Color      color.Color // Text color. Nil means black.
+	Align      Align       // Horizontal alignment of each line.
+	LineHeight int         // Distance between baselines in pixels. Zero uses the face metrics.
+	Cache      *Cache      // Glyph cache. Nil uses DefaultCache.
+}
+
+// Advance returns the width of a single line of text, including kerning.
+func (d *Drawer) Advance(s string) fixed.Int26_6 {
+	var x fixed.Int26_6
+	prev := rune(-1)
+
+	for _, r := range s {
+		if prev >= 0 {
+			x += d.Face.Kern(prev, r)
+		}
+
+		adv, ok := d.Face.GlyphAdvance(r)
+		if ok {
+			x += adv
+		}
+
+		prev = r
+	}
+
+	return x
+}
+
+// Measure returns the size of the given text in pixels.
+// Each newline starts a new line of text.
+func (d *Drawer) Measure(s string) image.Point {
+	lines := strings.Split(s, "\n")
+
+	var width fixed.Int26_6
+	for _, line := range lines {
+		if adv := d.Advance(line); adv > width {
+			width = adv
+		}
+	}
+
+	return image.Pt(width.Ceil(), len(lines)*d.lineHeight().Ceil())
+}
+
+// Wrap breaks the given text into lines no wider than width pixels.
+// Lines are broken at spaces where possible, and within words if a
+// single word does not fit. Existing newlines are kept.
+func (d *Drawer) Wrap(s string, width int) []string {
+	var lines []string
+	limit := fixed.I(width)
+
+	for _, para := range strings.Split(s, "\n") {
+		var line string
+
+		for _, word := range strings.Fields(para) {
+			try := word
+			if line != "" {
+				try = line + " " + word
+			}
+
+			if d.Advance(try) <= limit {
+				line = try
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			// Break words which do not fit on a line by themselves.
+			for d.Advance(word) > limit && utf8.RuneCountInString(word) > 1 {
+				n := d.fit(word, limit)
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+
+			line = word
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// fit returns the length in bytes of the longest prefix of s which
+// fits in the given width. At least one rune is always included.
+func (d *Drawer) fit(s string, limit fixed.Int26_6) int {
+	_, n := utf8.DecodeRuneInString(s)
+
+	for i := range s {
+		if i > n && d.Advance(s[:i]) > limit {
+			break
+		}
+
+		if i > 0 {
+			n = i
+		}
+	}
+
+	return n
+}
+
+// Draw draws the given text onto dst. Each newline starts a new line.
+//
+// The top of the first line is at pt.Y. Lines start at pt.X when aligned
+// to the left, are centred on it when aligned to the center, and end at
+// it when aligned to the right.
+func (d *Drawer) Draw(dst draw.Image, pt image.Point, s string) {
+	lines := strings.Split(s, "\n")
+	d.drawLines(dst, dst.Bounds(), pt.X, pt.Y, lines)
+}
+
+// DrawBox draws the given text inside the rectangle r. The text is
+// wrapped to fit the width of r, each line is aligned within r and
+// anything outside of r is clipped.
+func (d *Drawer) DrawBox(dst draw.Image, r image.Rectangle, s string) {
+	lines := d.Wrap(s, r.Dx())
+	clip := r.Intersect(dst.Bounds())
+
+	switch d.Align {
+	case AlignCenter:
+		d.drawLines(dst, clip, r.Min.X+r.Dx()/2, r.Min.Y, lines)
+	case AlignRight:
+		d.drawLines(dst, clip, r.Max.X, r.Min.Y, lines)
+	default:
+		d.drawLines(dst, clip, r.Min.X, r.Min.Y, lines)
+	}
+}
+
+// drawLines draws lines of text, with the top of the first line at y.
+// x is the anchor for alignment, as described for Draw.
+func (d *Drawer) drawLines(dst draw.Image, clip image.Rectangle, x, y int, lines []string) {
+	height := d.lineHeight()
+	baseline := fixed.I(y) + d.Face.Metrics().Ascent
+
+	for _, line := range lines {
+		dot := fixed.Point26_6{X: fixed.I(x), Y: baseline}
+
+		switch d.Align {
+		case AlignCenter:
+			dot.X -= d.Advance(line) / 2
+		case AlignRight:
+			dot.X -= d.Advance(line)
+		}
+
+		d.drawLine(dst, clip, dot, line)
+		baseline += height
+	}
+}
+
+// drawLine draws a single line of text with its origin at dot.
+func (d *Drawer) drawLine(dst draw.Image, clip image.Rectangle, dot fixed.Point26_6, s string) {
+	cache := d.Cache
+	if cache == nil {
+		cache = DefaultCache
+	}
+
+	clr := d.Color
+	if clr == nil {
+		clr = color.Black
+	}
+
+	prev := rune(-1)
+	for _, r := range s {
+		if prev >= 0 {
+			dot.X += d.Face.Kern(prev, r)
+		}
+		prev = r
+
+		g := cache.glyph(d.Face, clr, r, dot)
+		if g == nil {
+			continue
+		}
+
+		if g.img != nil {
+			pos := image.Pt(dot.X.Floor(), dot.Y.Round()).Add(g.offset)
+			dr := g.img.Bounds().Add(pos)
+			cr := dr.Intersect(clip)
+
+			if !cr.Empty() {
+				draw.Draw(dst, cr, g.img, cr.Min.Sub(pos), draw.Over)
+			}
+		}
+
+		dot.X += g.advance
+	}
+}
+
+// lineHeight returns the distance between baselines.
+func (d *Drawer) lineHeight() fixed.Int26_6 {
+	if d.LineHeight > 0 {
+		return fixed.I(d.LineHeight)
+	}
+
+	return d.Face.Metrics().Height
+}
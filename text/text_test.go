@@ -0,0 +1,244 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package text
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/sparques/framebuffer"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+func testFace(t *testing.T, size float64) font.Face {
+	t.Helper()
+
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { face.Close() })
+	return face
+}
+
+// inked returns the bounding box of all non-background pixels in img.
+func inked(img image.Image, bg color.Color) image.Rectangle {
+	br, bgc, bb, _ := bg.RGBA()
+	var r image.Rectangle
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			if cr == br && cg == bgc && cb == bb {
+				continue
+			}
+
+			p := image.Rect(x, y, x+1, y+1)
+			if r.Empty() {
+				r = p
+			} else {
+				r = r.Union(p)
+			}
+		}
+	}
+
+	return r
+}
+
+func TestAntiAliasing(t *testing.T) {
+	d := &Drawer{Face: testFace(t, 24), Color: color.Black, Cache: NewCache(64)}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 40))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	d.Draw(img, image.Pt(2, 2), "Sog")
+
+	// Anti-aliased text has intermediate shades besides black and white.
+	var grey int
+	for i := 0; i < len(img.Pix); i += 4 {
+		if v := img.Pix[i]; v > 0 && v < 0xff {
+			grey++
+		}
+	}
+
+	if grey == 0 {
+		t.Fatal("expected anti-aliased pixels")
+	}
+}
+
+func TestPixelFormats(t *testing.T) {
+	d := &Drawer{Face: testFace(t, 20), Color: color.RGBA{0xff, 0x80, 0, 0xff}, Cache: NewCache(64)}
+	r := image.Rect(0, 0, 80, 30)
+	n := r.Dx() * r.Dy()
+
+	want := image.NewRGBA(r)
+	d.Draw(want, image.Pt(1, 1), "Hello")
+
+	for _, tt := range []struct {
+		name string
+		img  draw.Image
+		tol  uint32
+	}{
+		{"BGRA", &framebuffer.BGRA{Pix: make([]byte, 4*n), Stride: 4 * r.Dx(), Rect: r}, 0},
+		{"RGB565", &framebuffer.RGB565{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r}, 8},
+		{"BGR565", &framebuffer.BGR565{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r}, 8},
+		{"RGB555", &framebuffer.RGB555{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r}, 8},
+		{"BGR555", &framebuffer.BGR555{Pix: make([]byte, 2*n), Stride: 2 * r.Dx(), Rect: r}, 8},
+	} {
+		d.Draw(tt.img, image.Pt(1, 1), "Hello")
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				w := want.RGBAAt(x, y)
+				gr, gg, gb, _ := tt.img.At(x, y).RGBA()
+
+				if diff(w.R, gr) > tt.tol || diff(w.G, gg) > tt.tol || diff(w.B, gb) > tt.tol {
+					t.Fatalf("%s: pixel %d,%d: want %v, have %d,%d,%d",
+						tt.name, x, y, w, gr>>8, gg>>8, gb>>8)
+				}
+			}
+		}
+	}
+}
+
+func diff(want uint8, have uint32) uint32 {
+	a, b := uint32(want), have>>8
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestMeasure(t *testing.T) {
+	face := basicfont.Face7x13
+	d := &Drawer{Face: face}
+
+	if have := d.Measure("abc"); have != image.Pt(21, 13) {
+		t.Fatalf("Measure: want 21x13, have %v", have)
+	}
+
+	if have := d.Measure("abcd\nab"); have != image.Pt(28, 26) {
+		t.Fatalf("Measure: want 28x26, have %v", have)
+	}
+
+	d.LineHeight = 20
+	if have := d.Measure("a\nb\nc"); have != image.Pt(7, 60) {
+		t.Fatalf("Measure: want 7x60, have %v", have)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	d := &Drawer{Face: basicfont.Face7x13}
+
+	for _, tt := range []struct {
+		in    string
+		width int
+		want  []string
+	}{
+		{"", 70, []string{""}},
+		{"hello world", 70, []string{"hello", "world"}},
+		{"hello world", 77, []string{"hello world"}},
+		{"a b c d e f", 35, []string{"a b c", "d e f"}},
+		{"one\n\ntwo", 70, []string{"one", "", "two"}},
+		{"abcdefghij", 28, []string{"abcd", "efgh", "ij"}},
+		{"x abcdefgh y", 28, []string{"x", "abcd", "efgh", "y"}},
+		{"ab", 1, []string{"a", "b"}},
+	} {
+		have := d.Wrap(tt.in, tt.width)
+		if len(have) != len(tt.want) {
+			t.Fatalf("Wrap(%q, %d): want %q, have %q", tt.in, tt.width, tt.want, have)
+		}
+
+		for i := range have {
+			if have[i] != tt.want[i] {
+				t.Fatalf("Wrap(%q, %d): want %q, have %q", tt.in, tt.width, tt.want, have)
+			}
+		}
+	}
+}
+
+func TestAlign(t *testing.T) {
+	r := image.Rect(0, 0, 100, 20)
+
+	for _, tt := range []struct {
+		align      Align
+		minX, maxX int
+	}{
+		{AlignLeft, 0, 21},
+		{AlignCenter, 39, 60},
+		{AlignRight, 79, 100},
+	} {
+		img := image.NewRGBA(r)
+		d := &Drawer{Face: basicfont.Face7x13, Color: color.White, Align: tt.align}
+		d.DrawBox(img, r, "MMM")
+
+		ink := inked(img, color.Transparent)
+		if ink.Min.X < tt.minX || ink.Max.X > tt.maxX {
+			t.Fatalf("align %d: ink %v outside [%d,%d)", tt.align, ink, tt.minX, tt.maxX)
+		}
+	}
+}
+
+func TestDrawBoxClip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	box := image.Rect(10, 10, 50, 30)
+
+	d := &Drawer{Face: testFace(t, 16), Color: color.White}
+	d.DrawBox(img, box, "The quick brown fox jumps over the lazy dog")
+
+	ink := inked(img, color.Transparent)
+	if ink.Empty() {
+		t.Fatal("nothing drawn")
+	}
+
+	if !ink.In(box) {
+		t.Fatalf("ink %v outside box %v", ink, box)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(8)
+	d := &Drawer{Face: basicfont.Face7x13, Color: color.White, Cache: c}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 20))
+
+	d.Draw(img, image.Point{}, "aab")
+	if hits, misses := c.Stats(); hits != 1 || misses != 2 {
+		t.Fatalf("Stats: want 1/2, have %d/%d", hits, misses)
+	}
+
+	d.Draw(img, image.Point{}, "ab")
+	if hits, misses := c.Stats(); hits != 3 || misses != 2 {
+		t.Fatalf("Stats: want 3/2, have %d/%d", hits, misses)
+	}
+
+	d.Color = color.Black
+	d.Draw(img, image.Point{}, "a")
+	if n := c.Len(); n != 3 {
+		t.Fatalf("Len: want 3, have %d", n)
+	}
+
+	d.Draw(img, image.Point{}, "cdefghijk")
+	if n := c.Len(); n > 8 {
+		t.Fatalf("Len: want at most 8, have %d", n)
+	}
+
+	c.Reset()
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len after Reset: want 0, have %d", n)
+	}
+}
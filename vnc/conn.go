@@ -0,0 +1,572 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/input"
+)
+
+// Client to server message types.
+const (
+	msgSetPixelFormat = 0
+	msgSetEncodings   = 2
+	msgUpdateRequest  = 3
+	msgKeyEvent       = 4
+	msgPointerEvent   = 5
+	msgClientCutText  = 6
+)
+
+// msgUpdate is the server to client message with screen contents.
+const msgUpdate = 0
+
+// Security types and results.
+const (
+	securityNone       = 1
+	securityResultOK   = 0
+	securityResultFail = 1
+)
+
+// maxCutText limits the clipboard text a viewer may send.
+const maxCutText = 1 << 20
+
+// conn is a connection to a viewer. Messages are read in the goroutine
+// running serve; updates are sent by a second one, whenever the viewer
+// asked for one and there is something to send.
+type conn struct {
+	s    *Server
+	nc   net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	wake chan struct{}
+
+	mu        sync.Mutex
+	bounds    image.Rectangle
+	cols      int    // Tiles per row.
+	dirty     []bool // Tiles the viewer has not seen the latest version of.
+	copies    []copyOp
+	requested bool            // The viewer waits for an update.
+	area      image.Rectangle // Area the viewer asked for.
+	pf        pixelFormat
+	enc       int32
+	copyRect  bool
+
+	// Input state, only used by the reading goroutine.
+	keys    framebuffer.KeyState
+	down    map[uint32]bool // Keysyms held down.
+	buttons uint8
+	pos     image.Point
+
+	e   encoder
+	buf []byte
+}
+
+// copyOp moves an area of the viewer's screen.
+type copyOp struct {
+	r    image.Rectangle
+	from image.Point
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	s.mu.RLock()
+	b := s.frame.Rect
+	s.mu.RUnlock()
+
+	c := &conn{
+		s:      s,
+		nc:     nc,
+		r:      bufio.NewReader(nc),
+		w:      bufio.NewWriter(nc),
+		wake:   make(chan struct{}, 1),
+		bounds: b,
+		cols:   (b.Dx() + tileSize - 1) / tileSize,
+		pf:     defaultFormat,
+		enc:    encRaw,
+		down:   make(map[uint32]bool),
+	}
+
+	// The viewer has seen nothing yet.
+	c.dirty = make([]bool, c.cols*((b.Dy()+tileSize-1)/tileSize))
+	for i := range c.dirty {
+		c.dirty[i] = true
+	}
+
+	return c
+}
+
+func (c *conn) serve() {
+	defer c.nc.Close()
+
+	if err := c.handshake(); err != nil {
+		return
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.writeLoop(quit)
+	}()
+
+	c.readLoop()
+	close(quit)
+	c.nc.Close()
+	<-done
+	c.release()
+}
+
+// handshake agrees on the protocol version and security type, and
+// tells the viewer about the screen.
+func (c *conn) handshake() error {
+	c.w.WriteString("RFB 003.008\n")
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	var version [12]byte
+	if _, err := io.ReadFull(c.r, version[:]); err != nil {
+		return err
+	}
+
+	v := string(version[:])
+	minor, err := strconv.Atoi(v[8:11])
+	if v[:8] != "RFB 003." || v[11] != '\n' || err != nil {
+		return errors.New("vnc: unsupported protocol version")
+	}
+
+	if minor >= 7 {
+		c.w.Write([]byte{1, securityNone})
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+
+		typ, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if typ != securityNone {
+			if minor >= 8 {
+				reason := "security type not supported"
+				c.writeUint32(securityResultFail)
+				c.writeUint32(uint32(len(reason)))
+				c.w.WriteString(reason)
+				c.w.Flush()
+			}
+			return errors.New("vnc: unsupported security type")
+		}
+
+		// Version 3.7 has no result for security type None.
+		if minor >= 8 {
+			c.writeUint32(securityResultOK)
+		}
+	} else {
+		// Version 3.3, where the server picks the security type.
+		c.writeUint32(securityNone)
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	// The shared flag does not matter; all viewers share the screen.
+	if _, err := c.r.ReadByte(); err != nil {
+		return err
+	}
+
+	c.writeUint16(uint16(c.bounds.Dx()))
+	c.writeUint16(uint16(c.bounds.Dy()))
+	c.w.Write(c.pf.bytes())
+	c.writeUint32(uint32(len(c.s.Name)))
+	c.w.WriteString(c.s.Name)
+	return c.w.Flush()
+}
+
+func (c *conn) readLoop() error {
+	var buf [20]byte
+
+	for {
+		typ, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case msgSetPixelFormat:
+			if _, err := io.ReadFull(c.r, buf[:19]); err != nil {
+				return err
+			}
+
+			pf, err := readPixelFormat(buf[3:19])
+			if err != nil {
+				return err
+			}
+
+			c.mu.Lock()
+			c.pf = pf
+			c.mu.Unlock()
+
+		case msgSetEncodings:
+			if _, err := io.ReadFull(c.r, buf[:3]); err != nil {
+				return err
+			}
+
+			encs := make([]byte, 4*int(binary.BigEndian.Uint16(buf[1:])))
+			if _, err := io.ReadFull(c.r, encs); err != nil {
+				return err
+			}
+
+			c.setEncodings(encs)
+
+		case msgUpdateRequest:
+			if _, err := io.ReadFull(c.r, buf[:9]); err != nil {
+				return err
+			}
+
+			x, y := int(binary.BigEndian.Uint16(buf[1:])), int(binary.BigEndian.Uint16(buf[3:]))
+			w, h := int(binary.BigEndian.Uint16(buf[5:])), int(binary.BigEndian.Uint16(buf[7:]))
+			r := image.Rect(x, y, x+w, y+h).Add(c.bounds.Min).Intersect(c.bounds)
+
+			c.mu.Lock()
+			c.requested = true
+			c.area = c.area.Union(r)
+			if buf[0] == 0 {
+				c.damageLocked(r)
+			}
+			c.mu.Unlock()
+			c.signal()
+
+		case msgKeyEvent:
+			if _, err := io.ReadFull(c.r, buf[:7]); err != nil {
+				return err
+			}
+			c.key(binary.BigEndian.Uint32(buf[3:]), buf[0] != 0)
+
+		case msgPointerEvent:
+			if _, err := io.ReadFull(c.r, buf[:5]); err != nil {
+				return err
+			}
+
+			x, y := int(binary.BigEndian.Uint16(buf[1:])), int(binary.BigEndian.Uint16(buf[3:]))
+			c.pointer(buf[0], image.Pt(x, y).Add(c.bounds.Min))
+
+		case msgClientCutText:
+			if _, err := io.ReadFull(c.r, buf[:7]); err != nil {
+				return err
+			}
+
+			// Clipboard contents are not used.
+			n := binary.BigEndian.Uint32(buf[3:])
+			if n > maxCutText {
+				return errors.New("vnc: clipboard text too long")
+			}
+			if _, err := c.r.Discard(int(n)); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("vnc: unknown message type %d", typ)
+		}
+	}
+}
+
+// setEncodings picks the first encoding the viewer prefers, which the
+// server supports. CopyRect is used in addition to it.
+func (c *conn) setEncodings(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enc = encRaw
+	c.copyRect = false
+	chosen := false
+
+	for i := 0; i < len(b); i += 4 {
+		switch enc := int32(binary.BigEndian.Uint32(b[i:])); enc {
+		case encCopyRect:
+			c.copyRect = true
+		case encRRE, encHextile, encZRLE:
+			if !chosen {
+				c.enc = enc
+				chosen = true
+			}
+		case encRaw:
+			chosen = true
+		}
+	}
+
+	// Pending copies are sent as pixels instead.
+	if !c.copyRect {
+		for _, op := range c.copies {
+			c.damageLocked(op.r)
+		}
+		c.copies = nil
+	}
+}
+
+// signal wakes the writing goroutine.
+func (c *conn) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// damage marks areas as changed.
+func (c *conn) damage(rs ...image.Rectangle) {
+	c.mu.Lock()
+	for _, r := range rs {
+		c.damageLocked(r)
+	}
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *conn) damageLocked(r image.Rectangle) {
+	for _, t := range tiles(c.bounds, r) {
+		c.dirty[c.tile(t.Min)] = true
+	}
+}
+
+// tile returns the index of the tile holding p.
+func (c *conn) tile(p image.Point) int {
+	p = p.Sub(c.bounds.Min)
+	return p.Y/tileSize*c.cols + p.X/tileSize
+}
+
+// copy queues an area to be moved on the viewer's screen. The viewer
+// can only copy the area if it has seen its latest contents; otherwise
+// the destination is sent in full.
+func (c *conn) copy(r image.Rectangle, from image.Point) {
+	c.mu.Lock()
+
+	stale := !c.copyRect
+	for _, t := range tiles(c.bounds, r.Add(from.Sub(r.Min))) {
+		stale = stale || c.dirty[c.tile(t.Min)]
+	}
+
+	if stale {
+		c.damageLocked(r)
+	} else {
+		c.copies = append(c.copies, copyOp{r, from})
+	}
+
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *conn) writeLoop(quit chan struct{}) {
+	for {
+		select {
+		case <-c.wake:
+		case <-quit:
+			return
+		}
+
+		if err := c.update(); err != nil {
+			c.nc.Close()
+			return
+		}
+	}
+}
+
+// update sends the pending copies and changed tiles, if the viewer
+// asked for an update.
+func (c *conn) update() error {
+	s := c.s
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c.mu.Lock()
+	if !c.requested {
+		c.mu.Unlock()
+		return nil
+	}
+
+	copies := c.copies
+	rects := c.takeDirty()
+	if len(copies) == 0 && len(rects) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.copies = nil
+	c.requested = false
+	c.area = image.Rectangle{}
+	c.e.pf = c.pf
+	enc := c.enc
+	c.mu.Unlock()
+
+	b := c.buf[:0]
+	b = append(b, msgUpdate, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(copies)+len(rects)))
+
+	// Copies come first, as they move what the viewer already has.
+	for _, op := range copies {
+		b = c.rectHeader(b, op.r, encCopyRect)
+		b = binary.BigEndian.AppendUint16(b, uint16(op.from.X-c.bounds.Min.X))
+		b = binary.BigEndian.AppendUint16(b, uint16(op.from.Y-c.bounds.Min.Y))
+	}
+
+	for _, r := range rects {
+		b = c.rectHeader(b, r, enc)
+		b = c.e.encode(b, enc, s.frame, r)
+	}
+
+	c.buf = b
+	if _, err := c.w.Write(b); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// takeDirty returns the changed areas within the requested area, as
+// runs of tiles along each row. Tiles entirely within the area are
+// marked as seen.
+func (c *conn) takeDirty() []image.Rectangle {
+	var rs []image.Rectangle
+
+	for y := c.bounds.Min.Y; y < c.bounds.Max.Y; y += tileSize {
+		var run image.Rectangle
+
+		for x := c.bounds.Min.X; x < c.bounds.Max.X; x += tileSize {
+			i := c.tile(image.Pt(x, y))
+			t := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(c.bounds)
+			part := t.Intersect(c.area)
+
+			if !c.dirty[i] || part.Empty() {
+				if !run.Empty() {
+					rs = append(rs, run)
+					run = image.Rectangle{}
+				}
+				continue
+			}
+
+			if part == t {
+				c.dirty[i] = false
+			}
+
+			if !run.Empty() && (run.Max.X != part.Min.X || run.Min.Y != part.Min.Y || run.Max.Y != part.Max.Y) {
+				rs = append(rs, run)
+				run = image.Rectangle{}
+			}
+			run = run.Union(part)
+		}
+
+		if !run.Empty() {
+			rs = append(rs, run)
+		}
+	}
+
+	return rs
+}
+
+func (c *conn) rectHeader(b []byte, r image.Rectangle, enc int32) []byte {
+	r = r.Sub(c.bounds.Min)
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Min.X))
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Min.Y))
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Dx()))
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Dy()))
+	return binary.BigEndian.AppendUint32(b, uint32(enc))
+}
+
+// key delivers a key event. Viewers repeat held keys by sending
+// them again, without releasing them first.
+func (c *conn) key(sym uint32, pressed bool) {
+	key, r := keysym(sym)
+
+	repeat := pressed && c.down[sym]
+	if pressed {
+		c.down[sym] = true
+	} else {
+		delete(c.down, sym)
+	}
+
+	ev := c.keys.Translate(key, pressed)
+	if r != 0 {
+		// The viewer knows its keyboard layout better.
+		ev.Rune = r
+	}
+
+	c.inject(&input.KeyEvent{Header: header(), KeyEvent: ev, Repeat: repeat})
+}
+
+// Pointer buttons, by their bit in the button mask.
+var buttons = [3]framebuffer.Key{input.BtnLeft, input.BtnMiddle, input.BtnRight}
+
+// pointer delivers the movement and buttons of the viewer's pointer.
+// The scroll wheel is reported as buttons 4 to 7 being clicked.
+func (c *conn) pointer(mask uint8, pos image.Point) {
+	if pos != c.pos {
+		d := pos.Sub(c.pos)
+		c.pos = pos
+		c.inject(&input.MotionEvent{Header: header(), DX: d.X, DY: d.Y, Abs: true, Pos: pos})
+	}
+
+	pressed := mask &^ c.buttons
+	changed := mask ^ c.buttons
+	c.buttons = mask
+
+	for i, btn := range buttons {
+		if changed&(1<<i) != 0 {
+			ev := c.keys.Translate(btn, mask&(1<<i) != 0)
+			c.inject(&input.KeyEvent{Header: header(), KeyEvent: ev})
+		}
+	}
+
+	var wheel, hwheel int
+	if pressed&(1<<3) != 0 {
+		wheel++
+	}
+	if pressed&(1<<4) != 0 {
+		wheel--
+	}
+	if pressed&(1<<5) != 0 {
+		hwheel--
+	}
+	if pressed&(1<<6) != 0 {
+		hwheel++
+	}
+
+	if wheel != 0 || hwheel != 0 {
+		c.inject(&input.MotionEvent{Header: header(), Wheel: wheel, HWheel: hwheel, Abs: true, Pos: pos})
+	}
+}
+
+// release lets go of any keys and buttons held down when the
+// viewer disconnects.
+func (c *conn) release() {
+	for sym := range c.down {
+		c.key(sym, false)
+	}
+	c.pointer(0, c.pos)
+}
+
+func (c *conn) inject(ev input.Event) {
+	if c.s.Input != nil {
+		c.s.Input.Inject(ev)
+	}
+}
+
+func header() input.Header {
+	return input.Header{Time: time.Now()}
+}
+
+func (c *conn) writeUint16(v uint16) {
+	c.w.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (c *conn) writeUint32(v uint32) {
+	c.w.Write(binary.BigEndian.AppendUint32(nil, v))
+}
@@ -0,0 +1,222 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+)
+
+// Encodings, by their number in the protocol.
+const (
+	encRaw      int32 = 0
+	encCopyRect int32 = 1
+	encRRE      int32 = 2
+	encHextile  int32 = 5
+	encZRLE     int32 = 16
+)
+
+// Hextile subencoding flags.
+const (
+	hexRaw        = 1
+	hexBackground = 2
+	hexForeground = 4
+	hexAnySubrect = 8
+	hexColoured   = 16
+)
+
+// encoder encodes rectangles of the screen for one connection.
+// ZRLE data of all rectangles forms a single zlib stream, so the
+// encoder lives as long as the connection does.
+type encoder struct {
+	pf   pixelFormat
+	px   []uint32
+	zbuf bytes.Buffer
+	zw   *zlib.Writer
+}
+
+// encode appends the rectangle r of img in the given encoding.
+func (e *encoder) encode(b []byte, enc int32, img *image.RGBA, r image.Rectangle) []byte {
+	switch enc {
+	case encRRE:
+		return e.rre(b, img, r)
+	case encHextile:
+		return e.hextile(b, img, r)
+	case encZRLE:
+		return e.zrle(b, img, r)
+	}
+	return e.raw(b, img, r)
+}
+
+// pixels converts the area r of img to pixel values, row by row.
+// The result is only valid until the next call.
+func (e *encoder) pixels(img *image.RGBA, r image.Rectangle) []uint32 {
+	n := r.Dx() * r.Dy()
+	if cap(e.px) < n {
+		e.px = make([]uint32, n)
+	}
+	px := e.px[:n]
+
+	i := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(r.Min.X, y):img.PixOffset(r.Max.X, y)]
+		for j := 0; j < len(row); j += 4 {
+			px[i] = e.pf.pixel(row[j], row[j+1], row[j+2])
+			i++
+		}
+	}
+
+	return px
+}
+
+func (e *encoder) raw(b []byte, img *image.RGBA, r image.Rectangle) []byte {
+	for _, p := range e.pixels(img, r) {
+		b = e.pf.put(b, p)
+	}
+	return b
+}
+
+// rre sends a background color, and rectangles of other colors.
+func (e *encoder) rre(b []byte, img *image.RGBA, r image.Rectangle) []byte {
+	px := e.pixels(img, r)
+	bg, _ := background(px)
+	rs := subrects(px, r.Dx(), r.Dy(), bg)
+
+	b = binary.BigEndian.AppendUint32(b, uint32(len(rs)))
+	b = e.pf.put(b, bg)
+
+	for _, s := range rs {
+		b = e.pf.put(b, s.p)
+		b = binary.BigEndian.AppendUint16(b, uint16(s.x))
+		b = binary.BigEndian.AppendUint16(b, uint16(s.y))
+		b = binary.BigEndian.AppendUint16(b, uint16(s.w))
+		b = binary.BigEndian.AppendUint16(b, uint16(s.h))
+	}
+
+	return b
+}
+
+// hextile sends tiles of 16x16 pixels, each as RRE with small
+// coordinates, or raw if that is shorter.
+func (e *encoder) hextile(b []byte, img *image.RGBA, r image.Rectangle) []byte {
+	size := e.pf.size()
+
+	for y := r.Min.Y; y < r.Max.Y; y += 16 {
+		for x := r.Min.X; x < r.Max.X; x += 16 {
+			t := image.Rect(x, y, x+16, y+16).Intersect(r)
+			w, h := t.Dx(), t.Dy()
+
+			px := e.pixels(img, t)
+			bg, colors := background(px)
+
+			if colors == 1 {
+				b = append(b, hexBackground)
+				b = e.pf.put(b, bg)
+				continue
+			}
+
+			rs := subrects(px, w, h, bg)
+			mono := colors == 2
+
+			// Background, count and subrectangles.
+			n := 1 + size + 1 + 2*len(rs)
+			if mono {
+				n += size
+			} else {
+				n += size * len(rs)
+			}
+
+			if n > 1+w*h*size || len(rs) > 255 {
+				b = append(b, hexRaw)
+				for _, p := range px {
+					b = e.pf.put(b, p)
+				}
+				continue
+			}
+
+			// A raw tile leaves the colors of the next tile undefined,
+			// so the background is always sent.
+			if mono {
+				b = append(b, hexBackground|hexForeground|hexAnySubrect)
+				b = e.pf.put(b, bg)
+				b = e.pf.put(b, rs[0].p)
+			} else {
+				b = append(b, hexBackground|hexAnySubrect|hexColoured)
+				b = e.pf.put(b, bg)
+			}
+
+			b = append(b, byte(len(rs)))
+			for _, s := range rs {
+				if !mono {
+					b = e.pf.put(b, s.p)
+				}
+				b = append(b, byte(s.x<<4|s.y), byte((s.w-1)<<4|(s.h-1)))
+			}
+		}
+	}
+
+	return b
+}
+
+// background returns the most common pixel value, and the number
+// of distinct values.
+func background(px []uint32) (uint32, int) {
+	counts := make(map[uint32]int)
+	bg, most := px[0], 0
+
+	for _, p := range px {
+		counts[p]++
+		if counts[p] > most {
+			bg, most = p, counts[p]
+		}
+	}
+
+	return bg, len(counts)
+}
+
+// subrect is a rectangle of a single color.
+type subrect struct {
+	p          uint32
+	x, y, w, h int
+}
+
+// subrects covers the pixels which differ from bg with rectangles.
+// Rows are split into runs of a color, and runs which continue those
+// of the previous row extend them.
+func subrects(px []uint32, w, h int, bg uint32) []subrect {
+	var rs []subrect
+	var open map[[3]uint32]int // Rectangles reaching the previous row.
+
+	for y := 0; y < h; y++ {
+		next := make(map[[3]uint32]int)
+		row := px[y*w : (y+1)*w]
+
+		for x := 0; x < w; {
+			p := row[x]
+			n := 1
+			for x+n < w && row[x+n] == p {
+				n++
+			}
+
+			if p != bg {
+				k := [3]uint32{uint32(x), uint32(n), p}
+				if i, ok := open[k]; ok {
+					rs[i].h++
+					next[k] = i
+				} else {
+					rs = append(rs, subrect{p, x, y, n, 1})
+					next[k] = len(rs) - 1
+				}
+			}
+
+			x += n
+		}
+
+		open = next
+	}
+
+	return rs
+}
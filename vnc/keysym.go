@@ -0,0 +1,125 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import "github.com/sparques/framebuffer"
+
+// keysyms maps the X11 keysyms of keys which produce no character,
+// or which are told apart from their character, to keycodes.
+var keysyms = map[uint32]framebuffer.Key{
+	0xff08: framebuffer.KeyBackspace,
+	0xff09: framebuffer.KeyTab,
+	0xff0d: framebuffer.KeyEnter,
+	0xff13: framebuffer.KeyPause,
+	0xff14: framebuffer.KeyScrollLock,
+	0xff15: framebuffer.KeySysRq,
+	0xff1b: framebuffer.KeyEsc,
+	0xff50: framebuffer.KeyHome,
+	0xff51: framebuffer.KeyLeft,
+	0xff52: framebuffer.KeyUp,
+	0xff53: framebuffer.KeyRight,
+	0xff54: framebuffer.KeyDown,
+	0xff55: framebuffer.KeyPageUp,
+	0xff56: framebuffer.KeyPageDown,
+	0xff57: framebuffer.KeyEnd,
+	0xff61: framebuffer.KeySysRq, // Print.
+	0xff63: framebuffer.KeyInsert,
+	0xff67: framebuffer.KeyCompose, // Menu.
+	0xff7f: framebuffer.KeyNumLock,
+	0xff8d: framebuffer.KeyKPEnter,
+	0xff95: framebuffer.KeyKP7, // Keypad keys with Num Lock off.
+	0xff96: framebuffer.KeyKP4,
+	0xff97: framebuffer.KeyKP8,
+	0xff98: framebuffer.KeyKP6,
+	0xff99: framebuffer.KeyKP2,
+	0xff9a: framebuffer.KeyKP9,
+	0xff9b: framebuffer.KeyKP3,
+	0xff9c: framebuffer.KeyKP1,
+	0xff9d: framebuffer.KeyKP5,
+	0xff9e: framebuffer.KeyKP0,
+	0xff9f: framebuffer.KeyKPDot,
+	0xffaa: framebuffer.KeyKPAsterisk,
+	0xffab: framebuffer.KeyKPPlus,
+	0xffad: framebuffer.KeyKPMinus,
+	0xffae: framebuffer.KeyKPDot,
+	0xffaf: framebuffer.KeyKPSlash,
+	0xffb0: framebuffer.KeyKP0,
+	0xffb1: framebuffer.KeyKP1,
+	0xffb2: framebuffer.KeyKP2,
+	0xffb3: framebuffer.KeyKP3,
+	0xffb4: framebuffer.KeyKP4,
+	0xffb5: framebuffer.KeyKP5,
+	0xffb6: framebuffer.KeyKP6,
+	0xffb7: framebuffer.KeyKP7,
+	0xffb8: framebuffer.KeyKP8,
+	0xffb9: framebuffer.KeyKP9,
+	0xffbe: framebuffer.KeyF1,
+	0xffbf: framebuffer.KeyF2,
+	0xffc0: framebuffer.KeyF3,
+	0xffc1: framebuffer.KeyF4,
+	0xffc2: framebuffer.KeyF5,
+	0xffc3: framebuffer.KeyF6,
+	0xffc4: framebuffer.KeyF7,
+	0xffc5: framebuffer.KeyF8,
+	0xffc6: framebuffer.KeyF9,
+	0xffc7: framebuffer.KeyF10,
+	0xffc8: framebuffer.KeyF11,
+	0xffc9: framebuffer.KeyF12,
+	0xffe1: framebuffer.KeyLeftShift,
+	0xffe2: framebuffer.KeyRightShift,
+	0xffe3: framebuffer.KeyLeftCtrl,
+	0xffe4: framebuffer.KeyRightCtrl,
+	0xffe5: framebuffer.KeyCapsLock,
+	0xffe7: framebuffer.KeyLeftMeta,
+	0xffe8: framebuffer.KeyRightMeta,
+	0xffe9: framebuffer.KeyLeftAlt,
+	0xffea: framebuffer.KeyRightAlt,
+	0xffeb: framebuffer.KeyLeftMeta, // Super.
+	0xffec: framebuffer.KeyRightMeta,
+	0xfe03: framebuffer.KeyRightAlt, // AltGr.
+	0xffff: framebuffer.KeyDelete,
+}
+
+// keysymRunes holds the characters of the keypad keysyms.
+var keysymRunes = map[uint32]rune{
+	0xffaa: '*',
+	0xffab: '+',
+	0xffad: '-',
+	0xffae: '.',
+	0xffaf: '/',
+	0xffb0: '0',
+	0xffb1: '1',
+	0xffb2: '2',
+	0xffb3: '3',
+	0xffb4: '4',
+	0xffb5: '5',
+	0xffb6: '6',
+	0xffb7: '7',
+	0xffb8: '8',
+	0xffb9: '9',
+}
+
+// keysym returns the key and character for an X11 keysym. Viewers send
+// the character the user typed, in their own keyboard layout; the key
+// is the one producing it on a US layout, if any.
+func keysym(sym uint32) (framebuffer.Key, rune) {
+	if key, ok := keysyms[sym]; ok {
+		return key, keysymRunes[sym]
+	}
+
+	var r rune
+	switch {
+	case sym >= 0x20 && sym <= 0x7e, sym >= 0xa0 && sym <= 0xff:
+		// Latin-1 keysyms are the characters themselves.
+		r = rune(sym)
+	case sym >= 0x010000a0 && sym <= 0x0110ffff:
+		// Unicode keysyms.
+		r = rune(sym - 0x01000000)
+	default:
+		return framebuffer.KeyNone, 0
+	}
+
+	key, _ := framebuffer.RuneKey(r)
+	return key, r
+}
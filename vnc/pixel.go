@@ -0,0 +1,133 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// pixelFormat describes how a viewer wants pixels sent.
+// Only true color formats are supported.
+type pixelFormat struct {
+	bpp, depth             uint8
+	bigEndian              bool
+	rmax, gmax, bmax       uint16
+	rshift, gshift, bshift uint8
+}
+
+// defaultFormat is offered to viewers: 32 bits per pixel,
+// with 8 bits for each of red, green and blue.
+var defaultFormat = pixelFormat{
+	bpp: 32, depth: 24,
+	rmax: 255, gmax: 255, bmax: 255,
+	rshift: 16, gshift: 8, bshift: 0,
+}
+
+// readPixelFormat decodes the 16 byte wire format.
+func readPixelFormat(b []byte) (pixelFormat, error) {
+	pf := pixelFormat{
+		bpp:       b[0],
+		depth:     b[1],
+		bigEndian: b[2] != 0,
+		rmax:      binary.BigEndian.Uint16(b[4:]),
+		gmax:      binary.BigEndian.Uint16(b[6:]),
+		bmax:      binary.BigEndian.Uint16(b[8:]),
+		rshift:    b[10],
+		gshift:    b[11],
+		bshift:    b[12],
+	}
+
+	if b[3] == 0 {
+		return pf, errors.New("vnc: color maps are not supported")
+	}
+
+	switch pf.bpp {
+	case 8, 16, 32:
+	default:
+		return pf, errors.New("vnc: unsupported pixel size")
+	}
+
+	if pf.rmax == 0 || pf.gmax == 0 || pf.bmax == 0 {
+		return pf, errors.New("vnc: invalid pixel format")
+	}
+
+	return pf, nil
+}
+
+// bytes encodes the format for the wire.
+func (pf *pixelFormat) bytes() []byte {
+	b := make([]byte, 16)
+	b[0] = pf.bpp
+	b[1] = pf.depth
+	if pf.bigEndian {
+		b[2] = 1
+	}
+	b[3] = 1 // True color.
+	binary.BigEndian.PutUint16(b[4:], pf.rmax)
+	binary.BigEndian.PutUint16(b[6:], pf.gmax)
+	binary.BigEndian.PutUint16(b[8:], pf.bmax)
+	b[10] = pf.rshift
+	b[11] = pf.gshift
+	b[12] = pf.bshift
+	return b
+}
+
+// pixel converts 8 bit channels to a pixel value.
+func (pf *pixelFormat) pixel(r, g, b uint8) uint32 {
+	scale := func(v uint8, max uint16) uint32 {
+		return (uint32(v)*uint32(max) + 127) / 255
+	}
+	return scale(r, pf.rmax)<<pf.rshift | scale(g, pf.gmax)<<pf.gshift | scale(b, pf.bmax)<<pf.bshift
+}
+
+// size returns the number of bytes in a pixel.
+func (pf *pixelFormat) size() int {
+	return int(pf.bpp) / 8
+}
+
+// put appends a pixel value in the byte order of the format.
+func (pf *pixelFormat) put(b []byte, p uint32) []byte {
+	switch pf.bpp {
+	case 8:
+		return append(b, byte(p))
+	case 16:
+		if pf.bigEndian {
+			return binary.BigEndian.AppendUint16(b, uint16(p))
+		}
+		return binary.LittleEndian.AppendUint16(b, uint16(p))
+	}
+
+	if pf.bigEndian {
+		return binary.BigEndian.AppendUint32(b, p)
+	}
+	return binary.LittleEndian.AppendUint32(b, p)
+}
+
+// cpixel returns the size and offset of the compressed pixels used by
+// ZRLE. Pixels of 32 bits whose colors fit in three of their bytes are
+// sent as just those bytes.
+func (pf *pixelFormat) cpixel() (size, offset int) {
+	if pf.bpp != 32 || pf.depth > 24 {
+		return pf.size(), 0
+	}
+
+	mask := uint32(pf.rmax)<<pf.rshift | uint32(pf.gmax)<<pf.gshift | uint32(pf.bmax)<<pf.bshift
+
+	switch {
+	case mask&0xff000000 == 0:
+		// The low bytes, which come first in little endian.
+		if pf.bigEndian {
+			return 3, 1
+		}
+		return 3, 0
+	case mask&0x000000ff == 0:
+		if pf.bigEndian {
+			return 3, 0
+		}
+		return 3, 1
+	}
+
+	return 4, 0
+}
@@ -0,0 +1,364 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+// Package vnc serves the screen to VNC viewers, using version 3.8 of
+// the RFB protocol. Viewers see what is drawn on the screen, and their
+// keyboard and pointer drive the program as local input would.
+//
+// There is no authentication, and the connection is not encrypted.
+// Listen on the loopback interface and use an ssh tunnel, unless the
+// network is trusted.
+package vnc
+
+import (
+	"errors"
+	"image"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sparques/framebuffer/input"
+)
+
+// Source provides the contents of the screen. It is implemented
+// by *framebuffer.Canvas. An empty rectangle means the whole screen,
+// and the returned image has the bounds of the requested area.
+type Source interface {
+	Snapshot(r image.Rectangle) (*image.RGBA, error)
+}
+
+// tileSize is the size of the squares changes are tracked in.
+// It matches the tiles of the ZRLE encoding.
+const tileSize = 64
+
+// Server serves a Source to any number of viewers.
+//
+// The screen is checked for changes at a fixed rate. Only the tiles
+// which changed are sent to viewers, and only when they ask for them,
+// so slow viewers skip intermediate frames.
+type Server struct {
+	// Name is the desktop name shown by viewers.
+	Name string
+
+	// Input receives key and pointer events from viewers. Events
+	// are dropped when it is nil.
+	Input *input.Mux
+
+	// Rate is the number of times per second the screen is checked
+	// for changes. Zero means 10 times. If it is negative, the screen
+	// is only checked when Update or Damage is called.
+	Rate float64
+
+	src Source
+
+	// mu guards frame. Connections hold it for reading while they
+	// send an update, so the frame does not change under them.
+	mu    sync.RWMutex
+	frame *image.RGBA // The screen as last seen.
+
+	cmu       sync.Mutex
+	conns     map[*conn]struct{}
+	listeners map[net.Listener]struct{}
+	closed    bool
+
+	poll sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// ErrServerClosed is returned by Serve after the server is closed.
+var ErrServerClosed = errors.New("vnc: server closed")
+
+// NewServer creates a server for the given source. The screen is
+// read once, to learn its size.
+func NewServer(src Source) (*Server, error) {
+	frame, err := src.Snapshot(image.Rectangle{})
+	if err != nil {
+		return nil, err
+	}
+
+	if frame.Rect.Dx() > 0xffff || frame.Rect.Dy() > 0xffff {
+		return nil, errors.New("vnc: screen too large")
+	}
+
+	return &Server{
+		Name:      "framebuffer",
+		src:       src,
+		frame:     frame,
+		conns:     make(map[*conn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// ListenAndServe listens on the given TCP address, and serves
+// viewers connecting to it. VNC normally uses port 5900.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts viewers on l, until the server is closed or l fails.
+// It always returns an error; ErrServerClosed after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.cmu.Lock()
+	if s.closed {
+		s.cmu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.cmu.Unlock()
+
+	defer func() {
+		s.cmu.Lock()
+		delete(s.listeners, l)
+		s.cmu.Unlock()
+	}()
+
+	s.poll.Do(func() {
+		if s.Rate >= 0 {
+			s.wg.Add(1)
+			go s.pollLoop()
+		}
+	})
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+				return err
+			}
+		}
+
+		s.cmu.Lock()
+		if s.closed {
+			s.cmu.Unlock()
+			nc.Close()
+			return ErrServerClosed
+		}
+
+		c := newConn(s, nc)
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.cmu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+
+			s.cmu.Lock()
+			delete(s.conns, c)
+			s.cmu.Unlock()
+		}()
+	}
+}
+
+// Close stops the server, disconnecting all viewers.
+func (s *Server) Close() error {
+	s.cmu.Lock()
+	if s.closed {
+		s.cmu.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	close(s.done)
+
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.cmu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// Bounds returns the area of the screen being served.
+func (s *Server) Bounds() image.Rectangle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.frame.Rect
+}
+
+func (s *Server) pollLoop() {
+	defer s.wg.Done()
+
+	rate := s.Rate
+	if rate == 0 {
+		rate = 10
+	}
+
+	t := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			// The screen may be unavailable for a while, for
+			// instance when switched away from. Try again later.
+			s.Update()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Update reads the screen, and sends the tiles which changed to
+// viewers. It is called at the server's rate, but programs which
+// know when they finish drawing may call it themselves.
+func (s *Server) Update() error {
+	frame, err := s.src.Snapshot(image.Rectangle{})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if frame.Rect != s.frame.Rect {
+		return errors.New("vnc: screen size changed")
+	}
+
+	var dirty []image.Rectangle
+	for _, r := range tiles(frame.Rect, frame.Rect) {
+		if !sameArea(frame, s.frame, r) {
+			dirty = append(dirty, r)
+		}
+	}
+
+	s.frame = frame
+	s.damage(dirty...)
+	return nil
+}
+
+// Damage tells the server the given area of the screen changed.
+// It is read and sent to viewers without comparing it to what
+// was there before.
+func (s *Server) Damage(r image.Rectangle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r = r.Intersect(s.frame.Rect)
+	if r.Empty() {
+		return nil
+	}
+
+	part, err := s.src.Snapshot(r)
+	if err != nil {
+		return err
+	}
+
+	if part.Rect != r {
+		return errors.New("vnc: snapshot has the wrong size")
+	}
+
+	copyArea(s.frame, r, part, r.Min)
+	s.damage(r)
+	return nil
+}
+
+// Copy tells the server the area r of the screen now holds what was
+// at from, such as after scrolling. Viewers which support it copy the
+// area themselves, rather than have it sent again. The screen is
+// read again at the next update, which sends any other changes.
+func (s *Server) Copy(r image.Rectangle, from image.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Clip both the destination and the source to the screen.
+	b := s.frame.Rect
+	d := from.Sub(r.Min)
+	r = r.Intersect(b).Intersect(b.Sub(d))
+	if r.Empty() {
+		return
+	}
+	from = r.Min.Add(d)
+
+	copyArea(s.frame, r, s.frame, from)
+
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	for c := range s.conns {
+		c.copy(r, from)
+	}
+}
+
+// damage marks the given areas as changed for all viewers.
+// The caller holds s.mu.
+func (s *Server) damage(rs ...image.Rectangle) {
+	if len(rs) == 0 {
+		return
+	}
+
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	for c := range s.conns {
+		c.damage(rs...)
+	}
+}
+
+// tiles splits r into the tiles it touches, clipped to r.
+// Tiles are aligned to the screen bounds b.
+func tiles(b, r image.Rectangle) []image.Rectangle {
+	var ts []image.Rectangle
+
+	x0 := b.Min.X + (r.Min.X-b.Min.X)/tileSize*tileSize
+	y0 := b.Min.Y + (r.Min.Y-b.Min.Y)/tileSize*tileSize
+
+	for y := y0; y < r.Max.Y; y += tileSize {
+		for x := x0; x < r.Max.X; x += tileSize {
+			t := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(r)
+			if !t.Empty() {
+				ts = append(ts, t)
+			}
+		}
+	}
+
+	return ts
+}
+
+// sameArea reports whether a and b hold the same pixels in r.
+func sameArea(a, b *image.RGBA, r image.Rectangle) bool {
+	n := r.Dx() * 4
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i, j := a.PixOffset(r.Min.X, y), b.PixOffset(r.Min.X, y)
+		if string(a.Pix[i:i+n]) != string(b.Pix[j:j+n]) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyArea copies the area r of dst from src at sp. The areas
+// may overlap, when dst and src are the same image.
+func copyArea(dst *image.RGBA, r image.Rectangle, src *image.RGBA, sp image.Point) {
+	n := r.Dx() * 4
+
+	copyRow := func(y int) {
+		sy := sp.Y + y - r.Min.Y
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):][:n], src.Pix[src.PixOffset(sp.X, sy):][:n])
+	}
+
+	if dst == src && sp.Y < r.Min.Y {
+		for y := r.Max.Y - 1; y >= r.Min.Y; y-- {
+			copyRow(y)
+		}
+		return
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copyRow(y)
+	}
+}
@@ -0,0 +1,654 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sparques/framebuffer"
+	"github.com/sparques/framebuffer/input"
+)
+
+// source is a screen the tests draw on.
+type source struct {
+	mu  sync.Mutex
+	img *image.RGBA
+}
+
+func (s *source) Snapshot(r image.Rectangle) (*image.RGBA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Empty() {
+		r = s.img.Rect
+	}
+
+	dst := image.NewRGBA(r)
+	copyArea(dst, r, s.img, r.Min)
+	return dst, nil
+}
+
+func (s *source) set(x, y int, c color.RGBA) {
+	s.mu.Lock()
+	s.img.SetRGBA(x, y, c)
+	s.mu.Unlock()
+}
+
+// newSource returns a screen with areas of a single color, of a few
+// colors and of many colors, so all encoders use all their forms.
+func newSource(w, h int) *source {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0x20, 0x40, 0x60, 0xff}
+			switch {
+			case x >= w/2 && y < h/2:
+				c = color.RGBA{uint8(x * 3), uint8(y * 5), uint8(x ^ y), 0xff}
+			case x < w/2 && y >= h/2:
+				if (x/3+y/2)%3 == 0 {
+					c = color.RGBA{0xff, 0xff, 0, 0xff}
+				} else if x%7 == 0 {
+					c = color.RGBA{0, 0, 0xff, 0xff}
+				}
+			case x >= w/2 && y >= h/2:
+				if (x+y)%2 == 0 {
+					c = color.RGBA{0xff, 0, 0, 0xff}
+				}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return &source{img: img}
+}
+
+// client is a VNC viewer, keeping the screen as pixel values.
+type client struct {
+	t    *testing.T
+	nc   net.Conn
+	r    *bufio.Reader
+	pf   pixelFormat
+	w, h int
+	name string
+	px   []uint32
+
+	zdata bytes.Buffer
+	zr    io.ReadCloser
+}
+
+func dial(t *testing.T, addr string, version string) *client {
+	t.Helper()
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c := &client{t: t, nc: nc, r: bufio.NewReader(nc)}
+
+	if v := string(c.read(12)); v != "RFB 003.008\n" {
+		t.Fatalf("server version %q", v)
+	}
+	nc.Write([]byte(version))
+
+	if version == "RFB 003.003\n" {
+		if typ := binary.BigEndian.Uint32(c.read(4)); typ != securityNone {
+			t.Fatalf("security type %d", typ)
+		}
+	} else {
+		n := c.read(1)[0]
+		if types := c.read(int(n)); !bytes.Equal(types, []byte{securityNone}) {
+			t.Fatalf("security types %v", types)
+		}
+		nc.Write([]byte{securityNone})
+
+		// Version 3.7 has no result for security type None.
+		if version == "RFB 003.008\n" {
+			if result := binary.BigEndian.Uint32(c.read(4)); result != securityResultOK {
+				t.Fatalf("security result %d", result)
+			}
+		}
+	}
+
+	nc.Write([]byte{1}) // Shared.
+
+	init := c.read(24)
+	c.w = int(binary.BigEndian.Uint16(init[0:]))
+	c.h = int(binary.BigEndian.Uint16(init[2:]))
+	c.pf, err = readPixelFormat(init[4:20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.name = string(c.read(int(binary.BigEndian.Uint32(init[20:]))))
+	c.px = make([]uint32, c.w*c.h)
+	return c
+}
+
+func (c *client) read(n int) []byte {
+	c.t.Helper()
+	b := make([]byte, n)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		c.t.Fatal(err)
+	}
+	return b
+}
+
+func (c *client) send(b ...any) {
+	c.t.Helper()
+	var buf bytes.Buffer
+	for _, v := range b {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	if _, err := c.nc.Write(buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) setPixelFormat(pf pixelFormat) {
+	c.send(uint8(msgSetPixelFormat), [3]byte{}, pf.bytes())
+	c.pf = pf
+}
+
+func (c *client) setEncodings(encs ...int32) {
+	c.send(uint8(msgSetEncodings), uint8(0), uint16(len(encs)), encs)
+}
+
+func (c *client) request(incremental bool) {
+	var inc uint8
+	if incremental {
+		inc = 1
+	}
+	c.send(uint8(msgUpdateRequest), inc, uint16(0), uint16(0), uint16(c.w), uint16(c.h))
+}
+
+// update reads one update, and returns its rectangles and encodings.
+func (c *client) update() ([]image.Rectangle, []int32) {
+	c.t.Helper()
+
+	hdr := c.read(4)
+	if hdr[0] != msgUpdate {
+		c.t.Fatalf("message type %d", hdr[0])
+	}
+
+	var rs []image.Rectangle
+	var encs []int32
+
+	for i := 0; i < int(binary.BigEndian.Uint16(hdr[2:])); i++ {
+		b := c.read(12)
+		x, y := int(binary.BigEndian.Uint16(b[0:])), int(binary.BigEndian.Uint16(b[2:]))
+		w, h := int(binary.BigEndian.Uint16(b[4:])), int(binary.BigEndian.Uint16(b[6:]))
+		r := image.Rect(x, y, x+w, y+h)
+		enc := int32(binary.BigEndian.Uint32(b[8:]))
+
+		switch enc {
+		case encRaw:
+			c.rawRect(c.r, r, c.pixel)
+		case encCopyRect:
+			b := c.read(4)
+			c.copyRect(r, image.Pt(int(binary.BigEndian.Uint16(b)), int(binary.BigEndian.Uint16(b[2:]))))
+		case encRRE:
+			c.rre(r)
+		case encHextile:
+			c.hextile(r)
+		case encZRLE:
+			c.zrle(r)
+		default:
+			c.t.Fatalf("encoding %d", enc)
+		}
+
+		rs = append(rs, r)
+		encs = append(encs, enc)
+	}
+
+	return rs, encs
+}
+
+func (c *client) pixel(r io.Reader) uint32 {
+	b := make([]byte, c.pf.size())
+	if _, err := io.ReadFull(r, b); err != nil {
+		c.t.Fatal(err)
+	}
+
+	switch {
+	case len(b) == 1:
+		return uint32(b[0])
+	case len(b) == 2 && c.pf.bigEndian:
+		return uint32(binary.BigEndian.Uint16(b))
+	case len(b) == 2:
+		return uint32(binary.LittleEndian.Uint16(b))
+	case c.pf.bigEndian:
+		return binary.BigEndian.Uint32(b)
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (c *client) fill(r image.Rectangle, p uint32) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c.px[y*c.w+x] = p
+		}
+	}
+}
+
+func (c *client) rawRect(rd io.Reader, r image.Rectangle, pixel func(io.Reader) uint32) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c.px[y*c.w+x] = pixel(rd)
+		}
+	}
+}
+
+func (c *client) copyRect(r image.Rectangle, from image.Point) {
+	src := make([]uint32, len(c.px))
+	copy(src, c.px)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c.px[y*c.w+x] = src[(from.Y+y-r.Min.Y)*c.w+from.X+x-r.Min.X]
+		}
+	}
+}
+
+func (c *client) rre(r image.Rectangle) {
+	n := binary.BigEndian.Uint32(c.read(4))
+	c.fill(r, c.pixel(c.r))
+
+	for i := uint32(0); i < n; i++ {
+		p := c.pixel(c.r)
+		b := c.read(8)
+		x, y := int(binary.BigEndian.Uint16(b[0:])), int(binary.BigEndian.Uint16(b[2:]))
+		w, h := int(binary.BigEndian.Uint16(b[4:])), int(binary.BigEndian.Uint16(b[6:]))
+		c.fill(image.Rect(x, y, x+w, y+h).Add(r.Min), p)
+	}
+}
+
+func (c *client) hextile(r image.Rectangle) {
+	var bg, fg uint32
+
+	for y := r.Min.Y; y < r.Max.Y; y += 16 {
+		for x := r.Min.X; x < r.Max.X; x += 16 {
+			t := image.Rect(x, y, x+16, y+16).Intersect(r)
+			mask := c.read(1)[0]
+
+			if mask&hexRaw != 0 {
+				c.rawRect(c.r, t, c.pixel)
+				continue
+			}
+
+			if mask&hexBackground != 0 {
+				bg = c.pixel(c.r)
+			}
+			if mask&hexForeground != 0 {
+				fg = c.pixel(c.r)
+			}
+			c.fill(t, bg)
+
+			if mask&hexAnySubrect == 0 {
+				continue
+			}
+
+			n := int(c.read(1)[0])
+			for i := 0; i < n; i++ {
+				p := fg
+				if mask&hexColoured != 0 {
+					p = c.pixel(c.r)
+				}
+				b := c.read(2)
+				sx, sy := int(b[0]>>4), int(b[0]&15)
+				sw, sh := int(b[1]>>4)+1, int(b[1]&15)+1
+				c.fill(image.Rect(sx, sy, sx+sw, sy+sh).Add(t.Min), p)
+			}
+		}
+	}
+}
+
+func (c *client) zrle(r image.Rectangle) {
+	n := binary.BigEndian.Uint32(c.read(4))
+	c.zdata.Write(c.read(int(n)))
+
+	if c.zr == nil {
+		var err error
+		if c.zr, err = zlib.NewReader(&c.zdata); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	zr := byteReader{c.zr}
+	size, off := c.pf.cpixel()
+	cpixel := func(rd io.Reader) uint32 {
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(rd, b[off:off+size]); err != nil {
+			c.t.Fatal(err)
+		}
+		if c.pf.bigEndian {
+			return binary.BigEndian.Uint32(b) >> (8 * (4 - c.pf.size()))
+		}
+		return binary.LittleEndian.Uint32(b)
+	}
+	if size == c.pf.size() {
+		cpixel = c.pixel
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y += tileSize {
+		for x := r.Min.X; x < r.Max.X; x += tileSize {
+			t := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(r)
+
+			sub, err := zr.ReadByte()
+			if err != nil {
+				c.t.Fatal(err)
+			}
+
+			switch {
+			case sub == 0:
+				c.rawRect(zr, t, cpixel)
+			case sub == 1:
+				c.fill(t, cpixel(zr))
+			case sub <= 16:
+				pal := make([]uint32, sub)
+				for i := range pal {
+					pal[i] = cpixel(zr)
+				}
+
+				bits := 4
+				if sub == 2 {
+					bits = 1
+				} else if sub <= 4 {
+					bits = 2
+				}
+
+				for py := t.Min.Y; py < t.Max.Y; py++ {
+					var acc byte
+					n := 0
+					for px := t.Min.X; px < t.Max.X; px++ {
+						if n == 0 {
+							acc, _ = zr.ReadByte()
+							n = 8
+						}
+						n -= bits
+						c.px[py*c.w+px] = pal[(acc>>n)&(1<<bits-1)]
+					}
+				}
+			default:
+				c.t.Fatalf("ZRLE subencoding %d", sub)
+			}
+		}
+	}
+
+	if c.zdata.Len() != 0 {
+		c.t.Fatalf("%d bytes of ZRLE data left", c.zdata.Len())
+	}
+}
+
+// byteReader reads single bytes, without reading ahead.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
+
+// check compares the client's screen with the source.
+func (c *client) check(name string, src *source) {
+	c.t.Helper()
+
+	img, _ := src.Snapshot(image.Rectangle{})
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			rgba := img.RGBAAt(x, y)
+			want := c.pf.pixel(rgba.R, rgba.G, rgba.B)
+			if have := c.px[y*c.w+x]; have != want {
+				c.t.Fatalf("%s: pixel %d,%d: have %#x, want %#x", name, x, y, have, want)
+			}
+		}
+	}
+}
+
+func serve(t *testing.T, src *source, mux *input.Mux) (*Server, string) {
+	t.Helper()
+
+	s, err := NewServer(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Name = "test"
+	s.Input = mux
+	s.Rate = -1
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	return s, l.Addr().String()
+}
+
+var rgb565 = pixelFormat{
+	bpp: 16, depth: 16, bigEndian: true,
+	rmax: 31, gmax: 63, bmax: 31,
+	rshift: 11, gshift: 5, bshift: 0,
+}
+
+func TestEncodings(t *testing.T) {
+	src := newSource(150, 90)
+	s, addr := serve(t, src, nil)
+
+	for _, enc := range []int32{encRaw, encRRE, encHextile, encZRLE} {
+		for _, pf := range []pixelFormat{defaultFormat, rgb565} {
+			name := fmt.Sprintf("encoding %d, %d bpp", enc, pf.bpp)
+
+			c := dial(t, addr, "RFB 003.008\n")
+			if c.w != 150 || c.h != 90 || c.name != "test" || c.pf != defaultFormat {
+				t.Fatalf("server init: %dx%d %q %+v", c.w, c.h, c.name, c.pf)
+			}
+
+			c.setPixelFormat(pf)
+			c.setEncodings(enc, encCopyRect)
+			c.request(false)
+
+			_, encs := c.update()
+			for _, e := range encs {
+				if e != enc {
+					t.Fatalf("%s: sent encoding %d", name, e)
+				}
+			}
+			c.check(name, src)
+
+			// Changes are sent in the same stream, which matters
+			// to ZRLE, whose compression spans rectangles.
+			src.set(100, 10, color.RGBA{uint8(enc), pf.bpp, 3, 0xff})
+			if err := s.Update(); err != nil {
+				t.Fatal(err)
+			}
+
+			c.request(true)
+			c.update()
+			c.check(name+", changed", src)
+			c.nc.Close()
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	src := newSource(200, 130)
+	s, addr := serve(t, src, nil)
+
+	c := dial(t, addr, "RFB 003.003\n")
+	c.setEncodings(encHextile)
+	c.request(false)
+
+	rs, _ := c.update()
+	if len(rs) != 3 || rs[0] != image.Rect(0, 0, 200, 64) {
+		t.Fatalf("initial update: %v", rs)
+	}
+	c.check("initial", src)
+
+	// Nothing changed, so an incremental update waits.
+	c.request(true)
+	s.Update()
+
+	src.set(130, 70, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	src.set(199, 129, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	s.Update()
+
+	rs, _ = c.update()
+	want := []image.Rectangle{image.Rect(128, 64, 192, 128), image.Rect(192, 128, 200, 130)}
+	if fmt.Sprint(rs) != fmt.Sprint(want) {
+		t.Fatalf("changed tiles: have %v, want %v", rs, want)
+	}
+	c.check("changed", src)
+
+	// Damage sends an area, even if it did not change.
+	s.Damage(image.Rect(10, 10, 20, 20))
+	c.request(true)
+
+	rs, _ = c.update()
+	if fmt.Sprint(rs) != fmt.Sprint([]image.Rectangle{image.Rect(0, 0, 64, 64)}) {
+		t.Fatalf("damaged tiles: %v", rs)
+	}
+}
+
+func TestCopyRect(t *testing.T) {
+	src := newSource(100, 100)
+	s, addr := serve(t, src, nil)
+
+	c := dial(t, addr, "RFB 003.007\n")
+	c.setEncodings(encZRLE, encCopyRect)
+	c.request(false)
+	c.update()
+
+	// Scroll up by 10 rows, keeping the bottom ones.
+	src.mu.Lock()
+	copyArea(src.img, image.Rect(0, 0, 100, 90), src.img, image.Pt(0, 10))
+	src.mu.Unlock()
+
+	s.Copy(image.Rect(0, 0, 100, 90), image.Pt(0, 10))
+	s.Update()
+
+	c.request(true)
+	rs, encs := c.update()
+	if len(rs) != 1 || encs[0] != encCopyRect || rs[0] != image.Rect(0, 0, 100, 90) {
+		t.Fatalf("scroll: %v %v", rs, encs)
+	}
+	c.check("scrolled", src)
+
+	// Copies from areas the viewer has not seen are sent in full.
+	src.set(5, 5, color.RGBA{9, 9, 9, 0xff})
+	s.Update()
+
+	src.mu.Lock()
+	copyArea(src.img, image.Rect(50, 50, 60, 60), src.img, image.Pt(0, 0))
+	src.mu.Unlock()
+	s.Copy(image.Rect(50, 50, 60, 60), image.Pt(0, 0))
+
+	c.request(true)
+	rs, encs = c.update()
+	for _, e := range encs {
+		if e == encCopyRect {
+			t.Fatalf("stale copy sent: %v %v", rs, encs)
+		}
+	}
+	c.check("stale copy", src)
+}
+
+func TestInput(t *testing.T) {
+	mux := input.NewMux()
+	defer mux.Close()
+
+	_, addr := serve(t, newSource(100, 100), mux)
+	c := dial(t, addr, "RFB 003.008\n")
+
+	key := func(down bool, sym uint32) {
+		var d uint8
+		if down {
+			d = 1
+		}
+		c.send(uint8(msgKeyEvent), d, uint16(0), sym)
+	}
+	pointer := func(mask uint8, x, y uint16) {
+		c.send(uint8(msgPointerEvent), mask, x, y)
+	}
+
+	key(true, 0xffe1) // Shift.
+	key(true, 'A')
+	key(true, 'A')
+	key(false, 'A')
+	key(false, 0xffe1)
+	key(true, 0xff0d) // Enter.
+	pointer(0, 10, 20)
+	pointer(1, 10, 20)
+	pointer(0, 12, 20)
+	pointer(1<<3, 12, 20)
+	c.send(uint8(msgClientCutText), [3]byte{}, uint32(3), []byte("abc"))
+	key(true, 0x010000e9) // é, as a Unicode keysym.
+
+	want := []string{
+		"key LeftShift '\\x00' [Shift] true false",
+		"key A 'A' [Shift] true false",
+		"key A 'A' [Shift] true true",
+		"key A 'A' [Shift] false false",
+		"key LeftShift '\\x00' [] false false",
+		"key Enter '\\x00' [] true false",
+		"motion 10,20 (10,20) 0",
+		"key Key(272) '\\x00' [] true false",
+		"motion 2,0 (12,20) 0",
+		"key Key(272) '\\x00' [] false false",
+		"motion 0,0 (12,20) 1",
+		"key Key(0) 'é' [] true false",
+	}
+
+	for i, w := range want {
+		var ev input.Event
+		select {
+		case ev = <-mux.Events():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d: timeout", i)
+		}
+
+		var have string
+		switch e := ev.(type) {
+		case *input.KeyEvent:
+			have = fmt.Sprintf("key %v %q [%v] %v %v", e.Key, e.Rune, e.Modifiers, e.Pressed, e.Repeat)
+		case *input.MotionEvent:
+			have = fmt.Sprintf("motion %d,%d (%d,%d) %d", e.DX, e.DY, e.Pos.X, e.Pos.Y, e.Wheel)
+			if !e.Abs {
+				t.Errorf("event %d: relative motion", i)
+			}
+		}
+
+		if have != w {
+			t.Errorf("event %d: have %s, want %s", i, have, w)
+		}
+	}
+
+	// Keys held down are released when the viewer leaves.
+	c.nc.Close()
+	ev := (<-mux.Events()).(*input.KeyEvent)
+	if ev.Key != framebuffer.KeyEnter && ev.Key != framebuffer.KeyNone || ev.Pressed {
+		t.Errorf("release: %+v", ev)
+	}
+}
@@ -0,0 +1,111 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package vnc
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+)
+
+// zrle sends tiles of 64x64 pixels, each a single color, packed
+// indices into a palette of up to 16 colors, or raw pixels. The
+// result is compressed with zlib.
+func (e *encoder) zrle(b []byte, img *image.RGBA, r image.Rectangle) []byte {
+	if e.zw == nil {
+		e.zw, _ = zlib.NewWriterLevel(&e.zbuf, zlib.BestSpeed)
+	}
+
+	size, off := e.pf.cpixel()
+	cpixel := func(b []byte, p uint32) []byte {
+		var tmp [4]byte
+		return append(b, e.pf.put(tmp[:0], p)[off:off+size]...)
+	}
+
+	var data []byte
+	var pal []uint32
+
+	for y := r.Min.Y; y < r.Max.Y; y += tileSize {
+		for x := r.Min.X; x < r.Max.X; x += tileSize {
+			t := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(r)
+			w := t.Dx()
+			px := e.pixels(img, t)
+
+			pal = palette(pal[:0], px, 16)
+
+			switch {
+			case len(pal) == 1:
+				data = append(data, 1)
+				data = cpixel(data, pal[0])
+
+			case len(pal) <= 16:
+				data = append(data, byte(len(pal)))
+				for _, p := range pal {
+					data = cpixel(data, p)
+				}
+
+				bits := 4
+				if len(pal) == 2 {
+					bits = 1
+				} else if len(pal) <= 4 {
+					bits = 2
+				}
+
+				// Indices are packed from the most significant bit,
+				// and rows start at a byte boundary.
+				for i := 0; i < len(px); i += w {
+					var acc byte
+					n := 0
+					for _, p := range px[i : i+w] {
+						acc = acc<<bits | byte(index(pal, p))
+						n += bits
+						if n == 8 {
+							data = append(data, acc)
+							acc, n = 0, 0
+						}
+					}
+					if n > 0 {
+						data = append(data, acc<<(8-n))
+					}
+				}
+
+			default:
+				data = append(data, 0)
+				for _, p := range px {
+					data = cpixel(data, p)
+				}
+			}
+		}
+	}
+
+	e.zbuf.Reset()
+	e.zw.Write(data)
+	e.zw.Flush()
+
+	b = binary.BigEndian.AppendUint32(b, uint32(e.zbuf.Len()))
+	return append(b, e.zbuf.Bytes()...)
+}
+
+// palette appends the distinct values of px to pal, in the order
+// they appear. It stops after more than limit values.
+func palette(pal []uint32, px []uint32, limit int) []uint32 {
+	for _, p := range px {
+		if index(pal, p) < 0 {
+			pal = append(pal, p)
+			if len(pal) > limit {
+				break
+			}
+		}
+	}
+	return pal
+}
+
+func index(pal []uint32, p uint32) int {
+	for i, q := range pal {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
@@ -20,12 +20,21 @@ type vtStat struct {
 }
 
 const (
-	_VT_GETMODE    = 0x5601 // get mode of active vt
-	_VT_SETMODE    = 0x5602 // set mode of active vt
-	_VT_GETSTATE   = 0x5603 // get global vt state info
-	_VT_RELDISP    = 0x5605 // release display
-	_VT_ACTIVATE   = 0x5606 // make vt active
-	_VT_WAITACTIVE = 0x5607 // wait for vt active
-	_VT_PROCESS    = 0x01   // process controls switching
-	_VT_ACKACQ     = 0x02   // acknowledge switch
+	_VT_OPENQRY     = 0x5600 // find available vt
+	_VT_GETMODE     = 0x5601 // get mode of active vt
+	_VT_SETMODE     = 0x5602 // set mode of active vt
+	_VT_GETSTATE    = 0x5603 // get global vt state info
+	_VT_RELDISP     = 0x5605 // release display
+	_VT_ACTIVATE    = 0x5606 // make vt active
+	_VT_WAITACTIVE  = 0x5607 // wait for vt active
+	_VT_DISALLOCATE = 0x5608 // free memory associated to vt
+	_VT_PROCESS     = 0x01   // process controls switching
+	_VT_ACKACQ      = 0x02   // acknowledge switch
+)
+
+// <linux/major.h>, <linux/tty.h>
+
+const (
+	_TTY_MAJOR       = 4  // Device major of the virtual consoles.
+	_MAX_NR_CONSOLES = 63 // Highest virtual console number.
 )
@@ -0,0 +1,655 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// V4L2 FOURCC codes of the supported YUV layouts.
+const (
+	FourCCYUYV = 'Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24 // Packed 4:2:2, Y0 Cb Y1 Cr.
+	FourCCUYVY = 'U' | 'Y'<<8 | 'V'<<16 | 'Y'<<24 // Packed 4:2:2, Cb Y0 Cr Y1.
+	FourCCNV12 = 'N' | 'V'<<8 | '1'<<16 | '2'<<24 // Luma plane, then a Cb Cr plane.
+	FourCCNV21 = 'N' | 'V'<<8 | '2'<<16 | '1'<<24 // Luma plane, then a Cr Cb plane.
+	FourCCI420 = 'Y' | 'U'<<8 | '1'<<16 | '2'<<24 // Luma, Cb and Cr planes.
+)
+
+// V4L2 colorspaces which select the BT.709 coefficients. Others,
+// including the default of zero, use those of BT.601.
+const (
+	_COLORSPACE_REC709 = 3
+	_COLORSPACE_SRGB   = 8
+)
+
+// YCbCrMatrix selects the coefficients converting between RGB
+// and Y'CbCr.
+type YCbCrMatrix uint8
+
+const (
+	BT601 YCbCrMatrix = iota // Standard definition video.
+	BT709                    // High definition video.
+)
+
+// matrixOf returns the coefficients a YUV format uses.
+func matrixOf(format PixelFormat) YCbCrMatrix {
+	switch format.Colorspace {
+	case _COLORSPACE_REC709, _COLORSPACE_SRGB:
+		return BT709
+	}
+	return BT601
+}
+
+// coefficients converts between 8-bit RGB and limited range Y'CbCr,
+// in 16.16 fixed point.
+type coefficients struct {
+	yr, yg, yb    int // RGB to luma.
+	cbr, cbg, cbb int // RGB to Cb.
+	crr, crg, crb int // RGB to Cr.
+	y, rcr        int // Luma and Cr to red.
+	gcb, gcr      int // Cb and Cr to green.
+	bcb           int // Cb to blue.
+}
+
+var matrices = [...]coefficients{
+	BT601: newCoefficients(0.299, 0.114),
+	BT709: newCoefficients(0.2126, 0.0722),
+}
+
+// newCoefficients derives the conversions from the luma weights of
+// red and blue. Luma spans 219 steps from 16, and chroma 224 steps
+// around 128.
+func newCoefficients(kr, kb float64) coefficients {
+	kg := 1 - kr - kb
+	fix := func(v float64) int {
+		if v < 0 {
+			return int(v*65536 - 0.5)
+		}
+		return int(v*65536 + 0.5)
+	}
+
+	const ys, cs = 219.0 / 255, 224.0 / 255
+	return coefficients{
+		yr: fix(kr * ys), yg: fix(kg * ys), yb: fix(kb * ys),
+		cbr: fix(-kr / (2 - 2*kb) * cs), cbg: fix(-kg / (2 - 2*kb) * cs), cbb: fix(cs / 2),
+		crr: fix(cs / 2), crg: fix(-kg / (2 - 2*kr) * cs), crb: fix(-kb / (2 - 2*kr) * cs),
+		y:   fix(1 / ys),
+		rcr: fix((2 - 2*kr) / cs),
+		gcb: fix((2 - 2*kb) * kb / kg / cs), gcr: fix((2 - 2*kr) * kr / kg / cs),
+		bcb: fix((2 - 2*kb) / cs),
+	}
+}
+
+// VideoYCbCr is a Y'CbCr color with the limited range of video, as
+// YUV framebuffers take it: luma from 16 to 235, and chroma from 16
+// to 240 around 128. Unlike color.YCbCr, which has the full range of
+// JPEG images, black is {16, 128, 128}.
+type VideoYCbCr struct {
+	Y, Cb, Cr uint8
+	Matrix    YCbCrMatrix
+}
+
+func (c VideoYCbCr) RGBA() (r, g, b, a uint32) {
+	m := &matrices[c.Matrix]
+	y := (int(c.Y) - 16) * m.y
+	cb, cr := int(c.Cb)-128, int(c.Cr)-128
+
+	return expand16(y + m.rcr*cr), expand16(y - m.gcb*cb - m.gcr*cr), expand16(y + m.bcb*cb), 0xffff
+}
+
+// expand16 clamps an 8-bit channel in 16.16 fixed point, and
+// scales it to 16 bits.
+func expand16(v int) uint32 {
+	v = max(0, min(v, 0xff<<16))
+	return uint32(v) * 0x101 >> 16
+}
+
+// videoYCbCr converts 8-bit RGB.
+func videoYCbCr(m YCbCrMatrix, r, g, b int) VideoYCbCr {
+	k := &matrices[m]
+	return VideoYCbCr{
+		Y:      uint8((k.yr*r + k.yg*g + k.yb*b + 1<<15 + 16<<16) >> 16),
+		Cb:     uint8((k.cbr*r + k.cbg*g + k.cbb*b + 1<<15 + 128<<16) >> 16),
+		Cr:     uint8((k.crr*r + k.crg*g + k.crb*b + 1<<15 + 128<<16) >> 16),
+		Matrix: m,
+	}
+}
+
+// BT601Model and BT709Model convert colors to VideoYCbCr, with the
+// coefficients of either standard.
+var (
+	BT601Model = videoModel(BT601)
+	BT709Model = videoModel(BT709)
+)
+
+func videoModel(m YCbCrMatrix) color.Model {
+	return color.ModelFunc(func(c color.Color) color.Color {
+		if v, ok := c.(VideoYCbCr); ok && v.Matrix == m {
+			return c
+		}
+
+		r, g, b, _ := c.RGBA()
+		return videoYCbCr(m, int(r>>8), int(g>>8), int(b>>8))
+	})
+}
+
+// Model returns the color model of the matrix.
+func (m YCbCrMatrix) Model() color.Model {
+	if m == BT709 {
+		return BT709Model
+	}
+	return BT601Model
+}
+
+// toVideo converts c to the color of an image with the matrix m.
+func toVideo(m YCbCrMatrix, c color.Color) VideoYCbCr {
+	return m.Model().Convert(c).(VideoYCbCr)
+}
+
+// videoBlack returns black.
+func videoBlack(m YCbCrMatrix) VideoYCbCr {
+	return VideoYCbCr{16, 128, 128, m}
+}
+
+// YUYV is an image in packed YUV 4:2:2. Each pair of pixels takes four
+// bytes, holding its luma samples and the chroma samples it shares, in
+// the order Y0 Cb Y1 Cr. Setting a pixel changes the hue of the other.
+type YUYV struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+	Matrix YCbCrMatrix
+}
+
+func (i *YUYV) Bounds() image.Rectangle { return i.Rect }
+func (i *YUYV) ColorModel() color.Model { return i.Matrix.Model() }
+
+func (i *YUYV) At(x, y int) color.Color {
+	return i.YCbCrAt(x, y)
+}
+
+func (i *YUYV) Set(x, y int, c color.Color) {
+	i.SetYCbCr(x, y, toVideo(i.Matrix, c))
+}
+
+// YCbCrAt returns the samples of the pixel at x, y.
+func (i *YUYV) YCbCrAt(x, y int) VideoYCbCr {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return videoBlack(i.Matrix)
+	}
+	yi, cb, cr := yuv422Offsets(i.Rect, i.Stride, x, y, yuyvOrder)
+	return VideoYCbCr{i.Pix[yi], i.Pix[cb], i.Pix[cr], i.Matrix}
+}
+
+// SetYCbCr sets the samples of the pixel at x, y, ignoring the matrix
+// of c.
+func (i *YUYV) SetYCbCr(x, y int, c VideoYCbCr) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	yi, cb, cr := yuv422Offsets(i.Rect, i.Stride, x, y, yuyvOrder)
+	i.Pix[yi], i.Pix[cb], i.Pix[cr] = c.Y, c.Cb, c.Cr
+}
+
+// PixOffset returns the index of the first of the two bytes of
+// the pixel at x, y.
+func (i *YUYV) PixOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.Stride + (x-i.Rect.Min.X)*2
+}
+
+// UYVY is an image in packed YUV 4:2:2, as YUYV, with the samples of
+// each pair of pixels in the order Cb Y0 Cr Y1.
+type UYVY struct {
+	Pix    []byte
+	Rect   image.Rectangle
+	Stride int
+	Matrix YCbCrMatrix
+}
+
+func (i *UYVY) Bounds() image.Rectangle { return i.Rect }
+func (i *UYVY) ColorModel() color.Model { return i.Matrix.Model() }
+
+func (i *UYVY) At(x, y int) color.Color {
+	return i.YCbCrAt(x, y)
+}
+
+func (i *UYVY) Set(x, y int, c color.Color) {
+	i.SetYCbCr(x, y, toVideo(i.Matrix, c))
+}
+
+// YCbCrAt returns the samples of the pixel at x, y.
+func (i *UYVY) YCbCrAt(x, y int) VideoYCbCr {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return videoBlack(i.Matrix)
+	}
+	yi, cb, cr := yuv422Offsets(i.Rect, i.Stride, x, y, uyvyOrder)
+	return VideoYCbCr{i.Pix[yi], i.Pix[cb], i.Pix[cr], i.Matrix}
+}
+
+// SetYCbCr sets the samples of the pixel at x, y, ignoring the matrix
+// of c.
+func (i *UYVY) SetYCbCr(x, y int, c VideoYCbCr) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	yi, cb, cr := yuv422Offsets(i.Rect, i.Stride, x, y, uyvyOrder)
+	i.Pix[yi], i.Pix[cb], i.Pix[cr] = c.Y, c.Cb, c.Cr
+}
+
+// PixOffset returns the index of the first of the two bytes of
+// the pixel at x, y.
+func (i *UYVY) PixOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.Stride + (x-i.Rect.Min.X)*2
+}
+
+// Positions of the samples of a pair of pixels in packed 4:2:2
+// layouts: Y0, Cb, Y1 and Cr.
+var (
+	yuyvOrder = [4]int{0, 1, 2, 3}
+	uyvyOrder = [4]int{1, 0, 3, 2}
+)
+
+// yuv422Offsets returns the indices of the luma and chroma samples
+// of the pixel at x, y of a packed 4:2:2 image.
+func yuv422Offsets(r image.Rectangle, stride, x, y int, order [4]int) (yi, cb, cr int) {
+	dx := x - r.Min.X
+	pair := (y-r.Min.Y)*stride + (dx&^1)*2
+	return pair + order[dx&1*2], pair + order[1], pair + order[3]
+}
+
+// NV12 is an image in planar YUV 4:2:0. A plane of luma samples is
+// followed by one of interleaved Cb and Cr samples, each of which is
+// shared by a block of 2x2 pixels. Setting a pixel changes the hue
+// of the others in its block.
+type NV12 struct {
+	Y, CbCr []byte
+	YStride int
+	CStride int
+	Rect    image.Rectangle
+	Matrix  YCbCrMatrix
+}
+
+func (i *NV12) Bounds() image.Rectangle { return i.Rect }
+func (i *NV12) ColorModel() color.Model { return i.Matrix.Model() }
+
+func (i *NV12) At(x, y int) color.Color {
+	return i.YCbCrAt(x, y)
+}
+
+func (i *NV12) Set(x, y int, c color.Color) {
+	i.SetYCbCr(x, y, toVideo(i.Matrix, c))
+}
+
+// YCbCrAt returns the samples of the pixel at x, y.
+func (i *NV12) YCbCrAt(x, y int) VideoYCbCr {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return videoBlack(i.Matrix)
+	}
+	c := i.COffset(x, y)
+	return VideoYCbCr{i.Y[i.YOffset(x, y)], i.CbCr[c], i.CbCr[c+1], i.Matrix}
+}
+
+// SetYCbCr sets the samples of the pixel at x, y, ignoring the matrix
+// of c.
+func (i *NV12) SetYCbCr(x, y int, c VideoYCbCr) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	n := i.COffset(x, y)
+	i.Y[i.YOffset(x, y)], i.CbCr[n], i.CbCr[n+1] = c.Y, c.Cb, c.Cr
+}
+
+// YOffset returns the index of the luma sample of the pixel at x, y.
+func (i *NV12) YOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.YStride + x - i.Rect.Min.X
+}
+
+// COffset returns the index of the chroma samples of the pixel at x, y.
+func (i *NV12) COffset(x, y int) int {
+	return (y-i.Rect.Min.Y)/2*i.CStride + (x-i.Rect.Min.X)&^1
+}
+
+// NV21 is an image in planar YUV 4:2:0, as NV12, with the chroma
+// samples interleaved as Cr and Cb.
+type NV21 struct {
+	Y, CrCb []byte
+	YStride int
+	CStride int
+	Rect    image.Rectangle
+	Matrix  YCbCrMatrix
+}
+
+func (i *NV21) Bounds() image.Rectangle { return i.Rect }
+func (i *NV21) ColorModel() color.Model { return i.Matrix.Model() }
+
+func (i *NV21) At(x, y int) color.Color {
+	return i.YCbCrAt(x, y)
+}
+
+func (i *NV21) Set(x, y int, c color.Color) {
+	i.SetYCbCr(x, y, toVideo(i.Matrix, c))
+}
+
+// YCbCrAt returns the samples of the pixel at x, y.
+func (i *NV21) YCbCrAt(x, y int) VideoYCbCr {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return videoBlack(i.Matrix)
+	}
+	c := i.COffset(x, y)
+	return VideoYCbCr{i.Y[i.YOffset(x, y)], i.CrCb[c+1], i.CrCb[c], i.Matrix}
+}
+
+// SetYCbCr sets the samples of the pixel at x, y, ignoring the matrix
+// of c.
+func (i *NV21) SetYCbCr(x, y int, c VideoYCbCr) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	n := i.COffset(x, y)
+	i.Y[i.YOffset(x, y)], i.CrCb[n], i.CrCb[n+1] = c.Y, c.Cr, c.Cb
+}
+
+// YOffset returns the index of the luma sample of the pixel at x, y.
+func (i *NV21) YOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.YStride + x - i.Rect.Min.X
+}
+
+// COffset returns the index of the chroma samples of the pixel at x, y.
+func (i *NV21) COffset(x, y int) int {
+	return (y-i.Rect.Min.Y)/2*i.CStride + (x-i.Rect.Min.X)&^1
+}
+
+// I420 is an image in planar YUV 4:2:0, with a plane each for the
+// luma, Cb and Cr samples. The chroma planes have half the width and
+// height of the luma plane. Setting a pixel changes the hue of the
+// others in its block of 2x2 pixels.
+type I420 struct {
+	Y, Cb, Cr []byte
+	YStride   int
+	CStride   int
+	Rect      image.Rectangle
+	Matrix    YCbCrMatrix
+}
+
+func (i *I420) Bounds() image.Rectangle { return i.Rect }
+func (i *I420) ColorModel() color.Model { return i.Matrix.Model() }
+
+func (i *I420) At(x, y int) color.Color {
+	return i.YCbCrAt(x, y)
+}
+
+func (i *I420) Set(x, y int, c color.Color) {
+	i.SetYCbCr(x, y, toVideo(i.Matrix, c))
+}
+
+// YCbCrAt returns the samples of the pixel at x, y.
+func (i *I420) YCbCrAt(x, y int) VideoYCbCr {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return videoBlack(i.Matrix)
+	}
+	c := i.COffset(x, y)
+	return VideoYCbCr{i.Y[i.YOffset(x, y)], i.Cb[c], i.Cr[c], i.Matrix}
+}
+
+// SetYCbCr sets the samples of the pixel at x, y, ignoring the matrix
+// of c.
+func (i *I420) SetYCbCr(x, y int, c VideoYCbCr) {
+	if !(image.Point{x, y}.In(i.Rect)) {
+		return
+	}
+	n := i.COffset(x, y)
+	i.Y[i.YOffset(x, y)], i.Cb[n], i.Cr[n] = c.Y, c.Cb, c.Cr
+}
+
+// YOffset returns the index of the luma sample of the pixel at x, y.
+func (i *I420) YOffset(x, y int) int {
+	return (y-i.Rect.Min.Y)*i.YStride + x - i.Rect.Min.X
+}
+
+// COffset returns the index of the chroma samples of the pixel at x, y.
+func (i *I420) COffset(x, y int) int {
+	return (y-i.Rect.Min.Y)/2*i.CStride + (x-i.Rect.Min.X)/2
+}
+
+// newYUVImage wraps the pixel memory p in the image type of a YUV
+// format. The planes of planar formats fill p, as frameSize lays
+// them out.
+func newYUVImage(format PixelFormat, p []byte, stride int, r image.Rectangle) draw.Image {
+	m := matrixOf(format)
+	n := len(p) / 3 * 2 // Size of the luma plane.
+
+	switch format.Type() {
+	case PF_YUYV:
+		return &YUYV{Pix: p, Stride: stride, Rect: r, Matrix: m}
+	case PF_UYVY:
+		return &UYVY{Pix: p, Stride: stride, Rect: r, Matrix: m}
+	case PF_NV12:
+		return &NV12{Y: p[:n], CbCr: p[n:], YStride: stride, CStride: stride, Rect: r, Matrix: m}
+	case PF_NV21:
+		return &NV21{Y: p[:n], CrCb: p[n:], YStride: stride, CStride: stride, Rect: r, Matrix: m}
+	case PF_I420:
+		return &I420{Y: p[:n], Cb: p[n : n+n/4], Cr: p[n+n/4 : n+n/2], YStride: stride, CStride: stride / 2, Rect: r, Matrix: m}
+	}
+	return nil
+}
+
+// clearYUV sets the pixel memory p of a YUV format to black.
+func clearYUV(format PixelFormat, p []byte) {
+	switch format.Type() {
+	case PF_YUYV:
+		for i := 0; i+1 < len(p); i += 2 {
+			p[i], p[i+1] = 16, 128
+		}
+	case PF_UYVY:
+		for i := 0; i+1 < len(p); i += 2 {
+			p[i], p[i+1] = 128, 16
+		}
+	case PF_NV12, PF_NV21, PF_I420:
+		n := len(p) / 3 * 2
+		for i := range p {
+			p[i] = 128
+			if i < n {
+				p[i] = 16
+			}
+		}
+	}
+}
+
+// YCbCrSrc copies *image.YCbCr sources onto the YUV image types. The
+// samples are copied as they are, without converting through RGB, so
+// frames decoded from video are shown quickly and with the colors of
+// the stream. Video decoders produce samples in the limited range the
+// YUV types use, even though image.YCbCr otherwise assumes the full
+// range of JPEG images. Sources whose chroma is subsampled as that
+// of the destination are copied a row at a time. Other images are
+// drawn with draw.Src.
+var YCbCrSrc draw.Drawer = ycbcrSrc{}
+
+type ycbcrSrc struct{}
+
+func (ycbcrSrc) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	s, ok := src.(*image.YCbCr)
+	if !ok {
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+
+	// Where to put the samples of a pixel. Chroma samples are put
+	// by the pixel starting each block of pixels sharing them.
+	var setY func(x, y int, v uint8)
+	var setC func(x, y int, cb, cr uint8)
+	block := image.Pt(2, 2)
+
+	switch d := dst.(type) {
+	case *YUYV:
+		setY = func(x, y int, v uint8) { d.Pix[d.PixOffset(x, y)] = v }
+		setC = func(x, y int, cb, cr uint8) {
+			_, ci, ri := yuv422Offsets(d.Rect, d.Stride, x, y, yuyvOrder)
+			d.Pix[ci], d.Pix[ri] = cb, cr
+		}
+		block.Y = 1
+	case *UYVY:
+		setY = func(x, y int, v uint8) { d.Pix[d.PixOffset(x, y)+1] = v }
+		setC = func(x, y int, cb, cr uint8) {
+			_, ci, ri := yuv422Offsets(d.Rect, d.Stride, x, y, uyvyOrder)
+			d.Pix[ci], d.Pix[ri] = cb, cr
+		}
+		block.Y = 1
+	case *NV12:
+		setY = func(x, y int, v uint8) { d.Y[d.YOffset(x, y)] = v }
+		setC = func(x, y int, cb, cr uint8) {
+			n := d.COffset(x, y)
+			d.CbCr[n], d.CbCr[n+1] = cb, cr
+		}
+	case *NV21:
+		setY = func(x, y int, v uint8) { d.Y[d.YOffset(x, y)] = v }
+		setC = func(x, y int, cb, cr uint8) {
+			n := d.COffset(x, y)
+			d.CrCb[n], d.CrCb[n+1] = cr, cb
+		}
+	case *I420:
+		setY = func(x, y int, v uint8) { d.Y[d.YOffset(x, y)] = v }
+		setC = func(x, y int, cb, cr uint8) {
+			n := d.COffset(x, y)
+			d.Cb[n], d.Cr[n] = cb, cr
+		}
+	default:
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+
+	// Clip to the destination and source, as draw.Draw does.
+	orig := r.Min
+	r = r.Intersect(dst.Bounds())
+	r = r.Intersect(src.Bounds().Add(orig.Sub(sp)))
+	sp = sp.Add(r.Min.Sub(orig))
+
+	// Whole blocks are copied a row at a time, when the source
+	// shares its chroma samples in the same way.
+	f := copyYCbCr(dst, r, s, sp, block)
+
+	o := dst.Bounds().Min
+	slow := func(r image.Rectangle) {
+		sp := sp.Add(r.Min.Sub(f.Min))
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			sy := sp.Y + y - r.Min.Y
+			firstRow := y == r.Min.Y || (y-o.Y)%block.Y == 0
+
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sx := sp.X + x - r.Min.X
+				setY(x, y, s.Y[s.YOffset(sx, sy)])
+
+				// Blocks cut by the edge of r take the chroma of
+				// their first pixel inside.
+				if firstRow && (x == r.Min.X || (x-o.X)%block.X == 0) {
+					c := s.COffset(sx, sy)
+					setC(x, y, s.Cb[c], s.Cr[c])
+				}
+			}
+		}
+	}
+
+	// The odd column and row left over, or all of r.
+	slow(image.Rect(f.Max.X, r.Min.Y, r.Max.X, r.Max.Y))
+	slow(image.Rect(r.Min.X, f.Max.Y, f.Max.X, r.Max.Y))
+}
+
+// copyYCbCr copies the samples of whole blocks of pixels of s at sp
+// into r of dst, and returns the part of r it filled, starting at
+// r.Min. The part is empty if the blocks of s and dst do not line up.
+func copyYCbCr(dst draw.Image, r image.Rectangle, s *image.YCbCr, sp image.Point, block image.Point) image.Rectangle {
+	f := image.Rectangle{r.Min, r.Min}
+
+	ratio := image.YCbCrSubsampleRatio420
+	if block.Y == 1 {
+		ratio = image.YCbCrSubsampleRatio422
+	}
+
+	// Chroma samples of s are shared from even coordinates on.
+	o := dst.Bounds().Min
+	if s.SubsampleRatio != ratio || (r.Min.X-o.X)&1 != 0 || sp.X&1 != 0 ||
+		block.Y == 2 && ((r.Min.Y-o.Y)&1 != 0 || sp.Y&1 != 0) {
+		return f
+	}
+
+	w, h := r.Dx()&^1, r.Dy()
+	if block.Y == 2 {
+		h &^= 1
+	}
+	if w <= 0 || h <= 0 {
+		return f
+	}
+	f.Max = r.Min.Add(image.Pt(w, h))
+
+	// Source rows of luma and chroma samples for row y of dst.
+	rows := func(y int) (ys, cb, cr []byte) {
+		sy := sp.Y + y - r.Min.Y
+		c := s.COffset(sp.X, sy)
+		return s.Y[s.YOffset(sp.X, sy):][:w], s.Cb[c:][:w/2], s.Cr[c:][:w/2]
+	}
+
+	switch d := dst.(type) {
+	case *YUYV:
+		for y := f.Min.Y; y < f.Max.Y; y++ {
+			ys, cb, cr := rows(y)
+			pack422(d.Pix[d.PixOffset(r.Min.X, y):], ys, cb, cr, yuyvOrder)
+		}
+
+	case *UYVY:
+		for y := f.Min.Y; y < f.Max.Y; y++ {
+			ys, cb, cr := rows(y)
+			pack422(d.Pix[d.PixOffset(r.Min.X, y):], ys, cb, cr, uyvyOrder)
+		}
+
+	case *NV12:
+		for y := f.Min.Y; y < f.Max.Y; y++ {
+			ys, cb, cr := rows(y)
+			copy(d.Y[d.YOffset(r.Min.X, y):], ys)
+			if (y-f.Min.Y)&1 == 0 {
+				interleave(d.CbCr[d.COffset(r.Min.X, y):][:w], cb, cr)
+			}
+		}
+
+	case *NV21:
+		for y := f.Min.Y; y < f.Max.Y; y++ {
+			ys, cb, cr := rows(y)
+			copy(d.Y[d.YOffset(r.Min.X, y):], ys)
+			if (y-f.Min.Y)&1 == 0 {
+				interleave(d.CrCb[d.COffset(r.Min.X, y):][:w], cr, cb)
+			}
+		}
+
+	case *I420:
+		for y := f.Min.Y; y < f.Max.Y; y++ {
+			ys, cb, cr := rows(y)
+			copy(d.Y[d.YOffset(r.Min.X, y):], ys)
+			if (y-f.Min.Y)&1 == 0 {
+				n := d.COffset(r.Min.X, y)
+				copy(d.Cb[n:], cb)
+				copy(d.Cr[n:], cr)
+			}
+		}
+	}
+
+	return f
+}
+
+// pack422 fills p with pairs of pixels of a packed 4:2:2 layout.
+func pack422(p, ys, cb, cr []byte, order [4]int) {
+	for i := range cb {
+		q := p[4*i : 4*i+4]
+		q[order[0]], q[order[1]] = ys[2*i], cb[i]
+		q[order[2]], q[order[3]] = ys[2*i+1], cr[i]
+	}
+}
+
+// interleave fills p with alternating samples of a and b.
+func interleave(p, a, b []byte) {
+	for i := range a {
+		p[2*i], p[2*i+1] = a[i], b[i]
+	}
+}
@@ -0,0 +1,273 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package framebuffer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestVideoYCbCr(t *testing.T) {
+	for _, test := range []struct {
+		m    YCbCrMatrix
+		rgb  color.RGBA
+		want VideoYCbCr
+	}{
+		{BT601, color.RGBA{0, 0, 0, 0xff}, VideoYCbCr{16, 128, 128, BT601}},
+		{BT601, color.RGBA{0xff, 0xff, 0xff, 0xff}, VideoYCbCr{235, 128, 128, BT601}},
+		{BT601, color.RGBA{0xff, 0, 0, 0xff}, VideoYCbCr{81, 90, 240, BT601}},
+		{BT601, color.RGBA{0, 0, 0xff, 0xff}, VideoYCbCr{41, 240, 110, BT601}},
+		{BT709, color.RGBA{0xff, 0, 0, 0xff}, VideoYCbCr{63, 102, 240, BT709}},
+		{BT709, color.RGBA{0, 0xff, 0, 0xff}, VideoYCbCr{173, 42, 26, BT709}},
+	} {
+		have := test.m.Model().Convert(test.rgb).(VideoYCbCr)
+		if have != test.want {
+			t.Errorf("%v: %v, want %v", test.rgb, have, test.want)
+		}
+
+		// Back to RGB, within rounding.
+		r, g, b, _ := have.RGBA()
+		for i, v := range []uint32{r >> 8, g >> 8, b >> 8} {
+			w := []uint8{test.rgb.R, test.rgb.G, test.rgb.B}[i]
+			if int(v) < int(w)-2 || int(v) > int(w)+2 {
+				t.Errorf("%v: back to %d %d %d", test.rgb, r>>8, g>>8, b>>8)
+				break
+			}
+		}
+	}
+
+	// Colors of the other matrix are converted.
+	c := BT709Model.Convert(VideoYCbCr{81, 90, 240, BT601}).(VideoYCbCr)
+	if c.Matrix != BT709 || c.Y < 62 || c.Y > 64 {
+		t.Errorf("red of BT.601 as %v", c)
+	}
+}
+
+func TestYUVImages(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+
+	for _, test := range []struct {
+		fourcc uint32
+		depth  uint8
+		check  func(img draw.Image) bool // Samples of red at 1, 1.
+	}{
+		{FourCCYUYV, 16, func(img draw.Image) bool {
+			p := img.(*YUYV).Pix[8:12]
+			return p[0] == 16 && p[1] == 90 && p[2] == 81 && p[3] == 240
+		}},
+		{FourCCUYVY, 16, func(img draw.Image) bool {
+			p := img.(*UYVY).Pix[8:12]
+			return p[0] == 90 && p[1] == 16 && p[2] == 240 && p[3] == 81
+		}},
+		{FourCCNV12, 12, func(img draw.Image) bool {
+			i := img.(*NV12)
+			return i.Y[5] == 81 && i.CbCr[0] == 90 && i.CbCr[1] == 240 && len(i.CbCr) == 8
+		}},
+		{FourCCNV21, 12, func(img draw.Image) bool {
+			i := img.(*NV21)
+			return i.Y[5] == 81 && i.CrCb[0] == 240 && i.CrCb[1] == 90
+		}},
+		{FourCCI420, 12, func(img draw.Image) bool {
+			i := img.(*I420)
+			return i.Y[5] == 81 && i.Cb[0] == 90 && i.Cr[0] == 240 && len(i.Cb) == 4
+		}},
+	} {
+		img, err := NewImage(PixelFormat{Depth: test.depth, FourCC: test.fourcc}, image.Rect(0, 0, 4, 4))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.At(3, 3) != (VideoYCbCr{16, 128, 128, BT601}) {
+			t.Errorf("%T starts as %v", img, img.At(3, 3))
+		}
+
+		img.Set(1, 1, red)
+		if !test.check(img) {
+			t.Errorf("%T: unexpected samples", img)
+		}
+
+		// The other pixel of the pair takes the same hue.
+		if c := img.At(0, 1).(VideoYCbCr); c != (VideoYCbCr{16, 90, 240, BT601}) {
+			t.Errorf("%T: neighbour %v", img, c)
+		}
+	}
+
+	if _, err := NewImage(PixelFormat{Depth: 16, FourCC: 'Y' | 'V'<<8 | 'Y'<<16 | 'U'<<24}, image.Rect(0, 0, 2, 2)); err == nil {
+		t.Error("unknown FOURCC accepted")
+	}
+}
+
+func TestYCbCrSrc(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 6, 4), image.YCbCrSubsampleRatio420)
+	for i := range src.Y {
+		src.Y[i] = uint8(20 + i)
+	}
+	for i := range src.Cb {
+		src.Cb[i], src.Cr[i] = uint8(100+i), uint8(200-i)
+	}
+
+	for _, fourcc := range []uint32{FourCCYUYV, FourCCUYVY, FourCCNV12, FourCCNV21, FourCCI420} {
+		dst, _ := NewImage(PixelFormat{Depth: 16, FourCC: fourcc}, image.Rect(0, 0, 8, 6))
+		YCbCrSrc.Draw(dst, image.Rect(2, 2, 8, 6), src, image.Point{})
+
+		yuv := dst.(interface{ YCbCrAt(x, y int) VideoYCbCr })
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 6; x++ {
+				s := src.YCbCrAt(x, y)
+				if d := yuv.YCbCrAt(x+2, y+2); d.Y != s.Y || d.Cb != s.Cb || d.Cr != s.Cr {
+					t.Fatalf("%T at %d, %d: %v, want %v", dst, x, y, d, s)
+				}
+			}
+		}
+
+		// Outside, pixels stay black.
+		if c := yuv.YCbCrAt(1, 1); c != (VideoYCbCr{16, 128, 128, BT601}) {
+			t.Errorf("%T: drawn outside, %v", dst, c)
+		}
+	}
+
+	// Other sources are converted.
+	dst := &YUYV{Pix: make([]byte, 4), Stride: 4, Rect: image.Rect(0, 0, 2, 1)}
+	YCbCrSrc.Draw(dst, dst.Rect, image.NewUniform(color.White), image.Point{})
+	if dst.Pix[0] != 235 || dst.Pix[1] != 128 {
+		t.Errorf("white as % x", dst.Pix)
+	}
+}
+
+func TestYCbCrSrcRows(t *testing.T) {
+	for _, test := range []struct {
+		fourcc uint32
+		ratio  image.YCbCrSubsampleRatio
+	}{
+		{FourCCYUYV, image.YCbCrSubsampleRatio422},
+		{FourCCUYVY, image.YCbCrSubsampleRatio422},
+		{FourCCNV12, image.YCbCrSubsampleRatio420},
+		{FourCCNV21, image.YCbCrSubsampleRatio420},
+		{FourCCI420, image.YCbCrSubsampleRatio420},
+	} {
+		src := image.NewYCbCr(image.Rect(0, 0, 8, 6), test.ratio)
+		for i := range src.Y {
+			src.Y[i] = uint8(20 + i)
+		}
+		for i := range src.Cb {
+			src.Cb[i], src.Cr[i] = uint8(100+i), uint8(200-i)
+		}
+
+		// Odd sizes leave a column and row of blocks cut in half.
+		for _, sp := range []image.Point{{0, 0}, {2, 2}, {1, 1}} {
+			dst, _ := NewImage(PixelFormat{Depth: 16, FourCC: test.fourcc}, image.Rect(0, 0, 10, 8))
+			r := image.Rect(2, 2, 7, 5)
+			YCbCrSrc.Draw(dst, r, src, sp)
+
+			yuv := dst.(interface{ YCbCrAt(x, y int) VideoYCbCr })
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 10; x++ {
+					d := yuv.YCbCrAt(x, y)
+					if !(image.Point{x, y}.In(r)) {
+						if d.Y != 16 {
+							t.Fatalf("%T: drawn outside at %d, %d", dst, x, y)
+						}
+						continue
+					}
+
+					// Where blocks line up, all samples are exact.
+					s := src.YCbCrAt(sp.X+x-2, sp.Y+y-2)
+					if d.Y != s.Y || sp.X&1 == 0 && (d.Cb != s.Cb || d.Cr != s.Cr) {
+						t.Fatalf("%T from %v at %d, %d: %v, want %v", dst, sp, x, y, d, s)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFourCCCanvas(t *testing.T) {
+	s := newFakeSystem(t)
+	fb := s.addFB(0, "fb0", "drv", 8, 4, 16)
+	fb.fi.typ = _TYPE_FOURCC
+	fb.fi.visual = _VISUAL_FOURCC
+	fb.vi.grayscale = FourCCUYVY
+	fb.vi.colorspace = _COLORSPACE_REC709
+
+	c, err := OpenDevice(fb.path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	mode, _ := c.CurrentMode()
+	if mode.Format.FourCC != FourCCUYVY || mode.Format.Type() != PF_UYVY {
+		t.Fatalf("format %+v", mode.Format)
+	}
+
+	img, _ := c.Image()
+	if i, ok := img.(*UYVY); !ok || i.Matrix != BT709 {
+		t.Fatalf("image %T", img)
+	}
+
+	img.Set(2, 1, color.White)
+	snap, err := c.Snapshot(image.Rect(0, 0, 4, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.RGBAAt(2, 1) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("snapshot pixel %v", snap.At(2, 1))
+	}
+
+	// Clearing gives black, rather than zeroes.
+	c.Clear()
+	if b := c.Buffer()[:4]; b[0] != 128 || b[1] != 16 {
+		t.Errorf("cleared to % x", b)
+	}
+
+	// Setting a mode keeps the format.
+	if err := c.setMode(mode); err != nil || fb.vi.grayscale != FourCCUYVY {
+		t.Errorf("grayscale %x after setting the mode: %v", fb.vi.grayscale, err)
+	}
+}
+
+func TestFourCCMemoryCanvas(t *testing.T) {
+	dm := memoryMode(4, 2, 4, 12)
+	dm.Format.FourCC = FourCCNV12
+
+	c, err := NewMemoryCanvas(dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The luma plane of all rows, then the chroma plane.
+	if len(c.Buffer()) != 24 || c.Buffer()[15] != 16 || c.Buffer()[16] != 128 {
+		t.Fatalf("buffer % x", c.Buffer())
+	}
+
+	// Planar formats do not pan; the back buffer is copied.
+	back, err := c.BackBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := back.(*NV12); !ok || back.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("back buffer %T %v", back, back.Bounds())
+	}
+
+	back.Set(3, 1, color.RGBA{0xff, 0, 0, 0xff})
+	if err := c.Flip(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, _ := c.Image()
+	if v := img.(*NV12).YCbCrAt(3, 1); v != (VideoYCbCr{81, 90, 240, BT601}) {
+		t.Errorf("flipped pixel %v", v)
+	}
+
+	snap, err := c.Snapshot(image.Rectangle{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := snap.At(3, 1).RGBA(); r>>8 < 0xfd || g>>8 > 2 {
+		t.Errorf("snapshot pixel %v", snap.At(3, 1))
+	}
+}